@@ -46,6 +46,7 @@ func (f *Fosite) NewAccessRequest(ctx context.Context, r *http.Request, session
 	defer otelx.End(span, &err)
 
 	accessRequest := NewAccessRequest(session)
+	accessRequest.RequestedAt = f.Config.GetClock(ctx).Now().UTC()
 	accessRequest.Request.Lang = i18n.GetLangFromRequest(f.Config.GetMessageCatalog(ctx), r)
 
 	ctx = context.WithValue(ctx, RequestContextKey, r)
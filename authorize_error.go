@@ -20,7 +20,7 @@ func (f *Fosite) WriteAuthorizeError(ctx context.Context, rw http.ResponseWriter
 	}
 
 	rfcerr := ErrorToRFC6749Error(err).WithLegacyFormat(f.Config.GetUseLegacyErrorFormat(ctx)).WithExposeDebug(f.Config.GetSendDebugMessagesToClients(ctx)).WithLocalizer(f.Config.GetMessageCatalog(ctx), getLangFromRequester(ar))
-	if !ar.IsRedirectURIValid() {
+	if !f.isRedirectURIValid(ctx, ar) {
 		rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
 
 		js, err := json.Marshal(rfcerr)
@@ -67,3 +67,13 @@ func (f *Fosite) WriteAuthorizeError(ctx context.Context, rw http.ResponseWriter
 	rw.Header().Set("Location", redirectURIString)
 	rw.WriteHeader(http.StatusSeeOther)
 }
+
+// isRedirectURIValid is like AuthorizeRequester.IsRedirectURIValid, but matches the redirect URI of an
+// AuthorizeRequest using the configured redirect URI policy.
+func (f *Fosite) isRedirectURIValid(ctx context.Context, ar AuthorizeRequester) bool {
+	d, ok := ar.(*AuthorizeRequest)
+	if !ok || d.GetClient() == nil {
+		return ar.IsRedirectURIValid()
+	}
+	return d.isRedirectURIValid(ctx, f.Config.GetRedirectURIPolicy(ctx, d.GetClient()))
+}
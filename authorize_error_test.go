@@ -7,11 +7,13 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	. "github.com/ory/fosite"
 	. "github.com/ory/fosite/internal"
@@ -443,6 +445,38 @@ func TestWriteAuthorizeError(t *testing.T) {
 	}
 }
 
+func TestWriteAuthorizeErrorUsesConfiguredRedirectURIPolicy(t *testing.T) {
+	redirectURI, err := url.Parse("myapp:/cb")
+	require.NoError(t, err)
+
+	ar := NewAuthorizeRequest()
+	ar.ResponseTypes = Arguments{"code"}
+	ar.RedirectURI = redirectURI
+	ar.Client = &DefaultRedirectURIProfileClient{
+		DefaultClient:      &DefaultClient{ID: "foo", Public: true, RedirectURIs: []string{"myapp:/cb"}},
+		RedirectURIProfile: "custom",
+	}
+
+	for k, c := range []struct {
+		policies map[string]RedirectURIPolicy
+		expected int
+	}{
+		{policies: nil, expected: http.StatusBadRequest},
+		{policies: map[string]RedirectURIPolicy{"custom": &NativeAppRedirectURIPolicy{AllowNonReverseDomainSchemes: true}}, expected: http.StatusSeeOther},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			oauth2 := &Fosite{Config: &Config{RedirectURIPolicies: c.policies}}
+			rw := httptest.NewRecorder()
+			oauth2.WriteAuthorizeError(context.Background(), rw, ar, ErrInvalidRequest)
+
+			assert.Equal(t, c.expected, rw.Code)
+			if c.expected == http.StatusSeeOther {
+				assert.Contains(t, rw.Header().Get("Location"), "myapp:/cb?error=invalid_request")
+			}
+		})
+	}
+}
+
 func copyUrl(u *url.URL) *url.URL {
 	u2, _ := url.Parse(u.String())
 	return u2
@@ -12,8 +12,6 @@ import (
 	"net/url"
 	"strings"
 
-	"github.com/ory/x/errorsx"
-
 	"github.com/asaskevich/govalidator"
 )
 
@@ -33,7 +31,8 @@ var DefaultFormPostTemplate = template.Must(template.New("form_post").Parse(`<ht
 </html>`))
 
 // MatchRedirectURIWithClientRedirectURIs if the given uri is a registered redirect uri. Does not perform
-// uri validation.
+// uri validation. If the client selects a built-in redirect URI profile (see RedirectURIProfileClient), the
+// redirect uri is matched and validated using the policy of that profile.
 //
 // Considered specifications
 //
@@ -63,22 +62,11 @@ var DefaultFormPostTemplate = template.Must(template.New("form_post").Parse(`<ht
 //     particular end-user authorization and validates this redirect URI
 //     with the redirect URI passed to the token's endpoint, such an
 //     attack is detected (see Section 5.2.4.5).
+//
+// Deprecated: This function ignores the configured redirect URI policies (see Config.RedirectURIPolicies). Use
+// MatchRedirectURIWithPolicy with the policy returned by Configurator.GetRedirectURIPolicy instead.
 func MatchRedirectURIWithClientRedirectURIs(rawurl string, client Client) (*url.URL, error) {
-	if rawurl == "" && len(client.GetRedirectURIs()) == 1 {
-		if redirectURIFromClient, err := url.Parse(client.GetRedirectURIs()[0]); err == nil && IsValidRedirectURI(redirectURIFromClient) {
-			// If no redirect_uri was given and the client has exactly one valid redirect_uri registered, use that instead
-			return redirectURIFromClient, nil
-		}
-	} else if redirectTo, ok := isMatchingRedirectURI(rawurl, client.GetRedirectURIs()); rawurl != "" && ok {
-		// If a redirect_uri was given and the clients knows it (simple string comparison!)
-		// return it.
-		if parsed, err := url.Parse(redirectTo); err == nil && IsValidRedirectURI(parsed) {
-			// If no redirect_uri was given and the client has exactly one valid redirect_uri registered, use that instead
-			return parsed, nil
-		}
-	}
-
-	return nil, errorsx.WithStack(ErrInvalidRequest.WithHint("The 'redirect_uri' parameter does not match any of the OAuth 2.0 Client's pre-registered redirect urls."))
+	return MatchRedirectURIWithPolicy(context.Background(), rawurl, client, redirectURIPolicyForClient(client, nil, nil))
 }
 
 // Match a requested  redirect URI against a pool of registered client URIs
@@ -4,6 +4,7 @@
 package fosite
 
 import (
+	"context"
 	"net/url"
 )
 
@@ -39,7 +40,13 @@ func NewAuthorizeRequest() *AuthorizeRequest {
 	}
 }
 
+// IsRedirectURIValid matches the redirect URI using the policy of the client's built-in redirect URI profile, or
+// the DefaultRedirectURIPolicy. Fosite.WriteAuthorizeError uses the configured redirect URI policy instead.
 func (d *AuthorizeRequest) IsRedirectURIValid() bool {
+	return d.isRedirectURIValid(context.Background(), redirectURIPolicyForClient(d.GetClient(), nil, nil))
+}
+
+func (d *AuthorizeRequest) isRedirectURIValid(ctx context.Context, policy RedirectURIPolicy) bool {
 	if d.GetRedirectURI() == nil {
 		return false
 	}
@@ -49,7 +56,7 @@ func (d *AuthorizeRequest) IsRedirectURIValid() bool {
 		return false
 	}
 
-	redirectURI, err := MatchRedirectURIWithClientRedirectURIs(raw, d.GetClient())
+	redirectURI, err := MatchRedirectURIWithPolicy(ctx, raw, d.GetClient(), policy)
 	if err != nil {
 		return false
 	}
@@ -6,11 +6,11 @@ package fosite
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 
 	"github.com/go-jose/go-jose/v3"
+	"github.com/hashicorp/go-retryablehttp"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ory/fosite/i18n"
@@ -65,8 +65,13 @@ func (f *Fosite) authorizeRequestParametersFromOpenIDConnectRequest(ctx context.
 			return errorsx.WithStack(ErrInvalidRequestURI.WithHintf("Request URI '%s' is not whitelisted by the OAuth 2.0 Client.", location))
 		}
 
+		req, err := retryablehttp.NewRequestWithContext(ctx, "GET", location, nil)
+		if err != nil {
+			return errorsx.WithStack(ErrInvalidRequestURI.WithHintf("Unable to fetch OpenID Connect request parameters from 'request_uri' because: %s.", err.Error()).WithWrap(err).WithDebug(err.Error()))
+		}
+
 		hc := f.Config.GetHTTPClient(ctx)
-		response, err := hc.Get(location)
+		response, err := hc.Do(req)
 		if err != nil {
 			return errorsx.WithStack(ErrInvalidRequestURI.WithHintf("Unable to fetch OpenID Connect request parameters from 'request_uri' because: %s.", err.Error()).WithWrap(err).WithDebug(err.Error()))
 		}
@@ -76,7 +81,7 @@ func (f *Fosite) authorizeRequestParametersFromOpenIDConnectRequest(ctx context.
 			return errorsx.WithStack(ErrInvalidRequestURI.WithHintf("Unable to fetch OpenID Connect request parameters from 'request_uri' because status code '%d' was expected, but got '%d'.", http.StatusOK, response.StatusCode))
 		}
 
-		body, err := io.ReadAll(response.Body)
+		body, err := readOutboundResponse(ctx, f.Config, response.Body)
 		if err != nil {
 			return errorsx.WithStack(ErrInvalidRequestURI.WithHintf("Unable to fetch OpenID Connect request parameters from 'request_uri' because body parsing failed with: %s.", err).WithWrap(err).WithDebug(err.Error()))
 		}
@@ -123,7 +128,7 @@ func (f *Fosite) authorizeRequestParametersFromOpenIDConnectRequest(ctx context.
 		default:
 			return nil, errorsx.WithStack(ErrInvalidRequestObject.WithHintf("This request object uses unsupported signing algorithm '%s'.", t.Header["alg"]))
 		}
-	})
+	}, f.jwtParserOptions(ctx)...)
 	if err != nil {
 		// Do not re-process already enhanced errors
 		var e *jwt.ValidationError
@@ -134,7 +139,7 @@ func (f *Fosite) authorizeRequestParametersFromOpenIDConnectRequest(ctx context.
 			return errorsx.WithStack(ErrInvalidRequestObject.WithHint("Unable to verify the request object's signature.").WithWrap(err).WithDebug(err.Error()))
 		}
 		return err
-	} else if err := token.Claims.Valid(); err != nil {
+	} else if err := token.Claims.ValidWithLeeway(f.Config.GetClock(ctx).Now(), f.Config.GetJWTLeeway(ctx)); err != nil {
 		return errorsx.WithStack(ErrInvalidRequestObject.WithHint("Unable to verify the request object because its claims could not be validated, check if the expiry time is set correctly.").WithWrap(err).WithDebug(err.Error()))
 	}
 
@@ -161,12 +166,12 @@ func (f *Fosite) authorizeRequestParametersFromOpenIDConnectRequest(ctx context.
 	return nil
 }
 
-func (f *Fosite) validateAuthorizeRedirectURI(_ *http.Request, request *AuthorizeRequest) error {
+func (f *Fosite) validateAuthorizeRedirectURI(ctx context.Context, _ *http.Request, request *AuthorizeRequest) error {
 	// Fetch redirect URI from request
 	rawRedirURI := request.Form.Get("redirect_uri")
 
 	// Validate redirect uri
-	redirectURI, err := MatchRedirectURIWithClientRedirectURIs(rawRedirURI, request.Client)
+	redirectURI, err := MatchRedirectURIWithPolicy(ctx, rawRedirURI, request.Client, f.Config.GetRedirectURIPolicy(ctx, request.Client))
 	if err != nil {
 		return err
 	} else if !IsValidRedirectURI(redirectURI) {
@@ -282,9 +287,15 @@ func (f *Fosite) authorizeRequestFromPAR(ctx context.Context, r *http.Request, r
 		return false, errorsx.WithStack(ErrServerError.WithHint(ErrorPARNotSupported).WithDebug(DebugPARStorageInvalid))
 	}
 
+	// The request URI is read and deleted while holding its lock, so it can only be used once.
+	unlock, err := f.Config.GetLocker(ctx).Lock(ctx, LockKey(PushedAuthorizeRequestContext, requestURI))
+	if err != nil {
+		return false, errorsx.WithStack(ErrServerError.WithWrap(err).WithDebug(err.Error()))
+	}
+	defer unlock()
+
 	// hydrate the requester
 	var parRequest AuthorizeRequester
-	var err error
 	if parRequest, err = storage.GetPARSession(ctx, requestURI); err != nil {
 		return false, errorsx.WithStack(ErrInvalidRequestURI.WithHint("Invalid PAR session").WithWrap(err).WithDebug(err.Error()))
 	}
@@ -317,6 +328,7 @@ func (f *Fosite) NewAuthorizeRequest(ctx context.Context, r *http.Request) (_ Au
 
 func (f *Fosite) newAuthorizeRequest(ctx context.Context, r *http.Request, isPARRequest bool) (AuthorizeRequester, error) {
 	request := NewAuthorizeRequest()
+	request.RequestedAt = f.Config.GetClock(ctx).Now().UTC()
 	request.Request.Lang = i18n.GetLangFromRequest(f.Config.GetMessageCatalog(ctx), r)
 
 	ctx = context.WithValue(ctx, RequestContextKey, r)
@@ -363,7 +375,7 @@ func (f *Fosite) newAuthorizeRequest(ctx context.Context, r *http.Request, isPAR
 		return request, err
 	}
 
-	if err := f.validateAuthorizeRedirectURI(r, request); err != nil {
+	if err := f.validateAuthorizeRedirectURI(ctx, r, request); err != nil {
 		return request, err
 	}
 
@@ -78,7 +78,7 @@ func TestAuthorizeRequestParametersFromOpenIDConnectRequest(t *testing.T) {
 	reqJWK := httptest.NewServer(hJWK)
 	defer reqJWK.Close()
 
-	f := &Fosite{Config: &Config{JWKSFetcherStrategy: NewDefaultJWKSFetcherStrategy()}}
+	f := &Fosite{Config: &Config{JWKSFetcherStrategy: newTestJWKSFetcherStrategy(), DisableOutboundHTTPPolicy: true}}
 	for k, tc := range []struct {
 		client Client
 		form   url.Values
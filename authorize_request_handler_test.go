@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
@@ -17,6 +20,7 @@ import (
 
 	. "github.com/ory/fosite"
 	. "github.com/ory/fosite/internal"
+	"github.com/ory/fosite/storage"
 )
 
 // Should pass
@@ -560,3 +564,48 @@ func TestNewAuthorizeRequest(t *testing.T) {
 		})
 	}
 }
+
+// slowPARStore widens the window between reading and deleting PAR sessions, which makes concurrent redemptions
+// overlap.
+type slowPARStore struct {
+	*storage.MemoryStore
+}
+
+func (s *slowPARStore) GetPARSession(ctx context.Context, requestURI string) (AuthorizeRequester, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return s.MemoryStore.GetPARSession(ctx, requestURI)
+}
+
+func TestNewAuthorizeRequest_ConcurrentPARRedemption(t *testing.T) {
+	store := &slowPARStore{MemoryStore: storage.NewMemoryStore()}
+	provider := &Fosite{Store: store, Config: &Config{Locker: NewMemoryLocker()}}
+
+	requestURI := "urn:ietf:params:oauth:request_uri:par"
+	par := NewAuthorizeRequest()
+	par.Client = &DefaultClient{ID: "client"}
+	par.Session = new(DefaultSession)
+	par.ResponseTypes = Arguments{"code"}
+	par.State = "state-state-state"
+	require.NoError(t, store.CreatePARSession(context.Background(), requestURI, par))
+
+	var wg sync.WaitGroup
+	var redeemed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &http.Request{
+				Header: http.Header{},
+				Form:   url.Values{"client_id": {"client"}, "request_uri": {requestURI}},
+			}
+			if _, err := provider.NewAuthorizeRequest(context.Background(), r); err == nil {
+				atomic.AddInt32(&redeemed, 1)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidRequestURI)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, redeemed, "the request_uri must be used exactly once")
+}
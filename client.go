@@ -71,6 +71,17 @@ type OpenIDConnectClient interface {
 	GetTokenEndpointAuthSigningAlgorithm() string
 }
 
+// SubjectTypeClient represents a client which selects the subject identifier type of its responses.
+type SubjectTypeClient interface {
+	// GetSubjectType returns the subject type requested for responses to this Client. The options are public
+	// and pairwise. An empty value is treated as public.
+	GetSubjectType() string
+
+	// GetSectorIdentifierURI returns the URL of a file with a single JSON array of redirect_uri values. Its host
+	// is used to calculate pairwise subject identifiers.
+	GetSectorIdentifierURI() string
+}
+
 // ResponseModeClient represents a client capable of handling response_mode
 type ResponseModeClient interface {
 	// GetResponseMode returns the response modes that client is allowed to send
@@ -98,6 +109,15 @@ type DefaultOpenIDConnectClient struct {
 	RequestURIs                       []string            `json:"request_uris"`
 	RequestObjectSigningAlgorithm     string              `json:"request_object_signing_alg"`
 	TokenEndpointAuthSigningAlgorithm string              `json:"token_endpoint_auth_signing_alg"`
+	SubjectType                       string              `json:"subject_type"`
+	SectorIdentifierURI               string              `json:"sector_identifier_uri"`
+}
+
+// DefaultRedirectURIProfileClient is a client which selects a redirect URI profile, for example
+// RedirectURIProfileNative.
+type DefaultRedirectURIProfileClient struct {
+	*DefaultClient
+	RedirectURIProfile string `json:"redirect_uri_profile"`
 }
 
 type DefaultResponseModeClient struct {
@@ -106,6 +126,10 @@ type DefaultResponseModeClient struct {
 }
 
 func (c *DefaultClient) GetID() string {
+	if c == nil {
+		return ""
+	}
+
 	return c.ID
 }
 
@@ -185,6 +209,18 @@ func (c *DefaultOpenIDConnectClient) GetRequestURIs() []string {
 	return c.RequestURIs
 }
 
+func (c *DefaultOpenIDConnectClient) GetSubjectType() string {
+	return c.SubjectType
+}
+
+func (c *DefaultOpenIDConnectClient) GetSectorIdentifierURI() string {
+	return c.SectorIdentifierURI
+}
+
+func (c *DefaultRedirectURIProfileClient) GetRedirectURIProfile() string {
+	return c.RedirectURIProfile
+}
+
 func (c *DefaultResponseModeClient) GetResponseModes() []ResponseModeType {
 	return c.ResponseModes
 }
@@ -4,6 +4,7 @@
 package fosite
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
@@ -11,6 +12,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"time"
 
@@ -34,7 +36,18 @@ func (f *Fosite) findClientPublicJWK(ctx context.Context, oidcClient OpenIDConne
 	}
 
 	if location := oidcClient.GetJSONWebKeysURI(); len(location) > 0 {
-		keys, err := f.Config.GetJWKSFetcherStrategy(ctx).Resolve(ctx, location, false)
+		strategy := f.Config.GetJWKSFetcherStrategy(ctx)
+		if s, ok := strategy.(JWKSKeyIDFetcherStrategy); ok {
+			kid, _ := t.Header["kid"].(string)
+			keys, err := s.ResolveKeyID(ctx, location, kid)
+			if err != nil {
+				return nil, err
+			}
+
+			return findPublicKey(t, keys, expectsRSAKey)
+		}
+
+		keys, err := strategy.Resolve(ctx, location, false)
 		if err != nil {
 			return nil, err
 		}
@@ -43,7 +56,7 @@ func (f *Fosite) findClientPublicJWK(ctx context.Context, oidcClient OpenIDConne
 			return key, nil
 		}
 
-		keys, err = f.Config.GetJWKSFetcherStrategy(ctx).Resolve(ctx, location, true)
+		keys, err = strategy.Resolve(ctx, location, true)
 		if err != nil {
 			return nil, err
 		}
@@ -54,6 +67,30 @@ func (f *Fosite) findClientPublicJWK(ctx context.Context, oidcClient OpenIDConne
 	return nil, errorsx.WithStack(ErrInvalidClient.WithHint("The OAuth 2.0 Client has no JSON Web Keys set registered, but they are needed to complete the request."))
 }
 
+// checkClientAssertionClient checks that the client authenticates with private_key_jwt and the signing algorithm of
+// the client assertion.
+func checkClientAssertionClient(client OpenIDConnectClient, t *jwt.Token) error {
+	switch client.GetTokenEndpointAuthMethod() {
+	case "private_key_jwt":
+		break
+	case "none":
+		return errorsx.WithStack(ErrInvalidClient.WithHint("This requested OAuth 2.0 client does not support client authentication, however 'client_assertion' was provided in the request."))
+	case "client_secret_post":
+		fallthrough
+	case "client_secret_basic":
+		return errorsx.WithStack(ErrInvalidClient.WithHintf("This requested OAuth 2.0 client only supports client authentication method '%s', however 'client_assertion' was provided in the request.", client.GetTokenEndpointAuthMethod()))
+	case "client_secret_jwt":
+		fallthrough
+	default:
+		return errorsx.WithStack(ErrInvalidClient.WithHintf("This requested OAuth 2.0 client only supports client authentication method '%s', however that method is not supported by this server.", client.GetTokenEndpointAuthMethod()))
+	}
+
+	if client.GetTokenEndpointAuthSigningAlgorithm() != fmt.Sprintf("%s", t.Header["alg"]) {
+		return errorsx.WithStack(ErrInvalidClient.WithHintf("The 'client_assertion' uses signing algorithm '%s' but the requested OAuth 2.0 Client enforces signing algorithm '%s'.", t.Header["alg"], client.GetTokenEndpointAuthSigningAlgorithm()))
+	}
+	return nil
+}
+
 // AuthenticateClient authenticates client requests using the configured strategy
 // `Fosite.ClientAuthenticationStrategy`, if nil it uses `Fosite.DefaultClientAuthenticationStrategy`
 func (f *Fosite) AuthenticateClient(ctx context.Context, r *http.Request, form url.Values) (Client, error) {
@@ -75,6 +112,7 @@ func (f *Fosite) DefaultClientAuthenticationStrategy(ctx context.Context, r *htt
 		var clientID string
 		var client Client
 
+		now, leeway := f.Config.GetClock(ctx).Now(), f.Config.GetJWTLeeway(ctx)
 		token, err := jwt.ParseWithClaims(assertion, jwt.MapClaims{}, func(t *jwt.Token) (interface{}, error) {
 			var err error
 			clientID, _, err = clientCredentialsFromRequestBody(form, false)
@@ -101,37 +139,41 @@ func (f *Fosite) DefaultClientAuthenticationStrategy(ctx context.Context, r *htt
 				return nil, errorsx.WithStack(ErrInvalidRequest.WithHint("The server configuration does not support OpenID Connect specific authentication methods."))
 			}
 
-			switch oidcClient.GetTokenEndpointAuthMethod() {
-			case "private_key_jwt":
-				break
-			case "none":
-				return nil, errorsx.WithStack(ErrInvalidClient.WithHint("This requested OAuth 2.0 client does not support client authentication, however 'client_assertion' was provided in the request."))
-			case "client_secret_post":
-				fallthrough
-			case "client_secret_basic":
-				return nil, errorsx.WithStack(ErrInvalidClient.WithHintf("This requested OAuth 2.0 client only supports client authentication method '%s', however 'client_assertion' was provided in the request.", oidcClient.GetTokenEndpointAuthMethod()))
-			case "client_secret_jwt":
-				fallthrough
-			default:
-				return nil, errorsx.WithStack(ErrInvalidClient.WithHintf("This requested OAuth 2.0 client only supports client authentication method '%s', however that method is not supported by this server.", oidcClient.GetTokenEndpointAuthMethod()))
+			if err := checkClientAssertionClient(oidcClient, t); err != nil {
+				return nil, err
 			}
 
-			if oidcClient.GetTokenEndpointAuthSigningAlgorithm() != fmt.Sprintf("%s", t.Header["alg"]) {
-				return nil, errorsx.WithStack(ErrInvalidClient.WithHintf("The 'client_assertion' uses signing algorithm '%s' but the requested OAuth 2.0 Client enforces signing algorithm '%s'.", t.Header["alg"], oidcClient.GetTokenEndpointAuthSigningAlgorithm()))
-			}
+			var expectsRSAKey bool
 			switch t.Method {
-			case jose.RS256, jose.RS384, jose.RS512:
-				return f.findClientPublicJWK(ctx, oidcClient, t, true)
+			case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+				expectsRSAKey = true
 			case jose.ES256, jose.ES384, jose.ES512:
-				return f.findClientPublicJWK(ctx, oidcClient, t, false)
-			case jose.PS256, jose.PS384, jose.PS512:
-				return f.findClientPublicJWK(ctx, oidcClient, t, true)
+				expectsRSAKey = false
 			case jose.HS256, jose.HS384, jose.HS512:
 				return nil, errorsx.WithStack(ErrInvalidClient.WithHint("This authorization server does not support client authentication method 'client_secret_jwt'."))
 			default:
 				return nil, errorsx.WithStack(ErrInvalidClient.WithHintf("The 'client_assertion' request parameter uses unsupported signing algorithm '%s'.", t.Header["alg"]))
 			}
-		})
+
+			key, err := f.findClientPublicJWK(ctx, oidcClient, t, expectsRSAKey)
+			if err != nil {
+				// The client's keys may have been rotated after the client was cached. The rest of the client may
+				// have changed as well, so the refreshed client must still accept the assertion.
+				if refreshed, ok := f.refreshClient(ctx, client, clientKeysChanged); ok {
+					if refreshedClient, ok := refreshed.(OpenIDConnectClient); ok {
+						if err := checkClientAssertionClient(refreshedClient, t); err != nil {
+							return nil, err
+						}
+						if key, err := f.findClientPublicJWK(ctx, refreshedClient, t, expectsRSAKey); err == nil {
+							client = refreshed
+							return key, nil
+						}
+					}
+				}
+				return nil, err
+			}
+			return key, nil
+		}, f.jwtParserOptions(ctx)...)
 		if err != nil {
 			// Do not re-process already enhanced errors
 			var e *jwt.ValidationError
@@ -142,7 +184,7 @@ func (f *Fosite) DefaultClientAuthenticationStrategy(ctx context.Context, r *htt
 				return nil, errorsx.WithStack(ErrInvalidClient.WithHint("Unable to verify the integrity of the 'client_assertion' value.").WithWrap(err).WithDebug(err.Error()))
 			}
 			return nil, err
-		} else if err := token.Claims.Valid(); err != nil {
+		} else if err := token.Claims.ValidWithLeeway(now, leeway); err != nil {
 			return nil, errorsx.WithStack(ErrInvalidClient.WithHint("Unable to verify the request object because its claims could not be validated, check if the expiry time is set correctly.").WithWrap(err).WithDebug(err.Error()))
 		}
 
@@ -177,7 +219,9 @@ func (f *Fosite) DefaultClientAuthenticationStrategy(ctx context.Context, r *htt
 		if err != nil {
 			return nil, errorsx.WithStack(err)
 		}
-		if err := f.Store.SetClientAssertionJWT(ctx, jti, time.Unix(expiry, 0)); err != nil {
+		// The assertion is accepted until its expiry plus the tolerated clock skew, so it must not be
+		// forgotten earlier.
+		if err := f.Store.SetClientAssertionJWT(ctx, jti, time.Unix(expiry, 0).Add(leeway)); err != nil {
 			return nil, err
 		}
 
@@ -218,7 +262,12 @@ func (f *Fosite) DefaultClientAuthenticationStrategy(ctx context.Context, r *htt
 
 	// Enforce client authentication
 	if err := f.checkClientSecret(ctx, client, []byte(clientSecret)); err != nil {
-		return nil, errorsx.WithStack(ErrInvalidClient.WithWrap(err).WithDebug(err.Error()))
+		// The client's secret may have been rotated after the client was cached.
+		refreshed, ok := f.refreshClient(ctx, client, clientSecretsChanged)
+		if !ok || refreshed.IsPublic() || f.checkClientSecret(ctx, refreshed, []byte(clientSecret)) != nil {
+			return nil, errorsx.WithStack(ErrInvalidClient.WithWrap(err).WithDebug(err.Error()))
+		}
+		client = refreshed
 	}
 
 	return client, nil
@@ -245,6 +294,55 @@ func audienceMatchesTokenURL(claims jwt.MapClaims, tokenURL string) bool {
 	return claims.VerifyAudience(tokenURL, true)
 }
 
+// refreshClient reloads the client if the store caches clients. It returns false if the store does not cache clients,
+// the client can not be reloaded, or changed reports that the reloaded client does not differ from the cached one.
+func (f *Fosite) refreshClient(ctx context.Context, client Client, changed func(cached, refreshed Client) bool) (Client, bool) {
+	refresher, ok := f.Store.(ClientRefresher)
+	if !ok {
+		return nil, false
+	}
+
+	refreshed, err := refresher.RefreshClient(ctx, client.GetID())
+	if err != nil || !changed(client, refreshed) {
+		return nil, false
+	}
+	return refreshed, true
+}
+
+// clientSecretsChanged reports whether the hashed secrets of the clients differ.
+func clientSecretsChanged(cached, refreshed Client) bool {
+	if !bytes.Equal(cached.GetHashedSecret(), refreshed.GetHashedSecret()) {
+		return true
+	}
+
+	var cachedHashes, refreshedHashes [][]byte
+	if cc, ok := cached.(ClientWithSecretRotation); ok {
+		cachedHashes = cc.GetRotatedHashes()
+	}
+	if rc, ok := refreshed.(ClientWithSecretRotation); ok {
+		refreshedHashes = rc.GetRotatedHashes()
+	}
+	if len(cachedHashes) != len(refreshedHashes) {
+		return true
+	}
+	for i := range cachedHashes {
+		if !bytes.Equal(cachedHashes[i], refreshedHashes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKeysChanged reports whether the JSON Web Keys or the JSON Web Key Set URIs of the clients differ.
+func clientKeysChanged(cached, refreshed Client) bool {
+	cc, cok := cached.(OpenIDConnectClient)
+	rc, rok := refreshed.(OpenIDConnectClient)
+	if !cok || !rok {
+		return cok != rok
+	}
+	return cc.GetJSONWebKeysURI() != rc.GetJSONWebKeysURI() || !reflect.DeepEqual(cc.GetJSONWebKeys(), rc.GetJSONWebKeys())
+}
+
 func (f *Fosite) checkClientSecret(ctx context.Context, client Client, clientSecret []byte) error {
 	var err error
 	err = f.Config.GetSecretsHasher(ctx).Compare(ctx, client.GetHashedSecret(), clientSecret)
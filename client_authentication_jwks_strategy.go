@@ -6,6 +6,11 @@ package fosite
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
@@ -16,7 +21,15 @@ import (
 	"github.com/go-jose/go-jose/v3"
 )
 
-const defaultJWKSFetcherStrategyCachePrefix = "github.com/ory/fosite.DefaultJWKSFetcherStrategy:"
+const (
+	defaultJWKSFetcherStrategyCachePrefix = "github.com/ory/fosite.DefaultJWKSFetcherStrategy:"
+
+	defaultJWKSFetcherRefreshCoolDown = time.Minute
+	defaultJWKSFetcherMinTTL          = time.Minute
+	defaultJWKSFetcherMaxTTL          = 24 * time.Hour
+
+	minJWKSLocationsPruneAt = 64
+)
 
 // JWKSFetcherStrategy is a strategy which pulls (optionally caches) JSON Web Key Sets from a location,
 // typically a client's jwks_uri.
@@ -27,12 +40,78 @@ type JWKSFetcherStrategy interface {
 	Resolve(ctx context.Context, location string, ignoreCache bool) (*jose.JSONWebKeySet, error)
 }
 
+// JWKSKeyIDFetcherStrategy is implemented by JWKS fetcher strategies which refresh their cache on their own
+// when a JSON Web Token references a key which is not part of the cached set, for example because the
+// client rotated its keys.
+type JWKSKeyIDFetcherStrategy interface {
+	// ResolveKeyID returns the JSON Web Key Set for the location. If the cached set does not contain a key with the
+	// given kid, the set is fetched again unless it was fetched recently. An empty kid matches any non-empty set.
+	ResolveKeyID(ctx context.Context, location, kid string) (*jose.JSONWebKeySet, error)
+}
+
+// JWKSFetcherMetrics contains counters describing the cache efficiency of the DefaultJWKSFetcherStrategy.
+type JWKSFetcherMetrics struct {
+	// Hits is the number of key sets served from a fresh cache entry.
+	Hits uint64
+	// StaleHits is the number of key sets served from an expired cache entry while it was refreshed in the background.
+	StaleHits uint64
+	// Misses is the number of lookups which required fetching the key set from the remote.
+	Misses uint64
+	// KeyIDRefreshes is the number of fetches caused by a kid which was not part of the cached key set.
+	KeyIDRefreshes uint64
+	// KeyIDRefreshesSuppressed is the number of kid misses which did not cause a fetch due to the refresh cool-down.
+	KeyIDRefreshesSuppressed uint64
+	// Revalidations is the number of fetches answered with "304 Not Modified".
+	Revalidations uint64
+	// Errors is the number of failed fetches.
+	Errors uint64
+}
+
 // DefaultJWKSFetcherStrategy is a default implementation of the JWKSFetcherStrategy interface.
+//
+// Key sets are cached for as long as the remote permits using the Cache-Control (max-age, no-cache, no-store
+// and stale-while-revalidate directives) and Expires headers, falling back to the default TTL. Expired entries
+// are revalidated using ETag and Last-Modified, and "no-cache" responses are revalidated on every use. When a
+// JSON Web Token references an unknown kid, the key set is fetched again, at most once per refresh cool-down and
+// location. If that fetch fails, the cached key set is used.
 type DefaultJWKSFetcherStrategy struct {
 	client           *retryablehttp.Client
 	cache            *ristretto.Cache
 	ttl              time.Duration
+	minTTL           time.Duration
+	maxTTL           time.Duration
+	refreshCoolDown  time.Duration
+	staleTTL         time.Duration
 	clientSourceFunc func(ctx context.Context) *retryablehttp.Client
+	now              func() time.Time
+
+	mu        sync.Mutex
+	locations map[string]*jwksLocationState
+	// pruneAt is the number of locations at which idle location states are removed.
+	pruneAt int
+
+	hits, staleHits, misses, keyIDRefreshes, keyIDRefreshesSuppressed, revalidations, errors atomic.Uint64
+}
+
+type jwksLocationState struct {
+	fetchedAt  time.Time
+	refreshing bool
+	// keyIDRefresh is set while a fetch caused by an unknown kid is in flight.
+	keyIDRefresh *jwksKeyIDRefresh
+}
+
+type jwksKeyIDRefresh struct {
+	done chan struct{}
+	set  *jose.JSONWebKeySet
+	err  error
+}
+
+type jwksCacheEntry struct {
+	set          *jose.JSONWebKeySet
+	expiresAt    time.Time
+	staleUntil   time.Time
+	etag         string
+	lastModified string
 }
 
 // NewDefaultJWKSFetcherStrategy returns a new instance of the DefaultJWKSFetcherStrategy.
@@ -51,9 +130,15 @@ func NewDefaultJWKSFetcherStrategy(opts ...func(*DefaultJWKSFetcherStrategy)) JW
 	}
 
 	s := &DefaultJWKSFetcherStrategy{
-		cache:  dc,
-		client: retryablehttp.NewClient(),
-		ttl:    time.Hour,
+		cache:           dc,
+		client:          defaultOutboundHTTPPolicy.WrapClient(retryablehttp.NewClient()),
+		ttl:             time.Hour,
+		minTTL:          defaultJWKSFetcherMinTTL,
+		maxTTL:          defaultJWKSFetcherMaxTTL,
+		refreshCoolDown: defaultJWKSFetcherRefreshCoolDown,
+		now:             time.Now,
+		locations:       map[string]*jwksLocationState{},
+		pruneAt:         minJWKSLocationsPruneAt,
 	}
 
 	for _, o := range opts {
@@ -63,13 +148,39 @@ func NewDefaultJWKSFetcherStrategy(opts ...func(*DefaultJWKSFetcherStrategy)) JW
 	return s
 }
 
-// JKWKSFetcherWithDefaultTTL sets the default TTL for the cache.
+// JKWKSFetcherWithDefaultTTL sets the default TTL for the cache. It is used if the remote does not send
+// caching headers.
 func JKWKSFetcherWithDefaultTTL(ttl time.Duration) func(*DefaultJWKSFetcherStrategy) {
 	return func(s *DefaultJWKSFetcherStrategy) {
 		s.ttl = ttl
 	}
 }
 
+// JWKSFetcherWithTTLBounds sets the bounds of the TTL derived from the remote's caching headers. Defaults to
+// one minute and one day.
+func JWKSFetcherWithTTLBounds(min, max time.Duration) func(*DefaultJWKSFetcherStrategy) {
+	return func(s *DefaultJWKSFetcherStrategy) {
+		s.minTTL = min
+		s.maxTTL = max
+	}
+}
+
+// JWKSFetcherWithRefreshCoolDown sets the minimum time between two fetches of a location caused by unknown
+// key IDs. Defaults to one minute.
+func JWKSFetcherWithRefreshCoolDown(coolDown time.Duration) func(*DefaultJWKSFetcherStrategy) {
+	return func(s *DefaultJWKSFetcherStrategy) {
+		s.refreshCoolDown = coolDown
+	}
+}
+
+// JWKSFetcherWithStaleWhileRevalidate sets how long an expired key set may still be served while it is
+// refreshed in the background, unless the remote sends a stale-while-revalidate directive. Defaults to zero.
+func JWKSFetcherWithStaleWhileRevalidate(stale time.Duration) func(*DefaultJWKSFetcherStrategy) {
+	return func(s *DefaultJWKSFetcherStrategy) {
+		s.staleTTL = stale
+	}
+}
+
 // JWKSFetcherWithCache sets the cache to use.
 func JWKSFetcherWithCache(cache *ristretto.Cache) func(*DefaultJWKSFetcherStrategy) {
 	return func(s *DefaultJWKSFetcherStrategy) {
@@ -95,41 +206,306 @@ func JWKSFetcherWithHTTPClientSource(clientSourceFunc func(ctx context.Context)
 // the strategy to fetch the key from the remote. If forceRefresh is false, the strategy may use a caching strategy
 // to fetch the key.
 func (s *DefaultJWKSFetcherStrategy) Resolve(ctx context.Context, location string, ignoreCache bool) (*jose.JSONWebKeySet, error) {
-	cacheKey := defaultJWKSFetcherStrategyCachePrefix + location
-	key, ok := s.cache.Get(cacheKey)
-	if !ok || ignoreCache {
-		req, err := retryablehttp.NewRequest("GET", location, nil)
-		if err != nil {
-			return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to create HTTP 'GET' request to fetch  JSON Web Keys from location '%s'.", location).WithWrap(err).WithDebug(err.Error()))
+	entry, ok := s.get(location)
+	if ignoreCache {
+		s.misses.Add(1)
+		return s.fetch(ctx, location, entry)
+	}
+
+	if !ok {
+		s.misses.Add(1)
+		return s.fetch(ctx, location, nil)
+	}
+
+	now := s.now()
+	if entry.expiresAt.IsZero() || now.Before(entry.expiresAt) {
+		s.hits.Add(1)
+		return entry.set, nil
+	}
+
+	if now.Before(entry.staleUntil) {
+		s.staleHits.Add(1)
+		s.refreshInBackground(ctx, location, entry)
+		return entry.set, nil
+	}
+
+	s.misses.Add(1)
+	return s.fetch(ctx, location, entry)
+}
+
+// ResolveKeyID returns the JSON Web Key Set for the location. If the cached set does not contain a key with the
+// given kid, the set is fetched again unless it was fetched within the refresh cool-down.
+func (s *DefaultJWKSFetcherStrategy) ResolveKeyID(ctx context.Context, location, kid string) (*jose.JSONWebKeySet, error) {
+	set, err := s.Resolve(ctx, location, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if (kid == "" && len(set.Keys) > 0) || (kid != "" && len(set.Key(kid)) > 0) {
+		return set, nil
+	}
+
+	s.mu.Lock()
+	state := s.location(location)
+	if refresh := state.keyIDRefresh; refresh != nil {
+		// Another request is already fetching the key set, wait for it instead of fetching it again.
+		s.mu.Unlock()
+		s.keyIDRefreshesSuppressed.Add(1)
+		select {
+		case <-refresh.done:
+			return refresh.set, refresh.err
+		case <-ctx.Done():
+			return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to fetch JSON Web Keys from location '%s'.", location).WithWrap(ctx.Err()).WithDebug(ctx.Err().Error()))
 		}
+	}
+	if s.now().Sub(state.fetchedAt) < s.refreshCoolDown {
+		s.mu.Unlock()
+		s.keyIDRefreshesSuppressed.Add(1)
+		return set, nil
+	}
+	// Reserve the fetch before releasing the lock, so concurrent requests do not pass the cool-down check as well.
+	refresh := &jwksKeyIDRefresh{done: make(chan struct{})}
+	state.keyIDRefresh = refresh
+	state.fetchedAt = s.now()
+	s.mu.Unlock()
 
-		hc := s.client
-		if s.clientSourceFunc != nil {
-			hc = s.clientSourceFunc(ctx)
+	s.keyIDRefreshes.Add(1)
+	entry, _ := s.get(location)
+	refresh.set, refresh.err = s.fetch(ctx, location, entry)
+	if refresh.err != nil {
+		// The cached key set is still valid, so a failed refresh must not fail requests signed with known keys.
+		refresh.set, refresh.err = set, nil
+	}
+
+	s.mu.Lock()
+	state.keyIDRefresh = nil
+	s.mu.Unlock()
+	close(refresh.done)
+
+	return refresh.set, refresh.err
+}
+
+// Metrics returns a snapshot of the cache metrics.
+func (s *DefaultJWKSFetcherStrategy) Metrics() JWKSFetcherMetrics {
+	return JWKSFetcherMetrics{
+		Hits:                     s.hits.Load(),
+		StaleHits:                s.staleHits.Load(),
+		Misses:                   s.misses.Load(),
+		KeyIDRefreshes:           s.keyIDRefreshes.Load(),
+		KeyIDRefreshesSuppressed: s.keyIDRefreshesSuppressed.Load(),
+		Revalidations:            s.revalidations.Load(),
+		Errors:                   s.errors.Load(),
+	}
+}
+
+// WaitForCache blocks until all pending writes to the cache have been applied.
+func (s *DefaultJWKSFetcherStrategy) WaitForCache() {
+	s.cache.Wait()
+}
+
+func (s *DefaultJWKSFetcherStrategy) get(location string) (*jwksCacheEntry, bool) {
+	v, ok := s.cache.Get(defaultJWKSFetcherStrategyCachePrefix + location)
+	if !ok {
+		return nil, false
+	}
+
+	switch e := v.(type) {
+	case *jwksCacheEntry:
+		return e, true
+	case *jose.JSONWebKeySet:
+		// Entries placed into the cache by third parties never expire on their own.
+		return &jwksCacheEntry{set: e}, true
+	}
+	return nil, false
+}
+
+// location must be called while holding s.mu.
+func (s *DefaultJWKSFetcherStrategy) location(location string) *jwksLocationState {
+	state, ok := s.locations[location]
+	if !ok {
+		if len(s.locations) >= s.pruneAt {
+			s.prune()
 		}
+		state = new(jwksLocationState)
+		s.locations[location] = state
+	}
+	return state
+}
 
-		response, err := hc.Do(req.WithContext(ctx))
-		if err != nil {
-			return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to fetch JSON Web Keys from location '%s'. Check for typos or other network issues.", location).WithWrap(err).WithDebug(err.Error()))
+// prune removes the states of locations which are neither being fetched nor within their refresh cool-down,
+// as they are equal to a new state. It must be called while holding s.mu.
+func (s *DefaultJWKSFetcherStrategy) prune() {
+	now := s.now()
+	for location, state := range s.locations {
+		if !state.refreshing && state.keyIDRefresh == nil && now.Sub(state.fetchedAt) >= s.refreshCoolDown {
+			delete(s.locations, location)
 		}
-		defer response.Body.Close()
+	}
 
-		if response.StatusCode < 200 || response.StatusCode >= 400 {
-			return nil, errorsx.WithStack(ErrServerError.WithHintf("Expected successful status code in range of 200 - 399 from location '%s' but received code %d.", location, response.StatusCode))
+	s.pruneAt = 2 * len(s.locations)
+	if s.pruneAt < minJWKSLocationsPruneAt {
+		s.pruneAt = minJWKSLocationsPruneAt
+	}
+}
+
+func (s *DefaultJWKSFetcherStrategy) refreshInBackground(ctx context.Context, location string, entry *jwksCacheEntry) {
+	s.mu.Lock()
+	state := s.location(location)
+	if state.refreshing {
+		s.mu.Unlock()
+		return
+	}
+	state.refreshing = true
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.location(location).refreshing = false
+			s.mu.Unlock()
+		}()
+		_, _ = s.fetch(detachedContext{ctx}, location, entry)
+	}()
+}
+
+func (s *DefaultJWKSFetcherStrategy) fetch(ctx context.Context, location string, previous *jwksCacheEntry) (*jose.JSONWebKeySet, error) {
+	set, err := s.doFetch(ctx, location, previous)
+	if err != nil {
+		s.errors.Add(1)
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s *DefaultJWKSFetcherStrategy) doFetch(ctx context.Context, location string, previous *jwksCacheEntry) (*jose.JSONWebKeySet, error) {
+	req, err := retryablehttp.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to create HTTP 'GET' request to fetch  JSON Web Keys from location '%s'.", location).WithWrap(err).WithDebug(err.Error()))
+	}
+
+	if previous != nil && previous.set != nil {
+		if previous.etag != "" {
+			req.Header.Set("If-None-Match", previous.etag)
 		}
+		if previous.lastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.lastModified)
+		}
+	}
 
-		var set jose.JSONWebKeySet
-		if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+	hc := s.client
+	if s.clientSourceFunc != nil {
+		hc = s.clientSourceFunc(ctx)
+	}
+
+	response, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to fetch JSON Web Keys from location '%s'. Check for typos or other network issues.", location).WithWrap(err).WithDebug(err.Error()))
+	}
+	defer response.Body.Close()
+
+	now := s.now()
+	s.mu.Lock()
+	s.location(location).fetchedAt = now
+	s.mu.Unlock()
+
+	var set *jose.JSONWebKeySet
+	if response.StatusCode == http.StatusNotModified && previous != nil && previous.set != nil {
+		s.revalidations.Add(1)
+		set = previous.set
+	} else if response.StatusCode < 200 || response.StatusCode >= 400 {
+		return nil, errorsx.WithStack(ErrServerError.WithHintf("Expected successful status code in range of 200 - 399 from location '%s' but received code %d.", location, response.StatusCode))
+	} else {
+		set = new(jose.JSONWebKeySet)
+		if err := json.NewDecoder(response.Body).Decode(set); err != nil {
 			return nil, errorsx.WithStack(ErrServerError.WithHintf("Unable to decode JSON Web Keys from location '%s'. Please check for typos and if the URL returns valid JSON.", location).WithWrap(err).WithDebug(err.Error()))
 		}
+	}
 
-		_ = s.cache.SetWithTTL(cacheKey, &set, 1, s.ttl)
-		return &set, nil
+	entry := &jwksCacheEntry{
+		set:          set,
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
+	}
+	if entry.etag == "" && entry.lastModified == "" && previous != nil {
+		entry.etag, entry.lastModified = previous.etag, previous.lastModified
 	}
 
-	return key.(*jose.JSONWebKeySet), nil
+	ttl, stale, store := s.cacheLifetime(response.Header, now)
+	retain := ttl + stale
+	if store && retain <= 0 {
+		// The response must be revalidated before it is used again, which is only worth it with validators.
+		store = entry.etag != "" || entry.lastModified != ""
+		retain = s.maxTTL
+	}
+	if !store {
+		s.cache.Del(defaultJWKSFetcherStrategyCachePrefix + location)
+		return set, nil
+	}
+
+	entry.expiresAt = now.Add(ttl)
+	entry.staleUntil = now.Add(ttl + stale)
+	_ = s.cache.SetWithTTL(defaultJWKSFetcherStrategyCachePrefix+location, entry, 1, retain)
+	return set, nil
 }
 
-func (s *DefaultJWKSFetcherStrategy) WaitForCache() {
-	s.cache.Wait()
+// cacheLifetime derives how long a response may be cached and served stale from its Cache-Control and
+// Expires headers. Responses which must be revalidated, such as "no-cache" ones, have a TTL of zero.
+func (s *DefaultJWKSFetcherStrategy) cacheLifetime(header http.Header, now time.Time) (ttl, stale time.Duration, store bool) {
+	ttl, stale = s.ttl, s.staleTTL
+	fromHeader := false
+
+	if cc := header.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(name) {
+			case "no-store":
+				return 0, 0, false
+			case "no-cache":
+				ttl, fromHeader = 0, true
+			case "max-age":
+				if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && !fromHeader {
+					ttl, fromHeader = time.Duration(seconds)*time.Second, true
+				}
+			case "stale-while-revalidate":
+				if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+					stale = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+
+	if !fromHeader {
+		if expires := header.Get("Expires"); expires != "" {
+			if t, err := http.ParseTime(expires); err == nil {
+				ttl, fromHeader = t.Sub(now), true
+			} else {
+				// Invalid values, such as "0", mean the response has already expired.
+				ttl, fromHeader = 0, true
+			}
+		}
+	}
+
+	if fromHeader {
+		if ttl <= 0 {
+			return 0, stale, true
+		}
+		if ttl < s.minTTL {
+			ttl = s.minTTL
+		}
+		if s.maxTTL > 0 && ttl > s.maxTTL {
+			ttl = s.maxTTL
+		}
+	}
+
+	return ttl, stale, fromHeader || ttl+stale > 0
 }
+
+// detachedContext keeps the values of the parent context but is never canceled. It is used for background
+// work which should outlive the request that triggered it.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -6,8 +6,11 @@ package fosite
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -51,11 +54,16 @@ func (r *failingTripper) RoundTrip(*http.Request) (*http.Response, error) {
 	return nil, errRoundTrip
 }
 
+// newTestJWKSFetcherStrategy returns a strategy which may fetch key sets from local test servers.
+func newTestJWKSFetcherStrategy(opts ...func(*DefaultJWKSFetcherStrategy)) JWKSFetcherStrategy {
+	return NewDefaultJWKSFetcherStrategy(append([]func(*DefaultJWKSFetcherStrategy){JWKSFetcherWithHTTPClient(retryablehttp.NewClient())}, opts...)...)
+}
+
 func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 	ctx := context.Background()
 	var h http.HandlerFunc
 
-	s := NewDefaultJWKSFetcherStrategy()
+	s := newTestJWKSFetcherStrategy()
 	t.Run("case=fetching", func(t *testing.T) {
 		var set *jose.JSONWebKeySet
 		h = func(w http.ResponseWriter, r *http.Request) {
@@ -77,6 +85,7 @@ func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 		keys, err := s.Resolve(ctx, ts.URL, false)
 		require.NoError(t, err)
 		assert.True(t, len(keys.Key("foo")) == 1)
+		s.(*DefaultJWKSFetcherStrategy).WaitForCache()
 
 		set = &jose.JSONWebKeySet{
 			Keys: []jose.JSONWebKey{
@@ -109,7 +118,7 @@ func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 		require.True(t, cache.Set(defaultJWKSFetcherStrategyCachePrefix+location, expected, 1))
 		cache.Wait()
 
-		s := NewDefaultJWKSFetcherStrategy(JWKSFetcherWithCache(cache))
+		s := newTestJWKSFetcherStrategy(JWKSFetcherWithCache(cache))
 		actual, err := s.Resolve(ctx, location, false)
 		require.NoError(t, err)
 		assert.Equal(t, expected, actual)
@@ -118,7 +127,7 @@ func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 	t.Run("JWKSFetcherWithTTL", func(t *testing.T) {
 		ts := initServerWithKey(t)
 
-		s := NewDefaultJWKSFetcherStrategy(JKWKSFetcherWithDefaultTTL(time.Nanosecond))
+		s := newTestJWKSFetcherStrategy(JKWKSFetcherWithDefaultTTL(time.Nanosecond))
 		_, err := s.Resolve(ctx, ts.URL, false)
 		require.NoError(t, err)
 		s.(*DefaultJWKSFetcherStrategy).cache.Wait()
@@ -149,8 +158,269 @@ func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 		require.ErrorIs(t, err, errRoundTrip)
 	})
 
+	t.Run("case=kid miss refreshes the key set with a cool-down", func(t *testing.T) {
+		var calls int32
+		kids := []string{"foo"}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			set := &jose.JSONWebKeySet{}
+			for _, kid := range kids {
+				set.Keys = append(set.Keys, jose.JSONWebKey{KeyID: kid, Use: "sig", Key: &gen.MustRSAKey().PublicKey})
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(set))
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy(JWKSFetcherWithRefreshCoolDown(time.Minute)).(*DefaultJWKSFetcherStrategy)
+		s.now = func() time.Time { return now }
+
+		keys, err := s.ResolveKeyID(ctx, ts.URL, "foo")
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("foo"), 1)
+		s.WaitForCache()
+
+		kids = []string{"bar"}
+		now = now.Add(2 * time.Minute)
+		keys, err = s.ResolveKeyID(ctx, ts.URL, "bar")
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("bar"), 1)
+		s.WaitForCache()
+
+		keys, err = s.ResolveKeyID(ctx, ts.URL, "baz")
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("baz"), 0)
+
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+		m := s.Metrics()
+		assert.EqualValues(t, 1, m.KeyIDRefreshes)
+		assert.EqualValues(t, 1, m.KeyIDRefreshesSuppressed)
+		assert.EqualValues(t, 1, m.Misses)
+		assert.EqualValues(t, 2, m.Hits)
+	})
+
+	t.Run("case=concurrent kid misses fetch the key set once", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) > 1 {
+				<-release
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{KeyID: "foo", Use: "sig", Key: &gen.MustRSAKey().PublicKey},
+			}}))
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy(JWKSFetcherWithRefreshCoolDown(time.Minute)).(*DefaultJWKSFetcherStrategy)
+		s.now = func() time.Time { return now }
+
+		_, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		s.WaitForCache()
+		now = now.Add(2 * time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				keys, err := s.ResolveKeyID(ctx, ts.URL, "unknown")
+				assert.NoError(t, err)
+				assert.Len(t, keys.Key("foo"), 1)
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "the key set is fetched once for all concurrent kid misses")
+		m := s.Metrics()
+		assert.EqualValues(t, 1, m.KeyIDRefreshes)
+		assert.EqualValues(t, 9, m.KeyIDRefreshesSuppressed)
+	})
+
+	t.Run("case=honors Cache-Control and revalidates with ETag", func(t *testing.T) {
+		var calls, notModified int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Cache-Control", "public, max-age=120")
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "foo", Use: "sig", Key: &gen.MustRSAKey().PublicKey}}}))
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy().(*DefaultJWKSFetcherStrategy)
+		s.now = func() time.Time { return now }
+
+		first, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		s.WaitForCache()
+
+		now = now.Add(time.Minute)
+		_, err = s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+		now = now.Add(2 * time.Minute)
+		second, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		assert.Same(t, first, second)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+		assert.EqualValues(t, 1, atomic.LoadInt32(&notModified))
+		assert.EqualValues(t, 1, s.Metrics().Revalidations)
+	})
+
+	t.Run("case=serves stale key sets while refreshing in the background", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kid := fmt.Sprintf("key-%d", atomic.AddInt32(&calls, 1))
+			w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=600")
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: kid, Use: "sig", Key: &gen.MustRSAKey().PublicKey}}}))
+		}))
+		defer ts.Close()
+
+		var mu sync.Mutex
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy().(*DefaultJWKSFetcherStrategy)
+		s.now = func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}
+
+		keys, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("key-1"), 1)
+		s.WaitForCache()
+
+		mu.Lock()
+		now = now.Add(2 * time.Minute)
+		mu.Unlock()
+
+		keys, err = s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("key-1"), 1)
+		assert.EqualValues(t, 1, s.Metrics().StaleHits)
+
+		assert.Eventually(t, func() bool {
+			keys, err := s.Resolve(ctx, ts.URL, false)
+			return err == nil && len(keys.Key("key-2")) == 1
+		}, time.Second*5, time.Millisecond*10)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=local key sets are not fetched by default", func(t *testing.T) {
+		ts := initServerWithKey(t)
+		defer ts.Close()
+
+		_, err := NewDefaultJWKSFetcherStrategy().Resolve(ctx, ts.URL, false)
+		assert.ErrorIs(t, err, ErrOutboundRequestDenied)
+	})
+
+	t.Run("case=does not cache no-store responses", func(t *testing.T) {
+		var calls int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Cache-Control", "no-store")
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{}))
+		}))
+		defer ts.Close()
+
+		s := newTestJWKSFetcherStrategy()
+		_, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		_, err = s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+	})
+
+	t.Run("case=revalidates no-cache responses on every use", func(t *testing.T) {
+		var calls, notModified int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Expires", "0")
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "foo", Use: "sig", Key: &gen.MustRSAKey().PublicKey}}}))
+		}))
+		defer ts.Close()
+
+		s := newTestJWKSFetcherStrategy().(*DefaultJWKSFetcherStrategy)
+		for i := 0; i < 3; i++ {
+			keys, err := s.Resolve(ctx, ts.URL, false)
+			require.NoError(t, err)
+			assert.Len(t, keys.Key("foo"), 1)
+			s.WaitForCache()
+		}
+		assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+		assert.EqualValues(t, 2, atomic.LoadInt32(&notModified))
+	})
+
+	t.Run("case=failed kid miss refreshes fall back to the cached key set", func(t *testing.T) {
+		var fail atomic.Bool
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(&jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "foo", Use: "sig", Key: &gen.MustRSAKey().PublicKey}}}))
+		}))
+		defer ts.Close()
+
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy(JWKSFetcherWithRefreshCoolDown(time.Minute)).(*DefaultJWKSFetcherStrategy)
+		s.client.RetryMax = 0
+		s.now = func() time.Time { return now }
+
+		_, err := s.Resolve(ctx, ts.URL, false)
+		require.NoError(t, err)
+		s.WaitForCache()
+
+		fail.Store(true)
+		now = now.Add(2 * time.Minute)
+		keys, err := s.ResolveKeyID(ctx, ts.URL, "unknown")
+		require.NoError(t, err)
+		assert.Len(t, keys.Key("foo"), 1)
+		assert.EqualValues(t, 1, s.Metrics().Errors)
+	})
+
+	t.Run("case=prunes idle locations", func(t *testing.T) {
+		now := time.Now()
+		s := newTestJWKSFetcherStrategy(JWKSFetcherWithRefreshCoolDown(time.Minute)).(*DefaultJWKSFetcherStrategy)
+		s.now = func() time.Time { return now }
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i := 0; i < minJWKSLocationsPruneAt-1; i++ {
+			s.location(fmt.Sprintf("https://idle-%d.example.com/jwks.json", i)).fetchedAt = now
+		}
+		s.location("https://refreshing.example.com/jwks.json").refreshing = true
+
+		now = now.Add(2 * time.Minute)
+		s.location("https://recent.example.com/jwks.json").fetchedAt = now
+		s.location("https://new.example.com/jwks.json")
+
+		assert.Len(t, s.locations, 3)
+		assert.Contains(t, s.locations, "https://refreshing.example.com/jwks.json")
+		assert.Contains(t, s.locations, "https://recent.example.com/jwks.json")
+		assert.Contains(t, s.locations, "https://new.example.com/jwks.json")
+	})
+
 	t.Run("case=error_network", func(t *testing.T) {
-		s := NewDefaultJWKSFetcherStrategy()
+		s := newTestJWKSFetcherStrategy()
 		h = func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(400)
 		}
@@ -165,7 +435,7 @@ func TestDefaultJWKSFetcherStrategy(t *testing.T) {
 	})
 
 	t.Run("case=error_encoding", func(t *testing.T) {
-		s := NewDefaultJWKSFetcherStrategy()
+		s := newTestJWKSFetcherStrategy()
 		h = func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte("[]"))
 		}
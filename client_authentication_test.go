@@ -78,7 +78,7 @@ func TestAuthenticateClient(t *testing.T) {
 	f := &Fosite{
 		Store: storage.NewMemoryStore(),
 		Config: &Config{
-			JWKSFetcherStrategy: NewDefaultJWKSFetcherStrategy(),
+			JWKSFetcherStrategy: NewDefaultJWKSFetcherStrategy(JWKSFetcherWithHTTPClient(retryablehttp.NewClient())),
 			ClientSecretsHasher: hasher,
 			TokenURL:            "token-url",
 			HTTPClient:          retryablehttp.NewClient(),
@@ -571,7 +571,7 @@ func TestAuthenticateClientTwice(t *testing.T) {
 	f := &Fosite{
 		Store: store,
 		Config: &Config{
-			JWKSFetcherStrategy: NewDefaultJWKSFetcherStrategy(),
+			JWKSFetcherStrategy: NewDefaultJWKSFetcherStrategy(JWKSFetcherWithHTTPClient(retryablehttp.NewClient())),
 			ClientSecretsHasher: hasher,
 			TokenURL:            "token-url",
 		},
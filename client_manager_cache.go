@@ -0,0 +1,216 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultClientCacheTTL             = time.Minute
+	defaultClientCacheNegativeTTL     = 5 * time.Second
+	defaultClientCacheMaxSize         = 10000
+	defaultClientCacheRefreshCoolDown = time.Second
+
+	// maxClientCacheCounters bounds the memory ristretto allocates to track the access frequency of client IDs.
+	maxClientCacheCounters = 1 << 24
+)
+
+var (
+	_ ClientManager   = (*CachedClientManager)(nil)
+	_ ClientRefresher = (*CachedClientManager)(nil)
+)
+
+// ClientRefresher is implemented by client managers which cache clients. Client authentication uses it to reload a
+// client whose cached secrets or keys fail to authenticate a request, so rotated secrets and keys take effect before
+// the cached client expires.
+type ClientRefresher interface {
+	// RefreshClient loads the client bypassing the cache.
+	RefreshClient(ctx context.Context, id string) (Client, error)
+}
+
+// ClientChangeNotifier is optionally implemented by the client manager wrapped by a CachedClientManager, for example
+// on top of database triggers or a message bus. The cache subscribes to it to evict changed clients immediately.
+type ClientChangeNotifier interface {
+	// NotifyClientChanges registers a function which must be called with the ID of every client which is changed or
+	// deleted.
+	NotifyClientChanges(notify func(clientID string))
+}
+
+// CachedClientManager is a ClientManager which caches the clients loaded from another ClientManager, including
+// the clients which do not exist. JTIs are not cached.
+//
+// Clients are cached until their TTL expires, Invalidate is called, or the wrapped manager reports a change through
+// ClientChangeNotifier. Because fosite loads clients from the Fosite.Store, a storage implementation uses the cache
+// by delegating its ClientManager methods to it:
+//
+//	type Store struct {
+//		*sqlstore.Store
+//		*fosite.CachedClientManager
+//	}
+//
+//	func (s *Store) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+//		return s.CachedClientManager.GetClient(ctx, id)
+//	}
+//
+// and likewise for ClientAssertionJWTValid and SetClientAssertionJWT. The embedded CachedClientManager also provides
+// ClientRefresher, which client authentication uses to pick up rotated secrets and keys.
+type CachedClientManager struct {
+	ClientManager
+
+	cache           *ristretto.Cache
+	ttl             time.Duration
+	negativeTTL     time.Duration
+	maxSize         int64
+	refreshCoolDown time.Duration
+	clock           Clock
+
+	// invalidations is incremented by every invalidation. Clients loaded while it changed are not cached, as they may
+	// have been loaded before the change.
+	invalidations atomic.Uint64
+}
+
+type clientCacheEntry struct {
+	client   Client
+	err      error
+	loadedAt time.Time
+}
+
+// NewCachedClientManager returns a cache of the clients of the manager.
+func NewCachedClientManager(manager ClientManager, opts ...func(*CachedClientManager)) *CachedClientManager {
+	c := &CachedClientManager{
+		ClientManager:   manager,
+		ttl:             defaultClientCacheTTL,
+		negativeTTL:     defaultClientCacheNegativeTTL,
+		maxSize:         defaultClientCacheMaxSize,
+		refreshCoolDown: defaultClientCacheRefreshCoolDown,
+		clock:           DefaultClock,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	if c.maxSize < 1 {
+		c.maxSize = 1
+	}
+	counters := int64(maxClientCacheCounters)
+	if c.maxSize < counters/10 {
+		counters = c.maxSize * 10
+	}
+
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: counters,
+		MaxCost:     c.maxSize,
+		BufferItems: 64,
+		Metrics:     false,
+		Cost: func(value interface{}) int64 {
+			return 1
+		},
+	})
+	if err != nil {
+		// unreachable, the configuration is valid for every size
+		panic(err)
+	}
+	c.cache = cache
+
+	if notifier, ok := manager.(ClientChangeNotifier); ok {
+		notifier.NotifyClientChanges(c.Invalidate)
+	}
+
+	return c
+}
+
+// ClientCacheWithTTL sets how long clients are cached. Defaults to one minute.
+func ClientCacheWithTTL(ttl time.Duration) func(*CachedClientManager) {
+	return func(c *CachedClientManager) {
+		c.ttl = ttl
+	}
+}
+
+// ClientCacheWithNegativeTTL sets how long unknown client IDs are cached. Zero disables caching unknown clients.
+// Defaults to five seconds.
+func ClientCacheWithNegativeTTL(ttl time.Duration) func(*CachedClientManager) {
+	return func(c *CachedClientManager) {
+		c.negativeTTL = ttl
+	}
+}
+
+// ClientCacheWithMaxSize sets the maximum number of cached client IDs. Sizes below one are treated as one. Defaults to
+// 10000.
+func ClientCacheWithMaxSize(size int64) func(*CachedClientManager) {
+	return func(c *CachedClientManager) {
+		c.maxSize = size
+	}
+}
+
+// ClientCacheWithRefreshCoolDown sets the time after loading a client during which RefreshClient returns the cached
+// client, which protects the wrapped manager from requests with invalid credentials. Defaults to one second.
+func ClientCacheWithRefreshCoolDown(coolDown time.Duration) func(*CachedClientManager) {
+	return func(c *CachedClientManager) {
+		c.refreshCoolDown = coolDown
+	}
+}
+
+// ClientCacheWithClock sets the clock used for the refresh cool-down. The cache TTLs always use the wall clock.
+// Defaults to DefaultClock.
+func ClientCacheWithClock(clock Clock) func(*CachedClientManager) {
+	return func(c *CachedClientManager) {
+		c.clock = clock
+	}
+}
+
+// GetClient returns the cached client, or loads it from the wrapped manager.
+func (c *CachedClientManager) GetClient(ctx context.Context, id string) (Client, error) {
+	if v, ok := c.cache.Get(id); ok {
+		e := v.(*clientCacheEntry)
+		return e.client, e.err
+	}
+	return c.load(ctx, id)
+}
+
+// RefreshClient loads the client from the wrapped manager and caches it. It returns the cached client instead if
+// the client was loaded within the refresh cool-down.
+func (c *CachedClientManager) RefreshClient(ctx context.Context, id string) (Client, error) {
+	if v, ok := c.cache.Get(id); ok {
+		if e := v.(*clientCacheEntry); c.clock.Now().Sub(e.loadedAt) < c.refreshCoolDown {
+			return e.client, e.err
+		}
+	}
+	return c.load(ctx, id)
+}
+
+// Invalidate removes the client from the cache, so it is loaded from the wrapped manager the next time it is
+// requested.
+func (c *CachedClientManager) Invalidate(clientID string) {
+	c.invalidations.Add(1)
+	c.cache.Del(clientID)
+}
+
+func (c *CachedClientManager) load(ctx context.Context, id string) (Client, error) {
+	invalidations := c.invalidations.Load()
+	client, err := c.ClientManager.GetClient(ctx, id)
+
+	ttl := c.ttl
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			// do not cache transient errors
+			return nil, err
+		}
+		ttl = c.negativeTTL
+	}
+
+	if ttl > 0 && c.invalidations.Load() == invalidations {
+		c.cache.SetWithTTL(id, &clientCacheEntry{client: client, err: err, loadedAt: c.clock.Now()}, 1, ttl)
+		if c.invalidations.Load() != invalidations {
+			// an invalidation raced with storing the client
+			c.cache.Del(id)
+		}
+	}
+	return client, err
+}
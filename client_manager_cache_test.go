@@ -0,0 +1,387 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/token/jwt"
+)
+
+type countingClientManager struct {
+	sync.Mutex
+	clients map[string]Client
+	err     error
+	calls   int
+}
+
+func newCountingClientManager(clients ...Client) *countingClientManager {
+	m := &countingClientManager{clients: make(map[string]Client)}
+	for _, c := range clients {
+		m.clients[c.GetID()] = c
+	}
+	return m
+}
+
+func (m *countingClientManager) GetClient(_ context.Context, id string) (Client, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	c, ok := m.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *countingClientManager) ClientAssertionJWTValid(context.Context, string) error {
+	return nil
+}
+
+func (m *countingClientManager) SetClientAssertionJWT(context.Context, string, time.Time) error {
+	return nil
+}
+
+func (m *countingClientManager) set(c Client) {
+	m.Lock()
+	defer m.Unlock()
+	m.clients[c.GetID()] = c
+}
+
+func (m *countingClientManager) count() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.calls
+}
+
+type notifyingClientManager struct {
+	*countingClientManager
+	notify func(clientID string)
+}
+
+func (m *notifyingClientManager) NotifyClientChanges(notify func(clientID string)) {
+	m.notify = notify
+}
+
+// getClient calls GetClient and waits until the loaded client is cached.
+func (c *CachedClientManager) getClient(ctx context.Context, id string) (Client, error) {
+	client, err := c.GetClient(ctx, id)
+	c.cache.Wait()
+	return client, err
+}
+
+func TestCachedClientManager(t *testing.T) {
+	ctx := context.Background()
+	foo := &DefaultClient{ID: "foo"}
+
+	t.Run("case=caches clients", func(t *testing.T) {
+		m := newCountingClientManager(foo)
+		c := NewCachedClientManager(m)
+
+		for i := 0; i < 3; i++ {
+			client, err := c.getClient(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, foo, client)
+		}
+		assert.Equal(t, 1, m.count())
+	})
+
+	t.Run("case=caches unknown clients", func(t *testing.T) {
+		m := newCountingClientManager()
+		c := NewCachedClientManager(m)
+
+		for i := 0; i < 3; i++ {
+			_, err := c.getClient(ctx, "foo")
+			assert.ErrorIs(t, err, ErrNotFound)
+		}
+		assert.Equal(t, 1, m.count())
+
+		c = NewCachedClientManager(m, ClientCacheWithNegativeTTL(0))
+		for i := 0; i < 3; i++ {
+			_, err := c.getClient(ctx, "foo")
+			assert.ErrorIs(t, err, ErrNotFound)
+		}
+		assert.Equal(t, 4, m.count(), "unknown clients are not cached if the negative ttl is zero")
+	})
+
+	t.Run("case=does not cache other errors", func(t *testing.T) {
+		m := newCountingClientManager(foo)
+		m.err = errors.New("connection refused")
+		c := NewCachedClientManager(m)
+
+		_, err := c.getClient(ctx, "foo")
+		assert.ErrorIs(t, err, m.err)
+
+		m.err = nil
+		client, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, foo, client)
+		assert.Equal(t, 2, m.count())
+	})
+
+	t.Run("case=expires clients", func(t *testing.T) {
+		m := newCountingClientManager(foo)
+		c := NewCachedClientManager(m, ClientCacheWithTTL(50*time.Millisecond))
+
+		_, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		_, err = c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, 1, m.count())
+
+		time.Sleep(100 * time.Millisecond)
+		_, err = c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, 2, m.count())
+	})
+
+	t.Run("case=invalidate", func(t *testing.T) {
+		m := newCountingClientManager(foo)
+		c := NewCachedClientManager(m)
+
+		_, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+
+		updated := &DefaultClient{ID: "foo", Scopes: []string{"offline"}}
+		m.set(updated)
+		c.Invalidate("foo")
+
+		client, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, updated, client)
+		assert.Equal(t, 2, m.count())
+	})
+
+	t.Run("case=change notifications", func(t *testing.T) {
+		m := &notifyingClientManager{countingClientManager: newCountingClientManager(foo)}
+		c := NewCachedClientManager(m)
+		require.NotNil(t, m.notify, "the cache subscribes to changes")
+
+		_, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+
+		updated := &DefaultClient{ID: "foo", Scopes: []string{"offline"}}
+		m.set(updated)
+		m.notify("foo")
+
+		client, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, updated, client)
+	})
+
+	t.Run("case=refresh", func(t *testing.T) {
+		now := time.Now()
+		m := newCountingClientManager(foo)
+		c := NewCachedClientManager(m, ClientCacheWithClock(ClockFunc(func() time.Time { return now })))
+
+		_, err := c.getClient(ctx, "foo")
+		require.NoError(t, err)
+
+		updated := &DefaultClient{ID: "foo", Scopes: []string{"offline"}}
+		m.set(updated)
+
+		client, err := c.RefreshClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, foo, client, "the client was loaded within the cool-down")
+		assert.Equal(t, 1, m.count())
+
+		now = now.Add(time.Second)
+		client, err = c.RefreshClient(ctx, "foo")
+		c.cache.Wait()
+		require.NoError(t, err)
+		assert.Equal(t, updated, client)
+		assert.Equal(t, 2, m.count())
+
+		client, err = c.getClient(ctx, "foo")
+		require.NoError(t, err)
+		assert.Equal(t, updated, client, "the refreshed client is cached")
+		assert.Equal(t, 2, m.count())
+	})
+
+	t.Run("case=max size", func(t *testing.T) {
+		m := newCountingClientManager()
+		for i := 0; i < 100; i++ {
+			m.set(&DefaultClient{ID: fmt.Sprintf("client-%d", i)})
+		}
+		c := NewCachedClientManager(m, ClientCacheWithMaxSize(10))
+
+		for i := 0; i < 100; i++ {
+			_, err := c.getClient(ctx, fmt.Sprintf("client-%d", i))
+			require.NoError(t, err)
+		}
+
+		var cached int
+		for i := 0; i < 100; i++ {
+			if _, ok := c.cache.Get(fmt.Sprintf("client-%d", i)); ok {
+				cached++
+			}
+		}
+		assert.LessOrEqual(t, cached, 10)
+	})
+
+	t.Run("case=invalid max size", func(t *testing.T) {
+		for _, size := range []int64{0, -1, math.MaxInt64} {
+			m := newCountingClientManager(foo)
+			var c *CachedClientManager
+			require.NotPanics(t, func() { c = NewCachedClientManager(m, ClientCacheWithMaxSize(size)) }, "size %d", size)
+
+			client, err := c.getClient(ctx, "foo")
+			require.NoError(t, err)
+			assert.Equal(t, foo, client)
+		}
+	})
+}
+
+func TestAuthenticateClient_CachedClientManager(t *testing.T) {
+	ctx := context.Background()
+	hasher := &BCrypt{Config: &Config{HashCost: 6}}
+	newFosite := func(store Storage) *Fosite {
+		return &Fosite{
+			Store: store,
+			Config: &Config{
+				JWKSFetcherStrategy: newTestJWKSFetcherStrategy(),
+				ClientSecretsHasher: hasher,
+				TokenURL:            "token-url",
+			},
+		}
+	}
+
+	t.Run("case=rotated secret", func(t *testing.T) {
+		oldSecret, err := hasher.Hash(ctx, []byte("old"))
+		require.NoError(t, err)
+		newSecret, err := hasher.Hash(ctx, []byte("new"))
+		require.NoError(t, err)
+
+		m := newCountingClientManager(&DefaultClient{ID: "foo", Secret: oldSecret})
+		c := NewCachedClientManager(m, ClientCacheWithRefreshCoolDown(0))
+		f := newFosite(c)
+
+		form := func(secret string) url.Values {
+			return url.Values{"client_id": {"foo"}, "client_secret": {secret}}
+		}
+
+		_, err = f.AuthenticateClient(ctx, new(http.Request), form("old"))
+		require.NoError(t, err)
+		c.cache.Wait()
+
+		rotated := &DefaultClient{ID: "foo", Secret: newSecret, RotatedSecrets: [][]byte{oldSecret}}
+		m.set(rotated)
+
+		client, err := f.AuthenticateClient(ctx, new(http.Request), form("new"))
+		require.NoError(t, err)
+		assert.Equal(t, rotated, client)
+		c.cache.Wait()
+
+		_, err = f.AuthenticateClient(ctx, new(http.Request), form("old"))
+		require.NoError(t, err, "the rotated secret remains valid")
+
+		calls := m.count()
+		_, err = f.AuthenticateClient(ctx, new(http.Request), form("invalid"))
+		assert.ErrorIs(t, err, ErrInvalidClient)
+		assert.Equal(t, calls+1, m.count(), "invalid secrets are checked against the reloaded client")
+
+		t.Run("case=cool-down", func(t *testing.T) {
+			m := newCountingClientManager(&DefaultClient{ID: "foo", Secret: oldSecret})
+			c := NewCachedClientManager(m)
+			f := newFosite(c)
+
+			_, err := f.AuthenticateClient(ctx, new(http.Request), form("old"))
+			require.NoError(t, err)
+			c.cache.Wait()
+			m.set(rotated)
+
+			_, err = f.AuthenticateClient(ctx, new(http.Request), form("new"))
+			assert.ErrorIs(t, err, ErrInvalidClient, "the client is not reloaded within the cool-down")
+		})
+	})
+
+	t.Run("case=rotated keys", func(t *testing.T) {
+		jwks := func(key *jose.JSONWebKey) *DefaultOpenIDConnectClient {
+			return &DefaultOpenIDConnectClient{
+				DefaultClient:           &DefaultClient{ID: "foo"},
+				JSONWebKeys:             &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*key}},
+				TokenEndpointAuthMethod: "private_key_jwt",
+			}
+		}
+		assertion := func(key *jose.JSONWebKey) url.Values {
+			token := jwt.NewWithClaims(jose.RS256, jwt.MapClaims{
+				"sub": "foo",
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"iss": "foo",
+				"jti": "12345",
+				"aud": "token-url",
+			})
+			token.Header["kid"] = key.KeyID
+			assertion, err := token.SignedString(key.Key)
+			require.NoError(t, err)
+			return url.Values{"client_assertion": {assertion}, "client_assertion_type": {clientAssertionJWTBearerType}}
+		}
+
+		oldKey, newKey := gen.MustRSAKey(), gen.MustRSAKey()
+		oldPrivate := &jose.JSONWebKey{KeyID: "old", Use: "sig", Key: oldKey}
+		newPrivate := &jose.JSONWebKey{KeyID: "new", Use: "sig", Key: newKey}
+		oldPublic := &jose.JSONWebKey{KeyID: "old", Use: "sig", Key: &oldKey.PublicKey}
+		newPublic := &jose.JSONWebKey{KeyID: "new", Use: "sig", Key: &newKey.PublicKey}
+
+		m := newCountingClientManager(jwks(oldPublic))
+		c := NewCachedClientManager(m, ClientCacheWithRefreshCoolDown(0))
+		f := newFosite(c)
+
+		_, err := f.AuthenticateClient(ctx, new(http.Request), assertion(oldPrivate))
+		require.NoError(t, err)
+		c.cache.Wait()
+
+		rotated := jwks(newPublic)
+		m.set(rotated)
+
+		client, err := f.AuthenticateClient(ctx, new(http.Request), assertion(newPrivate))
+		require.NoError(t, err)
+		assert.Equal(t, rotated, client)
+		c.cache.Wait()
+
+		_, err = f.AuthenticateClient(ctx, new(http.Request), assertion(oldPrivate))
+		assert.ErrorIs(t, err, ErrInvalidRequest, "the removed key is no longer accepted")
+
+		t.Run("case=the refreshed client is checked", func(t *testing.T) {
+			for name, change := range map[string]func(*DefaultOpenIDConnectClient){
+				"auth method":       func(c *DefaultOpenIDConnectClient) { c.TokenEndpointAuthMethod = "client_secret_basic" },
+				"signing algorithm": func(c *DefaultOpenIDConnectClient) { c.TokenEndpointAuthSigningAlgorithm = "ES256" },
+			} {
+				t.Run("changed="+name, func(t *testing.T) {
+					m := newCountingClientManager(jwks(oldPublic))
+					c := NewCachedClientManager(m, ClientCacheWithRefreshCoolDown(0))
+					f := newFosite(c)
+
+					_, err := f.AuthenticateClient(ctx, new(http.Request), assertion(oldPrivate))
+					require.NoError(t, err)
+					c.cache.Wait()
+
+					changed := jwks(newPublic)
+					change(changed)
+					m.set(changed)
+
+					_, err = f.AuthenticateClient(ctx, new(http.Request), assertion(newPrivate))
+					assert.ErrorIs(t, err, ErrInvalidClient)
+				})
+			}
+		})
+	})
+}
@@ -0,0 +1,32 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import "time"
+
+// Clock tells the current time. Fosite uses it for every expiry and issuance computation, which allows
+// replacing the system clock, for example in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// ClockFunc is an adapter which allows the use of ordinary functions, for example time.Now, as Clock.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// DefaultClock is the system clock.
+var DefaultClock Clock = ClockFunc(time.Now)
+
+// FixedClock is a Clock which always returns the same time. It is useful for deterministic tests.
+type FixedClock time.Time
+
+// Now returns the fixed time.
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
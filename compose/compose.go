@@ -69,7 +69,7 @@ func ComposeAllEnabled(config *fosite.Config, storage interface{}, key interface
 		&CommonStrategy{
 			CoreStrategy:               NewOAuth2HMACStrategy(config),
 			OpenIDConnectTokenStrategy: NewOpenIDConnectStrategy(keyGetter, config),
-			Signer:                     &jwt.DefaultSigner{GetPrivateKey: keyGetter},
+			Signer:                     &jwt.DefaultSigner{GetPrivateKey: keyGetter, GetParserOptions: jwtParserOptions(config)},
 		},
 		OAuth2AuthorizeExplicitFactory,
 		OAuth2AuthorizeImplicitFactory,
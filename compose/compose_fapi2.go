@@ -0,0 +1,80 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package compose
+
+import (
+	"context"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/fapi2"
+	"github.com/ory/fosite/token/jwt"
+)
+
+// ComposeFAPI2 returns a fosite instance which complies with the FAPI 2.0 Security Profile. It enables the authorization
+// code, refresh token and client credentials grants, OpenID Connect, PKCE, pushed authorization requests, token
+// introspection and revocation, and enforces:
+//
+//   - pushed authorization requests,
+//   - PKCE using the S256 challenge method,
+//   - private_key_jwt or mutual TLS client authentication,
+//   - the "iss" authorization response parameter (RFC 9207), and
+//   - sender-constrained access tokens using the given verifier for DPoP or mutual TLS.
+//
+// The config is modified accordingly. ComposeFAPI2 returns an error instead of a provider if the resulting
+// configuration does not comply with the profile, for example because the authorization code lifespan is too long.
+func ComposeFAPI2(config *fosite.Config, storage interface{}, key interface{}, verifier fapi2.SenderConstraintVerifier) (fosite.OAuth2Provider, error) {
+	config.IsPushedAuthorizeEnforced = true
+	config.EnforcePKCE = true
+	config.EnablePKCEPlainChallengeMethod = false
+	if config.AuthorizeCodeLifespan == 0 {
+		config.AuthorizeCodeLifespan = fapi2.MaxAuthorizeCodeLifespan
+	}
+	if config.PushedAuthorizeContextLifespan == 0 {
+		config.PushedAuthorizeContextLifespan = fapi2.MaxPushedAuthorizeContextLifespan
+	}
+
+	keyGetter := func(context.Context) (interface{}, error) {
+		return key, nil
+	}
+	handler := &fapi2.Handler{
+		SenderConstraintVerifier: verifier,
+		Config:                   config,
+	}
+
+	provider := Compose(
+		config,
+		storage,
+		&CommonStrategy{
+			CoreStrategy:               NewOAuth2HMACStrategy(config),
+			OpenIDConnectTokenStrategy: NewOpenIDConnectStrategy(keyGetter, config),
+			Signer:                     &jwt.DefaultSigner{GetPrivateKey: keyGetter, GetParserOptions: jwtParserOptions(config)},
+		},
+		OAuth2AuthorizeExplicitFactory,
+		OAuth2ClientCredentialsGrantFactory,
+		OAuth2RefreshTokenGrantFactory,
+
+		OpenIDConnectExplicitFactory,
+		OpenIDConnectRefreshFactory,
+
+		OAuth2TokenIntrospectionFactory,
+		OAuth2TokenRevocationFactory,
+
+		OAuth2PKCEFactory,
+		PushedAuthorizeHandlerFactory,
+	)
+
+	// The FAPI 2.0 handler rejects non-compliant authorization requests before any other handler stores them, and
+	// binds access tokens after the other token endpoint handlers loaded the session.
+	config.AuthorizeEndpointHandlers = append(fosite.AuthorizeEndpointHandlers{handler}, config.AuthorizeEndpointHandlers...)
+	config.PushedAuthorizeEndpointHandlers = append(fosite.PushedAuthorizeEndpointHandlers{handler}, config.PushedAuthorizeEndpointHandlers...)
+	config.TokenEndpointHandlers.Append(handler)
+	for i, introspector := range config.TokenIntrospectionHandlers {
+		config.TokenIntrospectionHandlers[i] = &fapi2.SenderConstrainedIntrospector{TokenIntrospector: introspector}
+	}
+
+	if err := fapi2.ValidateConfig(context.Background(), config); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
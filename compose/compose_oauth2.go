@@ -7,6 +7,7 @@ import (
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/handler/oauth2"
 	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/fosite/token/paseto"
 )
 
 // OAuth2AuthorizeExplicitFactory creates an OAuth2 authorize code grant ("authorize explicit flow") handler and registers
@@ -77,11 +78,15 @@ func OAuth2ResourceOwnerPasswordCredentialsFactory(config fosite.Configurator, s
 
 // OAuth2TokenRevocationFactory creates an OAuth2 token revocation handler.
 func OAuth2TokenRevocationFactory(config fosite.Configurator, storage interface{}, strategy interface{}) interface{} {
-	return &oauth2.TokenRevocationHandler{
+	handler := &oauth2.TokenRevocationHandler{
 		TokenRevocationStorage: storage.(oauth2.TokenRevocationStorage),
 		AccessTokenStrategy:    strategy.(oauth2.AccessTokenStrategy),
 		RefreshTokenStrategy:   strategy.(oauth2.RefreshTokenStrategy),
 	}
+	if s, ok := storage.(oauth2.JWTRevocationStorage); ok {
+		handler.JWTRevocationStorage = s
+	}
+	return handler
 }
 
 // OAuth2TokenIntrospectionFactory creates an OAuth2 token introspection handler and registers
@@ -94,16 +99,52 @@ func OAuth2TokenIntrospectionFactory(config fosite.Configurator, storage interfa
 	}
 }
 
+// OAuth2PhantomTokenFactories returns replacements for OAuth2TokenIntrospectionFactory and
+// OAuth2TokenRevocationFactory which issue phantom tokens signed by the given signer to resource servers asking for
+// them, see fosite.PhantomTokenIssuer. Both handlers share a cache, so revoked tokens lose their phantom tokens.
+func OAuth2PhantomTokenFactories(signer jwt.Signer) (introspection Factory, revocation Factory) {
+	cache := oauth2.NewPhantomTokenCache()
+	introspection = func(config fosite.Configurator, storage interface{}, strategy interface{}) interface{} {
+		validator := OAuth2TokenIntrospectionFactory(config, storage, strategy).(*oauth2.CoreValidator)
+		validator.PhantomTokenSigner = signer
+		validator.PhantomTokenCache = cache
+		return validator
+	}
+	revocation = func(config fosite.Configurator, storage interface{}, strategy interface{}) interface{} {
+		handler := OAuth2TokenRevocationFactory(config, storage, strategy).(*oauth2.TokenRevocationHandler)
+		handler.PhantomTokenCache = cache
+		return handler
+	}
+	return introspection, revocation
+}
+
 // OAuth2StatelessJWTIntrospectionFactory creates an OAuth2 token introspection handler and
 // registers an access token validator. This can only be used to validate JWTs and does so
 // statelessly, meaning it uses only the data available in the JWT itself, and does not access the
 // storage implementation at all.
 //
-// Due to the stateless nature of this factory, THE BUILT-IN REVOCATION MECHANISMS WILL NOT WORK.
-// If you need revocation, you can validate JWTs statefully, using the other factories.
+// Due to the stateless nature of this factory, THE BUILT-IN REVOCATION MECHANISMS WILL NOT WORK,
+// unless the storage implements oauth2.JWTRevocationStorage. In that case revoked access tokens are
+// rejected using the jti deny-list, which is a single lookup by token id.
 func OAuth2StatelessJWTIntrospectionFactory(config fosite.Configurator, storage interface{}, strategy interface{}) interface{} {
-	return &oauth2.StatelessJWTValidator{
+	validator := &oauth2.StatelessJWTValidator{
 		Signer: strategy.(jwt.Signer),
 		Config: config,
 	}
+	if s, ok := storage.(oauth2.JWTRevocationStorage); ok {
+		validator.JWTRevocationStorage = s
+	}
+	return validator
+}
+
+// OAuth2StatelessPASETOIntrospectionFactory returns a factory which creates a token introspection handler for the
+// encrypted access tokens issued by NewOAuth2PASETOStrategy. Like OAuth2StatelessJWTIntrospectionFactory, it does not
+// access the storage, so THE BUILT-IN REVOCATION MECHANISMS WILL NOT WORK unless the handler's Storage is set.
+func OAuth2StatelessPASETOIntrospectionFactory(keys paseto.GetKeysFunc) Factory {
+	return func(config fosite.Configurator, storage interface{}, strategy interface{}) interface{} {
+		return &oauth2.StatelessPASETOValidator{
+			Encrypter: &paseto.LocalEncrypter{GetKeys: keys},
+			Config:    config,
+		}
+	}
 }
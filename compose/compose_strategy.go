@@ -11,6 +11,7 @@ import (
 	"github.com/ory/fosite/handler/openid"
 	"github.com/ory/fosite/token/hmac"
 	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/fosite/token/paseto"
 )
 
 type CommonStrategy struct {
@@ -27,15 +28,33 @@ type HMACSHAStrategyConfigurator interface {
 	fosite.GlobalSecretProvider
 	fosite.RotatedGlobalSecretsProvider
 	fosite.HMACHashingProvider
+	fosite.HMACKeysProvider
+	fosite.ClockProvider
 }
 
 func NewOAuth2HMACStrategy(config HMACSHAStrategyConfigurator) *oauth2.HMACSHAStrategy {
 	return oauth2.NewHMACSHAStrategy(&hmac.HMACStrategy{Config: config}, config)
 }
 
+// NewOAuth2HMACStrategyChecksummed returns a HMAC strategy whose tokens carry the given prefix and a checksum, which
+// allows secret scanners to detect leaked tokens.
+func NewOAuth2HMACStrategyChecksummed(config HMACSHAStrategyConfigurator, prefix string) *oauth2.HMACSHAStrategyChecksummed {
+	return oauth2.NewHMACSHAStrategyChecksummed(&hmac.HMACStrategy{Config: config}, config, prefix)
+}
+
 func NewOAuth2JWTStrategy(keyGetter func(context.Context) (interface{}, error), strategy oauth2.CoreStrategy, config fosite.Configurator) *oauth2.DefaultJWTStrategy {
 	return &oauth2.DefaultJWTStrategy{
-		Signer:          &jwt.DefaultSigner{GetPrivateKey: keyGetter},
+		Signer:          &jwt.DefaultSigner{GetPrivateKey: keyGetter, GetParserOptions: jwtParserOptions(config)},
+		HMACSHAStrategy: strategy,
+		Config:          config,
+	}
+}
+
+// NewOAuth2PASETOStrategy returns a strategy which issues encrypted PASETO v4.local access and refresh tokens. The
+// first key returned by keys encrypts new tokens.
+func NewOAuth2PASETOStrategy(keys paseto.GetKeysFunc, strategy oauth2.CoreStrategy, config fosite.Configurator) *oauth2.DefaultPASETOStrategy {
+	return &oauth2.DefaultPASETOStrategy{
+		Encrypter:       &paseto.LocalEncrypter{GetKeys: keys},
 		HMACSHAStrategy: strategy,
 		Config:          config,
 	}
@@ -43,7 +62,17 @@ func NewOAuth2JWTStrategy(keyGetter func(context.Context) (interface{}, error),
 
 func NewOpenIDConnectStrategy(keyGetter func(context.Context) (interface{}, error), config fosite.Configurator) *openid.DefaultStrategy {
 	return &openid.DefaultStrategy{
-		Signer: &jwt.DefaultSigner{GetPrivateKey: keyGetter},
+		Signer: &jwt.DefaultSigner{GetPrivateKey: keyGetter, GetParserOptions: jwtParserOptions(config)},
 		Config: config,
 	}
 }
+
+// jwtParserOptions validates time based claims with the configured clock and leeway.
+func jwtParserOptions(config fosite.Configurator) func(ctx context.Context) []jwt.ParserOption {
+	return func(ctx context.Context) []jwt.ParserOption {
+		return []jwt.ParserOption{
+			jwt.WithTimeFunc(config.GetClock(ctx).Now),
+			jwt.WithLeeway(config.GetJWTLeeway(ctx)),
+		}
+	}
+}
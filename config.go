@@ -34,6 +34,12 @@ type AccessTokenLifespanProvider interface {
 	GetAccessTokenLifespan(ctx context.Context) time.Duration
 }
 
+// PhantomTokenLifespanProvider returns the provider for configuring the phantom token lifespan.
+type PhantomTokenLifespanProvider interface {
+	// GetPhantomTokenLifespan returns the phantom token lifespan.
+	GetPhantomTokenLifespan(ctx context.Context) time.Duration
+}
+
 // VerifiableCredentialsNonceLifespanProvider returns the provider for configuring the access token lifespan.
 type VerifiableCredentialsNonceLifespanProvider interface {
 	// GetNonceLifespan returns the nonce lifespan.
@@ -144,6 +150,12 @@ type EnforcePKCEForPublicClientsProvider interface {
 	GetEnforcePKCEForPublicClients(ctx context.Context) bool
 }
 
+// EnforceOAuth21Provider returns the provider for configuring the OAuth 2.1 compliance mode.
+type EnforceOAuth21Provider interface {
+	// GetEnforceOAuth21 returns true if the authorization server must comply with OAuth 2.1.
+	GetEnforceOAuth21(ctx context.Context) bool
+}
+
 // EnablePKCEPlainChallengeMethodProvider returns the provider for configuring the enable PKCE plain challenge method.
 type EnablePKCEPlainChallengeMethodProvider interface {
 	// GetEnablePKCEPlainChallengeMethod returns the enable PKCE plain challenge method.
@@ -192,6 +204,12 @@ type RotatedGlobalSecretsProvider interface {
 	GetRotatedGlobalSecrets(ctx context.Context) ([][]byte, error)
 }
 
+// HMACKeysProvider returns the provider for configuring key-identified HMAC secrets.
+type HMACKeysProvider interface {
+	// GetHMACKeys returns the keys used to generate and validate key-identified HMAC tokens.
+	GetHMACKeys(ctx context.Context) ([]HMACKey, error)
+}
+
 // HMACHashingProvider returns the provider for configuring the hash function.
 type HMACHashingProvider interface {
 	// GetHMACHasher returns the hash function.
@@ -222,6 +240,50 @@ type HTTPClientProvider interface {
 	GetHTTPClient(ctx context.Context) *retryablehttp.Client
 }
 
+// ClockProvider returns the provider for configuring the clock.
+type ClockProvider interface {
+	// GetClock returns the clock used for expiry and issuance computations.
+	GetClock(ctx context.Context) Clock
+}
+
+// SubjectIdentifierStrategyProvider returns the provider for configuring the subject identifier strategy.
+type SubjectIdentifierStrategyProvider interface {
+	// GetSubjectIdentifierStrategy returns the strategy which derives the subject identifiers presented to clients.
+	GetSubjectIdentifierStrategy(ctx context.Context) SubjectIdentifierStrategy
+}
+
+// PairwiseSubjectSaltProvider returns the provider for configuring the pairwise subject salt.
+type PairwiseSubjectSaltProvider interface {
+	// GetPairwiseSubjectSalt returns the secret salt used to calculate pairwise subject identifiers.
+	GetPairwiseSubjectSalt(ctx context.Context) []byte
+}
+
+// RedirectURIPolicyProvider returns the provider for configuring the redirect URI policy.
+type RedirectURIPolicyProvider interface {
+	// GetRedirectURIPolicy returns the policy used to match and validate the redirect URIs of the given client.
+	GetRedirectURIPolicy(ctx context.Context, client Client) RedirectURIPolicy
+}
+
+// LockerProvider returns the provider for configuring the locker.
+type LockerProvider interface {
+	// GetLocker returns the locker which serializes the redemption of authorize codes, refresh tokens and pushed
+	// authorization request URIs.
+	GetLocker(ctx context.Context) Locker
+}
+
+// JWTLeewayProvider returns the provider for configuring the clock skew leeway of JSON Web Tokens.
+type JWTLeewayProvider interface {
+	// GetJWTLeeway returns the clock skew which is tolerated when validating the iat, nbf and exp claims
+	// of JSON Web Tokens.
+	GetJWTLeeway(ctx context.Context) time.Duration
+}
+
+// OutboundHTTPPolicyProvider returns the provider for configuring the outbound HTTP policy.
+type OutboundHTTPPolicyProvider interface {
+	// GetOutboundHTTPPolicy returns the outbound HTTP policy or nil if outbound requests are not restricted.
+	GetOutboundHTTPPolicy(ctx context.Context) *OutboundHTTPPolicy
+}
+
 // ClientAuthenticationStrategyProvider returns the provider for configuring the client authentication strategy.
 type ClientAuthenticationStrategyProvider interface {
 	// GetClientAuthenticationStrategy returns the client authentication strategy.
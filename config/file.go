@@ -0,0 +1,362 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package config loads fosite.Config from YAML or JSON files and environment variables, validates it, and reloads
+// it when the file changes.
+//
+// A configuration file looks like this:
+//
+//	id_token_issuer: https://auth.example.com
+//	global_secret: env:FOSITE_GLOBAL_SECRET
+//	access_token_lifespan: 30m
+//	refresh_token_lifespan: 720h
+//	enforce_pkce: true
+//
+// Every option can be overridden using an environment variable named after the option, for example
+// FOSITE_ACCESS_TOKEN_LIFESPAN if the prefix is "FOSITE_". Options which are not set keep the value of the base
+// configuration.
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ory/fosite"
+)
+
+// File is the declarative representation of fosite.Config. Nil values are not set.
+type File struct {
+	IDTokenIssuer     *string `json:"id_token_issuer,omitempty" yaml:"id_token_issuer,omitempty"`
+	AccessTokenIssuer *string `json:"access_token_issuer,omitempty" yaml:"access_token_issuer,omitempty"`
+	TokenURL          *string `json:"token_url,omitempty" yaml:"token_url,omitempty"`
+
+	GlobalSecret         Secret   `json:"global_secret,omitempty" yaml:"global_secret,omitempty"`
+	RotatedGlobalSecrets []Secret `json:"rotated_global_secrets,omitempty" yaml:"rotated_global_secrets,omitempty"`
+	PairwiseSubjectSalt  Secret   `json:"pairwise_subject_salt,omitempty" yaml:"pairwise_subject_salt,omitempty"`
+
+	AccessTokenLifespan                *Duration `json:"access_token_lifespan,omitempty" yaml:"access_token_lifespan,omitempty"`
+	RefreshTokenLifespan               *Duration `json:"refresh_token_lifespan,omitempty" yaml:"refresh_token_lifespan,omitempty"`
+	AuthorizeCodeLifespan              *Duration `json:"authorize_code_lifespan,omitempty" yaml:"authorize_code_lifespan,omitempty"`
+	IDTokenLifespan                    *Duration `json:"id_token_lifespan,omitempty" yaml:"id_token_lifespan,omitempty"`
+	VerifiableCredentialsNonceLifespan *Duration `json:"verifiable_credentials_nonce_lifespan,omitempty" yaml:"verifiable_credentials_nonce_lifespan,omitempty"`
+	PushedAuthorizeContextLifespan     *Duration `json:"pushed_authorize_context_lifespan,omitempty" yaml:"pushed_authorize_context_lifespan,omitempty"`
+	PhantomTokenLifespan               *Duration `json:"phantom_token_lifespan,omitempty" yaml:"phantom_token_lifespan,omitempty"`
+	JWTLeeway                          *Duration `json:"jwt_leeway,omitempty" yaml:"jwt_leeway,omitempty"`
+	GrantTypeJWTBearerMaxDuration      *Duration `json:"grant_type_jwt_bearer_max_duration,omitempty" yaml:"grant_type_jwt_bearer_max_duration,omitempty"`
+
+	HashCost            *int `json:"hash_cost,omitempty" yaml:"hash_cost,omitempty"`
+	TokenEntropy        *int `json:"token_entropy,omitempty" yaml:"token_entropy,omitempty"`
+	MinParameterEntropy *int `json:"min_parameter_entropy,omitempty" yaml:"min_parameter_entropy,omitempty"`
+
+	EnforcePKCE                    *bool `json:"enforce_pkce,omitempty" yaml:"enforce_pkce,omitempty"`
+	EnforcePKCEForPublicClients    *bool `json:"enforce_pkce_for_public_clients,omitempty" yaml:"enforce_pkce_for_public_clients,omitempty"`
+	EnablePKCEPlainChallengeMethod *bool `json:"enable_pkce_plain_challenge_method,omitempty" yaml:"enable_pkce_plain_challenge_method,omitempty"`
+	EnforceOAuth21                 *bool `json:"enforce_oauth21,omitempty" yaml:"enforce_oauth21,omitempty"`
+
+	EnforcePushedAuthorize          *bool   `json:"enforce_pushed_authorize,omitempty" yaml:"enforce_pushed_authorize,omitempty"`
+	PushedAuthorizeRequestURIPrefix *string `json:"pushed_authorize_request_uri_prefix,omitempty" yaml:"pushed_authorize_request_uri_prefix,omitempty"`
+
+	GrantTypeJWTBearerCanSkipClientAuth  *bool `json:"grant_type_jwt_bearer_can_skip_client_auth,omitempty" yaml:"grant_type_jwt_bearer_can_skip_client_auth,omitempty"`
+	GrantTypeJWTBearerIDOptional         *bool `json:"grant_type_jwt_bearer_id_optional,omitempty" yaml:"grant_type_jwt_bearer_id_optional,omitempty"`
+	GrantTypeJWTBearerIssuedDateOptional *bool `json:"grant_type_jwt_bearer_issued_date_optional,omitempty" yaml:"grant_type_jwt_bearer_issued_date_optional,omitempty"`
+
+	SendDebugMessagesToClients    *bool `json:"send_debug_messages_to_clients,omitempty" yaml:"send_debug_messages_to_clients,omitempty"`
+	UseLegacyErrorFormat          *bool `json:"use_legacy_error_format,omitempty" yaml:"use_legacy_error_format,omitempty"`
+	DisableRefreshTokenValidation *bool `json:"disable_refresh_token_validation,omitempty" yaml:"disable_refresh_token_validation,omitempty"`
+	OmitRedirectScopeParam        *bool `json:"omit_redirect_scope_param,omitempty" yaml:"omit_redirect_scope_param,omitempty"`
+
+	// ScopeStrategy is one of "hierarchic", "exact" or "wildcard".
+	ScopeStrategy      *string  `json:"scope_strategy,omitempty" yaml:"scope_strategy,omitempty"`
+	RefreshTokenScopes []string `json:"refresh_token_scopes,omitempty" yaml:"refresh_token_scopes,omitempty"`
+	AllowedPrompts     []string `json:"allowed_prompts,omitempty" yaml:"allowed_prompts,omitempty"`
+}
+
+// ScopeStrategies are the scope strategies which can be selected by name.
+var ScopeStrategies = map[string]fosite.ScopeStrategy{
+	"hierarchic": fosite.HierarchicScopeStrategy,
+	"exact":      fosite.ExactScopeStrategy,
+	"wildcard":   fosite.WildcardScopeStrategy,
+}
+
+// LoadFile reads the configuration file at path. Files ending in ".json" are parsed as JSON, all others as YAML.
+// Unknown options are rejected.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(data)
+	}
+	return ParseYAML(data)
+}
+
+// ParseYAML parses a YAML configuration. Unknown options are rejected.
+func ParseYAML(data []byte) (*File, error) {
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "unable to parse YAML configuration")
+	}
+	return &f, nil
+}
+
+// ParseJSON parses a JSON configuration. Unknown options are rejected.
+func ParseJSON(data []byte) (*File, error) {
+	var f File
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, errors.Wrap(err, "unable to parse JSON configuration")
+	}
+	return &f, nil
+}
+
+// LoadEnv overrides the options of f with the environment variables named after the options, upper-cased and
+// prefixed with prefix. Lists are separated by commas.
+func (f *File) LoadEnv(prefix string) error {
+	v := reflect.ValueOf(f).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		key := prefix + strings.ToUpper(name)
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), value); err != nil {
+			return errors.Wrapf(err, "unable to parse environment variable %s", key)
+		}
+	}
+	return nil
+}
+
+func setFromString(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setFromString(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		return errors.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Apply sets the options of c which are set in f.
+func (f *File) Apply(c *fosite.Config) error {
+	setString(&c.IDTokenIssuer, f.IDTokenIssuer)
+	setString(&c.AccessTokenIssuer, f.AccessTokenIssuer)
+	setString(&c.TokenURL, f.TokenURL)
+	setString(&c.PushedAuthorizeRequestURIPrefix, f.PushedAuthorizeRequestURIPrefix)
+
+	if f.GlobalSecret != nil {
+		c.GlobalSecret = f.GlobalSecret
+	}
+	if f.RotatedGlobalSecrets != nil {
+		c.RotatedGlobalSecrets = make([][]byte, len(f.RotatedGlobalSecrets))
+		for i, secret := range f.RotatedGlobalSecrets {
+			c.RotatedGlobalSecrets[i] = secret
+		}
+	}
+	if f.PairwiseSubjectSalt != nil {
+		c.PairwiseSubjectSalt = f.PairwiseSubjectSalt
+	}
+
+	setDuration(&c.AccessTokenLifespan, f.AccessTokenLifespan)
+	setDuration(&c.RefreshTokenLifespan, f.RefreshTokenLifespan)
+	setDuration(&c.AuthorizeCodeLifespan, f.AuthorizeCodeLifespan)
+	setDuration(&c.IDTokenLifespan, f.IDTokenLifespan)
+	setDuration(&c.VerifiableCredentialsNonceLifespan, f.VerifiableCredentialsNonceLifespan)
+	setDuration(&c.PushedAuthorizeContextLifespan, f.PushedAuthorizeContextLifespan)
+	setDuration(&c.PhantomTokenLifespan, f.PhantomTokenLifespan)
+	setDuration(&c.JWTLeeway, f.JWTLeeway)
+	setDuration(&c.GrantTypeJWTBearerMaxDuration, f.GrantTypeJWTBearerMaxDuration)
+
+	setInt(&c.HashCost, f.HashCost)
+	setInt(&c.TokenEntropy, f.TokenEntropy)
+	setInt(&c.MinParameterEntropy, f.MinParameterEntropy)
+
+	setBool(&c.EnforcePKCE, f.EnforcePKCE)
+	setBool(&c.EnforcePKCEForPublicClients, f.EnforcePKCEForPublicClients)
+	setBool(&c.EnablePKCEPlainChallengeMethod, f.EnablePKCEPlainChallengeMethod)
+	setBool(&c.EnforceOAuth21, f.EnforceOAuth21)
+	setBool(&c.IsPushedAuthorizeEnforced, f.EnforcePushedAuthorize)
+	setBool(&c.GrantTypeJWTBearerCanSkipClientAuth, f.GrantTypeJWTBearerCanSkipClientAuth)
+	setBool(&c.GrantTypeJWTBearerIDOptional, f.GrantTypeJWTBearerIDOptional)
+	setBool(&c.GrantTypeJWTBearerIssuedDateOptional, f.GrantTypeJWTBearerIssuedDateOptional)
+	setBool(&c.SendDebugMessagesToClients, f.SendDebugMessagesToClients)
+	setBool(&c.UseLegacyErrorFormat, f.UseLegacyErrorFormat)
+	setBool(&c.DisableRefreshTokenValidation, f.DisableRefreshTokenValidation)
+	setBool(&c.OmitRedirectScopeParam, f.OmitRedirectScopeParam)
+
+	if f.ScopeStrategy != nil {
+		strategy, ok := ScopeStrategies[*f.ScopeStrategy]
+		if !ok {
+			return errors.Errorf("unknown scope strategy %q", *f.ScopeStrategy)
+		}
+		c.ScopeStrategy = strategy
+	}
+	if f.RefreshTokenScopes != nil {
+		c.RefreshTokenScopes = f.RefreshTokenScopes
+	}
+	if f.AllowedPrompts != nil {
+		c.AllowedPromptValues = f.AllowedPrompts
+	}
+
+	return nil
+}
+
+func setString(dst *string, src *string) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setDuration(dst *time.Duration, src *Duration) {
+	if src != nil {
+		*dst = time.Duration(*src)
+	}
+}
+
+func setInt(dst *int, src *int) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setBool(dst *bool, src *bool) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// Duration is a time.Duration which is written as a Go duration string, such as "1h30m", or as an integer number of
+// seconds.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if seconds, err := strconv.ParseInt(string(text), 10, 64); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.WithStack(err)
+	}
+	return d.UnmarshalText([]byte(fmt.Sprint(raw)))
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.UnmarshalText([]byte(node.Value))
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Secret is a secret value. Instead of the secret itself, it may reference its source:
+//
+//   - "env:NAME" reads the secret from the environment variable NAME,
+//   - "file:PATH" reads the secret from the file at PATH, without trailing newlines, and
+//   - "base64:VALUE" decodes the standard base64 encoded VALUE.
+type Secret []byte
+
+func (s *Secret) UnmarshalText(text []byte) error {
+	value := string(text)
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return errors.Errorf("environment variable %s is not set", name)
+		}
+		*s = Secret(secret)
+	case strings.HasPrefix(value, "file:"):
+		secret, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		*s = bytes.TrimRight(secret, "\r\n")
+	case strings.HasPrefix(value, "base64:"):
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		*s = secret
+	default:
+		*s = Secret(value)
+	}
+	return nil
+}
+
+// MarshalText redacts the secret.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte("[redacted]"), nil
+}
+
+// String redacts the secret.
+func (s Secret) String() string {
+	return "[redacted]"
+}
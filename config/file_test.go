@@ -0,0 +1,116 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	. "github.com/ory/fosite/config"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("some-secret-from-a-file-that-is-long-enough\n"), 0600))
+	t.Setenv("TEST_CONFIG_PAIRWISE_SALT", "salt")
+
+	yamlPath := filepath.Join(dir, "fosite.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+id_token_issuer: https://auth.example.com
+global_secret: file:`+filepath.Join(dir, "secret")+`
+rotated_global_secrets:
+  - base64:c29tZS1vbGQtc2VjcmV0
+pairwise_subject_salt: env:TEST_CONFIG_PAIRWISE_SALT
+access_token_lifespan: 30m
+refresh_token_lifespan: 86400
+enforce_pkce: true
+scope_strategy: exact
+refresh_token_scopes: []
+`), 0600))
+
+	jsonPath := filepath.Join(dir, "fosite.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{
+  "id_token_issuer": "https://auth.example.com",
+  "global_secret": "file:`+filepath.Join(dir, "secret")+`",
+  "rotated_global_secrets": ["base64:c29tZS1vbGQtc2VjcmV0"],
+  "pairwise_subject_salt": "env:TEST_CONFIG_PAIRWISE_SALT",
+  "access_token_lifespan": "30m",
+  "refresh_token_lifespan": 86400,
+  "enforce_pkce": true,
+  "scope_strategy": "exact",
+  "refresh_token_scopes": []
+}`), 0600))
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		t.Run("file="+filepath.Base(path), func(t *testing.T) {
+			f, err := LoadFile(path)
+			require.NoError(t, err)
+
+			c := &fosite.Config{AuthorizeCodeLifespan: time.Minute, EnforcePKCEForPublicClients: true}
+			require.NoError(t, f.Apply(c))
+
+			assert.Equal(t, "https://auth.example.com", c.IDTokenIssuer)
+			assert.Equal(t, []byte("some-secret-from-a-file-that-is-long-enough"), c.GlobalSecret)
+			assert.Equal(t, [][]byte{[]byte("some-old-secret")}, c.RotatedGlobalSecrets)
+			assert.Equal(t, []byte("salt"), c.PairwiseSubjectSalt)
+			assert.Equal(t, 30*time.Minute, c.AccessTokenLifespan)
+			assert.Equal(t, 24*time.Hour, c.RefreshTokenLifespan)
+			assert.True(t, c.EnforcePKCE)
+			assert.NotNil(t, c.ScopeStrategy)
+			assert.Empty(t, c.GetRefreshTokenScopes(nil))
+
+			// Options which are not set keep their value.
+			assert.Equal(t, time.Minute, c.AuthorizeCodeLifespan)
+			assert.True(t, c.EnforcePKCEForPublicClients)
+		})
+	}
+
+	t.Run("case=rejects unknown options", func(t *testing.T) {
+		_, err := ParseYAML([]byte("acces_token_lifespan: 1h"))
+		assert.Error(t, err)
+		_, err = ParseJSON([]byte(`{"acces_token_lifespan": "1h"}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("case=rejects invalid values", func(t *testing.T) {
+		_, err := ParseYAML([]byte("access_token_lifespan: forever"))
+		assert.Error(t, err)
+		_, err = ParseYAML([]byte("global_secret: env:TEST_CONFIG_UNSET"))
+		assert.Error(t, err)
+
+		f, err := ParseYAML([]byte("scope_strategy: fuzzy"))
+		require.NoError(t, err)
+		assert.Error(t, f.Apply(new(fosite.Config)))
+	})
+}
+
+func TestFile_LoadEnv(t *testing.T) {
+	t.Setenv("TEST_FOSITE_ACCESS_TOKEN_LIFESPAN", "2h")
+	t.Setenv("TEST_FOSITE_ENFORCE_PKCE", "true")
+	t.Setenv("TEST_FOSITE_HASH_COST", "13")
+	t.Setenv("TEST_FOSITE_ALLOWED_PROMPTS", "login, none")
+	t.Setenv("TEST_FOSITE_ROTATED_GLOBAL_SECRETS", "base64:Zm9v,bar")
+
+	f, err := ParseYAML([]byte("access_token_lifespan: 1h\nid_token_issuer: https://auth.example.com"))
+	require.NoError(t, err)
+	require.NoError(t, f.LoadEnv("TEST_FOSITE_"))
+
+	c := new(fosite.Config)
+	require.NoError(t, f.Apply(c))
+	assert.Equal(t, 2*time.Hour, c.AccessTokenLifespan)
+	assert.Equal(t, "https://auth.example.com", c.IDTokenIssuer)
+	assert.True(t, c.EnforcePKCE)
+	assert.Equal(t, 13, c.HashCost)
+	assert.Equal(t, []string{"login", "none"}, c.AllowedPromptValues)
+	assert.Equal(t, [][]byte{[]byte("foo"), []byte("bar")}, c.RotatedGlobalSecrets)
+
+	t.Setenv("TEST_FOSITE_ENFORCE_PKCE", "maybe")
+	assert.Error(t, f.LoadEnv("TEST_FOSITE_"))
+}
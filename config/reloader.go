@@ -0,0 +1,192 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+)
+
+var (
+	_ fosite.Configurator                         = (*Reloader)(nil)
+	_ fosite.PushedAuthorizeRequestConfigProvider = (*Reloader)(nil)
+	_ fosite.ClockProvider                        = (*Reloader)(nil)
+	_ fosite.JWTLeewayProvider                    = (*Reloader)(nil)
+	_ fosite.PairwiseSubjectSaltProvider          = (*Reloader)(nil)
+	_ fosite.OutboundHTTPPolicyProvider           = (*Reloader)(nil)
+)
+
+// Load returns a copy of base with the options of the configuration file at path and of the environment variables
+// with the given prefix applied. Environment variables take precedence. If path is empty, only environment variables
+// are applied, and if envPrefix is empty, environment variables are ignored. Load returns an error if the resulting
+// configuration has findings of severity SeverityError.
+func Load(ctx context.Context, base *fosite.Config, path, envPrefix string) (*fosite.Config, Findings, error) {
+	f := new(File)
+	if path != "" {
+		var err error
+		if f, err = LoadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if envPrefix != "" {
+		if err := f.LoadEnv(envPrefix); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c := *base
+	if err := f.Apply(&c); err != nil {
+		return nil, nil, err
+	}
+
+	findings := Validate(ctx, &c)
+	if err := findings.Err(); err != nil {
+		return nil, findings, err
+	}
+	return &c, findings, nil
+}
+
+// Reloader is a fosite.Configurator which serves the configuration loaded from a file and environment variables, and
+// which reloads it when the file changes. Handlers and strategies read the configuration through the
+// context-based providers on every request, so they pick up changes without being recreated as long as they are
+// created with the Reloader as their configuration, for example using Compose:
+//
+//	reloader, err := config.NewReloader(ctx, &fosite.Config{}, "fosite.yaml", "FOSITE_")
+//	provider := reloader.Compose(store, compose.NewOAuth2HMACStrategy(reloader), compose.OAuth2AuthorizeExplicitFactory)
+//	go reloader.Watch(ctx, 10*time.Second)
+//
+// The getters are provided by the embedded fosite.DynamicConfig, which reads from the current configuration.
+type Reloader struct {
+	fosite.DynamicConfig
+
+	// OnReload is called after the configuration was reloaded, or failed to reload. The previous configuration
+	// remains in use if err is not nil.
+	OnReload func(findings Findings, err error)
+
+	path      string
+	envPrefix string
+
+	m       sync.Mutex
+	base    *fosite.Config
+	modTime time.Time
+	size    int64
+	current atomic.Pointer[fosite.Config]
+}
+
+// NewReloader loads the configuration from base, the file at path and the environment variables with the given
+// prefix, see Load. It returns an error if the configuration can not be loaded or is invalid.
+func NewReloader(ctx context.Context, base *fosite.Config, path, envPrefix string) (*Reloader, error) {
+	r := &Reloader{base: base, path: path, envPrefix: envPrefix}
+	r.Resolve = func(context.Context) (*fosite.Config, error) {
+		return r.Current(), nil
+	}
+	if _, err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Current returns the configuration which is currently in use. It must not be modified.
+func (r *Reloader) Current() *fosite.Config {
+	return r.current.Load()
+}
+
+// Reload loads the configuration again. If it can not be loaded or is invalid, the current configuration remains in
+// use and the error is returned.
+func (r *Reloader) Reload(ctx context.Context) error {
+	findings, err := r.load(ctx)
+	if r.OnReload != nil {
+		r.OnReload(findings, err)
+	}
+	return err
+}
+
+func (r *Reloader) load(ctx context.Context) (Findings, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.path != "" {
+		if info, err := os.Stat(r.path); err == nil {
+			r.modTime, r.size = info.ModTime(), info.Size()
+		}
+	}
+
+	c, findings, err := Load(ctx, r.base, r.path, r.envPrefix)
+	if err != nil {
+		return findings, err
+	}
+	r.current.Store(c)
+	return findings, nil
+}
+
+// Watch reloads the configuration whenever the modification time or the size of the file changes, checking every
+// interval until ctx is done. Reload errors are reported to OnReload.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if r.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil {
+				continue
+			}
+
+			r.m.Lock()
+			changed := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+			r.m.Unlock()
+			if changed {
+				_ = r.Reload(ctx)
+			}
+		}
+	}
+}
+
+// Compose is like compose.Compose, but creates the handlers with the Reloader as their configuration and registers
+// them with the base configuration.
+func (r *Reloader) Compose(storage interface{}, strategy interface{}, factories ...compose.Factory) fosite.OAuth2Provider {
+	r.m.Lock()
+	for _, factory := range factories {
+		res := factory(r, storage, strategy)
+		if ah, ok := res.(fosite.AuthorizeEndpointHandler); ok {
+			r.base.AuthorizeEndpointHandlers.Append(ah)
+		}
+		if th, ok := res.(fosite.TokenEndpointHandler); ok {
+			r.base.TokenEndpointHandlers.Append(th)
+		}
+		if tv, ok := res.(fosite.TokenIntrospector); ok {
+			r.base.TokenIntrospectionHandlers.Append(tv)
+		}
+		if rh, ok := res.(fosite.RevocationHandler); ok {
+			r.base.RevocationHandlers.Append(rh)
+		}
+		if ph, ok := res.(fosite.PushedAuthorizeEndpointHandler); ok {
+			r.base.PushedAuthorizeEndpointHandlers.Append(ph)
+		}
+	}
+
+	// Carry the handlers over to the current configuration.
+	c := *r.current.Load()
+	c.AuthorizeEndpointHandlers = r.base.AuthorizeEndpointHandlers
+	c.TokenEndpointHandlers = r.base.TokenEndpointHandlers
+	c.TokenIntrospectionHandlers = r.base.TokenIntrospectionHandlers
+	c.RevocationHandlers = r.base.RevocationHandlers
+	c.PushedAuthorizeEndpointHandlers = r.base.PushedAuthorizeEndpointHandlers
+	r.current.Store(&c)
+	r.m.Unlock()
+
+	return fosite.NewOAuth2Provider(storage.(fosite.Storage), r)
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	. "github.com/ory/fosite/config"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/storage"
+)
+
+func TestReloader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "fosite.yaml")
+	modTime := time.Now()
+	write := func(content string) {
+		// Replace the file atomically with a distinct modification time, so the watcher never reads a partially
+		// written file and never misses a change because of the file system's timestamp granularity.
+		modTime = modTime.Add(time.Second)
+		tmp := path + ".tmp"
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+		require.NoError(t, os.Chtimes(tmp, modTime, modTime))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write("global_secret: some-super-cool-secret-that-nobody-knows\naccess_token_lifespan: 1h\n")
+
+	t.Setenv("TEST_RELOADER_ID_TOKEN_ISSUER", "https://auth.example.com")
+	r, err := NewReloader(ctx, &fosite.Config{EnforcePKCE: true}, path, "TEST_RELOADER_")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, r.GetAccessTokenLifespan(ctx))
+	assert.Equal(t, "https://auth.example.com", r.GetIDTokenIssuer(ctx))
+	assert.True(t, r.GetEnforcePKCE(ctx))
+
+	provider := r.Compose(storage.NewMemoryStore(), compose.NewOAuth2HMACStrategy(r), compose.OAuth2ClientCredentialsGrantFactory)
+	require.NotNil(t, provider)
+	require.Len(t, r.GetTokenEndpointHandlers(ctx), 1)
+	handler := r.GetTokenEndpointHandlers(ctx)[0].(*oauth2.ClientCredentialsGrantHandler)
+
+	reloaded := make(chan error, 10)
+	r.OnReload = func(_ Findings, err error) {
+		reloaded <- err
+	}
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	t.Run("case=reloads changes", func(t *testing.T) {
+		write("global_secret: some-super-cool-secret-that-nobody-knows\naccess_token_lifespan: 2h\n")
+		require.NoError(t, <-reloaded)
+
+		assert.Equal(t, 2*time.Hour, r.GetAccessTokenLifespan(ctx))
+		assert.Equal(t, 2*time.Hour, handler.Config.GetAccessTokenLifespan(ctx))
+		assert.Len(t, r.GetTokenEndpointHandlers(ctx), 1)
+	})
+
+	t.Run("case=keeps the configuration if the change is invalid", func(t *testing.T) {
+		write("global_secret: short\naccess_token_lifespan: 3h\n")
+		assert.Error(t, <-reloaded)
+		assert.Equal(t, 2*time.Hour, r.GetAccessTokenLifespan(ctx))
+	})
+
+	t.Run("case=refuses to start with an invalid configuration", func(t *testing.T) {
+		_, err := NewReloader(ctx, new(fosite.Config), path, "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ory/fosite"
+)
+
+// Severity is the severity of a Finding.
+type Severity string
+
+const (
+	// SeverityError marks settings which are invalid or insecure in any deployment.
+	SeverityError Severity = "error"
+	// SeverityWarning marks settings which weaken security and are usually only acceptable during development.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem which Validate found in a configuration.
+type Finding struct {
+	Severity Severity
+	// Option is the name of the offending option as used in configuration files.
+	Option  string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Option, f.Message)
+}
+
+// Findings are the problems which Validate found in a configuration.
+type Findings []Finding
+
+// Errors returns the findings of severity SeverityError.
+func (fs Findings) Errors() Findings {
+	return fs.filter(SeverityError)
+}
+
+// Warnings returns the findings of severity SeverityWarning.
+func (fs Findings) Warnings() Findings {
+	return fs.filter(SeverityWarning)
+}
+
+func (fs Findings) filter(severity Severity) Findings {
+	var filtered Findings
+	for _, f := range fs {
+		if f.Severity == severity {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// Err returns a *ValidationError if there are findings of severity SeverityError, and nil otherwise.
+func (fs Findings) Err() error {
+	if errs := fs.Errors(); len(errs) > 0 {
+		return &ValidationError{Findings: errs}
+	}
+	return nil
+}
+
+// ValidationError is returned if a configuration is invalid.
+type ValidationError struct {
+	Findings Findings
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		messages[i] = f.Option + ": " + f.Message
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// Validate checks the configuration for invalid settings and insecure combinations of settings.
+func Validate(ctx context.Context, c fosite.Configurator) Findings {
+	var findings Findings
+	report := func(severity Severity, option, format string, args ...interface{}) {
+		findings = append(findings, Finding{Severity: severity, Option: option, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if secret, err := c.GetGlobalSecret(ctx); err != nil {
+		report(SeverityError, "global_secret", "unable to load: %s", err)
+	} else if len(secret) == 0 {
+		report(SeverityWarning, "global_secret", "is not set, HMAC-based tokens can not be issued")
+	} else if len(secret) < 32 {
+		report(SeverityError, "global_secret", "must be at least 32 bytes long, but is %d bytes long", len(secret))
+	}
+	if secrets, err := c.GetRotatedGlobalSecrets(ctx); err != nil {
+		report(SeverityError, "rotated_global_secrets", "unable to load: %s", err)
+	} else {
+		for i, secret := range secrets {
+			if len(secret) < 32 {
+				report(SeverityError, "rotated_global_secrets", "secret %d must be at least 32 bytes long, but is %d bytes long", i, len(secret))
+			}
+		}
+	}
+
+	if keys, err := c.GetHMACKeys(ctx); err != nil {
+		report(SeverityError, "hmac_keys", "unable to load: %s", err)
+	} else {
+		seen := map[string]bool{}
+		for _, key := range keys {
+			if seen[key.ID] {
+				report(SeverityError, "hmac_keys", "key id %q is used more than once", key.ID)
+			}
+			seen[key.ID] = true
+			if len(key.Secret) < 32 {
+				report(SeverityError, "hmac_keys", "secret %q must be at least 32 bytes long, but is %d bytes long", key.ID, len(key.Secret))
+			}
+		}
+	}
+
+	for _, lifespan := range []struct {
+		option string
+		value  time.Duration
+	}{
+		{"access_token_lifespan", c.GetAccessTokenLifespan(ctx)},
+		{"authorize_code_lifespan", c.GetAuthorizeCodeLifespan(ctx)},
+		{"id_token_lifespan", c.GetIDTokenLifespan(ctx)},
+		{"verifiable_credentials_nonce_lifespan", c.GetVerifiableCredentialsNonceLifespan(ctx)},
+		{"phantom_token_lifespan", c.GetPhantomTokenLifespan(ctx)},
+	} {
+		if lifespan.value < 0 {
+			report(SeverityError, lifespan.option, "must not be negative")
+		}
+	}
+	if lifespan := c.GetRefreshTokenLifespan(ctx); lifespan < -1 {
+		report(SeverityError, "refresh_token_lifespan", "must not be negative, use -1ns for refresh tokens which do not expire")
+	}
+	if lifespan := c.GetAccessTokenLifespan(ctx); lifespan > 24*time.Hour {
+		report(SeverityWarning, "access_token_lifespan", "%s is very long for bearer tokens", lifespan)
+	}
+	if lifespan := c.GetAuthorizeCodeLifespan(ctx); lifespan > 10*time.Minute {
+		// https://tools.ietf.org/html/rfc6749#section-4.1.2
+		report(SeverityWarning, "authorize_code_lifespan", "%s exceeds the recommended maximum of 10 minutes", lifespan)
+	}
+
+	validateIssuer(c.GetIDTokenIssuer(ctx), "id_token_issuer", report)
+	validateIssuer(c.GetAccessTokenIssuer(ctx), "access_token_issuer", report)
+
+	if c.GetSendDebugMessagesToClients(ctx) {
+		report(SeverityWarning, "send_debug_messages_to_clients", "exposes internal error details to clients and must not be enabled in production")
+	}
+	if c.GetEnablePKCEPlainChallengeMethod(ctx) {
+		report(SeverityWarning, "enable_pkce_plain_challenge_method", "allows public clients to use the plain PKCE method, which does not protect against authorization code interception")
+	}
+	if !c.GetEnforcePKCE(ctx) && !c.GetEnforcePKCEForPublicClients(ctx) && !c.GetEnforceOAuth21(ctx) {
+		report(SeverityWarning, "enforce_pkce_for_public_clients", "is disabled, public clients may use the authorization code flow without PKCE")
+	}
+	if c.GetGrantTypeJWTBearerCanSkipClientAuth(ctx) {
+		report(SeverityWarning, "grant_type_jwt_bearer_can_skip_client_auth", "allows unauthenticated clients to use the JWT bearer grant")
+	}
+	if c.GetDisableRefreshTokenValidation(ctx) {
+		report(SeverityWarning, "disable_refresh_token_validation", "skips the validation of refresh tokens")
+	}
+
+	if entropy := c.GetTokenEntropy(ctx); entropy < 32 {
+		report(SeverityWarning, "token_entropy", "%d bytes are less than the recommended 32 bytes", entropy)
+	}
+	if entropy := c.GetMinParameterEntropy(ctx); entropy < fosite.MinParameterEntropy {
+		report(SeverityWarning, "min_parameter_entropy", "%d characters are less than the recommended %d characters", entropy, fosite.MinParameterEntropy)
+	}
+	if bc, ok := c.(fosite.BCryptCostProvider); ok && bc.GetBCryptCost(ctx) < fosite.DefaultBCryptWorkFactor {
+		report(SeverityWarning, "hash_cost", "%d is less than the recommended %d", bc.GetBCryptCost(ctx), fosite.DefaultBCryptWorkFactor)
+	}
+
+	return findings
+}
+
+func validateIssuer(issuer, option string, report func(severity Severity, option, format string, args ...interface{})) {
+	if issuer == "" {
+		return
+	}
+
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		report(SeverityError, option, "must be an absolute URL")
+		return
+	}
+	if u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		report(SeverityWarning, option, "should use the https scheme")
+	}
+}
+
+func isLoopback(hostname string) bool {
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
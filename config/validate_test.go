@@ -0,0 +1,86 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	. "github.com/ory/fosite/config"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	secure := func() *fosite.Config {
+		return &fosite.Config{
+			IDTokenIssuer:               "https://auth.example.com",
+			GlobalSecret:                []byte("some-super-cool-secret-that-nobody-knows"),
+			AuthorizeCodeLifespan:       10 * time.Minute,
+			EnforcePKCEForPublicClients: true,
+		}
+	}
+
+	t.Run("case=accepts a secure configuration", func(t *testing.T) {
+		assert.Empty(t, Validate(ctx, secure()))
+	})
+
+	t.Run("case=reports errors", func(t *testing.T) {
+		c := secure()
+		c.GlobalSecret = []byte("short")
+		c.RotatedGlobalSecrets = [][]byte{[]byte("short")}
+		c.AccessTokenLifespan = -time.Hour
+		c.IDTokenIssuer = "auth.example.com"
+		c.HMACKeys = []fosite.HMACKey{{ID: "a", Secret: c.GlobalSecret}, {ID: "a", Secret: c.GlobalSecret}}
+
+		findings := Validate(ctx, c)
+		assert.Empty(t, findings.Warnings())
+
+		var options []string
+		for _, f := range findings.Errors() {
+			options = append(options, f.Option)
+		}
+		assert.ElementsMatch(t, []string{"global_secret", "rotated_global_secrets", "hmac_keys", "hmac_keys", "hmac_keys", "access_token_lifespan", "id_token_issuer"}, options)
+
+		var validationErr *ValidationError
+		require.ErrorAs(t, findings.Err(), &validationErr)
+		assert.Len(t, validationErr.Findings, 7)
+	})
+
+	t.Run("case=reports insecure settings", func(t *testing.T) {
+		c := secure()
+		c.SendDebugMessagesToClients = true
+		c.EnablePKCEPlainChallengeMethod = true
+		c.EnforcePKCEForPublicClients = false
+		c.IDTokenIssuer = "http://auth.example.com"
+		c.AuthorizeCodeLifespan = time.Hour
+		c.HashCost = 4
+
+		findings := Validate(ctx, c)
+		assert.NoError(t, findings.Err())
+
+		var options []string
+		for _, f := range findings.Warnings() {
+			options = append(options, f.Option)
+		}
+		assert.ElementsMatch(t, []string{
+			"send_debug_messages_to_clients",
+			"enable_pkce_plain_challenge_method",
+			"enforce_pkce_for_public_clients",
+			"id_token_issuer",
+			"authorize_code_lifespan",
+			"hash_cost",
+		}, options)
+	})
+
+	t.Run("case=accepts http issuers on loopback interfaces", func(t *testing.T) {
+		c := secure()
+		c.IDTokenIssuer = "http://127.0.0.1:4444"
+		assert.Empty(t, Validate(ctx, c))
+	})
+}
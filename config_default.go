@@ -26,6 +26,7 @@ var (
 	_ AuthorizeCodeLifespanProvider                = (*Config)(nil)
 	_ RefreshTokenLifespanProvider                 = (*Config)(nil)
 	_ AccessTokenLifespanProvider                  = (*Config)(nil)
+	_ PhantomTokenLifespanProvider                 = (*Config)(nil)
 	_ ScopeStrategyProvider                        = (*Config)(nil)
 	_ AudienceStrategyProvider                     = (*Config)(nil)
 	_ RedirectSecureCheckerProvider                = (*Config)(nil)
@@ -38,6 +39,7 @@ var (
 	_ MinParameterEntropyProvider                  = (*Config)(nil)
 	_ SanitationAllowedProvider                    = (*Config)(nil)
 	_ EnforcePKCEForPublicClientsProvider          = (*Config)(nil)
+	_ EnforceOAuth21Provider                       = (*Config)(nil)
 	_ EnablePKCEPlainChallengeMethodProvider       = (*Config)(nil)
 	_ EnforcePKCEProvider                          = (*Config)(nil)
 	_ GrantTypeJWTBearerCanSkipClientAuthProvider  = (*Config)(nil)
@@ -55,7 +57,15 @@ var (
 	_ TokenURLProvider                             = (*Config)(nil)
 	_ GetSecretsHashingProvider                    = (*Config)(nil)
 	_ HTTPClientProvider                           = (*Config)(nil)
+	_ OutboundHTTPPolicyProvider                   = (*Config)(nil)
+	_ ClockProvider                                = (*Config)(nil)
+	_ JWTLeewayProvider                            = (*Config)(nil)
+	_ SubjectIdentifierStrategyProvider            = (*Config)(nil)
+	_ PairwiseSubjectSaltProvider                  = (*Config)(nil)
+	_ RedirectURIPolicyProvider                    = (*Config)(nil)
+	_ LockerProvider                               = (*Config)(nil)
 	_ HMACHashingProvider                          = (*Config)(nil)
+	_ HMACKeysProvider                             = (*Config)(nil)
 	_ AuthorizeEndpointHandlersProvider            = (*Config)(nil)
 	_ TokenEndpointHandlersProvider                = (*Config)(nil)
 	_ TokenIntrospectionHandlersProvider           = (*Config)(nil)
@@ -68,6 +78,10 @@ type Config struct {
 	// AccessTokenLifespan sets how long an access token is going to be valid. Defaults to one hour.
 	AccessTokenLifespan time.Duration
 
+	// PhantomTokenLifespan sets how long the JWTs which the introspection endpoint issues in exchange for opaque access
+	// tokens are going to be valid. They never outlive the access token. Defaults to five minutes.
+	PhantomTokenLifespan time.Duration
+
 	// VerifiableCredentialsNonceLifespan sets how long a verifiable credentials nonce is going to be valid. Defaults to one hour.
 	VerifiableCredentialsNonceLifespan time.Duration
 
@@ -107,6 +121,19 @@ type Config struct {
 	// EnforcePKCEForPublicClients requires only public clients to use PKCE with the authorize code flow. Defaults to false.
 	EnforcePKCEForPublicClients bool
 
+	// EnforceOAuth21, if set to true, makes the authorization server comply with OAuth 2.1. Defaults to false. When
+	// enabled,
+	//
+	//   - the implicit grant and the resource owner password credentials grant are rejected,
+	//   - all clients must use PKCE with the authorize code flow,
+	//   - access tokens passed in the query string are rejected, and
+	//   - refresh tokens of public clients are rotated without a grace period unless they are sender-constrained.
+	//
+	// This setting does not change how redirect URIs are matched. The DefaultRedirectURIPolicy uses exact string
+	// matching but accepts any port for loopback redirect URIs, which OAuth 2.1 permits for native apps. Use the
+	// WebRedirectURIPolicy or RedirectURIPolicies to require exact matches, see RedirectURIPolicy.
+	EnforceOAuth21 bool
+
 	// EnablePKCEPlainChallengeMethod sets whether or not to allow the plain challenge method (S256 should be used whenever possible, plain is really discouraged). Defaults to false.
 	EnablePKCEPlainChallengeMethod bool
 
@@ -182,6 +209,15 @@ type Config struct {
 	// HTTPClient is the HTTP client to use for requests.
 	HTTPClient *retryablehttp.Client
 
+	// OutboundHTTPPolicy restricts the locations the HTTP client may contact, for example when fetching
+	// request_uri or jwks_uri documents of clients. The client returned by GetHTTPClient enforces the policy.
+	// Defaults to a zero OutboundHTTPPolicy, which only allows https requests to public addresses.
+	OutboundHTTPPolicy *OutboundHTTPPolicy
+
+	// DisableOutboundHTTPPolicy lets the HTTP client contact any location if OutboundHTTPPolicy is nil. This
+	// should only be used for development and testing.
+	DisableOutboundHTTPPolicy bool
+
 	// AuthorizeEndpointHandlers is a list of handlers that are called before the authorization endpoint is served.
 	AuthorizeEndpointHandlers AuthorizeEndpointHandlers
 
@@ -206,6 +242,10 @@ type Config struct {
 	// HMACHasher is the hasher used to generate HMAC signatures.
 	HMACHasher func() hash.Hash
 
+	// HMACKeys are the keys used to generate and validate key-identified HMAC tokens. If set, they take precedence
+	// over GlobalSecret for new tokens. Tokens generated with GlobalSecret or RotatedGlobalSecrets remain valid.
+	HMACKeys []HMACKey
+
 	// PushedAuthorizeRequestURIPrefix is the URI prefix for the PAR request_uri.
 	// This is defaulted to 'urn:ietf:params:oauth:request_uri:'.
 	PushedAuthorizeRequestURIPrefix string
@@ -215,6 +255,33 @@ type Config struct {
 
 	// IsPushedAuthorizeEnforced enforces pushed authorization request for /authorize
 	IsPushedAuthorizeEnforced bool
+
+	// Clock is used for all expiry and issuance computations. Defaults to fosite.DefaultClock.
+	Clock Clock
+
+	// JWTLeeway is the clock skew tolerated when validating the iat, nbf and exp claims of JSON Web Tokens,
+	// for example client assertions, request objects, id_token_hint and JWT bearer grants. Defaults to zero.
+	JWTLeeway time.Duration
+
+	// SubjectIdentifierStrategy derives the subject identifiers presented to clients. Defaults to
+	// fosite.PairwiseSubjectIdentifierStrategy.
+	SubjectIdentifierStrategy SubjectIdentifierStrategy
+
+	// PairwiseSubjectSalt is the secret salt used to calculate pairwise subject identifiers. It is required if
+	// any client uses the pairwise subject type.
+	PairwiseSubjectSalt []byte
+
+	// RedirectURIPolicy is the redirect URI policy of clients which do not select a redirect URI profile.
+	// Defaults to fosite.DefaultRedirectURIPolicy.
+	RedirectURIPolicy RedirectURIPolicy
+
+	// RedirectURIPolicies maps redirect URI profile names to policies. Clients select a profile by implementing
+	// fosite.RedirectURIProfileClient. The built-in "native" and "web" profiles can be overridden here.
+	RedirectURIPolicies map[string]RedirectURIPolicy
+
+	// Locker serializes the redemption of authorize codes, refresh tokens and pushed authorization request URIs.
+	// Defaults to fosite.NoopLocker, which relies on the storage to prevent double redemption.
+	Locker Locker
 }
 
 func (c *Config) GetGlobalSecret(ctx context.Context) ([]byte, error) {
@@ -233,6 +300,10 @@ func (c *Config) GetHMACHasher(ctx context.Context) func() hash.Hash {
 	return c.HMACHasher
 }
 
+func (c *Config) GetHMACKeys(ctx context.Context) ([]HMACKey, error) {
+	return c.HMACKeys, nil
+}
+
 func (c *Config) GetAuthorizeEndpointHandlers(ctx context.Context) AuthorizeEndpointHandlers {
 	return c.AuthorizeEndpointHandlers
 }
@@ -249,11 +320,76 @@ func (c *Config) GetRevocationHandlers(ctx context.Context) RevocationHandlers {
 	return c.RevocationHandlers
 }
 
+// GetHTTPClient returns the HTTP client, which enforces the outbound HTTP policy unless it is disabled.
 func (c *Config) GetHTTPClient(ctx context.Context) *retryablehttp.Client {
-	if c.HTTPClient == nil {
-		return retryablehttp.NewClient()
+	policy := c.GetOutboundHTTPPolicy(ctx)
+	if policy == nil {
+		if c.HTTPClient == nil {
+			return retryablehttp.NewClient()
+		}
+		return c.HTTPClient
+	}
+	return policy.WrappedClient(c.HTTPClient)
+}
+
+// GetClock returns the clock. Defaults to fosite.DefaultClock.
+func (c *Config) GetClock(_ context.Context) Clock {
+	if c.Clock == nil {
+		return DefaultClock
+	}
+	return c.Clock
+}
+
+// GetJWTLeeway returns the tolerated clock skew for JSON Web Tokens. Defaults to zero.
+func (c *Config) GetJWTLeeway(_ context.Context) time.Duration {
+	if c.JWTLeeway < 0 {
+		return 0
 	}
-	return c.HTTPClient
+	return c.JWTLeeway
+}
+
+// GetSubjectIdentifierStrategy returns the subject identifier strategy. Defaults to
+// fosite.PairwiseSubjectIdentifierStrategy.
+func (c *Config) GetSubjectIdentifierStrategy(_ context.Context) SubjectIdentifierStrategy {
+	if c.SubjectIdentifierStrategy == nil {
+		return &PairwiseSubjectIdentifierStrategy{Config: c}
+	}
+	return c.SubjectIdentifierStrategy
+}
+
+// GetPairwiseSubjectSalt returns the salt used to calculate pairwise subject identifiers.
+func (c *Config) GetPairwiseSubjectSalt(_ context.Context) []byte {
+	return c.PairwiseSubjectSalt
+}
+
+// GetRedirectURIPolicy returns the redirect URI policy of the client's redirect URI profile. Defaults to
+// RedirectURIPolicy for clients without a profile.
+func (c *Config) GetRedirectURIPolicy(_ context.Context, client Client) RedirectURIPolicy {
+	fallback := c.RedirectURIPolicy
+	if fallback == nil {
+		fallback = new(DefaultRedirectURIPolicy)
+	}
+	return redirectURIPolicyForClient(client, c.RedirectURIPolicies, fallback)
+}
+
+// GetLocker returns the locker. Defaults to fosite.NoopLocker.
+func (c *Config) GetLocker(_ context.Context) Locker {
+	if c.Locker == nil {
+		return NoopLocker{}
+	}
+	return c.Locker
+}
+
+// GetOutboundHTTPPolicy returns the outbound HTTP policy. Defaults to a zero OutboundHTTPPolicy, or to nil, which
+// means no restrictions, if DisableOutboundHTTPPolicy is set.
+func (c *Config) GetOutboundHTTPPolicy(_ context.Context) *OutboundHTTPPolicy {
+	if c.OutboundHTTPPolicy != nil {
+		return c.OutboundHTTPPolicy
+	}
+	if c.DisableOutboundHTTPPolicy {
+		return nil
+	}
+	return defaultOutboundHTTPPolicy
 }
 
 func (c *Config) GetSecretsHasher(ctx context.Context) Hasher {
@@ -317,6 +453,11 @@ func (c *Config) GetEnforcePKCEForPublicClients(ctx context.Context) bool {
 	return c.EnforcePKCEForPublicClients
 }
 
+// GetEnforceOAuth21 returns the value of EnforceOAuth21.
+func (c *Config) GetEnforceOAuth21(_ context.Context) bool {
+	return c.EnforceOAuth21
+}
+
 // GetSanitationWhiteList returns a list of allowed form values that are required by the token endpoint. These values
 // are safe for storage in a database (cleartext).
 func (c *Config) GetSanitationWhiteList(ctx context.Context) []string {
@@ -379,6 +520,14 @@ func (c *Config) GetAccessTokenLifespan(_ context.Context) time.Duration {
 	return c.AccessTokenLifespan
 }
 
+// GetPhantomTokenLifespan returns how long a phantom token should be valid. Defaults to five minutes.
+func (c *Config) GetPhantomTokenLifespan(_ context.Context) time.Duration {
+	if c.PhantomTokenLifespan == 0 {
+		return 5 * time.Minute
+	}
+	return c.PhantomTokenLifespan
+}
+
 // GetNonceLifespan returns how long a nonce should be valid. Defaults to one hour.
 func (c *Config) GetVerifiableCredentialsNonceLifespan(_ context.Context) time.Duration {
 	if c.VerifiableCredentialsNonceLifespan == 0 {
@@ -407,7 +556,7 @@ func (c *Config) GetBCryptCost(_ context.Context) int {
 // GetJWKSFetcherStrategy returns the JWKSFetcherStrategy.
 func (c *Config) GetJWKSFetcherStrategy(_ context.Context) JWKSFetcherStrategy {
 	if c.JWKSFetcherStrategy == nil {
-		c.JWKSFetcherStrategy = NewDefaultJWKSFetcherStrategy()
+		c.JWKSFetcherStrategy = NewDefaultJWKSFetcherStrategy(JWKSFetcherWithHTTPClientSource(c.GetHTTPClient))
 	}
 	return c.JWKSFetcherStrategy
 }
@@ -0,0 +1,290 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"hash"
+	"html/template"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite/i18n"
+	"github.com/ory/fosite/token/jwt"
+)
+
+var (
+	_ Configurator                         = (*DynamicConfig)(nil)
+	_ PushedAuthorizeRequestConfigProvider = (*DynamicConfig)(nil)
+	_ ClockProvider                        = (*DynamicConfig)(nil)
+	_ JWTLeewayProvider                    = (*DynamicConfig)(nil)
+	_ PairwiseSubjectSaltProvider          = (*DynamicConfig)(nil)
+	_ OutboundHTTPPolicyProvider           = (*DynamicConfig)(nil)
+)
+
+// DynamicConfig is a Configurator which resolves the Config to read from on every call, for example from the request
+// context or from a configuration which is replaced at runtime. It is embedded by MultiTenantConfig and
+// config.Reloader.
+type DynamicConfig struct {
+	// Resolve returns the configuration for ctx. If the configuration can not be resolved, Resolve returns the error
+	// together with the configuration used by the getters which can not return errors, usually an empty one.
+	Resolve func(ctx context.Context) (*Config, error)
+}
+
+func (c *DynamicConfig) resolve(ctx context.Context) (*Config, error) {
+	if c.Resolve == nil {
+		return new(Config), errorsx.WithStack(ErrServerError.WithDebug("The dynamic configuration has no Resolve function."))
+	}
+	return c.Resolve(ctx)
+}
+
+// config returns the configuration for ctx, see Resolve.
+func (c *DynamicConfig) config(ctx context.Context) *Config {
+	config, _ := c.resolve(ctx)
+	return config
+}
+
+func (c *DynamicConfig) GetGlobalSecret(ctx context.Context) ([]byte, error) {
+	config, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetGlobalSecret(ctx)
+}
+
+func (c *DynamicConfig) GetUseLegacyErrorFormat(ctx context.Context) bool {
+	return c.config(ctx).GetUseLegacyErrorFormat(ctx)
+}
+
+func (c *DynamicConfig) GetRotatedGlobalSecrets(ctx context.Context) ([][]byte, error) {
+	config, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetRotatedGlobalSecrets(ctx)
+}
+
+func (c *DynamicConfig) GetHMACHasher(ctx context.Context) func() hash.Hash {
+	return c.config(ctx).GetHMACHasher(ctx)
+}
+
+func (c *DynamicConfig) GetPhantomTokenLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetPhantomTokenLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetHMACKeys(ctx context.Context) ([]HMACKey, error) {
+	config, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetHMACKeys(ctx)
+}
+
+func (c *DynamicConfig) GetAuthorizeEndpointHandlers(ctx context.Context) AuthorizeEndpointHandlers {
+	return c.config(ctx).GetAuthorizeEndpointHandlers(ctx)
+}
+
+func (c *DynamicConfig) GetTokenEndpointHandlers(ctx context.Context) TokenEndpointHandlers {
+	return c.config(ctx).GetTokenEndpointHandlers(ctx)
+}
+
+func (c *DynamicConfig) GetTokenIntrospectionHandlers(ctx context.Context) TokenIntrospectionHandlers {
+	return c.config(ctx).GetTokenIntrospectionHandlers(ctx)
+}
+
+func (c *DynamicConfig) GetRevocationHandlers(ctx context.Context) RevocationHandlers {
+	return c.config(ctx).GetRevocationHandlers(ctx)
+}
+
+func (c *DynamicConfig) GetHTTPClient(ctx context.Context) *retryablehttp.Client {
+	return c.config(ctx).GetHTTPClient(ctx)
+}
+
+func (c *DynamicConfig) GetClock(ctx context.Context) Clock {
+	return c.config(ctx).GetClock(ctx)
+}
+
+func (c *DynamicConfig) GetJWTLeeway(ctx context.Context) time.Duration {
+	return c.config(ctx).GetJWTLeeway(ctx)
+}
+
+func (c *DynamicConfig) GetSubjectIdentifierStrategy(ctx context.Context) SubjectIdentifierStrategy {
+	return c.config(ctx).GetSubjectIdentifierStrategy(ctx)
+}
+
+func (c *DynamicConfig) GetPairwiseSubjectSalt(ctx context.Context) []byte {
+	return c.config(ctx).GetPairwiseSubjectSalt(ctx)
+}
+
+func (c *DynamicConfig) GetRedirectURIPolicy(ctx context.Context, client Client) RedirectURIPolicy {
+	return c.config(ctx).GetRedirectURIPolicy(ctx, client)
+}
+
+func (c *DynamicConfig) GetLocker(ctx context.Context) Locker {
+	return c.config(ctx).GetLocker(ctx)
+}
+
+func (c *DynamicConfig) GetOutboundHTTPPolicy(ctx context.Context) *OutboundHTTPPolicy {
+	return c.config(ctx).GetOutboundHTTPPolicy(ctx)
+}
+
+func (c *DynamicConfig) GetSecretsHasher(ctx context.Context) Hasher {
+	return c.config(ctx).GetSecretsHasher(ctx)
+}
+
+func (c *DynamicConfig) GetTokenURLs(ctx context.Context) []string {
+	return c.config(ctx).GetTokenURLs(ctx)
+}
+
+func (c *DynamicConfig) GetFormPostHTMLTemplate(ctx context.Context) *template.Template {
+	return c.config(ctx).GetFormPostHTMLTemplate(ctx)
+}
+
+func (c *DynamicConfig) GetMessageCatalog(ctx context.Context) i18n.MessageCatalog {
+	return c.config(ctx).GetMessageCatalog(ctx)
+}
+
+func (c *DynamicConfig) GetResponseModeHandlerExtension(ctx context.Context) ResponseModeHandler {
+	return c.config(ctx).GetResponseModeHandlerExtension(ctx)
+}
+
+func (c *DynamicConfig) GetSendDebugMessagesToClients(ctx context.Context) bool {
+	return c.config(ctx).GetSendDebugMessagesToClients(ctx)
+}
+
+func (c *DynamicConfig) GetIDTokenIssuer(ctx context.Context) string {
+	return c.config(ctx).GetIDTokenIssuer(ctx)
+}
+
+func (c *DynamicConfig) GetGrantTypeJWTBearerIssuedDateOptional(ctx context.Context) bool {
+	return c.config(ctx).GetGrantTypeJWTBearerIssuedDateOptional(ctx)
+}
+
+func (c *DynamicConfig) GetGrantTypeJWTBearerIDOptional(ctx context.Context) bool {
+	return c.config(ctx).GetGrantTypeJWTBearerIDOptional(ctx)
+}
+
+func (c *DynamicConfig) GetGrantTypeJWTBearerCanSkipClientAuth(ctx context.Context) bool {
+	return c.config(ctx).GetGrantTypeJWTBearerCanSkipClientAuth(ctx)
+}
+
+func (c *DynamicConfig) GetEnforcePKCE(ctx context.Context) bool {
+	return c.config(ctx).GetEnforcePKCE(ctx)
+}
+
+func (c *DynamicConfig) GetEnablePKCEPlainChallengeMethod(ctx context.Context) bool {
+	return c.config(ctx).GetEnablePKCEPlainChallengeMethod(ctx)
+}
+
+func (c *DynamicConfig) GetEnforcePKCEForPublicClients(ctx context.Context) bool {
+	return c.config(ctx).GetEnforcePKCEForPublicClients(ctx)
+}
+
+func (c *DynamicConfig) GetEnforceOAuth21(ctx context.Context) bool {
+	return c.config(ctx).GetEnforceOAuth21(ctx)
+}
+
+func (c *DynamicConfig) GetSanitationWhiteList(ctx context.Context) []string {
+	return c.config(ctx).GetSanitationWhiteList(ctx)
+}
+
+func (c *DynamicConfig) GetOmitRedirectScopeParam(ctx context.Context) bool {
+	return c.config(ctx).GetOmitRedirectScopeParam(ctx)
+}
+
+func (c *DynamicConfig) GetAccessTokenIssuer(ctx context.Context) string {
+	return c.config(ctx).GetAccessTokenIssuer(ctx)
+}
+
+func (c *DynamicConfig) GetJWTScopeField(ctx context.Context) jwt.JWTScopeFieldEnum {
+	return c.config(ctx).GetJWTScopeField(ctx)
+}
+
+func (c *DynamicConfig) GetAllowedPrompts(ctx context.Context) []string {
+	return c.config(ctx).GetAllowedPrompts(ctx)
+}
+
+func (c *DynamicConfig) GetScopeStrategy(ctx context.Context) ScopeStrategy {
+	return c.config(ctx).GetScopeStrategy(ctx)
+}
+
+func (c *DynamicConfig) GetAudienceStrategy(ctx context.Context) AudienceMatchingStrategy {
+	return c.config(ctx).GetAudienceStrategy(ctx)
+}
+
+func (c *DynamicConfig) GetAuthorizeCodeLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetAuthorizeCodeLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetIDTokenLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetIDTokenLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetAccessTokenLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetAccessTokenLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetVerifiableCredentialsNonceLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetVerifiableCredentialsNonceLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetRefreshTokenLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetRefreshTokenLifespan(ctx)
+}
+
+func (c *DynamicConfig) GetBCryptCost(ctx context.Context) int {
+	return c.config(ctx).GetBCryptCost(ctx)
+}
+
+func (c *DynamicConfig) GetJWKSFetcherStrategy(ctx context.Context) JWKSFetcherStrategy {
+	return c.config(ctx).GetJWKSFetcherStrategy(ctx)
+}
+
+func (c *DynamicConfig) GetTokenEntropy(ctx context.Context) int {
+	return c.config(ctx).GetTokenEntropy(ctx)
+}
+
+func (c *DynamicConfig) GetRedirectSecureChecker(ctx context.Context) func(context.Context, *url.URL) bool {
+	return c.config(ctx).GetRedirectSecureChecker(ctx)
+}
+
+func (c *DynamicConfig) GetRefreshTokenScopes(ctx context.Context) []string {
+	return c.config(ctx).GetRefreshTokenScopes(ctx)
+}
+
+func (c *DynamicConfig) GetMinParameterEntropy(ctx context.Context) int {
+	return c.config(ctx).GetMinParameterEntropy(ctx)
+}
+
+func (c *DynamicConfig) GetJWTMaxDuration(ctx context.Context) time.Duration {
+	return c.config(ctx).GetJWTMaxDuration(ctx)
+}
+
+func (c *DynamicConfig) GetClientAuthenticationStrategy(ctx context.Context) ClientAuthenticationStrategy {
+	return c.config(ctx).GetClientAuthenticationStrategy(ctx)
+}
+
+func (c *DynamicConfig) GetDisableRefreshTokenValidation(ctx context.Context) bool {
+	return c.config(ctx).GetDisableRefreshTokenValidation(ctx)
+}
+
+func (c *DynamicConfig) GetPushedAuthorizeEndpointHandlers(ctx context.Context) PushedAuthorizeEndpointHandlers {
+	return c.config(ctx).GetPushedAuthorizeEndpointHandlers(ctx)
+}
+
+func (c *DynamicConfig) GetPushedAuthorizeRequestURIPrefix(ctx context.Context) string {
+	return c.config(ctx).GetPushedAuthorizeRequestURIPrefix(ctx)
+}
+
+func (c *DynamicConfig) GetPushedAuthorizeContextLifespan(ctx context.Context) time.Duration {
+	return c.config(ctx).GetPushedAuthorizeContextLifespan(ctx)
+}
+
+func (c *DynamicConfig) EnforcePushedAuthorize(ctx context.Context) bool {
+	return c.config(ctx).EnforcePushedAuthorize(ctx)
+}
@@ -0,0 +1,41 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/ory/fosite"
+)
+
+func TestDynamicConfig(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=reads from the resolved configuration", func(t *testing.T) {
+		current := &Config{AccessTokenLifespan: time.Minute, GlobalSecret: []byte("some-secret")}
+		c := &DynamicConfig{Resolve: func(context.Context) (*Config, error) { return current, nil }}
+		assert.Equal(t, time.Minute, c.GetAccessTokenLifespan(ctx))
+
+		current = &Config{AccessTokenLifespan: time.Hour}
+		assert.Equal(t, time.Hour, c.GetAccessTokenLifespan(ctx))
+	})
+
+	t.Run("case=returns resolve errors", func(t *testing.T) {
+		c := &DynamicConfig{Resolve: func(context.Context) (*Config, error) {
+			return new(Config), ErrNotFound
+		}}
+		_, err := c.GetGlobalSecret(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Empty(t, c.GetIDTokenIssuer(ctx))
+	})
+
+	t.Run("case=fails without resolve function", func(t *testing.T) {
+		_, err := new(DynamicConfig).GetGlobalSecret(ctx)
+		assert.ErrorIs(t, err, ErrServerError)
+	})
+}
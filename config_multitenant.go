@@ -0,0 +1,199 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	_ Configurator                         = (*MultiTenantConfig)(nil)
+	_ PushedAuthorizeRequestConfigProvider = (*MultiTenantConfig)(nil)
+	_ ClockProvider                        = (*MultiTenantConfig)(nil)
+	_ JWTLeewayProvider                    = (*MultiTenantConfig)(nil)
+	_ PairwiseSubjectSaltProvider          = (*MultiTenantConfig)(nil)
+	_ OutboundHTTPPolicyProvider           = (*MultiTenantConfig)(nil)
+)
+
+// TenantConfigLoader loads the configuration of a tenant. The configuration usually carries the tenant's issuer,
+// global secrets, lifespans and the handlers composed for the tenant, which in turn hold the tenant's signing keys:
+//
+//	func(ctx context.Context, tenant string) (*fosite.Config, error) {
+//		config := &fosite.Config{IDTokenIssuer: "https://" + tenant + ".example.com", GlobalSecret: secrets[tenant]}
+//		compose.ComposeAllEnabled(config, store.Tenant(tenant), keys[tenant])
+//		return config, nil
+//	}
+type TenantConfigLoader func(ctx context.Context, tenant string) (*Config, error)
+
+// MultiTenantConfig is a Configurator which resolves the configuration from the tenant stored in the request
+// context, which allows a single OAuth2Provider to serve many issuers:
+//
+//	config := fosite.NewMultiTenantConfig(loader)
+//	provider := fosite.NewOAuth2Provider(store, config)
+//
+//	func(rw http.ResponseWriter, req *http.Request) {
+//		ctx, err := config.ContextFromRequest(req, fosite.HostTenantResolver{"foo.example.com": "foo"})
+//		if err != nil { ... }
+//		ar, err := provider.NewAuthorizeRequest(ctx, req)
+//		...
+//	}
+//
+// Tenant configurations are loaded once and cached, see CacheLifespan. Requests of tenants whose configuration
+// cannot be loaded fail, they are never served with the Default configuration. Use NewMultiTenantConfig to create
+// a MultiTenantConfig, as it sets up the embedded DynamicConfig.
+type MultiTenantConfig struct {
+	DynamicConfig
+
+	// LoadTenantConfig loads the configuration of a tenant.
+	LoadTenantConfig TenantConfigLoader
+
+	// Default is the configuration used for contexts which carry no tenant. Defaults to an empty configuration.
+	Default *Config
+
+	// CacheLifespan sets how long tenant configurations are cached. Defaults to 0, which caches them until
+	// Invalidate is called.
+	CacheLifespan time.Duration
+
+	m       sync.RWMutex
+	tenants map[string]cachedTenantConfig
+	// loading contains the loads which are in flight by tenant.
+	loading map[string]*tenantConfigLoad
+}
+
+type cachedTenantConfig struct {
+	config   *Config
+	loadedAt time.Time
+}
+
+type tenantConfigLoad struct {
+	done   chan struct{}
+	config *Config
+	err    error
+}
+
+// tenantConfigContextKey is the context key of the configuration loaded by ContextWithTenant.
+const tenantConfigContextKey = ContextKey("tenantConfig")
+
+// NewMultiTenantConfig returns a MultiTenantConfig which loads tenant configurations using loader.
+func NewMultiTenantConfig(loader TenantConfigLoader) *MultiTenantConfig {
+	c := &MultiTenantConfig{LoadTenantConfig: loader, Default: new(Config)}
+	c.Resolve = c.lookup
+	return c
+}
+
+// TenantConfig returns the configuration of the tenant, loading it if it is not cached. Concurrent calls for the
+// same tenant share one load.
+func (c *MultiTenantConfig) TenantConfig(ctx context.Context, tenant string) (*Config, error) {
+	now := c.defaultConfig().GetClock(ctx).Now()
+
+	c.m.RLock()
+	cached, ok := c.tenants[tenant]
+	c.m.RUnlock()
+	if ok && c.isFresh(cached, now) {
+		return cached.config, nil
+	}
+
+	c.m.Lock()
+	if cached, ok := c.tenants[tenant]; ok && c.isFresh(cached, now) {
+		c.m.Unlock()
+		return cached.config, nil
+	}
+	if load, ok := c.loading[tenant]; ok {
+		// Another request is already loading the configuration, wait for it instead of loading it again.
+		c.m.Unlock()
+		select {
+		case <-load.done:
+			return load.config, load.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	load := &tenantConfigLoad{done: make(chan struct{})}
+	if c.loading == nil {
+		c.loading = make(map[string]*tenantConfigLoad)
+	}
+	c.loading[tenant] = load
+	c.m.Unlock()
+
+	load.config, load.err = c.LoadTenantConfig(ctx, tenant)
+
+	c.m.Lock()
+	// The load is no longer registered if the tenant was invalidated while it was in flight, in which case the
+	// configuration might be outdated and is not cached.
+	if c.loading[tenant] == load {
+		delete(c.loading, tenant)
+		if load.err == nil {
+			if c.tenants == nil {
+				c.tenants = make(map[string]cachedTenantConfig)
+			}
+			c.tenants[tenant] = cachedTenantConfig{config: load.config, loadedAt: now}
+		}
+	}
+	c.m.Unlock()
+	close(load.done)
+
+	if load.err != nil {
+		return nil, load.err
+	}
+	return load.config, nil
+}
+
+func (c *MultiTenantConfig) isFresh(cached cachedTenantConfig, now time.Time) bool {
+	return c.CacheLifespan == 0 || now.Before(cached.loadedAt.Add(c.CacheLifespan))
+}
+
+// Invalidate removes the tenant's configuration from the cache, it is loaded again when it is needed next.
+func (c *MultiTenantConfig) Invalidate(tenant string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.tenants, tenant)
+	delete(c.loading, tenant)
+}
+
+// ContextWithTenant returns a copy of ctx which carries the tenant ID and the tenant's configuration. Unlike
+// WithTenant, it returns an error if the configuration cannot be loaded.
+func (c *MultiTenantConfig) ContextWithTenant(ctx context.Context, tenant string) (context.Context, error) {
+	config, err := c.TenantConfig(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(WithTenant(ctx, tenant), tenantConfigContextKey, config), nil
+}
+
+// ContextFromRequest resolves the tenant of the request and returns a copy of the request context which carries the
+// tenant ID and the tenant's configuration.
+func (c *MultiTenantConfig) ContextFromRequest(r *http.Request, resolver TenantResolver) (context.Context, error) {
+	tenant, err := resolver.ResolveTenant(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.ContextWithTenant(r.Context(), tenant)
+}
+
+// lookup returns the configuration for ctx. If ctx carries a tenant whose configuration cannot be loaded, lookup
+// returns an empty configuration and the error instead of the default configuration, so the requests of the tenant
+// fail rather than being served with the secrets, keys and issuer of the default configuration. Use
+// ContextWithTenant to handle such errors before calling fosite.
+func (c *MultiTenantConfig) lookup(ctx context.Context) (*Config, error) {
+	if config, ok := ctx.Value(tenantConfigContextKey).(*Config); ok {
+		return config, nil
+	} else if tenant := TenantFromContext(ctx); tenant != "" {
+		config, err := c.TenantConfig(ctx, tenant)
+		if err != nil {
+			return new(Config), err
+		}
+		return config, nil
+	}
+	return c.defaultConfig(), nil
+}
+
+func (c *MultiTenantConfig) defaultConfig() *Config {
+	if c.Default == nil {
+		return new(Config)
+	}
+	return c.Default
+}
@@ -6,6 +6,8 @@ package fosite
 import (
 	"context"
 	"reflect"
+
+	"github.com/ory/fosite/token/jwt"
 )
 
 const MinParameterEntropy = 8
@@ -84,12 +86,19 @@ func (a *PushedAuthorizeEndpointHandlers) Append(h PushedAuthorizeEndpointHandle
 
 var _ OAuth2Provider = (*Fosite)(nil)
 
+// Configurator is the configuration of fosite and its handlers. Config, MultiTenantConfig and DynamicConfig
+// implement it.
+//
+// Custom implementations must also implement the EnforceOAuth21Provider, PhantomTokenLifespanProvider,
+// HMACKeysProvider, ClockProvider, JWTLeewayProvider, SubjectIdentifierStrategyProvider, RedirectURIPolicyProvider
+// and LockerProvider interfaces, which were added to Configurator. Embedding *Config provides their defaults.
 type Configurator interface {
 	IDTokenIssuerProvider
 	IDTokenLifespanProvider
 	AllowedPromptsProvider
 	EnforcePKCEProvider
 	EnforcePKCEForPublicClientsProvider
+	EnforceOAuth21Provider
 	EnablePKCEPlainChallengeMethodProvider
 	GrantTypeJWTBearerCanSkipClientAuthProvider
 	GrantTypeJWTBearerIDOptionalProvider
@@ -105,6 +114,7 @@ type Configurator interface {
 	DisableRefreshTokenValidationProvider
 	RefreshTokenScopesProvider
 	AccessTokenLifespanProvider
+	PhantomTokenLifespanProvider
 	RefreshTokenLifespanProvider
 	VerifiableCredentialsNonceLifespanProvider
 	AuthorizeCodeLifespanProvider
@@ -117,6 +127,7 @@ type Configurator interface {
 	AudienceStrategyProvider
 	MinParameterEntropyProvider
 	HMACHashingProvider
+	HMACKeysProvider
 	ClientAuthenticationStrategyProvider
 	ResponseModeHandlerExtensionProvider
 	SendDebugMessagesToClientsProvider
@@ -132,6 +143,11 @@ type Configurator interface {
 	TokenIntrospectionHandlersProvider
 	RevocationHandlersProvider
 	UseLegacyErrorFormatProvider
+	ClockProvider
+	JWTLeewayProvider
+	SubjectIdentifierStrategyProvider
+	RedirectURIPolicyProvider
+	LockerProvider
 }
 
 func NewOAuth2Provider(s Storage, c Configurator) *Fosite {
@@ -160,3 +176,12 @@ func (f *Fosite) ResponseModeHandler(ctx context.Context) ResponseModeHandler {
 	}
 	return defaultResponseModeHandler
 }
+
+// jwtParserOptions returns the options for validating the time based claims of JSON Web Tokens using the
+// configured clock and leeway.
+func (f *Fosite) jwtParserOptions(ctx context.Context) []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithTimeFunc(f.Config.GetClock(ctx).Now),
+		jwt.WithLeeway(f.Config.GetJWTLeeway(ctx)),
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fapi2
+
+import (
+	"context"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/token/jwt"
+)
+
+const confirmationClaim = "cnf"
+
+// Confirmation describes the key a sender-constrained token is bound to, see
+// https://tools.ietf.org/html/rfc7800#section-3.1.
+type Confirmation struct {
+	// JWKThumbprint is the SHA-256 JWK thumbprint of the DPoP proof key, see
+	// https://tools.ietf.org/html/rfc9449#section-6.1.
+	JWKThumbprint string
+
+	// X509Thumbprint is the SHA-256 thumbprint of the client certificate of a mutual TLS connection, see
+	// https://tools.ietf.org/html/rfc8705#section-3.1.
+	X509Thumbprint string
+}
+
+// IsDPoP returns true if the token is bound to a DPoP proof key.
+func (c *Confirmation) IsDPoP() bool {
+	return c != nil && c.JWKThumbprint != ""
+}
+
+// IsEmpty returns true if the confirmation does not bind the token to any key.
+func (c *Confirmation) IsEmpty() bool {
+	return c == nil || (c.JWKThumbprint == "" && c.X509Thumbprint == "")
+}
+
+// SenderConstraintVerifier verifies the proof of possession presented with a token request, for example a DPoP proof
+// (RFC 9449) or the client certificate of a mutual TLS connection (RFC 8705). Implementations usually retrieve the
+// HTTP request or the TLS connection state from the context.
+type SenderConstraintVerifier interface {
+	// VerifySenderConstraint returns the confirmation the issued tokens will be bound to. It returns nil if the
+	// request does not present a proof of possession and an error if the presented proof is invalid.
+	VerifySenderConstraint(ctx context.Context, requester fosite.AccessRequester) (*Confirmation, error)
+}
+
+// SetConfirmation binds the tokens issued for the session to the confirmation by adding a "cnf" claim to the
+// session. The claim is part of JWT access tokens and introspection responses.
+func SetConfirmation(session fosite.Session, confirmation *Confirmation) bool {
+	cnf := map[string]interface{}{}
+	if confirmation.JWKThumbprint != "" {
+		cnf["jkt"] = confirmation.JWKThumbprint
+	}
+	if confirmation.X509Thumbprint != "" {
+		cnf["x5t#S256"] = confirmation.X509Thumbprint
+	}
+
+	if s, ok := session.(oauth2.JWTSessionContainer); ok {
+		if claims, ok := s.GetJWTClaims().(*jwt.JWTClaims); ok && claims != nil {
+			claims.Add(confirmationClaim, cnf)
+			return true
+		}
+	}
+
+	if s, ok := session.(fosite.ExtraClaimsSession); ok {
+		if extra := s.GetExtraClaims(); extra != nil {
+			extra[confirmationClaim] = cnf
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetConfirmation returns the confirmation the tokens issued for the session are bound to, or nil if they are
+// bearer tokens.
+func GetConfirmation(session fosite.Session) *Confirmation {
+	confirmation := new(Confirmation)
+	confirmation.JWKThumbprint, confirmation.X509Thumbprint = fosite.GetConfirmationThumbprints(session)
+	if confirmation.IsEmpty() {
+		return nil
+	}
+	return confirmation
+}
@@ -0,0 +1,143 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fapi2 enforces the FAPI 2.0 Security Profile, see
+// https://openid.net/specs/fapi-2_0-security-profile.html.
+package fapi2
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+)
+
+var (
+	_ fosite.AuthorizeEndpointHandler       = (*Handler)(nil)
+	_ fosite.PushedAuthorizeEndpointHandler = (*Handler)(nil)
+	_ fosite.TokenEndpointHandler           = (*Handler)(nil)
+)
+
+// ClientAuthenticationMethods are the client authentication methods permitted by the FAPI 2.0 Security Profile.
+var ClientAuthenticationMethods = []string{"private_key_jwt", "tls_client_auth", "self_signed_tls_client_auth"}
+
+// Handler enforces the FAPI 2.0 Security Profile per request:
+//
+//   - Authorization requests must be pushed (RFC 9126) and use the authorization code flow with S256 PKCE.
+//   - Clients must authenticate using private_key_jwt or mutual TLS.
+//   - Authorization responses contain the "iss" parameter (RFC 9207).
+//   - Access tokens are sender-constrained using DPoP (RFC 9449) or mutual TLS (RFC 8705). Token requests
+//     without a proof of possession are rejected.
+//
+// The handler must be registered before all other authorize and pushed authorize endpoint handlers, and after all
+// other token endpoint handlers. Token introspection handlers must be wrapped in a SenderConstrainedIntrospector.
+// compose.ComposeFAPI2 takes care of this.
+type Handler struct {
+	SenderConstraintVerifier SenderConstraintVerifier
+	Config                   interface {
+		fosite.IDTokenIssuerProvider
+		fosite.PushedAuthorizeRequestConfigProvider
+	}
+}
+
+func (c *Handler) HandlePushedAuthorizeEndpointRequest(ctx context.Context, ar fosite.AuthorizeRequester, _ fosite.PushedAuthorizeResponder) error {
+	if err := c.validateClientAuthenticationMethod(ar.GetClient()); err != nil {
+		return err
+	}
+	return c.validateAuthorizeRequest(ar)
+}
+
+func (c *Handler) HandleAuthorizeEndpointRequest(ctx context.Context, ar fosite.AuthorizeRequester, resp fosite.AuthorizeResponder) error {
+	if requestURI := ar.GetRequestForm().Get("request_uri"); !strings.HasPrefix(requestURI, c.Config.GetPushedAuthorizeRequestURIPrefix(ctx)) {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("The FAPI 2.0 Security Profile requires authorization requests to be pushed to the pushed authorization request endpoint."))
+	}
+
+	if err := c.validateAuthorizeRequest(ar); err != nil {
+		return err
+	}
+
+	// https://tools.ietf.org/html/rfc9207#section-2
+	resp.AddParameter("iss", c.Config.GetIDTokenIssuer(ctx))
+	return nil
+}
+
+func (c *Handler) CanSkipClientAuth(context.Context, fosite.AccessRequester) bool {
+	return false
+}
+
+func (c *Handler) CanHandleTokenEndpointRequest(_ context.Context, requester fosite.AccessRequester) bool {
+	return requester.GetGrantTypes().ExactOne("authorization_code") ||
+		requester.GetGrantTypes().ExactOne("refresh_token") ||
+		requester.GetGrantTypes().ExactOne("client_credentials")
+}
+
+func (c *Handler) HandleTokenEndpointRequest(ctx context.Context, requester fosite.AccessRequester) error {
+	if !c.CanHandleTokenEndpointRequest(ctx, requester) {
+		return errorsx.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	if err := c.validateClientAuthenticationMethod(requester.GetClient()); err != nil {
+		return err
+	}
+
+	if c.SenderConstraintVerifier == nil {
+		return errorsx.WithStack(fosite.ErrServerError.WithDebug("The FAPI 2.0 handler requires a SenderConstraintVerifier."))
+	}
+
+	confirmation, err := c.SenderConstraintVerifier.VerifySenderConstraint(ctx, requester)
+	if err != nil {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("The proof of possession presented with the token request is invalid.").WithWrap(err).WithDebug(err.Error()))
+	} else if confirmation.IsEmpty() {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("The FAPI 2.0 Security Profile requires sender-constrained access tokens. Present a DPoP proof or a mutual TLS client certificate."))
+	}
+
+	if !SetConfirmation(requester.GetSession(), confirmation) {
+		return errorsx.WithStack(fosite.ErrServerError.WithDebugf("Unable to bind the access token because the session of type %T does not support extra claims.", requester.GetSession()))
+	}
+
+	return nil
+}
+
+func (c *Handler) PopulateTokenEndpointResponse(ctx context.Context, requester fosite.AccessRequester, responder fosite.AccessResponder) error {
+	if !c.CanHandleTokenEndpointRequest(ctx, requester) {
+		return errorsx.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	// https://tools.ietf.org/html/rfc9449#section-5
+	if GetConfirmation(requester.GetSession()).IsDPoP() {
+		responder.SetTokenType("DPoP")
+	}
+	return nil
+}
+
+func (c *Handler) validateAuthorizeRequest(ar fosite.AuthorizeRequester) error {
+	if !ar.GetResponseTypes().ExactOne("code") {
+		return errorsx.WithStack(fosite.ErrUnsupportedResponseType.WithHint("The FAPI 2.0 Security Profile only permits the 'code' response type."))
+	}
+
+	if ar.GetRequestForm().Get("code_challenge") == "" {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("The FAPI 2.0 Security Profile requires the 'code_challenge' parameter."))
+	} else if method := ar.GetRequestForm().Get("code_challenge_method"); method != "S256" {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHintf("The FAPI 2.0 Security Profile requires the 'S256' code challenge method, but '%s' was given.", method))
+	}
+
+	return nil
+}
+
+func (c *Handler) validateClientAuthenticationMethod(client fosite.Client) error {
+	oidcClient, ok := client.(fosite.OpenIDConnectClient)
+	if !ok {
+		return errorsx.WithStack(fosite.ErrInvalidClient.WithHint("The FAPI 2.0 Security Profile requires clients to register a token endpoint authentication method."))
+	}
+
+	method := oidcClient.GetTokenEndpointAuthMethod()
+	for _, allowed := range ClientAuthenticationMethods {
+		if method == allowed {
+			return nil
+		}
+	}
+
+	return errorsx.WithStack(fosite.ErrInvalidClient.WithHintf("The FAPI 2.0 Security Profile does not permit the '%s' client authentication method.", method))
+}
@@ -0,0 +1,217 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fapi2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	. "github.com/ory/fosite/handler/fapi2"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+)
+
+type verifierFunc func(ctx context.Context, requester fosite.AccessRequester) (*Confirmation, error)
+
+func (f verifierFunc) VerifySenderConstraint(ctx context.Context, requester fosite.AccessRequester) (*Confirmation, error) {
+	return f(ctx, requester)
+}
+
+func newClient(method string) fosite.Client {
+	return &fosite.DefaultOpenIDConnectClient{
+		DefaultClient:           &fosite.DefaultClient{ID: "foo"},
+		TokenEndpointAuthMethod: method,
+	}
+}
+
+func newAuthorizeRequest(client fosite.Client, form map[string]string) *fosite.AuthorizeRequest {
+	ar := fosite.NewAuthorizeRequest()
+	ar.Client = client
+	ar.ResponseTypes = fosite.Arguments{"code"}
+	ar.Form.Set("code_challenge", "challenge")
+	ar.Form.Set("code_challenge_method", "S256")
+	for k, v := range form {
+		if v == "" {
+			ar.Form.Del(k)
+		} else {
+			ar.Form.Set(k, v)
+		}
+	}
+	return ar
+}
+
+func TestHandler_HandleAuthorizeEndpointRequest(t *testing.T) {
+	ctx := context.Background()
+	h := &Handler{Config: &fosite.Config{IDTokenIssuer: "https://auth.example.com"}}
+	requestURI := "urn:ietf:params:oauth:request_uri:foo"
+
+	for _, c := range []struct {
+		d      string
+		ar     *fosite.AuthorizeRequest
+		method string
+		err    error
+	}{
+		{d: "accepts pushed requests", ar: newAuthorizeRequest(newClient("private_key_jwt"), map[string]string{"request_uri": requestURI})},
+		{d: "rejects requests which were not pushed", ar: newAuthorizeRequest(newClient("private_key_jwt"), nil), err: fosite.ErrInvalidRequest},
+		{d: "rejects requests without PKCE", ar: newAuthorizeRequest(newClient("private_key_jwt"), map[string]string{"request_uri": requestURI, "code_challenge": ""}), err: fosite.ErrInvalidRequest},
+		{d: "rejects the plain PKCE method", ar: newAuthorizeRequest(newClient("private_key_jwt"), map[string]string{"request_uri": requestURI, "code_challenge_method": "plain"}), err: fosite.ErrInvalidRequest},
+	} {
+		t.Run("case="+c.d, func(t *testing.T) {
+			resp := fosite.NewAuthorizeResponse()
+			err := h.HandleAuthorizeEndpointRequest(ctx, c.ar, resp)
+			if c.err != nil {
+				require.ErrorIs(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "https://auth.example.com", resp.GetParameters().Get("iss"))
+		})
+	}
+
+	t.Run("case=rejects the implicit flow", func(t *testing.T) {
+		ar := newAuthorizeRequest(newClient("private_key_jwt"), map[string]string{"request_uri": requestURI})
+		ar.ResponseTypes = fosite.Arguments{"code", "token"}
+		require.ErrorIs(t, h.HandleAuthorizeEndpointRequest(ctx, ar, fosite.NewAuthorizeResponse()), fosite.ErrUnsupportedResponseType)
+	})
+}
+
+func TestHandler_HandlePushedAuthorizeEndpointRequest(t *testing.T) {
+	ctx := context.Background()
+	h := &Handler{Config: new(fosite.Config)}
+
+	for method, err := range map[string]error{
+		"private_key_jwt":             nil,
+		"tls_client_auth":             nil,
+		"self_signed_tls_client_auth": nil,
+		"client_secret_basic":         fosite.ErrInvalidClient,
+		"none":                        fosite.ErrInvalidClient,
+	} {
+		actual := h.HandlePushedAuthorizeEndpointRequest(ctx, newAuthorizeRequest(newClient(method), nil), nil)
+		if err == nil {
+			assert.NoError(t, actual, method)
+		} else {
+			assert.ErrorIs(t, actual, err, method)
+		}
+	}
+
+	ar := newAuthorizeRequest(&fosite.DefaultClient{ID: "foo"}, nil)
+	assert.ErrorIs(t, h.HandlePushedAuthorizeEndpointRequest(ctx, ar, nil), fosite.ErrInvalidClient)
+}
+
+func TestHandler_TokenEndpoint(t *testing.T) {
+	ctx := context.Background()
+	var confirmation *Confirmation
+	var verifyErr error
+	h := &Handler{
+		Config: new(fosite.Config),
+		SenderConstraintVerifier: verifierFunc(func(context.Context, fosite.AccessRequester) (*Confirmation, error) {
+			return confirmation, verifyErr
+		}),
+	}
+
+	newAccessRequest := func(method string) *fosite.AccessRequest {
+		ar := fosite.NewAccessRequest(&oauth2.JWTSession{})
+		ar.Client = newClient(method)
+		ar.GrantTypes = fosite.Arguments{"authorization_code"}
+		return ar
+	}
+
+	t.Run("case=binds access tokens to DPoP keys", func(t *testing.T) {
+		confirmation, verifyErr = &Confirmation{JWKThumbprint: "thumbprint"}, nil
+		ar := newAccessRequest("private_key_jwt")
+		require.True(t, h.CanHandleTokenEndpointRequest(ctx, ar))
+		require.False(t, h.CanSkipClientAuth(ctx, ar))
+		require.NoError(t, h.HandleTokenEndpointRequest(ctx, ar))
+
+		resp := fosite.NewAccessResponse()
+		resp.SetTokenType("bearer")
+		require.NoError(t, h.PopulateTokenEndpointResponse(ctx, ar, resp))
+		assert.Equal(t, "DPoP", resp.GetTokenType())
+		assert.Equal(t, "thumbprint", ar.GetSession().(*oauth2.JWTSession).GetJWTClaims().ToMapClaims()["cnf"].(map[string]interface{})["jkt"])
+	})
+
+	t.Run("case=binds access tokens to client certificates", func(t *testing.T) {
+		confirmation, verifyErr = &Confirmation{X509Thumbprint: "thumbprint"}, nil
+		ar := newAccessRequest("tls_client_auth")
+		ar.Session = new(fosite.DefaultSession)
+		require.NoError(t, h.HandleTokenEndpointRequest(ctx, ar))
+
+		resp := fosite.NewAccessResponse()
+		resp.SetTokenType("bearer")
+		require.NoError(t, h.PopulateTokenEndpointResponse(ctx, ar, resp))
+		assert.Equal(t, "bearer", resp.GetTokenType())
+		assert.Equal(t, &Confirmation{X509Thumbprint: "thumbprint"}, GetConfirmation(ar.GetSession()))
+	})
+
+	t.Run("case=binds access tokens of OpenID Connect sessions", func(t *testing.T) {
+		confirmation, verifyErr = &Confirmation{JWKThumbprint: "thumbprint"}, nil
+		ar := newAccessRequest("private_key_jwt")
+		ar.Session = openid.NewDefaultSession()
+		require.NoError(t, h.HandleTokenEndpointRequest(ctx, ar))
+
+		resp := fosite.NewAccessResponse()
+		resp.SetTokenType("bearer")
+		require.NoError(t, h.PopulateTokenEndpointResponse(ctx, ar, resp))
+		assert.Equal(t, "DPoP", resp.GetTokenType())
+		assert.Equal(t, &Confirmation{JWKThumbprint: "thumbprint"}, GetConfirmation(ar.GetSession()))
+		assert.True(t, fosite.IsSenderConstrained(ar.GetSession()))
+		assert.Empty(t, ar.GetSession().(*openid.DefaultSession).IDTokenClaims().Extra, "the confirmation is not part of the ID token")
+	})
+
+	t.Run("case=rejects token requests without proof of possession", func(t *testing.T) {
+		confirmation, verifyErr = nil, nil
+		require.ErrorIs(t, h.HandleTokenEndpointRequest(ctx, newAccessRequest("private_key_jwt")), fosite.ErrInvalidRequest)
+
+		confirmation, verifyErr = nil, errors.New("invalid proof")
+		require.ErrorIs(t, h.HandleTokenEndpointRequest(ctx, newAccessRequest("private_key_jwt")), fosite.ErrInvalidRequest)
+	})
+
+	t.Run("case=rejects shared secrets", func(t *testing.T) {
+		confirmation, verifyErr = &Confirmation{JWKThumbprint: "thumbprint"}, nil
+		require.ErrorIs(t, h.HandleTokenEndpointRequest(ctx, newAccessRequest("client_secret_post")), fosite.ErrInvalidClient)
+	})
+
+	t.Run("case=ignores other grants", func(t *testing.T) {
+		ar := newAccessRequest("private_key_jwt")
+		ar.GrantTypes = fosite.Arguments{"password"}
+		assert.False(t, h.CanHandleTokenEndpointRequest(ctx, ar))
+		assert.ErrorIs(t, h.HandleTokenEndpointRequest(ctx, ar), fosite.ErrUnknownRequest)
+	})
+}
+
+type introspectorFunc func(ctx context.Context, accessRequest fosite.AccessRequester) (fosite.TokenUse, error)
+
+func (f introspectorFunc) IntrospectToken(ctx context.Context, _ string, _ fosite.TokenUse, accessRequest fosite.AccessRequester, _ []string) (fosite.TokenUse, error) {
+	return f(ctx, accessRequest)
+}
+
+func TestSenderConstrainedIntrospector(t *testing.T) {
+	ctx := context.Background()
+	var bound bool
+	introspector := &SenderConstrainedIntrospector{TokenIntrospector: introspectorFunc(func(_ context.Context, ar fosite.AccessRequester) (fosite.TokenUse, error) {
+		if bound {
+			SetConfirmation(ar.GetSession(), &Confirmation{JWKThumbprint: "thumbprint"})
+		}
+		return fosite.RefreshToken, nil
+	})}
+
+	_, err := introspector.IntrospectToken(ctx, "token", "", fosite.NewAccessRequest(new(fosite.DefaultSession)), nil)
+	assert.ErrorIs(t, err, fosite.ErrRequestUnauthorized)
+
+	bound = true
+	tu, err := introspector.IntrospectToken(ctx, "token", "", fosite.NewAccessRequest(new(fosite.DefaultSession)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, fosite.RefreshToken, tu)
+
+	introspector.TokenIntrospector = introspectorFunc(func(context.Context, fosite.AccessRequester) (fosite.TokenUse, error) {
+		return "", fosite.ErrUnknownRequest
+	})
+	_, err = introspector.IntrospectToken(ctx, "token", "", fosite.NewAccessRequest(new(fosite.DefaultSession)), nil)
+	assert.ErrorIs(t, err, fosite.ErrUnknownRequest)
+}
@@ -0,0 +1,34 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fapi2
+
+import (
+	"context"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+)
+
+var _ fosite.TokenIntrospector = (*SenderConstrainedIntrospector)(nil)
+
+// SenderConstrainedIntrospector wraps a token introspection handler and rejects tokens which are not
+// sender-constrained, as the FAPI 2.0 Security Profile does not accept bearer tokens. Refresh tokens share the
+// session of the access token they were issued with and are therefore bound as well.
+type SenderConstrainedIntrospector struct {
+	fosite.TokenIntrospector
+}
+
+func (c *SenderConstrainedIntrospector) IntrospectToken(ctx context.Context, token string, tokenUse fosite.TokenUse, accessRequest fosite.AccessRequester, scopes []string) (fosite.TokenUse, error) {
+	tu, err := c.TokenIntrospector.IntrospectToken(ctx, token, tokenUse, accessRequest, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	if GetConfirmation(accessRequest.GetSession()) == nil {
+		return "", errorsx.WithStack(fosite.ErrRequestUnauthorized.WithHint("The FAPI 2.0 Security Profile does not accept bearer tokens which are not sender-constrained."))
+	}
+
+	return tu, nil
+}
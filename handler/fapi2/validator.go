@@ -0,0 +1,109 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fapi2
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+)
+
+const (
+	// MaxAuthorizeCodeLifespan is the maximum lifespan of authorization codes permitted by the FAPI 2.0 Security Profile.
+	MaxAuthorizeCodeLifespan = time.Minute
+
+	// MaxPushedAuthorizeContextLifespan is the maximum lifespan of pushed authorization requests permitted by the
+	// FAPI 2.0 Security Profile.
+	MaxPushedAuthorizeContextLifespan = 10 * time.Minute
+)
+
+// ProfileConfig is the configuration which ValidateConfig inspects.
+type ProfileConfig interface {
+	fosite.Configurator
+	fosite.PushedAuthorizeRequestConfigProvider
+}
+
+// ProfileError lists the settings which violate the FAPI 2.0 Security Profile.
+type ProfileError struct {
+	Violations []string
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("the configuration does not comply with the FAPI 2.0 Security Profile: %s", strings.Join(e.Violations, "; "))
+}
+
+// ValidateConfig returns a *ProfileError if the configuration and the registered handlers do not comply with the FAPI
+// 2.0 Security Profile. Call it before serving requests and refuse to start if it fails.
+func ValidateConfig(ctx context.Context, config ProfileConfig) error {
+	var violations []string
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	if !config.EnforcePushedAuthorize(ctx) {
+		violate("pushed authorization requests must be enforced")
+	}
+	if lifespan := config.GetPushedAuthorizeContextLifespan(ctx); lifespan > MaxPushedAuthorizeContextLifespan {
+		violate("the pushed authorization request lifespan %s exceeds %s", lifespan, MaxPushedAuthorizeContextLifespan)
+	}
+	if !config.GetEnforcePKCE(ctx) {
+		violate("PKCE must be enforced for all clients")
+	}
+	if config.GetEnablePKCEPlainChallengeMethod(ctx) {
+		violate("the plain PKCE challenge method must be disabled")
+	}
+	if lifespan := config.GetAuthorizeCodeLifespan(ctx); lifespan > MaxAuthorizeCodeLifespan {
+		violate("the authorization code lifespan %s exceeds %s", lifespan, MaxAuthorizeCodeLifespan)
+	}
+	if issuer, err := url.Parse(config.GetIDTokenIssuer(ctx)); err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		violate("the issuer identifier must be an https URL")
+	}
+
+	var authorize, pushedAuthorize, token bool
+	for _, h := range config.GetAuthorizeEndpointHandlers(ctx) {
+		switch h := h.(type) {
+		case *Handler:
+			authorize = true
+		case *oauth2.AuthorizeImplicitGrantTypeHandler, *openid.OpenIDConnectImplicitHandler, *openid.OpenIDConnectHybridHandler:
+			violate("the %T handler issues tokens from the authorization endpoint", h)
+		}
+	}
+	if pph, ok := config.(fosite.PushedAuthorizeRequestHandlersProvider); ok {
+		for _, h := range pph.GetPushedAuthorizeEndpointHandlers(ctx) {
+			if _, ok := h.(*Handler); ok {
+				pushedAuthorize = true
+			}
+		}
+	}
+	for _, h := range config.GetTokenEndpointHandlers(ctx) {
+		switch h := h.(type) {
+		case *Handler:
+			token = true
+			if h.SenderConstraintVerifier == nil {
+				violate("a sender constraint verifier for DPoP or mutual TLS must be configured")
+			}
+		case *oauth2.ResourceOwnerPasswordCredentialsGrantHandler:
+			violate("the %T handler implements the resource owner password credentials grant", h)
+		}
+	}
+	if !authorize || !pushedAuthorize || !token {
+		violate("the FAPI 2.0 handler must be registered for the authorize, pushed authorize and token endpoints")
+	}
+	for _, h := range config.GetTokenIntrospectionHandlers(ctx) {
+		if _, ok := h.(*SenderConstrainedIntrospector); !ok {
+			violate("the %T token introspection handler accepts bearer tokens", h)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ProfileError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fapi2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	. "github.com/ory/fosite/handler/fapi2"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/storage"
+)
+
+func TestComposeFAPI2(t *testing.T) {
+	verifier := verifierFunc(func(context.Context, fosite.AccessRequester) (*Confirmation, error) {
+		return nil, nil
+	})
+	newConfig := func() *fosite.Config {
+		return &fosite.Config{
+			IDTokenIssuer: "https://auth.example.com",
+			GlobalSecret:  []byte("some-super-cool-secret-that-nobody-knows"),
+		}
+	}
+
+	t.Run("case=composes a compliant provider", func(t *testing.T) {
+		config := newConfig()
+		provider, err := compose.ComposeFAPI2(config, storage.NewMemoryStore(), gen.MustRSAKey(), verifier)
+		require.NoError(t, err)
+		require.NotNil(t, provider)
+
+		assert.True(t, config.IsPushedAuthorizeEnforced)
+		assert.True(t, config.EnforcePKCE)
+		assert.IsType(t, new(Handler), config.AuthorizeEndpointHandlers[0])
+		assert.IsType(t, new(Handler), config.PushedAuthorizeEndpointHandlers[0])
+		assert.IsType(t, new(Handler), config.TokenEndpointHandlers[len(config.TokenEndpointHandlers)-1])
+		for _, h := range config.TokenIntrospectionHandlers {
+			assert.IsType(t, new(SenderConstrainedIntrospector), h)
+		}
+	})
+
+	t.Run("case=refuses non-compliant settings", func(t *testing.T) {
+		config := newConfig()
+		config.AuthorizeCodeLifespan = time.Hour
+		config.IDTokenIssuer = "http://auth.example.com"
+		_, err := compose.ComposeFAPI2(config, storage.NewMemoryStore(), gen.MustRSAKey(), nil)
+
+		var profileErr *ProfileError
+		require.ErrorAs(t, err, &profileErr)
+		assert.Len(t, profileErr.Violations, 3, "%+v", profileErr.Violations)
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	ctx := context.Background()
+	config := &fosite.Config{IDTokenIssuer: "https://auth.example.com"}
+	config.AuthorizeEndpointHandlers.Append(new(oauth2.AuthorizeImplicitGrantTypeHandler))
+	config.TokenEndpointHandlers.Append(new(oauth2.ResourceOwnerPasswordCredentialsGrantHandler))
+	config.TokenIntrospectionHandlers.Append(new(oauth2.CoreValidator))
+
+	err := ValidateConfig(ctx, config)
+	var profileErr *ProfileError
+	require.ErrorAs(t, err, &profileErr)
+	assert.ElementsMatch(t, []string{
+		"pushed authorization requests must be enforced",
+		"PKCE must be enforced for all clients",
+		"the authorization code lifespan 15m0s exceeds 1m0s",
+		"the *oauth2.AuthorizeImplicitGrantTypeHandler handler issues tokens from the authorization endpoint",
+		"the *oauth2.ResourceOwnerPasswordCredentialsGrantHandler handler implements the resource owner password credentials grant",
+		"the FAPI 2.0 handler must be registered for the authorize, pushed authorize and token endpoints",
+		"the *oauth2.CoreValidator token introspection handler accepts bearer tokens",
+	}, profileErr.Violations)
+}
@@ -7,7 +7,6 @@ import (
 	"context"
 	"net/url"
 	"strings"
-	"time"
 
 	"github.com/ory/x/errorsx"
 
@@ -35,6 +34,8 @@ type AuthorizeExplicitGrantHandler struct {
 		fosite.RefreshTokenScopesProvider
 		fosite.OmitRedirectScopeParamProvider
 		fosite.SanitationAllowedProvider
+		fosite.ClockProvider
+		fosite.LockerProvider
 	}
 }
 
@@ -82,7 +83,7 @@ func (c *AuthorizeExplicitGrantHandler) IssueAuthorizeCode(ctx context.Context,
 		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
 	}
 
-	ar.GetSession().SetExpiresAt(fosite.AuthorizeCode, time.Now().UTC().Add(c.Config.GetAuthorizeCodeLifespan(ctx)))
+	ar.GetSession().SetExpiresAt(fosite.AuthorizeCode, c.Config.GetClock(ctx).Now().UTC().Add(c.Config.GetAuthorizeCodeLifespan(ctx)))
 	if err := c.CoreStorage.CreateAuthorizeCodeSession(ctx, signature, ar.Sanitize(c.GetSanitationWhiteList(ctx))); err != nil {
 		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
 	}
@@ -28,28 +28,14 @@ func (c *AuthorizeExplicitGrantHandler) HandleTokenEndpointRequest(ctx context.C
 	}
 
 	code := request.GetRequestForm().Get("code")
+	if err := verifyTokenFormat(ctx, c.AuthorizeCodeStrategy, fosite.AuthorizeCode, code); err != nil {
+		return errorsx.WithStack(fosite.ErrInvalidGrant.WithWrap(err).WithDebug(err.Error()))
+	}
+
 	signature := c.AuthorizeCodeStrategy.AuthorizeCodeSignature(ctx, code)
 	authorizeRequest, err := c.CoreStorage.GetAuthorizeCodeSession(ctx, signature, request.GetSession())
 	if errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
-		if authorizeRequest == nil {
-			return fosite.ErrServerError.
-				WithHint("Misconfigured code lead to an error that prohibited the OAuth 2.0 Framework from processing this request.").
-				WithDebug("GetAuthorizeCodeSession must return a value for \"fosite.Requester\" when returning \"ErrInvalidatedAuthorizeCode\".")
-		}
-
-		// If an authorize code is used twice, we revoke all refresh and access tokens associated with this request.
-		reqID := authorizeRequest.GetID()
-		hint := "The authorization code has already been used."
-		debug := ""
-		if revErr := c.TokenRevocationStorage.RevokeAccessToken(ctx, reqID); revErr != nil {
-			hint += " Additionally, an error occurred during processing the access token revocation."
-			debug += "Revocation of access_token lead to error " + revErr.Error() + "."
-		}
-		if revErr := c.TokenRevocationStorage.RevokeRefreshToken(ctx, reqID); revErr != nil {
-			hint += " Additionally, an error occurred during processing the refresh token revocation."
-			debug += "Revocation of refresh_token lead to error " + revErr.Error() + "."
-		}
-		return errorsx.WithStack(fosite.ErrInvalidGrant.WithHint(hint).WithDebug(debug))
+		return c.revokeReusedAuthorizeCode(ctx, authorizeRequest)
 	} else if err != nil && errors.Is(err, fosite.ErrNotFound) {
 		return errorsx.WithStack(fosite.ErrInvalidGrant.WithWrap(err).WithDebug(err.Error()))
 	} else if err != nil {
@@ -93,16 +79,39 @@ func (c *AuthorizeExplicitGrantHandler) HandleTokenEndpointRequest(ctx context.C
 	request.SetID(authorizeRequest.GetID())
 
 	atLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypeAuthorizationCode, fosite.AccessToken, c.Config.GetAccessTokenLifespan(ctx))
-	request.GetSession().SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(atLifespan).Round(time.Second))
+	request.GetSession().SetExpiresAt(fosite.AccessToken, c.Config.GetClock(ctx).Now().UTC().Add(atLifespan).Round(time.Second))
 
 	rtLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypeAuthorizationCode, fosite.RefreshToken, c.Config.GetRefreshTokenLifespan(ctx))
 	if rtLifespan > -1 {
-		request.GetSession().SetExpiresAt(fosite.RefreshToken, time.Now().UTC().Add(rtLifespan).Round(time.Second))
+		request.GetSession().SetExpiresAt(fosite.RefreshToken, c.Config.GetClock(ctx).Now().UTC().Add(rtLifespan).Round(time.Second))
 	}
 
 	return nil
 }
 
+// revokeReusedAuthorizeCode revokes all refresh and access tokens issued for the request of an authorize code which is
+// used twice, and returns the error of the token request.
+func (c *AuthorizeExplicitGrantHandler) revokeReusedAuthorizeCode(ctx context.Context, authorizeRequest fosite.Requester) error {
+	if authorizeRequest == nil {
+		return fosite.ErrServerError.
+			WithHint("Misconfigured code lead to an error that prohibited the OAuth 2.0 Framework from processing this request.").
+			WithDebug("GetAuthorizeCodeSession must return a value for \"fosite.Requester\" when returning \"ErrInvalidatedAuthorizeCode\".")
+	}
+
+	reqID := authorizeRequest.GetID()
+	hint := "The authorization code has already been used."
+	debug := ""
+	if revErr := c.TokenRevocationStorage.RevokeAccessToken(ctx, reqID); revErr != nil {
+		hint += " Additionally, an error occurred during processing the access token revocation."
+		debug += "Revocation of access_token lead to error " + revErr.Error() + "."
+	}
+	if revErr := c.TokenRevocationStorage.RevokeRefreshToken(ctx, reqID); revErr != nil {
+		hint += " Additionally, an error occurred during processing the refresh token revocation."
+		debug += "Revocation of refresh_token lead to error " + revErr.Error() + "."
+	}
+	return errorsx.WithStack(fosite.ErrInvalidGrant.WithHint(hint).WithDebug(debug))
+}
+
 func canIssueRefreshToken(ctx context.Context, c *AuthorizeExplicitGrantHandler, request fosite.Requester) bool {
 	scope := c.Config.GetRefreshTokenScopes(ctx)
 	// Require one of the refresh token scopes, if set.
@@ -123,9 +132,20 @@ func (c *AuthorizeExplicitGrantHandler) PopulateTokenEndpointResponse(ctx contex
 
 	code := requester.GetRequestForm().Get("code")
 	signature := c.AuthorizeCodeStrategy.AuthorizeCodeSignature(ctx, code)
-	authorizeRequest, err := c.CoreStorage.GetAuthorizeCodeSession(ctx, signature, requester.GetSession())
+
+	// The code is read, invalidated and exchanged while holding its lock, so it can only be redeemed once.
+	unlock, err := c.Config.GetLocker(ctx).Lock(ctx, fosite.LockKey(fosite.AuthorizeCode, signature))
 	if err != nil {
 		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
+	}
+	defer unlock()
+
+	// A concurrent request may have redeemed the code after HandleTokenEndpointRequest read it.
+	authorizeRequest, err := c.CoreStorage.GetAuthorizeCodeSession(ctx, signature, requester.GetSession())
+	if errors.Is(err, fosite.ErrInvalidatedAuthorizeCode) {
+		return c.revokeReusedAuthorizeCode(ctx, authorizeRequest)
+	} else if err != nil {
+		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
 	} else if err := c.AuthorizeCodeStrategy.ValidateAuthorizeCode(ctx, requester, code); err != nil {
 		// This needs to happen after store retrieval for the session to be hydrated properly
 		return errorsx.WithStack(fosite.ErrInvalidRequest.WithWrap(err).WithDebug(err.Error()))
@@ -177,7 +197,7 @@ func (c *AuthorizeExplicitGrantHandler) PopulateTokenEndpointResponse(ctx contex
 	responder.SetAccessToken(access)
 	responder.SetTokenType("bearer")
 	atLifespan := fosite.GetEffectiveLifespan(requester.GetClient(), fosite.GrantTypeAuthorizationCode, fosite.AccessToken, c.Config.GetAccessTokenLifespan(ctx))
-	responder.SetExpiresIn(getExpiresIn(requester, fosite.AccessToken, atLifespan, time.Now().UTC()))
+	responder.SetExpiresIn(getExpiresIn(requester, fosite.AccessToken, atLifespan, c.Config.GetClock(ctx).Now().UTC()))
 	responder.SetScopes(requester.GetGrantedScopes())
 	if refresh != "" {
 		responder.SetExtra("refresh_token", refresh)
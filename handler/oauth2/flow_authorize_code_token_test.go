@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing" //"time"
 
 	//"github.com/golang/mock/gomock"
@@ -673,3 +675,73 @@ func TestAuthorizeCodeTransactional_HandleTokenEndpointRequest(t *testing.T) {
 		})
 	}
 }
+
+// slowStore widens the window between reading and invalidating single-use artifacts, which makes concurrent
+// redemptions overlap.
+type slowStore struct {
+	*storage.MemoryStore
+}
+
+func (s *slowStore) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return s.MemoryStore.GetAuthorizeCodeSession(ctx, code, session)
+}
+
+func (s *slowStore) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	defer time.Sleep(10 * time.Millisecond)
+	return s.MemoryStore.GetRefreshTokenSession(ctx, signature, session)
+}
+
+func TestAuthorizeCode_PopulateTokenEndpointResponseConcurrent(t *testing.T) {
+	store := &slowStore{MemoryStore: storage.NewMemoryStore()}
+	h := AuthorizeExplicitGrantHandler{
+		CoreStorage:            store,
+		TokenRevocationStorage: store,
+		AuthorizeCodeStrategy:  hmacshaStrategy,
+		AccessTokenStrategy:    hmacshaStrategy,
+		RefreshTokenStrategy:   hmacshaStrategy,
+		Config: &fosite.Config{
+			ScopeStrategy:            fosite.HierarchicScopeStrategy,
+			AudienceMatchingStrategy: fosite.DefaultAudienceMatchingStrategy,
+			AccessTokenLifespan:      time.Minute,
+			Locker:                   fosite.NewMemoryLocker(),
+		},
+	}
+
+	newRequest := func(code string) *fosite.AccessRequest {
+		areq := fosite.NewAccessRequest(&fosite.DefaultSession{})
+		areq.ID = "request-id"
+		areq.GrantTypes = fosite.Arguments{"authorization_code"}
+		areq.Client = &fosite.DefaultClient{GrantTypes: fosite.Arguments{"authorization_code", "refresh_token"}}
+		areq.GrantedScope = fosite.Arguments{"offline"}
+		areq.Form = url.Values{"code": {code}}
+		return areq
+	}
+
+	code, signature, err := hmacshaStrategy.GenerateAuthorizeCode(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAuthorizeCodeSession(context.Background(), signature, newRequest(code)))
+
+	var wg sync.WaitGroup
+	var redeemed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.PopulateTokenEndpointResponse(context.Background(), newRequest(code), fosite.NewAccessResponse()); err == nil {
+				atomic.AddInt32(&redeemed, 1)
+			} else {
+				assert.ErrorIs(t, err, fosite.ErrInvalidGrant)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, redeemed, "the authorize code must be redeemed exactly once")
+	assert.Empty(t, store.AccessTokens, "the tokens of a reused authorize code are revoked")
+	require.Len(t, store.RefreshTokens, 1)
+	for signature := range store.RefreshTokens {
+		_, err := store.GetRefreshTokenSession(context.Background(), signature, nil)
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+	}
+}
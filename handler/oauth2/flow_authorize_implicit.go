@@ -27,6 +27,8 @@ type AuthorizeImplicitGrantTypeHandler struct {
 		fosite.AccessTokenLifespanProvider
 		fosite.ScopeStrategyProvider
 		fosite.AudienceStrategyProvider
+		fosite.ClockProvider
+		fosite.EnforceOAuth21Provider
 	}
 }
 
@@ -65,10 +67,15 @@ func (c *AuthorizeImplicitGrantTypeHandler) HandleAuthorizeEndpointRequest(ctx c
 }
 
 func (c *AuthorizeImplicitGrantTypeHandler) IssueImplicitAccessToken(ctx context.Context, ar fosite.AuthorizeRequester, resp fosite.AuthorizeResponder) error {
+	// OAuth 2.1 does not permit issuing access tokens from the authorization endpoint.
+	if c.Config.GetEnforceOAuth21(ctx) {
+		return errorsx.WithStack(fosite.ErrUnsupportedResponseType.WithHint("The authorization server does not issue access tokens from the authorization endpoint, use the authorization code flow instead."))
+	}
+
 	// Only override expiry if none is set.
 	atLifespan := fosite.GetEffectiveLifespan(ar.GetClient(), fosite.GrantTypeImplicit, fosite.AccessToken, c.Config.GetAccessTokenLifespan(ctx))
 	if ar.GetSession().GetExpiresAt(fosite.AccessToken).IsZero() {
-		ar.GetSession().SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(atLifespan).Round(time.Second))
+		ar.GetSession().SetExpiresAt(fosite.AccessToken, c.Config.GetClock(ctx).Now().UTC().Add(atLifespan).Round(time.Second))
 	}
 
 	// Generate the code
@@ -81,7 +88,7 @@ func (c *AuthorizeImplicitGrantTypeHandler) IssueImplicitAccessToken(ctx context
 		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
 	}
 	resp.AddParameter("access_token", token)
-	resp.AddParameter("expires_in", strconv.FormatInt(int64(getExpiresIn(ar, fosite.AccessToken, atLifespan, time.Now().UTC())/time.Second), 10))
+	resp.AddParameter("expires_in", strconv.FormatInt(int64(getExpiresIn(ar, fosite.AccessToken, atLifespan, c.Config.GetClock(ctx).Now().UTC())/time.Second), 10))
 	resp.AddParameter("token_type", "bearer")
 	resp.AddParameter("state", ar.GetState())
 	resp.AddParameter("scope", strings.Join(ar.GetGrantedScopes(), " "))
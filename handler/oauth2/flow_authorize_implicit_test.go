@@ -167,3 +167,22 @@ func TestDefaultResponseMode_AuthorizeImplicit_EndpointHandler(t *testing.T) {
 
 	internal.RequireEqualTime(t, time.Now().UTC().Add(*internal.TestLifespans.ImplicitGrantAccessTokenLifespan), areq.Session.GetExpiresAt(fosite.AccessToken), time.Minute)
 }
+
+func TestAuthorizeImplicit_EndpointHandlerWithOAuth21(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	areq := fosite.NewAuthorizeRequest()
+	areq.Session = new(fosite.DefaultSession)
+	areq.ResponseTypes = fosite.Arguments{"token"}
+	areq.Client = &fosite.DefaultClient{
+		GrantTypes:    fosite.Arguments{"implicit"},
+		ResponseTypes: fosite.Arguments{"token"},
+	}
+
+	h, _, _, aresp := makeAuthorizeImplicitGrantTypeHandler(ctrl)
+	h.Config.(*fosite.Config).EnforceOAuth21 = true
+
+	err := h.HandleAuthorizeEndpointRequest(context.Background(), areq, aresp)
+	require.ErrorIs(t, err, fosite.ErrUnsupportedResponseType)
+}
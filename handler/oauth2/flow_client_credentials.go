@@ -5,7 +5,6 @@ package oauth2
 
 import (
 	"context"
-	"time"
 
 	"github.com/ory/x/errorsx"
 
@@ -20,6 +19,7 @@ type ClientCredentialsGrantHandler struct {
 		fosite.ScopeStrategyProvider
 		fosite.AudienceStrategyProvider
 		fosite.AccessTokenLifespanProvider
+		fosite.ClockProvider
 	}
 }
 
@@ -49,7 +49,7 @@ func (c *ClientCredentialsGrantHandler) HandleTokenEndpointRequest(ctx context.C
 	// if the client is not public, he has already been authenticated by the access request handler.
 
 	atLifespan := fosite.GetEffectiveLifespan(client, fosite.GrantTypeClientCredentials, fosite.AccessToken, c.Config.GetAccessTokenLifespan(ctx))
-	request.GetSession().SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(atLifespan))
+	request.GetSession().SetExpiresAt(fosite.AccessToken, c.Config.GetClock(ctx).Now().UTC().Add(atLifespan))
 	return nil
 }
 
@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -522,6 +524,53 @@ func TestRefreshFlow_PopulateTokenEndpointResponse(t *testing.T) {
 	}
 }
 
+func TestRefreshFlow_PopulateTokenEndpointResponseConcurrent(t *testing.T) {
+	store := &slowStore{MemoryStore: storage.NewMemoryStore()}
+	h := RefreshTokenGrantHandler{
+		TokenRevocationStorage: store,
+		RefreshTokenStrategy:   hmacshaStrategy,
+		AccessTokenStrategy:    hmacshaStrategy,
+		Config: &fosite.Config{
+			AccessTokenLifespan:      time.Hour,
+			ScopeStrategy:            fosite.HierarchicScopeStrategy,
+			AudienceMatchingStrategy: fosite.DefaultAudienceMatchingStrategy,
+			Locker:                   fosite.NewMemoryLocker(),
+		},
+	}
+
+	newRequest := func(token string) *fosite.AccessRequest {
+		areq := fosite.NewAccessRequest(&fosite.DefaultSession{})
+		areq.ID = "request-id"
+		areq.GrantTypes = fosite.Arguments{"refresh_token"}
+		areq.Client = &fosite.DefaultClient{}
+		areq.Form = url.Values{"refresh_token": {token}}
+		return areq
+	}
+
+	token, signature, err := hmacshaStrategy.GenerateRefreshToken(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateRefreshTokenSession(context.Background(), signature, newRequest(token)))
+
+	var wg sync.WaitGroup
+	var redeemed int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.PopulateTokenEndpointResponse(context.Background(), newRequest(token), fosite.NewAccessResponse()); err == nil {
+				atomic.AddInt32(&redeemed, 1)
+			} else {
+				assert.ErrorIs(t, err, fosite.ErrInvalidRequest)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, redeemed, "the refresh token must be rotated exactly once")
+	assert.Len(t, store.AccessTokens, 1)
+	assert.Len(t, store.RefreshTokens, 2, "the revoked refresh token and its successor")
+}
+
 func TestRefreshFlowTransactional_PopulateTokenEndpointResponse(t *testing.T) {
 	var mockTransactional *internal.MockTransactional
 	var mockRevocationStore *internal.MockTokenRevocationStorage
@@ -1086,3 +1135,62 @@ func TestRefreshFlowTransactional_PopulateTokenEndpointResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshFlow_PopulateTokenEndpointResponseWithOAuth21(t *testing.T) {
+	for _, c := range []struct {
+		description string
+		client      fosite.Client
+		session     *fosite.DefaultSession
+		gracePeriod bool
+	}{
+		{
+			description: "public clients must not use the grace period",
+			client:      &fosite.DefaultClient{Public: true},
+			session:     &fosite.DefaultSession{},
+		},
+		{
+			description: "public clients with sender-constrained tokens may use the grace period",
+			client:      &fosite.DefaultClient{Public: true},
+			session:     &fosite.DefaultSession{Extra: map[string]interface{}{"cnf": map[string]interface{}{"jkt": "thumbprint"}}},
+			gracePeriod: true,
+		},
+		{
+			description: "confidential clients may use the grace period",
+			client:      &fosite.DefaultClient{},
+			session:     &fosite.DefaultSession{},
+			gracePeriod: true,
+		},
+	} {
+		t.Run("case="+c.description, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			request := fosite.NewAccessRequest(c.session)
+			request.Client = c.client
+			request.GrantTypes = fosite.Arguments{"refresh_token"}
+
+			store := internal.NewMockTokenRevocationStorage(ctrl)
+			store.EXPECT().GetRefreshTokenSession(ctx, gomock.Any(), nil).Return(request, nil)
+			store.EXPECT().RevokeAccessToken(ctx, gomock.Any()).Return(nil)
+			if c.gracePeriod {
+				store.EXPECT().RevokeRefreshTokenMaybeGracePeriod(ctx, gomock.Any(), gomock.Any()).Return(nil)
+			} else {
+				store.EXPECT().RevokeRefreshToken(ctx, gomock.Any()).Return(nil)
+			}
+			store.EXPECT().CreateAccessTokenSession(ctx, gomock.Any(), gomock.Any()).Return(nil)
+			store.EXPECT().CreateRefreshTokenSession(ctx, gomock.Any(), gomock.Any()).Return(nil)
+
+			h := RefreshTokenGrantHandler{
+				TokenRevocationStorage: store,
+				AccessTokenStrategy:    hmacshaStrategy,
+				RefreshTokenStrategy:   hmacshaStrategy,
+				Config: &fosite.Config{
+					AccessTokenLifespan: time.Hour,
+					EnforceOAuth21:      true,
+				},
+			}
+			require.NoError(t, h.PopulateTokenEndpointResponse(ctx, request, fosite.NewAccessResponse()))
+		})
+	}
+}
@@ -30,6 +30,8 @@ type ResourceOwnerPasswordCredentialsGrantHandler struct {
 		fosite.RefreshTokenScopesProvider
 		fosite.RefreshTokenLifespanProvider
 		fosite.AccessTokenLifespanProvider
+		fosite.ClockProvider
+		fosite.EnforceOAuth21Provider
 	}
 }
 
@@ -39,6 +41,10 @@ func (c *ResourceOwnerPasswordCredentialsGrantHandler) HandleTokenEndpointReques
 		return errorsx.WithStack(fosite.ErrUnknownRequest)
 	}
 
+	if c.Config.GetEnforceOAuth21(ctx) {
+		return errorsx.WithStack(fosite.ErrUnsupportedGrantType.WithHint("The authorization server does not support the resource owner password credentials grant."))
+	}
+
 	if !request.GetClient().GetGrantTypes().Has("password") {
 		return errorsx.WithStack(fosite.ErrUnauthorizedClient.WithHint("The client is not allowed to use authorization grant 'password'."))
 	}
@@ -68,11 +74,11 @@ func (c *ResourceOwnerPasswordCredentialsGrantHandler) HandleTokenEndpointReques
 	delete(request.GetRequestForm(), "password")
 
 	atLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypePassword, fosite.AccessToken, c.Config.GetAccessTokenLifespan(ctx))
-	request.GetSession().SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(atLifespan).Round(time.Second))
+	request.GetSession().SetExpiresAt(fosite.AccessToken, c.Config.GetClock(ctx).Now().UTC().Add(atLifespan).Round(time.Second))
 
 	rtLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypePassword, fosite.RefreshToken, c.Config.GetRefreshTokenLifespan(ctx))
 	if rtLifespan > -1 {
-		request.GetSession().SetExpiresAt(fosite.RefreshToken, time.Now().UTC().Add(rtLifespan).Round(time.Second))
+		request.GetSession().SetExpiresAt(fosite.RefreshToken, c.Config.GetClock(ctx).Now().UTC().Add(rtLifespan).Round(time.Second))
 	}
 
 	return nil
@@ -39,6 +39,15 @@ func TestResourceOwnerFlow_HandleTokenEndpointRequest(t *testing.T) {
 				areq.GrantTypes = fosite.Arguments{"123"}
 			},
 		},
+		{
+			description: "should fail because OAuth 2.1 is enforced",
+			setup: func(config *fosite.Config) {
+				config.EnforceOAuth21 = true
+				areq.GrantTypes = fosite.Arguments{"password"}
+				areq.Client = &fosite.DefaultClient{GrantTypes: fosite.Arguments{"password"}}
+			},
+			expectErr: fosite.ErrUnsupportedGrantType,
+		},
 		{
 			description: "should fail because scope missing",
 			setup: func(config *fosite.Config) {
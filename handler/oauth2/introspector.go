@@ -9,11 +9,17 @@ import (
 	"github.com/ory/x/errorsx"
 
 	"github.com/ory/fosite"
+	"github.com/ory/fosite/token/jwt"
 )
 
 type coreValidatorConfigProvider interface {
 	fosite.ScopeStrategyProvider
 	fosite.DisableRefreshTokenValidationProvider
+	fosite.PhantomTokenLifespanProvider
+	fosite.AccessTokenIssuerProvider
+	fosite.JWTScopeFieldProvider
+	fosite.ClockProvider
+	fosite.SubjectIdentifierStrategyProvider
 }
 
 var _ fosite.TokenIntrospector = (*CoreValidator)(nil)
@@ -22,6 +28,13 @@ type CoreValidator struct {
 	CoreStrategy
 	CoreStorage
 	Config coreValidatorConfigProvider
+
+	// PhantomTokenSigner optionally signs the JWTs which resource servers receive in exchange for opaque access
+	// tokens. See IssuePhantomToken.
+	PhantomTokenSigner jwt.Signer
+
+	// PhantomTokenCache optionally caches phantom tokens.
+	PhantomTokenCache *PhantomTokenCache
 }
 
 func (c *CoreValidator) IntrospectToken(ctx context.Context, token string, tokenUse fosite.TokenUse, accessRequest fosite.AccessRequester, scopes []string) (fosite.TokenUse, error) {
@@ -67,6 +80,10 @@ func matchScopes(ss fosite.ScopeStrategy, granted, scopes []string) error {
 }
 
 func (c *CoreValidator) introspectAccessToken(ctx context.Context, token string, accessRequest fosite.AccessRequester, scopes []string) error {
+	if err := verifyTokenFormat(ctx, c.CoreStrategy, fosite.AccessToken, token); err != nil {
+		return errorsx.WithStack(fosite.ErrRequestUnauthorized.WithWrap(err).WithDebug(err.Error()))
+	}
+
 	sig := c.CoreStrategy.AccessTokenSignature(ctx, token)
 	or, err := c.CoreStorage.GetAccessTokenSession(ctx, sig, accessRequest.GetSession())
 	if err != nil {
@@ -84,6 +101,10 @@ func (c *CoreValidator) introspectAccessToken(ctx context.Context, token string,
 }
 
 func (c *CoreValidator) introspectRefreshToken(ctx context.Context, token string, accessRequest fosite.AccessRequester, scopes []string) error {
+	if err := verifyTokenFormat(ctx, c.CoreStrategy, fosite.RefreshToken, token); err != nil {
+		return errorsx.WithStack(fosite.ErrRequestUnauthorized.WithWrap(err).WithDebug(err.Error()))
+	}
+
 	sig := c.CoreStrategy.RefreshTokenSignature(ctx, token)
 	or, err := c.CoreStorage.GetRefreshTokenSession(ctx, sig, accessRequest.GetSession())
 
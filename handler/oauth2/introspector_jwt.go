@@ -7,14 +7,26 @@ import (
 	"context"
 	"time"
 
+	"github.com/ory/x/errorsx"
+
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/token/jwt"
 )
 
 type StatelessJWTValidator struct {
 	jwt.Signer
+
+	// JWTRevocationStorage is optional. If set, tokens whose jti is on the deny-list are rejected.
+	JWTRevocationStorage JWTRevocationStorage
+
+	// RevokedJWTFilter is optional. If set, the deny-list is only consulted for tokens which the filter reports as
+	// possibly revoked.
+	RevokedJWTFilter *RevokedJWTFilter
+
 	Config interface {
 		fosite.ScopeStrategyProvider
+		fosite.ClockProvider
+		fosite.JWTLeewayProvider
 	}
 }
 
@@ -69,11 +81,15 @@ func AccessTokenJWTToRequest(token *jwt.Token) fosite.Requester {
 }
 
 func (v *StatelessJWTValidator) IntrospectToken(ctx context.Context, token string, tokenUse fosite.TokenUse, accessRequest fosite.AccessRequester, scopes []string) (fosite.TokenUse, error) {
-	t, err := validate(ctx, v.Signer, token)
+	t, err := validate(ctx, v.Signer, token, v.Config.GetClock(ctx).Now(), v.Config.GetJWTLeeway(ctx))
 	if err != nil {
 		return "", err
 	}
 
+	if err := v.checkRevocation(ctx, t); err != nil {
+		return "", err
+	}
+
 	// TODO: From here we assume it is an access token, but how do we know it is really and that is not an ID token?
 
 	requester := AccessTokenJWTToRequest(t)
@@ -86,3 +102,22 @@ func (v *StatelessJWTValidator) IntrospectToken(ctx context.Context, token strin
 
 	return fosite.AccessToken, nil
 }
+
+func (v *StatelessJWTValidator) checkRevocation(ctx context.Context, t *jwt.Token) error {
+	if v.JWTRevocationStorage == nil {
+		return nil
+	}
+
+	jti, _ := t.Claims["jti"].(string)
+	if jti == "" || (v.RevokedJWTFilter != nil && !v.RevokedJWTFilter.MayContain(jti)) {
+		return nil
+	}
+
+	revoked, err := v.JWTRevocationStorage.IsJWTRevoked(ctx, jti)
+	if err != nil {
+		return errorsx.WithStack(fosite.ErrServerError.WithWrap(err).WithDebug(err.Error()))
+	} else if revoked {
+		return errorsx.WithStack(fosite.ErrInactiveToken.WithHint("Token has been revoked."))
+	}
+	return nil
+}
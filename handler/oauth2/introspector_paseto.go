@@ -0,0 +1,57 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/fosite/token/paseto"
+)
+
+// StatelessPASETOValidator validates access tokens issued by DefaultPASETOStrategy using only the claims encrypted in
+// the token. Tokens which are not PASETO tokens are left to other introspection handlers.
+type StatelessPASETOValidator struct {
+	Encrypter *paseto.LocalEncrypter
+
+	// Storage is optional. If set, tokens whose signature is no longer stored are rejected, which makes revocation
+	// effective at the cost of a storage lookup.
+	Storage AccessTokenStorage
+
+	Config interface {
+		fosite.ScopeStrategyProvider
+		fosite.ClockProvider
+		fosite.JWTLeewayProvider
+	}
+}
+
+func (v *StatelessPASETOValidator) IntrospectToken(ctx context.Context, token string, tokenUse fosite.TokenUse, accessRequest fosite.AccessRequester, scopes []string) (fosite.TokenUse, error) {
+	if !strings.HasPrefix(token, paseto.LocalHeader) {
+		return "", errorsx.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	claims, err := decryptPASETO(ctx, v.Encrypter, fosite.AccessToken, token, v.Config.GetClock(ctx).Now(), v.Config.GetJWTLeeway(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	if v.Storage != nil {
+		if _, err := v.Storage.GetAccessTokenSession(ctx, paseto.Tag(token), nil); err != nil {
+			return "", errorsx.WithStack(fosite.ErrRequestUnauthorized.WithWrap(err).WithDebug(err.Error()))
+		}
+	}
+
+	requester := AccessTokenJWTToRequest(&jwt.Token{Header: map[string]interface{}{}, Claims: claims})
+	if err := matchScopes(v.Config.GetScopeStrategy(ctx), requester.GetGrantedScopes(), scopes); err != nil {
+		return fosite.AccessToken, err
+	}
+
+	accessRequest.Merge(requester)
+
+	return fosite.AccessToken, nil
+}
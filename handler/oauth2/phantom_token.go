@@ -0,0 +1,220 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/pkg/errors"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+)
+
+var _ fosite.PhantomTokenIssuer = (*CoreValidator)(nil)
+
+const defaultPhantomTokenCacheMaxSize = 10000
+
+// PhantomTokenCache caches phantom tokens by the signature of the access token they were issued for, so that an API
+// gateway introspecting the same access token repeatedly does not cause a signature for every request. Entries of a
+// request are removed when its tokens are revoked through a TokenRevocationHandler using the same cache.
+type PhantomTokenCache struct {
+	cache   *ristretto.Cache
+	maxSize int64
+
+	// requests indexes the cached entries by request ID. It is guarded by m and updated when ristretto evicts,
+	// expires or replaces an entry.
+	m        sync.Mutex
+	requests map[string]map[string]*phantomTokenEntry
+}
+
+type phantomTokenEntry struct {
+	signature string
+	requestID string
+	token     string
+	expiresAt time.Time
+}
+
+// NewPhantomTokenCache returns a cache of at most 10000 phantom tokens, unless configured otherwise.
+func NewPhantomTokenCache(opts ...func(*PhantomTokenCache)) *PhantomTokenCache {
+	c := &PhantomTokenCache{
+		maxSize:  defaultPhantomTokenCacheMaxSize,
+		requests: make(map[string]map[string]*phantomTokenEntry),
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	if c.maxSize < 1 {
+		c.maxSize = 1
+	}
+
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: c.maxSize * 10,
+		MaxCost:     c.maxSize,
+		BufferItems: 64,
+		Metrics:     false,
+		Cost: func(value interface{}) int64 {
+			return 1
+		},
+		OnExit: c.removeFromIndex,
+	})
+	if err != nil {
+		panic(err)
+	}
+	c.cache = cache
+
+	return c
+}
+
+// PhantomTokenCacheWithMaxSize sets the maximum number of cached phantom tokens. Defaults to 10000.
+func PhantomTokenCacheWithMaxSize(size int64) func(*PhantomTokenCache) {
+	return func(c *PhantomTokenCache) {
+		c.maxSize = size
+	}
+}
+
+// Get returns the phantom token cached for the access token signature if it is still valid at the given time.
+func (c *PhantomTokenCache) Get(signature string, now time.Time) (string, bool) {
+	v, ok := c.cache.Get(signature)
+	if !ok {
+		return "", false
+	}
+
+	entry := v.(*phantomTokenEntry)
+	if !now.Before(entry.expiresAt) {
+		return "", false
+	}
+	return entry.token, true
+}
+
+// Set caches the phantom token for the access token signature until the given time.
+func (c *PhantomTokenCache) Set(signature, requestID, token string, expiresAt time.Time, now time.Time) {
+	ttl := expiresAt.Sub(now)
+	if ttl <= 0 {
+		return
+	}
+
+	entry := &phantomTokenEntry{signature: signature, requestID: requestID, token: token, expiresAt: expiresAt}
+	c.m.Lock()
+	signatures, ok := c.requests[requestID]
+	if !ok {
+		signatures = make(map[string]*phantomTokenEntry)
+		c.requests[requestID] = signatures
+	}
+	signatures[signature] = entry
+	c.m.Unlock()
+
+	// Rejected entries are removed from the index by removeFromIndex.
+	c.cache.SetWithTTL(signature, entry, 1, ttl)
+	c.cache.Wait()
+}
+
+// InvalidateRequest removes the phantom tokens of all access tokens of the given request.
+func (c *PhantomTokenCache) InvalidateRequest(requestID string) {
+	c.m.Lock()
+	signatures := c.requests[requestID]
+	delete(c.requests, requestID)
+	c.m.Unlock()
+
+	// ristretto calls removeFromIndex synchronously, so the cache must not be modified while holding m.
+	for signature := range signatures {
+		c.cache.Del(signature)
+	}
+}
+
+// removeFromIndex is called by ristretto whenever an entry leaves the cache.
+func (c *PhantomTokenCache) removeFromIndex(value interface{}) {
+	entry, ok := value.(*phantomTokenEntry)
+	if !ok {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	signatures := c.requests[entry.requestID]
+	// The entry may have been replaced by a newer phantom token for the same signature.
+	if signatures[entry.signature] != entry {
+		return
+	}
+	delete(signatures, entry.signature)
+	if len(signatures) == 0 {
+		delete(c.requests, entry.requestID)
+	}
+}
+
+// IssuePhantomToken exchanges an opaque access token, which has already been introspected into the requester, for a
+// short-lived JWT signed by PhantomTokenSigner. The claims are taken from the session's JWTClaimsContainer, which means
+// the introspection session must implement JWTSessionContainer. The JWT expires after the configured phantom token
+// lifespan, but never after the access token. Returns fosite.ErrUnknownRequest if PhantomTokenSigner is not set.
+func (c *CoreValidator) IssuePhantomToken(ctx context.Context, token string, requester fosite.AccessRequester) (string, error) {
+	if c.PhantomTokenSigner == nil {
+		return "", errorsx.WithStack(fosite.ErrUnknownRequest)
+	}
+
+	signature := c.CoreStrategy.AccessTokenSignature(ctx, token)
+	now := c.Config.GetClock(ctx).Now().UTC()
+	if c.PhantomTokenCache != nil {
+		if phantomToken, ok := c.PhantomTokenCache.Get(signature, now); ok {
+			return phantomToken, nil
+		}
+	}
+
+	jwtSession, ok := requester.GetSession().(JWTSessionContainer)
+	if !ok {
+		return "", errors.Errorf("Session must be of type JWTSessionContainer but got type: %T", requester.GetSession())
+	} else if jwtSession.GetJWTClaims() == nil {
+		return "", errors.New("GetTokenClaims() must not be nil")
+	}
+
+	lifespan := c.Config.GetPhantomTokenLifespan(ctx)
+	expiresAt := now.Add(lifespan)
+	if exp := jwtSession.GetExpiresAt(fosite.AccessToken); !exp.IsZero() && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+
+	mapClaims := jwtSession.GetJWTClaims().
+		With(
+			expiresAt,
+			requester.GetGrantedScopes(),
+			requester.GetGrantedAudience(),
+		).
+		WithDefaults(
+			now,
+			c.Config.GetAccessTokenIssuer(ctx),
+		).
+		WithScopeField(
+			c.Config.GetJWTScopeField(ctx),
+		).
+		ToMapClaims()
+	// The phantom token is issued now, not when the access token was issued.
+	mapClaims["iat"] = now.Unix()
+	if sub, ok := mapClaims["sub"].(string); ok && sub != "" {
+		subject, err := c.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, requester.GetClient(), sub)
+		if err != nil {
+			return "", err
+		}
+		mapClaims["sub"] = subject
+	}
+	if requester.GetClient().GetID() != "" {
+		mapClaims["client_id"] = requester.GetClient().GetID()
+	}
+
+	phantomToken, _, err := c.PhantomTokenSigner.Generate(ctx, mapClaims, jwtSession.GetJWTHeader())
+	if err != nil {
+		return "", err
+	}
+
+	if c.PhantomTokenCache != nil {
+		// Hand out cached tokens only during the first half of their lifespan, so downstream services always receive
+		// tokens with a reasonable remaining lifetime.
+		c.PhantomTokenCache.Set(signature, requester.GetID(), phantomToken, now.Add(expiresAt.Sub(now)/2), now)
+	}
+	return phantomToken, nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage"
+)
+
+func TestCoreValidator_IssuePhantomToken(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	cache := NewPhantomTokenCache()
+	v := &CoreValidator{
+		CoreStrategy:       hmacshaStrategy,
+		CoreStorage:        store,
+		Config:             &fosite.Config{PhantomTokenLifespan: time.Hour},
+		PhantomTokenSigner: j.Signer,
+		PhantomTokenCache:  cache,
+	}
+
+	request := jwtValidCase(fosite.AccessToken)
+	request.ID = "request-id"
+	request.Client = &fosite.DefaultClient{ID: "client-id"}
+	request.Session.SetExpiresAt(fosite.AccessToken, time.Now().Add(10*time.Minute))
+	token, signature, err := hmacshaStrategy.GenerateAccessToken(ctx, request)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(ctx, signature, request))
+
+	ar := fosite.NewAccessRequest(new(JWTSession))
+	_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, ar, nil)
+	require.NoError(t, err)
+
+	phantomToken, err := v.IssuePhantomToken(ctx, token, ar)
+	require.NoError(t, err)
+
+	decoded, err := j.Signer.Decode(ctx, phantomToken)
+	require.NoError(t, err)
+	assert.Equal(t, "peter", decoded.Claims["sub"])
+	assert.Equal(t, "client-id", decoded.Claims["client_id"])
+	assert.Equal(t, "bar", decoded.Claims["foo"])
+	assert.InDelta(t, time.Now().Add(10*time.Minute).Unix(), decoded.Claims["exp"], 5, "phantom tokens never outlive the access token")
+
+	cached, err := v.IssuePhantomToken(ctx, token, ar)
+	require.NoError(t, err)
+	assert.Equal(t, phantomToken, cached)
+
+	t.Run("case=revocation invalidates the cache", func(t *testing.T) {
+		r := &TokenRevocationHandler{
+			TokenRevocationStorage: store,
+			AccessTokenStrategy:    hmacshaStrategy,
+			RefreshTokenStrategy:   hmacshaStrategy,
+			PhantomTokenCache:      cache,
+		}
+		require.NoError(t, r.RevokeToken(ctx, token, fosite.AccessToken, request.Client))
+
+		_, ok := cache.Get(signature, time.Now())
+		assert.False(t, ok)
+	})
+
+	t.Run("case=requires a signer", func(t *testing.T) {
+		_, err := (&CoreValidator{CoreStrategy: hmacshaStrategy, Config: new(fosite.Config)}).IssuePhantomToken(ctx, token, ar)
+		assert.ErrorIs(t, err, fosite.ErrUnknownRequest)
+	})
+
+	t.Run("case=requires a JWT session", func(t *testing.T) {
+		ar := fosite.NewAccessRequest(new(fosite.DefaultSession))
+		_, err := (&CoreValidator{CoreStrategy: hmacshaStrategy, Config: new(fosite.Config), PhantomTokenSigner: j.Signer}).IssuePhantomToken(ctx, token, ar)
+		assert.Error(t, err)
+	})
+}
+
+func TestPhantomTokenCache(t *testing.T) {
+	now := time.Now()
+	cache := NewPhantomTokenCache()
+	cache.Set("a", "request-a", "token-a", now.Add(time.Minute), now)
+	cache.Set("b", "request-b", "token-b", now.Add(time.Hour), now)
+
+	token, ok := cache.Get("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, "token-a", token)
+
+	_, ok = cache.Get("a", now.Add(time.Minute))
+	assert.False(t, ok)
+
+	cache.InvalidateRequest("request-b")
+	_, ok = cache.Get("b", now)
+	assert.False(t, ok)
+
+	t.Run("case=replaced entries stay indexed", func(t *testing.T) {
+		cache := NewPhantomTokenCache()
+		cache.Set("a", "request-a", "token-a", now.Add(time.Minute), now)
+		cache.Set("a", "request-a", "token-a2", now.Add(time.Minute), now)
+
+		token, ok := cache.Get("a", now)
+		require.True(t, ok)
+		assert.Equal(t, "token-a2", token)
+
+		cache.InvalidateRequest("request-a")
+		_, ok = cache.Get("a", now)
+		assert.False(t, ok)
+	})
+
+	t.Run("case=size is bounded", func(t *testing.T) {
+		cache := NewPhantomTokenCache(PhantomTokenCacheWithMaxSize(10))
+		for i := 0; i < 100; i++ {
+			cache.Set(fmt.Sprintf("signature-%d", i), fmt.Sprintf("request-%d", i), "token", now.Add(time.Hour), now)
+		}
+
+		var cached int
+		for i := 0; i < 100; i++ {
+			if _, ok := cache.Get(fmt.Sprintf("signature-%d", i), now); ok {
+				cached++
+			}
+		}
+		assert.LessOrEqual(t, cached, 10)
+
+		cache.m.Lock()
+		defer cache.m.Unlock()
+		assert.LessOrEqual(t, len(cache.requests), 10, "evicted entries are removed from the request index")
+	})
+
+	t.Run("case=expired entries are not cached", func(t *testing.T) {
+		cache := NewPhantomTokenCache()
+		cache.Set("a", "request-a", "token-a", now, now)
+		_, ok := cache.Get("a", now.Add(-time.Minute))
+		assert.False(t, ok)
+		assert.Empty(t, cache.requests)
+	})
+}
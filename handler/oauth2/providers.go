@@ -9,4 +9,5 @@ type LifespanConfigProvider interface {
 	fosite.AccessTokenLifespanProvider
 	fosite.RefreshTokenLifespanProvider
 	fosite.AuthorizeCodeLifespanProvider
+	fosite.ClockProvider
 }
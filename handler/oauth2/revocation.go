@@ -5,18 +5,44 @@ package oauth2
 
 import (
 	"context"
+	"time"
 
 	"github.com/ory/x/errorsx"
 
 	"github.com/pkg/errors"
 
 	"github.com/ory/fosite"
+	"github.com/ory/fosite/token/jwt"
 )
 
 type TokenRevocationHandler struct {
 	TokenRevocationStorage TokenRevocationStorage
 	RefreshTokenStrategy   RefreshTokenStrategy
 	AccessTokenStrategy    AccessTokenStrategy
+
+	// PhantomTokenCache is optional. If set, the phantom tokens of revoked tokens are removed from it.
+	PhantomTokenCache *PhantomTokenCache
+
+	// JWTRevocationStorage is optional. If set and the AccessTokenStrategy issues JWTs, revoked JWT access tokens are
+	// put on its deny-list, so StatelessJWTValidator rejects them. Only the revoked token itself is put on the
+	// deny-list, not the other JWTs of the same grant.
+	JWTRevocationStorage JWTRevocationStorage
+
+	// RevokedJWTFilter is optional. If set, the ids of revoked JWT access tokens are added to it.
+	RevokedJWTFilter *RevokedJWTFilter
+}
+
+var _ fosite.BulkRevocationHandler = (*TokenRevocationHandler)(nil)
+
+// RevokeRequests removes the phantom tokens of the grants revoked by fosite.Fosite.RevokeTokens from the
+// PhantomTokenCache.
+func (r *TokenRevocationHandler) RevokeRequests(_ context.Context, requestIDs []string) {
+	if r.PhantomTokenCache == nil {
+		return
+	}
+	for _, requestID := range requestIDs {
+		r.PhantomTokenCache.InvalidateRequest(requestID)
+	}
 }
 
 // RevokeToken implements https://tools.ietf.org/html/rfc7009#section-2.1
@@ -25,11 +51,17 @@ func (r *TokenRevocationHandler) RevokeToken(ctx context.Context, token string,
 	discoveryFuncs := []func() (request fosite.Requester, err error){
 		func() (request fosite.Requester, err error) {
 			// Refresh token
+			if err := verifyTokenFormat(ctx, r.RefreshTokenStrategy, fosite.RefreshToken, token); err != nil {
+				return nil, errorsx.WithStack(fosite.ErrNotFound.WithWrap(err).WithDebug(err.Error()))
+			}
 			signature := r.RefreshTokenStrategy.RefreshTokenSignature(ctx, token)
 			return r.TokenRevocationStorage.GetRefreshTokenSession(ctx, signature, nil)
 		},
 		func() (request fosite.Requester, err error) {
 			// Access token
+			if err := verifyTokenFormat(ctx, r.AccessTokenStrategy, fosite.AccessToken, token); err != nil {
+				return nil, errorsx.WithStack(fosite.ErrNotFound.WithWrap(err).WithDebug(err.Error()))
+			}
 			signature := r.AccessTokenStrategy.AccessTokenSignature(ctx, token)
 			return r.TokenRevocationStorage.GetAccessTokenSession(ctx, signature, nil)
 		},
@@ -57,8 +89,52 @@ func (r *TokenRevocationHandler) RevokeToken(ctx context.Context, token string,
 	requestID := ar.GetID()
 	err1 = r.TokenRevocationStorage.RevokeRefreshToken(ctx, requestID)
 	err2 = r.TokenRevocationStorage.RevokeAccessToken(ctx, requestID)
+	if r.PhantomTokenCache != nil {
+		r.PhantomTokenCache.InvalidateRequest(requestID)
+	}
+
+	if err := storeErrorsToRevocationError(err1, err2); err != nil {
+		return err
+	}
+	return r.revokeJWT(ctx, token)
+}
+
+// revokeJWT puts the token on the deny-list if it is a JWT access token.
+func (r *TokenRevocationHandler) revokeJWT(ctx context.Context, token string) error {
+	if r.JWTRevocationStorage == nil {
+		return nil
+	}
+
+	signer, ok := r.AccessTokenStrategy.(jwt.Signer)
+	if !ok {
+		return nil
+	}
+
+	t, err := signer.Decode(ctx, token)
+	if err != nil {
+		// The token is not a valid JWT, so it can not be accepted by StatelessJWTValidator either.
+		return nil
+	}
 
-	return storeErrorsToRevocationError(err1, err2)
+	var claims jwt.JWTClaims
+	claims.FromMapClaims(t.Claims)
+	if claims.JTI == "" {
+		return nil
+	}
+
+	exp := claims.ExpiresAt
+	if exp.IsZero() {
+		// Tokens without expiry stay on the deny-list forever.
+		exp = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+
+	if err := r.JWTRevocationStorage.RevokeJWT(ctx, claims.JTI, exp); err != nil {
+		return errorsx.WithStack(fosite.ErrTemporarilyUnavailable.WithWrap(err).WithDebug(err.Error()))
+	}
+	if r.RevokedJWTFilter != nil {
+		r.RevokedJWTFilter.Add(claims.JTI)
+	}
+	return nil
 }
 
 func storeErrorsToRevocationError(err1, err2 error) error {
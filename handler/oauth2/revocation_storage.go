@@ -5,6 +5,7 @@ package oauth2
 
 import (
 	"context"
+	"time"
 )
 
 // TokenRevocationStorage provides the storage implementation
@@ -41,3 +42,19 @@ type TokenRevocationStorage interface {
 	// token as well.
 	RevokeAccessToken(ctx context.Context, requestID string) error
 }
+
+// JWTRevocationStorage keeps a deny-list of the ids ("jti" claims) of revoked JWT access tokens, which allows
+// StatelessJWTValidator to reject revoked tokens before they expire.
+type JWTRevocationStorage interface {
+	// RevokeJWT adds the jti to the deny-list until the token expires at exp.
+	RevokeJWT(ctx context.Context, jti string, exp time.Time) error
+
+	// IsJWTRevoked returns true if the jti is on the deny-list.
+	IsJWTRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RevokedJWTLister is optionally implemented by JWTRevocationStorage implementations to rebuild a RevokedJWTFilter.
+type RevokedJWTLister interface {
+	// ListRevokedJWTs returns the ids of all revoked JWTs which have not expired yet.
+	ListRevokedJWTs(ctx context.Context) ([]string, error)
+}
@@ -0,0 +1,169 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// RevokedJWTFilter is a bloom filter over the ids of revoked JWT access tokens. StatelessJWTValidator only consults the
+// JWTRevocationStorage for tokens which the filter reports as possibly revoked, which avoids a storage lookup for
+// almost every token.
+//
+// The filter must know every revoked id. TokenRevocationHandler adds the ids it revokes, but if tokens are revoked by
+// other processes, for example other instances of a horizontally scaled server or bulk revocations, the filter has to
+// be rebuilt from the storage periodically using RebuildPeriodically. Tokens revoked by other processes are accepted
+// until the next rebuild, so the interval bounds how long they remain usable:
+//
+//	filter := oauth2.NewRevokedJWTFilter(10000, 0.01)
+//	go filter.RebuildPeriodically(ctx, store, time.Minute, func(err error) { log.Println(err) })
+type RevokedJWTFilter struct {
+	m      sync.RWMutex
+	bits   []uint64
+	hashes uint64
+	// size is the number of bits, it does not change when the bits are replaced.
+	size uint64
+
+	// rebuilds counts the running rebuilds. While it is not zero, added ids are recorded in pending, so rebuilds
+	// do not drop ids added after they listed the storage.
+	rebuilds int
+	pending  map[string]struct{}
+}
+
+// NewRevokedJWTFilter returns a filter sized for the expected number of revoked, unexpired tokens at the given false
+// positive rate, for example 0.01.
+func NewRevokedJWTFilter(expectedItems int, falsePositiveRate float64) *RevokedJWTFilter {
+	if expectedItems < 1 {
+		expectedItems = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+
+	size := math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(size/float64(expectedItems)*math.Ln2))
+	words := (uint64(size) + 63) / 64
+	return &RevokedJWTFilter{
+		bits:   make([]uint64, words),
+		hashes: uint64(hashes),
+		size:   words * 64,
+	}
+}
+
+// positions returns the bit positions of the jti using double hashing.
+func (f *RevokedJWTFilter) positions(jti string) []uint64 {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(jti))
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+
+	positions := make([]uint64, f.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.size
+	}
+	return positions
+}
+
+// Add adds the jti to the filter.
+func (f *RevokedJWTFilter) Add(jti string) {
+	positions := f.positions(jti)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	for _, p := range positions {
+		f.bits[p/64] |= 1 << (p % 64)
+	}
+	if f.rebuilds > 0 {
+		f.pending[jti] = struct{}{}
+	}
+}
+
+// MayContain returns false if the jti has definitely not been added to the filter.
+func (f *RevokedJWTFilter) MayContain(jti string) bool {
+	positions := f.positions(jti)
+
+	f.m.RLock()
+	defer f.m.RUnlock()
+	for _, p := range positions {
+		if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebuild replaces the contents of the filter with the revoked ids listed by the storage, which also drops the ids
+// of expired tokens.
+func (f *RevokedJWTFilter) Rebuild(ctx context.Context, lister RevokedJWTLister) error {
+	f.m.Lock()
+	if f.rebuilds == 0 {
+		f.pending = make(map[string]struct{})
+	}
+	f.rebuilds++
+	f.m.Unlock()
+
+	defer func() {
+		f.m.Lock()
+		defer f.m.Unlock()
+		f.rebuilds--
+		if f.rebuilds == 0 {
+			f.pending = nil
+		}
+	}()
+
+	jtis, err := lister.ListRevokedJWTs(ctx)
+	if err != nil {
+		return err
+	}
+
+	bits := make([]uint64, f.size/64)
+	set := func(jti string) {
+		for _, p := range f.positions(jti) {
+			bits[p/64] |= 1 << (p % 64)
+		}
+	}
+	for _, jti := range jtis {
+		set(jti)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+	// Ids added while the storage was listed may be missing from the listing.
+	for jti := range f.pending {
+		set(jti)
+	}
+	f.bits = bits
+	return nil
+}
+
+// RebuildPeriodically rebuilds the filter from the storage right away and then every interval until ctx is done. If
+// a rebuild fails, the filter keeps its contents and onError, if not nil, is called with the error.
+func (f *RevokedJWTFilter) RebuildPeriodically(ctx context.Context, lister RevokedJWTLister, interval time.Duration, onError func(error)) {
+	rebuild := func() {
+		if err := f.Rebuild(ctx, lister); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+	}
+
+	rebuild()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rebuild()
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage"
+)
+
+func TestRevokedJWTFilter(t *testing.T) {
+	f := NewRevokedJWTFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("revoked-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.MayContain(fmt.Sprintf("revoked-%d", i)))
+	}
+
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if f.MayContain(fmt.Sprintf("active-%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+
+	t.Run("case=rebuild", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		require.NoError(t, store.RevokeJWT(context.Background(), "from-storage", time.Now().Add(time.Hour)))
+
+		require.NoError(t, f.Rebuild(context.Background(), store))
+		assert.True(t, f.MayContain("from-storage"))
+		assert.False(t, f.MayContain("revoked-1"))
+	})
+
+	t.Run("case=rebuild keeps ids added while listing the storage", func(t *testing.T) {
+		f := NewRevokedJWTFilter(1000, 0.01)
+		lister := revokedJWTListerFunc(func(ctx context.Context) ([]string, error) {
+			// A token is revoked after the storage was read.
+			f.Add("revoked-during-rebuild")
+			return []string{"from-storage"}, nil
+		})
+
+		require.NoError(t, f.Rebuild(context.Background(), lister))
+		assert.True(t, f.MayContain("from-storage"))
+		assert.True(t, f.MayContain("revoked-during-rebuild"))
+		assert.Nil(t, f.pending)
+	})
+
+	t.Run("case=rebuilds periodically", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		store := storage.NewMemoryStore()
+		f := NewRevokedJWTFilter(1000, 0.01)
+		errs := make(chan error, 1)
+		done := make(chan struct{})
+		var fail atomic.Bool
+		lister := revokedJWTListerFunc(func(ctx context.Context) ([]string, error) {
+			if fail.Load() {
+				return nil, errors.New("storage unavailable")
+			}
+			return store.ListRevokedJWTs(ctx)
+		})
+		go func() {
+			defer close(done)
+			f.RebuildPeriodically(ctx, lister, time.Millisecond, func(err error) {
+				select {
+				case errs <- err:
+				default:
+				}
+			})
+		}()
+
+		// Another process revokes a token.
+		require.NoError(t, store.RevokeJWT(ctx, "revoked-elsewhere", time.Now().Add(time.Hour)))
+		assert.Eventually(t, func() bool { return f.MayContain("revoked-elsewhere") }, time.Second, time.Millisecond)
+
+		fail.Store(true)
+		assert.EqualError(t, <-errs, "storage unavailable")
+		assert.True(t, f.MayContain("revoked-elsewhere"), "failed rebuilds keep the filter contents")
+
+		cancel()
+		<-done
+	})
+}
+
+type revokedJWTListerFunc func(ctx context.Context) ([]string, error)
+
+func (f revokedJWTListerFunc) ListRevokedJWTs(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+func TestRevokeJWT(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	filter := NewRevokedJWTFilter(100, 0.01)
+	v := &StatelessJWTValidator{
+		Signer:               j,
+		JWTRevocationStorage: store,
+		RevokedJWTFilter:     filter,
+		Config:               &fosite.Config{ScopeStrategy: fosite.HierarchicScopeStrategy},
+	}
+	r := &TokenRevocationHandler{
+		TokenRevocationStorage: store,
+		AccessTokenStrategy:    j,
+		RefreshTokenStrategy:   j,
+		JWTRevocationStorage:   store,
+		RevokedJWTFilter:       filter,
+	}
+
+	request := jwtValidCase(fosite.AccessToken)
+	request.ID = "request-id"
+	request.Client = &fosite.DefaultClient{ID: "client-id"}
+	token, signature, err := j.GenerateAccessToken(ctx, request)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(ctx, signature, request))
+
+	other, _, err := j.GenerateAccessToken(ctx, jwtValidCase(fosite.AccessToken))
+	require.NoError(t, err)
+
+	_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+	require.NoError(t, err)
+
+	require.NoError(t, r.RevokeToken(ctx, token, fosite.AccessToken, request.Client))
+	assert.Len(t, store.RevokedJWTs, 1)
+
+	_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+	assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+
+	_, err = v.IntrospectToken(ctx, other, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+	assert.NoError(t, err)
+}
@@ -32,3 +32,16 @@ type AuthorizeCodeStrategy interface {
 	GenerateAuthorizeCode(ctx context.Context, requester fosite.Requester) (token string, signature string, err error)
 	ValidateAuthorizeCode(ctx context.Context, requester fosite.Requester, token string) (err error)
 }
+
+// TokenFormatVerifier is implemented by strategies whose tokens can be checked for typos and corruption without a
+// storage lookup. Handlers call VerifyTokenFormat before looking up a token, if the strategy implements it.
+type TokenFormatVerifier interface {
+	VerifyTokenFormat(ctx context.Context, tokenType fosite.TokenType, token string) error
+}
+
+func verifyTokenFormat(ctx context.Context, strategy interface{}, tokenType fosite.TokenType, token string) error {
+	if v, ok := strategy.(TokenFormatVerifier); ok {
+		return v.VerifyTokenFormat(ctx, tokenType, token)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"hash/crc32"
+	"strings"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+	enigma "github.com/ory/fosite/token/hmac"
+)
+
+var (
+	_ CoreStrategy        = (*HMACSHAStrategyChecksummed)(nil)
+	_ TokenFormatVerifier = (*HMACSHAStrategyChecksummed)(nil)
+)
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// checksumLength is the length of a base62 encoded CRC32 checksum, as 62^6 > 2^32.
+	checksumLength = 6
+)
+
+// HMACSHAStrategyChecksummed generates tokens in a format which secret scanners can recognize and verify offline:
+//
+//	<prefix>_<at|rt|ac>_<token>_<checksum>
+//
+// The checksum is the base62 encoded CRC32 (IEEE) checksum of everything before it. Tokens with an invalid checksum are
+// rejected before any storage lookup. See VerifyTokenChecksum.
+type HMACSHAStrategyChecksummed struct {
+	*HMACSHAStrategyUnPrefixed
+
+	// Prefix identifies the issuer of the tokens, for example "acme". It should be short and unique enough for secret
+	// scanners to recognize the tokens.
+	Prefix string
+}
+
+func NewHMACSHAStrategyChecksummed(
+	enigma *enigma.HMACStrategy,
+	config LifespanConfigProvider,
+	prefix string,
+) *HMACSHAStrategyChecksummed {
+	return &HMACSHAStrategyChecksummed{
+		HMACSHAStrategyUnPrefixed: NewHMACSHAStrategyUnPrefixed(enigma, config),
+		Prefix:                    prefix,
+	}
+}
+
+// VerifyTokenChecksum returns true if the token ends with a valid checksum. It does not need any secrets and is meant to
+// be used by secret scanners to tell tokens apart from random strings which look like tokens.
+func VerifyTokenChecksum(token string) bool {
+	if len(token) <= checksumLength+1 || token[len(token)-checksumLength-1] != '_' {
+		return false
+	}
+
+	payload, checksum := token[:len(token)-checksumLength-1], token[len(token)-checksumLength:]
+	return checksum == encodeChecksum(payload)
+}
+
+func encodeChecksum(payload string) string {
+	sum := crc32.ChecksumIEEE([]byte(payload))
+
+	var encoded [checksumLength]byte
+	for i := checksumLength - 1; i >= 0; i-- {
+		encoded[i] = base62Alphabet[sum%62]
+		sum /= 62
+	}
+	return string(encoded[:])
+}
+
+func (h *HMACSHAStrategyChecksummed) getPrefix(part string) string {
+	return h.Prefix + "_" + part + "_"
+}
+
+func (h *HMACSHAStrategyChecksummed) encode(token, part string) string {
+	if token == "" {
+		return ""
+	}
+	payload := h.getPrefix(part) + token
+	return payload + "_" + encodeChecksum(payload)
+}
+
+// decode returns the token without prefix and checksum, or an empty string if the token is not of the given part or
+// its checksum is invalid.
+func (h *HMACSHAStrategyChecksummed) decode(token, part string) string {
+	if !strings.HasPrefix(token, h.getPrefix(part)) || !VerifyTokenChecksum(token) {
+		return ""
+	}
+	return token[len(h.getPrefix(part)) : len(token)-checksumLength-1]
+}
+
+func (h *HMACSHAStrategyChecksummed) verify(token, part string) error {
+	if h.decode(token, part) == "" {
+		return errorsx.WithStack(fosite.ErrInvalidTokenFormat.WithHint("The token has an invalid prefix or checksum."))
+	}
+	return nil
+}
+
+func (h *HMACSHAStrategyChecksummed) VerifyTokenFormat(ctx context.Context, tokenType fosite.TokenType, token string) error {
+	switch tokenType {
+	case fosite.AccessToken:
+		return h.verify(token, "at")
+	case fosite.RefreshToken:
+		return h.verify(token, "rt")
+	case fosite.AuthorizeCode:
+		return h.verify(token, "ac")
+	}
+	return nil
+}
+
+func (h *HMACSHAStrategyChecksummed) AccessTokenSignature(ctx context.Context, token string) string {
+	return h.HMACSHAStrategyUnPrefixed.AccessTokenSignature(ctx, h.decode(token, "at"))
+}
+
+func (h *HMACSHAStrategyChecksummed) RefreshTokenSignature(ctx context.Context, token string) string {
+	return h.HMACSHAStrategyUnPrefixed.RefreshTokenSignature(ctx, h.decode(token, "rt"))
+}
+
+func (h *HMACSHAStrategyChecksummed) AuthorizeCodeSignature(ctx context.Context, token string) string {
+	return h.HMACSHAStrategyUnPrefixed.AuthorizeCodeSignature(ctx, h.decode(token, "ac"))
+}
+
+func (h *HMACSHAStrategyChecksummed) GenerateAccessToken(ctx context.Context, r fosite.Requester) (token string, signature string, err error) {
+	token, sig, err := h.HMACSHAStrategyUnPrefixed.GenerateAccessToken(ctx, r)
+	return h.encode(token, "at"), sig, err
+}
+
+func (h *HMACSHAStrategyChecksummed) ValidateAccessToken(ctx context.Context, r fosite.Requester, token string) (err error) {
+	if err := h.verify(token, "at"); err != nil {
+		return err
+	}
+	return h.HMACSHAStrategyUnPrefixed.ValidateAccessToken(ctx, r, h.decode(token, "at"))
+}
+
+func (h *HMACSHAStrategyChecksummed) GenerateRefreshToken(ctx context.Context, r fosite.Requester) (token string, signature string, err error) {
+	token, sig, err := h.HMACSHAStrategyUnPrefixed.GenerateRefreshToken(ctx, r)
+	return h.encode(token, "rt"), sig, err
+}
+
+func (h *HMACSHAStrategyChecksummed) ValidateRefreshToken(ctx context.Context, r fosite.Requester, token string) (err error) {
+	if err := h.verify(token, "rt"); err != nil {
+		return err
+	}
+	return h.HMACSHAStrategyUnPrefixed.ValidateRefreshToken(ctx, r, h.decode(token, "rt"))
+}
+
+func (h *HMACSHAStrategyChecksummed) GenerateAuthorizeCode(ctx context.Context, r fosite.Requester) (token string, signature string, err error) {
+	token, sig, err := h.HMACSHAStrategyUnPrefixed.GenerateAuthorizeCode(ctx, r)
+	return h.encode(token, "ac"), sig, err
+}
+
+func (h *HMACSHAStrategyChecksummed) ValidateAuthorizeCode(ctx context.Context, r fosite.Requester, token string) (err error) {
+	if err := h.verify(token, "ac"); err != nil {
+		return err
+	}
+	return h.HMACSHAStrategyUnPrefixed.ValidateAuthorizeCode(ctx, r, h.decode(token, "ac"))
+}
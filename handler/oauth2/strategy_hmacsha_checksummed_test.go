@@ -0,0 +1,110 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/internal"
+	"github.com/ory/fosite/token/hmac"
+)
+
+var hmacshaStrategyChecksummed = NewHMACSHAStrategyChecksummed(
+	&hmac.HMACStrategy{Config: &fosite.Config{GlobalSecret: []byte("foobarfoobarfoobarfoobarfoobarfoobarfoobarfoobar")}},
+	&fosite.Config{
+		AccessTokenLifespan:   time.Hour * 24,
+		AuthorizeCodeLifespan: time.Hour * 24,
+	},
+	"acme",
+)
+
+func TestVerifyTokenChecksum(t *testing.T) {
+	// The checksum of "acme_at_foo" is the base62 encoded CRC32 checksum 0x0f112f22.
+	assert.Equal(t, "0H6em2", encodeChecksum("acme_at_foo"))
+	assert.True(t, VerifyTokenChecksum("acme_at_foo_0H6em2"))
+
+	for _, token := range []string{
+		"",
+		"_0H6em2",
+		"acme_at_foo_0H6em3",
+		"acme_at_fop_0H6em2",
+		"acme_at_foo0H6em2",
+		"acme_at_foo_0H6em",
+	} {
+		assert.False(t, VerifyTokenChecksum(token), token)
+	}
+}
+
+func TestHMACChecksummedTokens(t *testing.T) {
+	ctx := context.Background()
+	s := hmacshaStrategyChecksummed
+
+	for _, c := range []struct {
+		tokenType fosite.TokenType
+		part      string
+		generate  func(context.Context, fosite.Requester) (string, string, error)
+		validate  func(context.Context, fosite.Requester, string) error
+		signature func(context.Context, string) string
+	}{
+		{fosite.AccessToken, "at", s.GenerateAccessToken, s.ValidateAccessToken, s.AccessTokenSignature},
+		{fosite.RefreshToken, "rt", s.GenerateRefreshToken, s.ValidateRefreshToken, s.RefreshTokenSignature},
+		{fosite.AuthorizeCode, "ac", s.GenerateAuthorizeCode, s.ValidateAuthorizeCode, s.AuthorizeCodeSignature},
+	} {
+		t.Run("type="+string(c.tokenType), func(t *testing.T) {
+			token, signature, err := c.generate(ctx, &hmacValidCase)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(token, "acme_"+c.part+"_"), token)
+			assert.True(t, VerifyTokenChecksum(token))
+			assert.Equal(t, signature, c.signature(ctx, token))
+
+			require.NoError(t, s.VerifyTokenFormat(ctx, c.tokenType, token))
+			require.NoError(t, c.validate(ctx, &hmacValidCase, token))
+			assert.Error(t, c.validate(ctx, &hmacExpiredCase, token))
+
+			typo := token[:20] + string(token[20]^1) + token[21:]
+			assert.ErrorIs(t, s.VerifyTokenFormat(ctx, c.tokenType, typo), fosite.ErrInvalidTokenFormat)
+			assert.ErrorIs(t, c.validate(ctx, &hmacValidCase, typo), fosite.ErrInvalidTokenFormat)
+
+			other := "acme_xx_" + strings.TrimPrefix(token, "acme_"+c.part+"_")
+			assert.ErrorIs(t, s.VerifyTokenFormat(ctx, c.tokenType, other), fosite.ErrInvalidTokenFormat)
+			assert.Empty(t, c.signature(ctx, other))
+		})
+	}
+}
+
+func TestHMACChecksummedTokens_SkipStorageLookup(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The mocks fail the test on any call, which proves that malformed tokens never reach the storage.
+	store := internal.NewMockCoreStorage(ctrl)
+	revocationStore := internal.NewMockTokenRevocationStorage(ctrl)
+
+	token, _, err := hmacshaStrategyChecksummed.GenerateAccessToken(ctx, &hmacValidCase)
+	require.NoError(t, err)
+	typo := token[:len(token)-1] + "0"
+	if typo == token {
+		typo = token[:len(token)-1] + "1"
+	}
+
+	v := &CoreValidator{CoreStrategy: hmacshaStrategyChecksummed, CoreStorage: store, Config: new(fosite.Config)}
+	_, err = v.IntrospectToken(ctx, typo, fosite.AccessToken, fosite.NewAccessRequest(new(fosite.DefaultSession)), nil)
+	assert.ErrorIs(t, err, fosite.ErrRequestUnauthorized)
+
+	r := &TokenRevocationHandler{
+		TokenRevocationStorage: revocationStore,
+		AccessTokenStrategy:    hmacshaStrategyChecksummed,
+		RefreshTokenStrategy:   hmacshaStrategyChecksummed,
+	}
+	assert.NoError(t, r.RevokeToken(ctx, typo, fosite.AccessToken, &fosite.DefaultClient{ID: "foo"}))
+}
@@ -5,7 +5,6 @@ package oauth2
 
 import (
 	"context"
-	"time"
 
 	"github.com/ory/x/errorsx"
 
@@ -51,11 +50,11 @@ func (h *HMACSHAStrategyUnPrefixed) GenerateAccessToken(ctx context.Context, _ f
 
 func (h *HMACSHAStrategyUnPrefixed) ValidateAccessToken(ctx context.Context, r fosite.Requester, token string) (err error) {
 	var exp = r.GetSession().GetExpiresAt(fosite.AccessToken)
-	if exp.IsZero() && r.GetRequestedAt().Add(h.Config.GetAccessTokenLifespan(ctx)).Before(time.Now().UTC()) {
+	if exp.IsZero() && r.GetRequestedAt().Add(h.Config.GetAccessTokenLifespan(ctx)).Before(h.Config.GetClock(ctx).Now().UTC()) {
 		return errorsx.WithStack(fosite.ErrTokenExpired.WithHintf("Access token expired at '%s'.", r.GetRequestedAt().Add(h.Config.GetAccessTokenLifespan(ctx))))
 	}
 
-	if !exp.IsZero() && exp.Before(time.Now().UTC()) {
+	if !exp.IsZero() && exp.Before(h.Config.GetClock(ctx).Now().UTC()) {
 		return errorsx.WithStack(fosite.ErrTokenExpired.WithHintf("Access token expired at '%s'.", exp))
 	}
 
@@ -78,7 +77,7 @@ func (h *HMACSHAStrategyUnPrefixed) ValidateRefreshToken(ctx context.Context, r
 		return h.Enigma.Validate(ctx, token)
 	}
 
-	if !exp.IsZero() && exp.Before(time.Now().UTC()) {
+	if !exp.IsZero() && exp.Before(h.Config.GetClock(ctx).Now().UTC()) {
 		return errorsx.WithStack(fosite.ErrTokenExpired.WithHintf("Refresh token expired at '%s'.", exp))
 	}
 
@@ -96,11 +95,11 @@ func (h *HMACSHAStrategyUnPrefixed) GenerateAuthorizeCode(ctx context.Context, _
 
 func (h *HMACSHAStrategyUnPrefixed) ValidateAuthorizeCode(ctx context.Context, r fosite.Requester, token string) (err error) {
 	var exp = r.GetSession().GetExpiresAt(fosite.AuthorizeCode)
-	if exp.IsZero() && r.GetRequestedAt().Add(h.Config.GetAuthorizeCodeLifespan(ctx)).Before(time.Now().UTC()) {
+	if exp.IsZero() && r.GetRequestedAt().Add(h.Config.GetAuthorizeCodeLifespan(ctx)).Before(h.Config.GetClock(ctx).Now().UTC()) {
 		return errorsx.WithStack(fosite.ErrTokenExpired.WithHintf("Authorize code expired at '%s'.", r.GetRequestedAt().Add(h.Config.GetAuthorizeCodeLifespan(ctx))))
 	}
 
-	if !exp.IsZero() && exp.Before(time.Now().UTC()) {
+	if !exp.IsZero() && exp.Before(h.Config.GetClock(ctx).Now().UTC()) {
 		return errorsx.WithStack(fosite.ErrTokenExpired.WithHintf("Authorize code expired at '%s'.", exp))
 	}
 
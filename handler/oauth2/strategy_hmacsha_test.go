@@ -189,3 +189,28 @@ func TestHMACAuthorizeCode(t *testing.T) {
 		})
 	}
 }
+
+func TestHMACAccessTokenWithClock(t *testing.T) {
+	now := time.Now().UTC()
+	config := &fosite.Config{
+		AccessTokenLifespan: time.Hour,
+		Clock:               fosite.FixedClock(now),
+	}
+	strategy := NewHMACSHAStrategy(&hmac.HMACStrategy{Config: &fosite.Config{GlobalSecret: []byte("foobarfoobarfoobarfoobarfoobarfoobarfoobarfoobar")}}, config)
+
+	r := &fosite.Request{
+		Client: &fosite.DefaultClient{},
+		Session: &fosite.DefaultSession{
+			ExpiresAt: map[fosite.TokenType]time.Time{
+				fosite.AccessToken: now.Add(time.Minute),
+			},
+		},
+	}
+
+	token, _, err := strategy.GenerateAccessToken(context.Background(), r)
+	assert.NoError(t, err)
+	assert.NoError(t, strategy.ValidateAccessToken(context.Background(), r, token))
+
+	config.Clock = fosite.FixedClock(now.Add(2 * time.Minute))
+	assert.ErrorIs(t, strategy.ValidateAccessToken(context.Background(), r, token), fosite.ErrTokenExpired)
+}
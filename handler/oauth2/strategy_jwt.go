@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
 	"github.com/ory/fosite"
@@ -22,6 +23,9 @@ type DefaultJWTStrategy struct {
 	Config          interface {
 		fosite.AccessTokenIssuerProvider
 		fosite.JWTScopeFieldProvider
+		fosite.ClockProvider
+		fosite.JWTLeewayProvider
+		fosite.SubjectIdentifierStrategyProvider
 	}
 }
 
@@ -43,10 +47,18 @@ func (h *DefaultJWTStrategy) GenerateAccessToken(ctx context.Context, requester
 }
 
 func (h *DefaultJWTStrategy) ValidateAccessToken(ctx context.Context, _ fosite.Requester, token string) error {
-	_, err := validate(ctx, h.Signer, token)
+	_, err := validate(ctx, h.Signer, token, h.Config.GetClock(ctx).Now(), h.Config.GetJWTLeeway(ctx))
 	return err
 }
 
+// VerifyTokenFormat verifies the format of refresh tokens and authorization codes if the HMAC strategy supports it.
+func (h DefaultJWTStrategy) VerifyTokenFormat(ctx context.Context, tokenType fosite.TokenType, token string) error {
+	if tokenType == fosite.AccessToken {
+		return nil
+	}
+	return verifyTokenFormat(ctx, h.HMACSHAStrategy, tokenType, token)
+}
+
 func (h DefaultJWTStrategy) RefreshTokenSignature(ctx context.Context, token string) string {
 	return h.HMACSHAStrategy.RefreshTokenSignature(ctx, token)
 }
@@ -71,10 +83,10 @@ func (h *DefaultJWTStrategy) ValidateAuthorizeCode(ctx context.Context, req fosi
 	return h.HMACSHAStrategy.ValidateAuthorizeCode(ctx, req, token)
 }
 
-func validate(ctx context.Context, jwtStrategy jwt.Signer, token string) (t *jwt.Token, err error) {
+func validate(ctx context.Context, jwtStrategy jwt.Signer, token string, now time.Time, leeway time.Duration) (t *jwt.Token, err error) {
 	t, err = jwtStrategy.Decode(ctx, token)
 	if err == nil {
-		err = t.Claims.Valid()
+		err = t.Claims.ValidWithLeeway(now, leeway)
 		return
 	}
 
@@ -121,13 +133,26 @@ func (h *DefaultJWTStrategy) generate(ctx context.Context, tokenType fosite.Toke
 				requester.GetGrantedAudience(),
 			).
 			WithDefaults(
-				time.Now().UTC(),
+				h.Config.GetClock(ctx).Now().UTC(),
 				h.Config.GetAccessTokenIssuer(ctx),
 			).
 			WithScopeField(
 				h.Config.GetJWTScopeField(ctx),
 			)
 
-		return h.Signer.Generate(ctx, claims.ToMapClaims(), jwtSession.GetJWTHeader())
+		mapClaims := claims.ToMapClaims()
+		// Every token needs an id, otherwise it can not be put on the deny-list when it is revoked.
+		if jti, _ := mapClaims["jti"].(string); jti == "" {
+			mapClaims["jti"] = uuid.New().String()
+		}
+		if sub, ok := mapClaims["sub"].(string); ok && sub != "" {
+			subject, err := h.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, requester.GetClient(), sub)
+			if err != nil {
+				return "", "", err
+			}
+			mapClaims["sub"] = subject
+		}
+
+		return h.Signer.Generate(ctx, mapClaims, jwtSession.GetJWTHeader())
 	}
 }
@@ -0,0 +1,195 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/token/jwt"
+	"github.com/ory/fosite/token/paseto"
+	"github.com/ory/x/errorsx"
+)
+
+var _ CoreStrategy = (*DefaultPASETOStrategy)(nil)
+
+// DefaultPASETOStrategy issues access and refresh tokens as encrypted PASETO v4.local tokens which carry the claims of
+// the session. Unlike JWTs, the claims can not be read by clients, but they can be validated without a storage lookup
+// by anyone holding the key, see StatelessPASETOValidator. Authorization codes are issued by HMACSHAStrategy.
+//
+// The signature of a token is its authentication tag, which is stored like the signature of any other token, so
+// revocation and introspection using the storage keep working.
+type DefaultPASETOStrategy struct {
+	Encrypter       *paseto.LocalEncrypter
+	HMACSHAStrategy CoreStrategy
+	Config          interface {
+		fosite.AccessTokenIssuerProvider
+		fosite.JWTScopeFieldProvider
+		fosite.ClockProvider
+		fosite.JWTLeewayProvider
+		fosite.SubjectIdentifierStrategyProvider
+	}
+}
+
+func (h *DefaultPASETOStrategy) AccessTokenSignature(ctx context.Context, token string) string {
+	return paseto.Tag(token)
+}
+
+func (h *DefaultPASETOStrategy) GenerateAccessToken(ctx context.Context, requester fosite.Requester) (token string, signature string, err error) {
+	return h.generate(ctx, fosite.AccessToken, requester)
+}
+
+func (h *DefaultPASETOStrategy) ValidateAccessToken(ctx context.Context, _ fosite.Requester, token string) error {
+	_, err := decryptPASETO(ctx, h.Encrypter, fosite.AccessToken, token, h.Config.GetClock(ctx).Now(), h.Config.GetJWTLeeway(ctx))
+	return err
+}
+
+func (h *DefaultPASETOStrategy) RefreshTokenSignature(ctx context.Context, token string) string {
+	return paseto.Tag(token)
+}
+
+func (h *DefaultPASETOStrategy) GenerateRefreshToken(ctx context.Context, requester fosite.Requester) (token string, signature string, err error) {
+	return h.generate(ctx, fosite.RefreshToken, requester)
+}
+
+func (h *DefaultPASETOStrategy) ValidateRefreshToken(ctx context.Context, _ fosite.Requester, token string) error {
+	_, err := decryptPASETO(ctx, h.Encrypter, fosite.RefreshToken, token, h.Config.GetClock(ctx).Now(), h.Config.GetJWTLeeway(ctx))
+	return err
+}
+
+func (h *DefaultPASETOStrategy) AuthorizeCodeSignature(ctx context.Context, token string) string {
+	return h.HMACSHAStrategy.AuthorizeCodeSignature(ctx, token)
+}
+
+func (h *DefaultPASETOStrategy) GenerateAuthorizeCode(ctx context.Context, requester fosite.Requester) (token string, signature string, err error) {
+	return h.HMACSHAStrategy.GenerateAuthorizeCode(ctx, requester)
+}
+
+func (h *DefaultPASETOStrategy) ValidateAuthorizeCode(ctx context.Context, requester fosite.Requester, token string) error {
+	return h.HMACSHAStrategy.ValidateAuthorizeCode(ctx, requester, token)
+}
+
+func (h *DefaultPASETOStrategy) generate(ctx context.Context, tokenType fosite.TokenType, requester fosite.Requester) (string, string, error) {
+	jwtSession, ok := requester.GetSession().(JWTSessionContainer)
+	if !ok {
+		return "", "", errors.Errorf("Session must be of type JWTSessionContainer but got type: %T", requester.GetSession())
+	} else if jwtSession.GetJWTClaims() == nil {
+		return "", "", errors.New("GetTokenClaims() must not be nil")
+	}
+
+	mapClaims := jwtSession.GetJWTClaims().
+		With(
+			jwtSession.GetExpiresAt(tokenType),
+			requester.GetGrantedScopes(),
+			requester.GetGrantedAudience(),
+		).
+		WithDefaults(
+			h.Config.GetClock(ctx).Now().UTC(),
+			h.Config.GetAccessTokenIssuer(ctx),
+		).
+		WithScopeField(
+			h.Config.GetJWTScopeField(ctx),
+		).
+		ToMapClaims()
+	if sub, ok := mapClaims["sub"].(string); ok && sub != "" {
+		subject, err := h.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, requester.GetClient(), sub)
+		if err != nil {
+			return "", "", err
+		}
+		mapClaims["sub"] = subject
+	}
+	mapClaims["client_id"] = requester.GetClient().GetID()
+
+	payload, err := json.Marshal(toPASETOClaims(mapClaims))
+	if err != nil {
+		return "", "", errorsx.WithStack(err)
+	}
+
+	// The token type is bound to the token as implicit assertion, so refresh tokens can not be used as access tokens.
+	token, err := h.Encrypter.Encrypt(ctx, payload, []byte(tokenType))
+	if err != nil {
+		return "", "", err
+	}
+	return token, paseto.Tag(token), nil
+}
+
+// pasetoTimeClaims are the claims which PASETO encodes as RFC 3339 timestamps instead of numeric dates.
+var pasetoTimeClaims = []string{"exp", "iat", "nbf"}
+
+func toPASETOClaims(claims jwt.MapClaims) map[string]interface{} {
+	for _, name := range pasetoTimeClaims {
+		if v, ok := claims[name].(int64); ok {
+			claims[name] = time.Unix(v, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return claims
+}
+
+func fromPASETOClaims(claims map[string]interface{}) (jwt.MapClaims, error) {
+	for _, name := range pasetoTimeClaims {
+		v, ok := claims[name]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("claim %s must be a RFC 3339 timestamp", name)
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		claims[name] = float64(t.Unix())
+	}
+
+	if aud, ok := claims["aud"].([]interface{}); ok {
+		audience := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		claims["aud"] = audience
+	}
+
+	return claims, nil
+}
+
+// decryptPASETO decrypts a PASETO token of the given type and validates its time based claims.
+func decryptPASETO(ctx context.Context, encrypter *paseto.LocalEncrypter, tokenType fosite.TokenType, token string, now time.Time, leeway time.Duration) (jwt.MapClaims, error) {
+	if !strings.HasPrefix(token, paseto.LocalHeader) {
+		return nil, errorsx.WithStack(fosite.ErrInvalidTokenFormat)
+	}
+
+	payload, err := encrypter.Decrypt(ctx, token, []byte(tokenType))
+	if errors.Is(err, paseto.ErrInvalidToken) || errors.Is(err, paseto.ErrUnknownKey) {
+		return nil, errorsx.WithStack(fosite.ErrTokenSignatureMismatch.WithWrap(err).WithDebug(err.Error()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, errorsx.WithStack(fosite.ErrInvalidTokenFormat.WithWrap(err).WithDebug(err.Error()))
+	}
+	claims, err := fromPASETOClaims(raw)
+	if err != nil {
+		return nil, errorsx.WithStack(fosite.ErrInvalidTokenFormat.WithWrap(err).WithDebug(err.Error()))
+	}
+
+	if err := claims.ValidWithLeeway(now, leeway); err != nil {
+		var e *jwt.ValidationError
+		if errors.As(err, &e) {
+			return nil, errorsx.WithStack(toRFCErr(e).WithWrap(err).WithDebug(err.Error()))
+		}
+		return nil, err
+	}
+
+	return claims, nil
+}
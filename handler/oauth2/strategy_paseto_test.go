@@ -0,0 +1,107 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/token/paseto"
+)
+
+var pasetoKeys = []paseto.Key{{ID: "1", Secret: []byte("0123456789abcdef0123456789abcdef")}}
+
+var pasetoStrategy = &DefaultPASETOStrategy{
+	Encrypter: &paseto.LocalEncrypter{GetKeys: func(context.Context) ([]paseto.Key, error) {
+		return pasetoKeys, nil
+	}},
+	HMACSHAStrategy: hmacshaStrategy,
+	Config:          &fosite.Config{},
+}
+
+func TestPASETOStrategy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=access tokens", func(t *testing.T) {
+		token, signature, err := pasetoStrategy.GenerateAccessToken(ctx, jwtValidCase(fosite.AccessToken))
+		require.NoError(t, err)
+		assert.Equal(t, signature, pasetoStrategy.AccessTokenSignature(ctx, token))
+		assert.NotContains(t, token, "peter")
+
+		require.NoError(t, pasetoStrategy.ValidateAccessToken(ctx, nil, token))
+		assert.ErrorIs(t, pasetoStrategy.ValidateRefreshToken(ctx, nil, token), fosite.ErrTokenSignatureMismatch)
+	})
+
+	t.Run("case=refresh tokens", func(t *testing.T) {
+		token, signature, err := pasetoStrategy.GenerateRefreshToken(ctx, jwtValidCase(fosite.RefreshToken))
+		require.NoError(t, err)
+		assert.Equal(t, signature, pasetoStrategy.RefreshTokenSignature(ctx, token))
+
+		require.NoError(t, pasetoStrategy.ValidateRefreshToken(ctx, nil, token))
+		assert.ErrorIs(t, pasetoStrategy.ValidateAccessToken(ctx, nil, token), fosite.ErrTokenSignatureMismatch)
+	})
+
+	t.Run("case=expired tokens", func(t *testing.T) {
+		token, _, err := pasetoStrategy.GenerateAccessToken(ctx, jwtExpiredCase(fosite.AccessToken))
+		require.NoError(t, err)
+		assert.ErrorIs(t, pasetoStrategy.ValidateAccessToken(ctx, nil, token), fosite.ErrTokenExpired)
+	})
+
+	t.Run("case=malformed tokens", func(t *testing.T) {
+		assert.ErrorIs(t, pasetoStrategy.ValidateAccessToken(ctx, nil, "foo.bar"), fosite.ErrInvalidTokenFormat)
+		assert.Empty(t, pasetoStrategy.AccessTokenSignature(ctx, "foo.bar"))
+	})
+
+	t.Run("case=authorize codes are HMAC tokens", func(t *testing.T) {
+		code, signature, err := pasetoStrategy.GenerateAuthorizeCode(ctx, &hmacValidCase)
+		require.NoError(t, err)
+		assert.Equal(t, signature, pasetoStrategy.AuthorizeCodeSignature(ctx, code))
+		require.NoError(t, pasetoStrategy.ValidateAuthorizeCode(ctx, &hmacValidCase, code))
+	})
+}
+
+func TestStatelessPASETOValidator(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	v := &StatelessPASETOValidator{Encrypter: pasetoStrategy.Encrypter, Config: &fosite.Config{}}
+
+	request := jwtValidCase(fosite.AccessToken)
+	request.ID = "request-id"
+	request.Client = &fosite.DefaultClient{ID: "client-id"}
+	token, signature, err := pasetoStrategy.GenerateAccessToken(ctx, request)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(ctx, signature, request))
+
+	ar := fosite.NewAccessRequest(new(JWTSession))
+	tu, err := v.IntrospectToken(ctx, token, fosite.AccessToken, ar, []string{"email"})
+	require.NoError(t, err)
+	assert.Equal(t, fosite.AccessToken, tu)
+	assert.Equal(t, "client-id", ar.GetClient().GetID())
+	assert.Equal(t, "peter", ar.GetSession().GetSubject())
+	assert.Equal(t, fosite.Arguments{"email", "offline"}, ar.GetGrantedScopes())
+	assert.Equal(t, fosite.Arguments{"group0"}, ar.GetGrantedAudience())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), ar.GetSession().GetExpiresAt(fosite.AccessToken), time.Minute)
+
+	_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), []string{"admin"})
+	assert.ErrorIs(t, err, fosite.ErrInvalidScope)
+
+	_, err = v.IntrospectToken(ctx, "ory_at_foo.bar", fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+	assert.ErrorIs(t, err, fosite.ErrUnknownRequest)
+
+	t.Run("case=revocation", func(t *testing.T) {
+		v.Storage = store
+		_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+		require.NoError(t, err)
+
+		require.NoError(t, store.RevokeAccessToken(ctx, request.ID))
+		_, err = v.IntrospectToken(ctx, token, fosite.AccessToken, fosite.NewAccessRequest(new(JWTSession)), nil)
+		assert.ErrorIs(t, err, fosite.ErrRequestUnauthorized)
+	})
+}
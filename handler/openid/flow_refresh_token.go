@@ -21,6 +21,7 @@ type OpenIDConnectRefreshHandler struct {
 
 	Config interface {
 		fosite.IDTokenLifespanProvider
+		fosite.ClockProvider
 	}
 }
 
@@ -93,7 +94,7 @@ func (c *OpenIDConnectRefreshHandler) PopulateTokenEndpointResponse(ctx context.
 	claims.AccessTokenHash = c.GetAccessTokenHash(ctx, requester, responder)
 	claims.JTI = uuid.New().String()
 	claims.CodeHash = ""
-	claims.IssuedAt = time.Now().Truncate(time.Second)
+	claims.IssuedAt = c.Config.GetClock(ctx).Now().Truncate(time.Second)
 
 	idTokenLifespan := fosite.GetEffectiveLifespan(requester.GetClient(), fosite.GrantTypeRefreshToken, fosite.IDToken, c.Config.GetIDTokenLifespan(ctx))
 	return c.IssueExplicitIDToken(ctx, idTokenLifespan, requester, responder)
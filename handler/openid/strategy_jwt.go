@@ -38,6 +38,9 @@ type DefaultSession struct {
 	ExpiresAt map[fosite.TokenType]time.Time `json:"expires_at"`
 	Username  string                         `json:"username"`
 	Subject   string                         `json:"subject"`
+	// Extra contains claims which are not part of the ID token, for example the confirmation ("cnf") claim of
+	// sender-constrained access tokens.
+	Extra map[string]interface{} `json:"extra,omitempty"`
 }
 
 func NewDefaultSession() *DefaultSession {
@@ -94,6 +97,30 @@ func (s *DefaultSession) GetSubject() string {
 	return s.Subject
 }
 
+// GetSessionID returns the "sid" claim of the ID token, which identifies the end-user's login session.
+func (s *DefaultSession) GetSessionID() string {
+	if s == nil || s.Claims == nil {
+		return ""
+	}
+
+	sid, _ := s.Claims.Extra["sid"].(string)
+	return sid
+}
+
+// GetExtraClaims implements ExtraClaimsSession for DefaultSession.
+// The returned value can be modified in-place.
+func (s *DefaultSession) GetExtraClaims() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+
+	if s.Extra == nil {
+		s.Extra = make(map[string]interface{})
+	}
+
+	return s.Extra
+}
+
 func (s *DefaultSession) IDTokenHeaders() *jwt.Headers {
 	if s.Headers == nil {
 		s.Headers = &jwt.Headers{}
@@ -115,6 +142,8 @@ type DefaultStrategy struct {
 		fosite.IDTokenIssuerProvider
 		fosite.IDTokenLifespanProvider
 		fosite.MinParameterEntropyProvider
+		fosite.ClockProvider
+		fosite.SubjectIdentifierStrategyProvider
 	}
 }
 
@@ -136,6 +165,12 @@ func (h DefaultStrategy) GenerateIDToken(ctx context.Context, lifespan time.Dura
 		return "", errorsx.WithStack(fosite.ErrServerError.WithDebug("Failed to generate id token because subject is an empty string."))
 	}
 
+	subject, err := h.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, requester.GetClient(), claims.Subject)
+	if err != nil {
+		return "", err
+	}
+
+	now := h.Config.GetClock(ctx).Now().UTC()
 	if requester.GetRequestForm().Get("grant_type") != "refresh_token" {
 		maxAge, err := strconv.ParseInt(requester.GetRequestForm().Get("max_age"), 10, 64)
 		if err != nil {
@@ -143,7 +178,7 @@ func (h DefaultStrategy) GenerateIDToken(ctx context.Context, lifespan time.Dura
 		}
 
 		// Adds a bit of wiggle room for timing issues
-		if claims.AuthTime.After(time.Now().UTC().Add(time.Second * 5)) {
+		if claims.AuthTime.After(now.Add(time.Second * 5)) {
 			return "", errorsx.WithStack(fosite.ErrServerError.WithDebug("Failed to validate OpenID Connect request because authentication time is in the future."))
 		}
 
@@ -194,22 +229,22 @@ func (h DefaultStrategy) GenerateIDToken(ctx context.Context, lifespan time.Dura
 
 			if hintSub, _ := tokenHint.Claims["sub"].(string); hintSub == "" {
 				return "", errorsx.WithStack(fosite.ErrServerError.WithDebug("Provided id token from 'id_token_hint' does not have a subject."))
-			} else if hintSub != claims.Subject {
+			} else if hintSub != subject {
 				return "", errorsx.WithStack(fosite.ErrServerError.WithDebug("Subject from authorization mismatches id token subject from 'id_token_hint'."))
 			}
 		}
 	}
 
 	if claims.ExpiresAt.IsZero() {
-		claims.ExpiresAt = time.Now().UTC().Add(lifespan)
+		claims.ExpiresAt = now.Add(lifespan)
 	}
 
-	if claims.ExpiresAt.Before(time.Now().UTC()) {
+	if claims.ExpiresAt.Before(now) {
 		return "", errorsx.WithStack(fosite.ErrServerError.WithDebug("Failed to generate id token because expiry claim can not be in the past."))
 	}
 
 	if claims.AuthTime.IsZero() {
-		claims.AuthTime = time.Now().Truncate(time.Second).UTC()
+		claims.AuthTime = now.Truncate(time.Second)
 	}
 
 	if claims.Issuer == "" {
@@ -226,8 +261,11 @@ func (h DefaultStrategy) GenerateIDToken(ctx context.Context, lifespan time.Dura
 	}
 
 	claims.Audience = stringslice.Unique(append(claims.Audience, requester.GetClient().GetID()))
-	claims.IssuedAt = time.Now().UTC()
+	claims.IssuedAt = now
+
+	mapClaims := claims.ToMapClaims()
+	mapClaims["sub"] = subject
 
-	token, _, err = h.Signer.Generate(ctx, claims.ToMapClaims(), sess.IDTokenHeaders())
+	token, _, err = h.Signer.Generate(ctx, mapClaims, sess.IDTokenHeaders())
 	return token, err
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/token/jwt"
@@ -283,3 +284,46 @@ func TestJWTStrategy_GenerateIDToken(t *testing.T) {
 		})
 	}
 }
+
+func TestJWTStrategy_GenerateIDTokenWithPairwiseSubject(t *testing.T) {
+	config := &fosite.Config{
+		MinParameterEntropy: fosite.MinParameterEntropy,
+		PairwiseSubjectSalt: []byte("some-salt"),
+	}
+	var j = &DefaultStrategy{
+		Signer: &jwt.DefaultSigner{
+			GetPrivateKey: func(_ context.Context) (interface{}, error) {
+				return key, nil
+			}},
+		Config: config,
+	}
+
+	newRequest := func() *fosite.AccessRequest {
+		req := fosite.NewAccessRequest(&DefaultSession{
+			Claims:  &jwt.IDTokenClaims{Subject: "peter"},
+			Headers: &jwt.Headers{},
+		})
+		req.Client = &fosite.DefaultOpenIDConnectClient{
+			DefaultClient: &fosite.DefaultClient{ID: "foo", RedirectURIs: []string{"https://a.example.com/cb"}},
+			SubjectType:   fosite.SubjectTypePairwise,
+		}
+		return req
+	}
+
+	req := newRequest()
+	token, err := j.GenerateIDToken(context.TODO(), time.Duration(0), req)
+	require.NoError(t, err)
+
+	expected, err := config.GetSubjectIdentifierStrategy(context.TODO()).SubjectIdentifier(context.TODO(), req.Client, "peter")
+	require.NoError(t, err)
+	decoded, err := j.Signer.Decode(context.TODO(), token)
+	require.NoError(t, err)
+	assert.Equal(t, expected, decoded.Claims["sub"])
+	assert.NotEqual(t, "peter", expected)
+	assert.Equal(t, "peter", req.Session.(*DefaultSession).Claims.Subject)
+
+	req = newRequest()
+	req.Form.Set("id_token_hint", token)
+	_, err = j.GenerateIDToken(context.TODO(), time.Duration(0), req)
+	require.NoError(t, err)
+}
@@ -23,6 +23,8 @@ var defaultPrompts = []string{"login", "none", "consent", "select_account"}
 type openIDConnectRequestValidatorConfigProvider interface {
 	fosite.RedirectSecureCheckerProvider
 	fosite.AllowedPromptsProvider
+	fosite.ClockProvider
+	fosite.SubjectIdentifierStrategyProvider
 }
 
 type OpenIDConnectRequestValidator struct {
@@ -98,7 +100,7 @@ func (v *OpenIDConnectRequestValidator) ValidatePrompt(ctx context.Context, req
 	}
 
 	// Adds a bit of wiggle room for timing issues
-	if claims.AuthTime.After(time.Now().UTC().Add(time.Second * 5)) {
+	if claims.AuthTime.After(v.Config.GetClock(ctx).Now().UTC().Add(time.Second * 5)) {
 		return errorsx.WithStack(fosite.ErrServerError.WithDebug("Failed to validate OpenID Connect request because authentication time is in the future."))
 	}
 
@@ -141,9 +143,14 @@ func (v *OpenIDConnectRequestValidator) ValidatePrompt(ctx context.Context, req
 		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("Failed to validate OpenID Connect request as decoding id token from id_token_hint parameter failed.").WithWrap(err).WithDebug(err.Error()))
 	}
 
+	subject, err := v.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, req.GetClient(), claims.Subject)
+	if err != nil {
+		return err
+	}
+
 	if hintSub, _ := tokenHint.Claims["sub"].(string); hintSub == "" {
 		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("Failed to validate OpenID Connect request because provided id token from id_token_hint does not have a subject."))
-	} else if hintSub != claims.Subject {
+	} else if hintSub != subject {
 		return errorsx.WithStack(fosite.ErrLoginRequired.WithHint("Failed to validate OpenID Connect request because the subject from provided id token from id_token_hint does not match the current session's subject."))
 	}
 
@@ -8,7 +8,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
-	"time"
 
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/token/hmac"
@@ -45,8 +44,8 @@ func (c *PushedAuthorizeHandler) HandlePushedAuthorizeEndpointRequest(ctx contex
 		return nil
 	}
 
-	if !c.secureChecker(ctx, ar.GetRedirectURI()) {
-		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("Redirect URL is using an insecure protocol, http is only allowed for hosts with suffix 'localhost', for example: http://myapp.localhost/."))
+	if err := c.secureChecker(ctx, ar.GetClient(), ar.GetRedirectURI()); err != nil {
+		return err
 	}
 
 	client := ar.GetClient()
@@ -62,7 +61,7 @@ func (c *PushedAuthorizeHandler) HandlePushedAuthorizeEndpointRequest(ctx contex
 
 	expiresIn := configProvider.GetPushedAuthorizeContextLifespan(ctx)
 	if ar.GetSession() != nil {
-		ar.GetSession().SetExpiresAt(fosite.PushedAuthorizeRequestContext, time.Now().UTC().Add(expiresIn))
+		ar.GetSession().SetExpiresAt(fosite.PushedAuthorizeRequestContext, c.Config.GetClock(ctx).Now().UTC().Add(expiresIn))
 	}
 
 	// generate an ID
@@ -83,10 +82,13 @@ func (c *PushedAuthorizeHandler) HandlePushedAuthorizeEndpointRequest(ctx contex
 	return nil
 }
 
-func (c *PushedAuthorizeHandler) secureChecker(ctx context.Context, u *url.URL) bool {
+func (c *PushedAuthorizeHandler) secureChecker(ctx context.Context, client fosite.Client, u *url.URL) error {
 	isRedirectURISecure := c.Config.GetRedirectSecureChecker(ctx)
 	if isRedirectURISecure == nil {
 		isRedirectURISecure = fosite.IsRedirectURISecure
 	}
-	return isRedirectURISecure(ctx, u)
+	if !isRedirectURISecure(ctx, u) {
+		return errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("Redirect URL is using an insecure protocol, http is only allowed for hosts with suffix 'localhost', for example: http://myapp.localhost/."))
+	}
+	return c.Config.GetRedirectURIPolicy(ctx, client).ValidateRedirectURI(ctx, client, u)
 }
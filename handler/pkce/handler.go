@@ -26,6 +26,7 @@ type Handler struct {
 		fosite.EnforcePKCEProvider
 		fosite.EnforcePKCEForPublicClientsProvider
 		fosite.EnablePKCEPlainChallengeMethodProvider
+		fosite.EnforceOAuth21Provider
 	}
 }
 
@@ -103,8 +104,13 @@ func (c *Handler) validate(ctx context.Context, challenge, method string, client
 	return nil
 }
 
+// enforcePKCE returns true if all clients must use PKCE, which OAuth 2.1 requires.
+func (c *Handler) enforcePKCE(ctx context.Context) bool {
+	return c.Config.GetEnforcePKCE(ctx) || c.Config.GetEnforceOAuth21(ctx)
+}
+
 func (c *Handler) validateNoPKCE(ctx context.Context, client fosite.Client) error {
-	if c.Config.GetEnforcePKCE(ctx) {
+	if c.enforcePKCE(ctx) {
 		return errorsx.WithStack(fosite.ErrInvalidRequest.
 			WithHint("Clients must include a code_challenge when performing the authorize code flow, but it is missing.").
 			WithDebug("The server is configured in a way that enforces PKCE for clients."))
@@ -159,7 +165,7 @@ func (c *Handler) HandleTokenEndpointRequest(ctx context.Context, request fosite
 
 	nc := len(challenge)
 
-	if !c.Config.GetEnforcePKCE(ctx) && nc == 0 && nv == 0 {
+	if !c.enforcePKCE(ctx) && nc == 0 && nv == 0 {
 		return nil
 	}
 
@@ -77,6 +77,10 @@ func TestPKCEHandleAuthorizeEndpointRequest(t *testing.T) {
 	config.EnforcePKCE = true
 	require.Error(t, h.HandleAuthorizeEndpointRequest(context.Background(), r, w))
 
+	config.EnforcePKCE = false
+	config.EnforceOAuth21 = true
+	require.Error(t, h.HandleAuthorizeEndpointRequest(context.Background(), r, w))
+
 	r.Form.Set("code_challenge", "challenge")
 	require.NoError(t, h.HandleAuthorizeEndpointRequest(context.Background(), r, w))
 }
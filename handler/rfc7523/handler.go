@@ -32,6 +32,8 @@ type Handler struct {
 		fosite.GetJWTMaxDurationProvider
 		fosite.AudienceStrategyProvider
 		fosite.ScopeStrategyProvider
+		fosite.ClockProvider
+		fosite.JWTLeewayProvider
 	}
 
 	*oauth2.HandleHelper
@@ -112,7 +114,7 @@ func (c *Handler) HandleTokenEndpointRequest(ctx context.Context, request fosite
 	}
 
 	atLifespan := fosite.GetEffectiveLifespan(request.GetClient(), fosite.GrantTypeJWTBearer, fosite.AccessToken, c.HandleHelper.Config.GetAccessTokenLifespan(ctx))
-	session.SetExpiresAt(fosite.AccessToken, time.Now().UTC().Add(atLifespan).Round(time.Second))
+	session.SetExpiresAt(fosite.AccessToken, c.Config.GetClock(ctx).Now().UTC().Add(atLifespan).Round(time.Second))
 	session.SetSubject(claims.Subject)
 
 	return nil
@@ -242,13 +244,14 @@ func (c *Handler) validateTokenClaims(ctx context.Context, claims jwt.Claims, ke
 		)
 	}
 
-	if claims.Expiry.Time().Before(time.Now()) {
+	now, leeway := c.Config.GetClock(ctx).Now(), c.Config.GetJWTLeeway(ctx)
+	if claims.Expiry.Time().Add(leeway).Before(now) {
 		return errorsx.WithStack(fosite.ErrInvalidGrant.
 			WithHint("The JWT in \"assertion\" request parameter expired."),
 		)
 	}
 
-	if claims.NotBefore != nil && !claims.NotBefore.Time().Before(time.Now()) {
+	if claims.NotBefore != nil && !claims.NotBefore.Time().Before(now.Add(leeway)) {
 		return errorsx.WithStack(fosite.ErrInvalidGrant.
 			WithHintf(
 				"The JWT in \"assertion\" request parameter contains an \"nbf\" (not before) claim, that identifies the time '%s' before which the token MUST NOT be accepted.",
@@ -267,7 +270,7 @@ func (c *Handler) validateTokenClaims(ctx context.Context, claims jwt.Claims, ke
 	if claims.IssuedAt != nil {
 		issuedDate = claims.IssuedAt.Time()
 	} else {
-		issuedDate = time.Now()
+		issuedDate = now
 	}
 	if claims.Expiry.Time().Sub(issuedDate) > c.Config.GetJWTMaxDuration(ctx) {
 		return errorsx.WithStack(fosite.ErrInvalidGrant.
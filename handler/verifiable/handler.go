@@ -5,7 +5,6 @@ package verifiable
 
 import (
 	"context"
-	"time"
 
 	"github.com/ory/fosite"
 	"github.com/ory/x/errorsx"
@@ -20,6 +19,7 @@ const (
 type Handler struct {
 	Config interface {
 		fosite.VerifiableCredentialsNonceLifespanProvider
+		fosite.ClockProvider
 	}
 	NonceManager
 }
@@ -44,7 +44,7 @@ func (c *Handler) PopulateTokenEndpointResponse(
 	}
 
 	lifespan := c.Config.GetVerifiableCredentialsNonceLifespan(ctx)
-	expiry := time.Now().UTC().Add(lifespan)
+	expiry := c.Config.GetClock(ctx).Now().UTC().Add(lifespan)
 	nonce, err := c.NewNonce(ctx, response.GetAccessToken(), expiry)
 	if err != nil {
 		return err
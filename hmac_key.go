@@ -0,0 +1,39 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import "time"
+
+// HMACKey is a secret used to generate and validate key-identified HMAC tokens. The key identifier is embedded in every
+// token, which allows validating the token with exactly one secret, regardless of how many secrets are configured.
+//
+// Secrets are rolled over by adding a key whose NotBefore lies in the future. Once NotBefore has passed, the new key
+// is used to generate tokens. The previous key keeps validating tokens until its NotAfter has passed, which should be
+// at least the longest token lifespan after the new key became active.
+type HMACKey struct {
+	// ID identifies the key in the tokens it generated. It must only contain the characters of the URL-safe base64
+	// alphabet.
+	ID string
+
+	// Secret is the secret used to sign and verify tokens. It must be at least 32 bytes long.
+	Secret []byte
+
+	// NotBefore is the time from which on the key is used to generate tokens. The zero value means immediately.
+	NotBefore time.Time
+
+	// NotAfter is the time from which on the key is no longer used to generate or validate tokens. The zero value
+	// means never.
+	NotAfter time.Time
+}
+
+// CanSign returns true if the key may be used to generate tokens at the given time.
+func (k *HMACKey) CanSign(now time.Time) bool {
+	return !now.Before(k.NotBefore) && k.CanVerify(now)
+}
+
+// CanVerify returns true if the key may be used to validate tokens at the given time. Keys are accepted before their
+// NotBefore time, so that servers with slightly different clocks accept each other's tokens during a rollover.
+func (k *HMACKey) CanVerify(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
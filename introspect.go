@@ -38,6 +38,26 @@ func AccessTokenFromRequest(req *http.Request) string {
 	return split[1]
 }
 
+// AccessTokenFromRequestWithConfig works like AccessTokenFromRequest, but if the configuration enforces OAuth 2.1,
+// the access_token parameter is only read from the request body, because OAuth 2.1 forbids passing access tokens
+// in the URI query string.
+func AccessTokenFromRequestWithConfig(ctx context.Context, config EnforceOAuth21Provider, req *http.Request) string {
+	if !config.GetEnforceOAuth21(ctx) {
+		return AccessTokenFromRequest(req)
+	}
+
+	auth := req.Header.Get("Authorization")
+	split := strings.SplitN(auth, " ", 2)
+	if len(split) != 2 || !strings.EqualFold(split[0], "bearer") {
+		if err := req.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+			return ""
+		}
+		return req.PostForm.Get("access_token")
+	}
+
+	return split[1]
+}
+
 func (f *Fosite) IntrospectToken(ctx context.Context, token string, tokenUse TokenUse, session Session, scopes ...string) (_ TokenUse, _ AccessRequester, err error) {
 	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer("github.com/ory/fosite").Start(ctx, "Fosite.IntrospectToken")
 	defer otelx.End(span, &err)
@@ -46,6 +66,7 @@ func (f *Fosite) IntrospectToken(ctx context.Context, token string, tokenUse Tok
 	var foundTokenUse TokenUse = ""
 
 	ar := NewAccessRequest(session)
+	ar.RequestedAt = f.Config.GetClock(ctx).Now().UTC()
 	for _, validator := range f.Config.GetTokenIntrospectionHandlers(ctx) {
 		tu, err := validator.IntrospectToken(ctx, token, tokenUse, ar, scopes)
 		if err == nil {
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -42,6 +43,32 @@ func TestAccessTokenFromRequestQuery(t *testing.T) {
 	assert.Equal(t, AccessTokenFromRequest(req), token, "Token should be obtainable from access_token query parameter")
 }
 
+func TestAccessTokenFromRequestWithConfig(t *testing.T) {
+	ctx := context.Background()
+	newRequest := func(t *testing.T, header string) *http.Request {
+		req, err := http.NewRequest("POST", "http://example.com/test?access_token=TokenFromQueryParam", strings.NewReader("access_token=TokenFromBody"))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		return req
+	}
+
+	query := func(t *testing.T) *http.Request {
+		req, err := http.NewRequest("GET", "http://example.com/test?access_token=TokenFromQueryParam", nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	assert.Equal(t, "TokenFromQueryParam", AccessTokenFromRequestWithConfig(ctx, new(Config), query(t)))
+
+	config := &Config{EnforceOAuth21: true}
+	assert.Empty(t, AccessTokenFromRequestWithConfig(ctx, config, query(t)), "OAuth 2.1 forbids access tokens in the query string")
+	assert.Equal(t, "TokenFromBody", AccessTokenFromRequestWithConfig(ctx, config, newRequest(t, "")))
+	assert.Equal(t, "TokenFromHeader", AccessTokenFromRequestWithConfig(ctx, config, newRequest(t, "TokenFromHeader")))
+}
+
 func TestIntrospect(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	validator := internal.NewMockTokenIntrospector(ctrl)
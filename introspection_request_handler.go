@@ -109,10 +109,16 @@ func (f *Fosite) NewIntrospectionRequest(ctx context.Context, r *http.Request, s
 		return &IntrospectionResponse{Active: false}, errorsx.WithStack(ErrInvalidRequest.WithHint("The POST body can not be empty."))
 	}
 
+	// OAuth 2.1 forbids passing access tokens in the query string, see
+	// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-v2-1-11#section-5.2
+	if f.Config.GetEnforceOAuth21(ctx) && r.URL.Query().Has("access_token") {
+		return &IntrospectionResponse{Active: false}, errorsx.WithStack(ErrInvalidRequest.WithHint("Access tokens must not be passed in the URI query string."))
+	}
+
 	token := r.PostForm.Get("token")
 	tokenTypeHint := r.PostForm.Get("token_type_hint")
 	scope := r.PostForm.Get("scope")
-	if clientToken := AccessTokenFromRequest(r); clientToken != "" {
+	if clientToken := AccessTokenFromRequestWithConfig(ctx, f.Config, r); clientToken != "" {
 		if token == clientToken {
 			return &IntrospectionResponse{Active: false}, errorsx.WithStack(ErrRequestUnauthorized.WithHint("Bearer and introspection token are identical."))
 		}
@@ -159,11 +165,19 @@ func (f *Fosite) NewIntrospectionRequest(ctx context.Context, r *http.Request, s
 		accessTokenType = BearerAccessToken
 	}
 
+	var phantomToken string
+	if tu == AccessToken && acceptsPhantomToken(r) {
+		if phantomToken, err = f.issuePhantomToken(ctx, token, ar); err != nil {
+			return &IntrospectionResponse{Active: false}, errorsx.WithStack(ErrServerError.WithHint("Unable to issue a phantom token.").WithWrap(err).WithDebug(err.Error()))
+		}
+	}
+
 	return &IntrospectionResponse{
 		Active:          true,
 		AccessRequester: ar,
 		TokenUse:        tu,
 		AccessTokenType: accessTokenType,
+		PhantomToken:    phantomToken,
 	}, nil
 }
 
@@ -173,6 +187,10 @@ type IntrospectionResponse struct {
 	TokenUse        TokenUse        `json:"token_use,omitempty"`
 	AccessTokenType string          `json:"token_type,omitempty"`
 	Lang            language.Tag    `json:"-"`
+
+	// PhantomToken is the JWT issued in exchange for the introspected access token, if the resource server asked for
+	// one. See PhantomTokenIssuer.
+	PhantomToken string `json:"-"`
 }
 
 func (r *IntrospectionResponse) IsActive() bool {
@@ -190,3 +208,7 @@ func (r *IntrospectionResponse) GetTokenUse() TokenUse {
 func (r *IntrospectionResponse) GetAccessTokenType() string {
 	return r.AccessTokenType
 }
+
+func (r *IntrospectionResponse) GetPhantomToken() string {
+	return r.PhantomToken
+}
@@ -205,6 +205,22 @@ func TestNewIntrospectionRequest(t *testing.T) {
 			},
 			isActive: true,
 		},
+		{
+			description: "should fail because OAuth 2.1 forbids access tokens in the query string",
+			setup: func() {
+				config.EnforceOAuth21 = true
+				config.TokenIntrospectionHandlers = TokenIntrospectionHandlers{validator}
+				httpreq = &http.Request{
+					Method: "POST",
+					URL:    &url.URL{RawQuery: "access_token=some-token"},
+					Header: http.Header{},
+					PostForm: url.Values{
+						"token": []string{"introspect-token"},
+					},
+				}
+			},
+			expectErr: ErrInvalidRequest,
+		},
 	} {
 		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
 			c.setup()
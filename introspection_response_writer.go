@@ -178,7 +178,24 @@ func (f *Fosite) WriteIntrospectionError(ctx context.Context, rw http.ResponseWr
 //	{
 //	  "active": false
 //	}
+//
+// If the resource server asked for a phantom token and one was issued, the response is the signed JWT instead:
+//
+//	HTTP/1.1 200 OK
+//	Content-Type: application/jwt
+//
+//	eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJ...
 func (f *Fosite) WriteIntrospectionResponse(ctx context.Context, rw http.ResponseWriter, r IntrospectionResponder) {
+	var subject string
+	if r.IsActive() && r.GetAccessRequester().GetSession().GetSubject() != "" {
+		var err error
+		subject, err = f.Config.GetSubjectIdentifierStrategy(ctx).SubjectIdentifier(ctx, r.GetAccessRequester().GetClient(), r.GetAccessRequester().GetSession().GetSubject())
+		if err != nil {
+			f.WriteIntrospectionError(ctx, rw, err)
+			return
+		}
+	}
+
 	rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
 	rw.Header().Set("Cache-Control", "no-store")
 	rw.Header().Set("Pragma", "no-cache")
@@ -190,6 +207,12 @@ func (f *Fosite) WriteIntrospectionResponse(ctx context.Context, rw http.Respons
 		return
 	}
 
+	if pr, ok := r.(PhantomTokenResponder); ok && pr.GetPhantomToken() != "" {
+		rw.Header().Set("Content-Type", PhantomTokenMediaType)
+		_, _ = rw.Write([]byte(pr.GetPhantomToken()))
+		return
+	}
+
 	response := map[string]interface{}{
 		"active": true,
 	}
@@ -220,8 +243,8 @@ func (f *Fosite) WriteIntrospectionResponse(ctx context.Context, rw http.Respons
 	if !r.GetAccessRequester().GetRequestedAt().IsZero() {
 		response["iat"] = r.GetAccessRequester().GetRequestedAt().Unix()
 	}
-	if r.GetAccessRequester().GetSession().GetSubject() != "" {
-		response["sub"] = r.GetAccessRequester().GetSession().GetSubject()
+	if subject != "" {
+		response["sub"] = subject
 	}
 	if len(r.GetAccessRequester().GetGrantedAudience()) > 0 {
 		response["aud"] = r.GetAccessRequester().GetGrantedAudience()
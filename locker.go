@@ -0,0 +1,97 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Locker serializes the redemption of single-use artifacts such as authorize codes, refresh tokens and pushed
+// authorization request URIs. Fosite holds the lock of an artifact while it reads, invalidates and replaces it, so
+// concurrent requests can not redeem it twice even if the storage is not transactional. Deployments running more than
+// one instance need a distributed implementation, for example on top of Redis or etcd.
+type Locker interface {
+	// Lock blocks until the lock of the key is acquired or ctx is done. The returned function releases the lock.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// LockKey returns the key of the lock of a single-use artifact, for example the signature of an authorize code.
+func LockKey(tokenType TokenType, id string) string {
+	return string(tokenType) + ":" + id
+}
+
+// NoopLocker is a Locker which does not lock. It is used if no Locker is configured, in which case the storage is
+// responsible for preventing double redemption.
+type NoopLocker struct{}
+
+// Lock returns immediately.
+func (NoopLocker) Lock(context.Context, string) (func(), error) {
+	return func() {}, nil
+}
+
+// MemoryLocker is a Locker for deployments running a single instance. The zero value is ready to use.
+type MemoryLocker struct {
+	m     sync.Mutex
+	locks map[string]*memoryLock
+}
+
+type memoryLock struct {
+	// held contains a value while the lock is held.
+	held chan struct{}
+	// refs counts the holder and the waiters, the lock is removed once it drops to zero.
+	refs int
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]*memoryLock)}
+}
+
+func (l *MemoryLocker) Lock(ctx context.Context, key string) (func(), error) {
+	l.m.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*memoryLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &memoryLock{held: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.m.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, errors.WithStack(ctx.Err())
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.held
+			l.release(key, lock)
+		})
+	}, nil
+}
+
+func (l *MemoryLocker) release(key string, lock *memoryLock) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// len returns the number of locks which are held or waited for.
+func (l *MemoryLocker) len() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return len(l.locks)
+}
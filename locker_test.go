@@ -0,0 +1,104 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, "authorize_code:foo", LockKey(AuthorizeCode, "foo"))
+	assert.NotEqual(t, LockKey(AuthorizeCode, "foo"), LockKey(RefreshToken, "foo"))
+}
+
+func TestConfigGetLocker(t *testing.T) {
+	assert.Equal(t, NoopLocker{}, new(Config).GetLocker(context.Background()))
+
+	locker := NewMemoryLocker()
+	assert.Equal(t, locker, (&Config{Locker: locker}).GetLocker(context.Background()))
+}
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=mutual exclusion", func(t *testing.T) {
+		var locker MemoryLocker
+		var wg sync.WaitGroup
+		var held, counter int
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock, err := locker.Lock(ctx, "key")
+				require.NoError(t, err)
+				defer unlock()
+
+				held++
+				assert.Equal(t, 1, held, "the lock is held by a single goroutine")
+				counter++
+				held--
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 50, counter)
+		assert.Equal(t, 0, locker.len(), "released locks are removed")
+	})
+
+	t.Run("case=keys are independent", func(t *testing.T) {
+		locker := NewMemoryLocker()
+		unlock, err := locker.Lock(ctx, "a")
+		require.NoError(t, err)
+		defer unlock()
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		unlockB, err := locker.Lock(ctx, "b")
+		require.NoError(t, err)
+		unlockB()
+	})
+
+	t.Run("case=context done", func(t *testing.T) {
+		locker := NewMemoryLocker()
+		unlock, err := locker.Lock(ctx, "key")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = locker.Lock(ctx, "key")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		unlock()
+		assert.Equal(t, 0, locker.len())
+	})
+
+	t.Run("case=unlock twice", func(t *testing.T) {
+		locker := NewMemoryLocker()
+		unlock, err := locker.Lock(ctx, "key")
+		require.NoError(t, err)
+		unlock()
+
+		unlockOther, err := locker.Lock(ctx, "key")
+		require.NoError(t, err)
+		defer unlockOther()
+		unlock()
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = locker.Lock(ctx, "key")
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "releasing a lock twice must not release it for the next holder")
+	})
+
+	t.Run("case=noop", func(t *testing.T) {
+		unlock, err := NoopLocker{}.Lock(ctx, "key")
+		require.NoError(t, err)
+		unlock()
+	})
+}
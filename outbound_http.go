@@ -0,0 +1,445 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultOutboundHTTPTimeout          = 10 * time.Second
+	defaultOutboundHTTPMaxResponseBytes = 1 << 20
+)
+
+var (
+	// ErrOutboundRequestDenied is returned (wrapped) by HTTP clients that enforce an OutboundHTTPPolicy when a
+	// request targets a location the policy does not allow.
+	ErrOutboundRequestDenied = errors.New("outbound HTTP request denied by policy")
+
+	// ErrOutboundResponseTooLarge is returned when reading a response body that exceeds
+	// OutboundHTTPPolicy.MaxResponseBytes.
+	ErrOutboundResponseTooLarge = errors.New("outbound HTTP response exceeds the maximum allowed size")
+
+	// deniedOutboundNetworks are address ranges that are not considered publicly routable, in addition to the
+	// ones covered by net.IP.IsLoopback, IsPrivate, IsLinkLocalUnicast and friends.
+	deniedOutboundNetworks = mustParseCIDRs(
+		"0.0.0.0/8",          // "this" network
+		"100.64.0.0/10",      // carrier-grade NAT
+		"192.0.0.0/24",       // IETF protocol assignments
+		"198.18.0.0/15",      // benchmarking
+		"240.0.0.0/4",        // reserved
+		"64:ff9b:1::/48",     // local-use IPv4/IPv6 translation
+		"2001:db8::/32",      // documentation
+		"fec0::/10",          // deprecated site-local
+		"::ffff:0:0:0/96",    // IPv4-translated addresses
+		"100::/64",           // discard-only
+		"2001::/23",          // IETF protocol assignments
+		"255.255.255.255/32", // broadcast
+	)
+)
+
+// OutboundHTTPPolicy restricts the remote locations fosite is allowed to contact, for example when fetching
+// a client's request_uri, jwks_uri or sector_identifier_uri. Because these locations are supplied by clients,
+// an unrestricted HTTP client allows a malicious client registration to make the server issue requests
+// to internal services (server-side request forgery).
+//
+// The policy is enforced by the HTTP client returned from Config.GetHTTPClient and therefore applies to every
+// component which uses that client. Unless Config.DisableOutboundHTTPPolicy is set, a zero policy is enforced if
+// Config.OutboundHTTPPolicy is nil. Destination addresses are checked after DNS resolution, right before the
+// connection is established, so DNS rebinding cannot be used to bypass the checks.
+type OutboundHTTPPolicy struct {
+	// AllowedSchemes is the list of URL schemes which may be requested. Defaults to "https".
+	AllowedSchemes []string
+
+	// AllowedPorts is the list of destination ports which may be requested. If empty, all ports are allowed.
+	AllowedPorts []int
+
+	// AllowedHosts restricts requests to the given host names. Entries starting with "*." match any subdomain
+	// of the given domain. If empty, all hosts are allowed.
+	AllowedHosts []string
+
+	// PrivateNetworkHosts is a list of host names (same syntax as AllowedHosts) which may resolve to loopback,
+	// private, link-local or otherwise non-public addresses. Requests to every other host are refused if
+	// they resolve to such an address.
+	PrivateNetworkHosts []string
+
+	// AllowPrivateNetworks disables the check for non-public destination addresses altogether. This should only
+	// be used for development and testing.
+	AllowPrivateNetworks bool
+
+	// Timeout limits the total time of a single request including reading the response body. Defaults to ten seconds.
+	Timeout time.Duration
+
+	// MaxResponseBytes limits the size of response bodies. Defaults to one MiB.
+	MaxResponseBytes int64
+
+	// wrapped caches the client returned by WrappedClient as a *wrappedOutboundHTTPClient. Copies of the policy do
+	// not use it, because it is only valid for the policy it was stored by.
+	wrapped atomic.Value
+}
+
+// defaultOutboundHTTPPolicy is enforced if Config.OutboundHTTPPolicy is nil.
+var defaultOutboundHTTPPolicy = new(OutboundHTTPPolicy)
+
+// wrappedOutboundHTTPClient is the client source wrapped with policy.
+type wrappedOutboundHTTPClient struct {
+	client *retryablehttp.Client
+	source *retryablehttp.Client
+	policy *OutboundHTTPPolicy
+}
+
+func (p *OutboundHTTPPolicy) allowedSchemes() []string {
+	if len(p.AllowedSchemes) == 0 {
+		return []string{"https"}
+	}
+	return p.AllowedSchemes
+}
+
+func (p *OutboundHTTPPolicy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultOutboundHTTPTimeout
+	}
+	return p.Timeout
+}
+
+func (p *OutboundHTTPPolicy) maxResponseBytes() int64 {
+	if p.MaxResponseBytes <= 0 {
+		return defaultOutboundHTTPMaxResponseBytes
+	}
+	return p.MaxResponseBytes
+}
+
+// ValidateURL checks the scheme, host and port of the given URL against the policy. It does not resolve
+// the host, destination addresses are checked when the connection is established.
+func (p *OutboundHTTPPolicy) ValidateURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if !containsFold(p.allowedSchemes(), scheme) {
+		return errors.WithStack(fmt.Errorf("%w: scheme '%s' is not allowed", ErrOutboundRequestDenied, u.Scheme))
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return errors.WithStack(fmt.Errorf("%w: the URL does not contain a host", ErrOutboundRequestDenied))
+	}
+
+	if len(p.AllowedHosts) > 0 && !matchesHostPattern(p.AllowedHosts, host) {
+		return errors.WithStack(fmt.Errorf("%w: host '%s' is not allowed", ErrOutboundRequestDenied, host))
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+
+	if len(p.AllowedPorts) > 0 {
+		n, err := strconv.Atoi(port)
+		if err != nil || !containsInt(p.AllowedPorts, n) {
+			return errors.WithStack(fmt.Errorf("%w: port '%s' is not allowed", ErrOutboundRequestDenied, port))
+		}
+	}
+
+	return nil
+}
+
+// ValidateIP returns an error if the given address is not publicly routable and host is not listed in
+// PrivateNetworkHosts.
+func (p *OutboundHTTPPolicy) ValidateIP(host string, ip net.IP) error {
+	if p.AllowPrivateNetworks || matchesHostPattern(p.PrivateNetworkHosts, host) {
+		return nil
+	}
+
+	if !IsPublicIP(ip) {
+		return errors.WithStack(fmt.Errorf("%w: host '%s' resolves to non-public address '%s'", ErrOutboundRequestDenied, host, ip))
+	}
+
+	return nil
+}
+
+// WrappedClient returns the given client wrapped by WrapClient. The wrapped client is reused as long as the given
+// client does not change.
+func (p *OutboundHTTPPolicy) WrappedClient(c *retryablehttp.Client) *retryablehttp.Client {
+	if cached, ok := p.wrapped.Load().(*wrappedOutboundHTTPClient); ok && cached.source == c && cached.policy == p {
+		return cached.client
+	}
+
+	// Concurrent calls may wrap the client more than once, which is harmless as every wrapped client is equivalent.
+	cached := &wrappedOutboundHTTPClient{client: p.WrapClient(c), source: c, policy: p}
+	p.wrapped.Store(cached)
+	return cached.client
+}
+
+// WrapClient returns a copy of the given client that enforces the policy. The copy shares the logger,
+// retry and backoff settings of the given client, but never retries requests that violate the policy. The timeout
+// of the copy is the smaller of the timeouts of the given client and the policy.
+func (p *OutboundHTTPPolicy) WrapClient(c *retryablehttp.Client) *retryablehttp.Client {
+	if c == nil {
+		c = retryablehttp.NewClient()
+	}
+
+	wrapped := &retryablehttp.Client{
+		Logger:          c.Logger,
+		RetryWaitMin:    c.RetryWaitMin,
+		RetryWaitMax:    c.RetryWaitMax,
+		RetryMax:        c.RetryMax,
+		RequestLogHook:  c.RequestLogHook,
+		ResponseLogHook: c.ResponseLogHook,
+		Backoff:         c.Backoff,
+		ErrorHandler:    c.ErrorHandler,
+	}
+
+	base := http.DefaultClient
+	if c.HTTPClient != nil {
+		base = c.HTTPClient
+	}
+
+	hc := *base
+	hc.Transport = p.WrapTransport(base.Transport)
+	if hc.Timeout <= 0 || hc.Timeout > p.timeout() {
+		hc.Timeout = p.timeout()
+	}
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := p.ValidateURL(req.URL); err != nil {
+			return err
+		}
+		if base.CheckRedirect != nil {
+			return base.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	wrapped.HTTPClient = &hc
+
+	checkRetry := c.CheckRetry
+	if checkRetry == nil {
+		checkRetry = retryablehttp.DefaultRetryPolicy
+	}
+	wrapped.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if errors.Is(err, ErrOutboundRequestDenied) || errors.Is(err, ErrOutboundResponseTooLarge) {
+			return false, err
+		}
+		return checkRetry(ctx, resp, err)
+	}
+
+	return wrapped
+}
+
+// WrapTransport returns a http.RoundTripper that enforces the policy. If the given transport is a *http.Transport
+// (or nil), its dialers are replaced by one which validates the resolved destination address. The destination
+// addresses of other transports can not be checked, so unless AllowPrivateNetworks is set, the returned transport
+// refuses all requests.
+func (p *OutboundHTTPPolicy) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	if t, ok := rt.(*http.Transport); ok {
+		t = t.Clone()
+		// Requests through a proxy or custom dialers would bypass the destination address checks.
+		t.Proxy = nil
+		t.Dial = nil
+		t.DialTLS = nil
+		t.DialTLSContext = nil
+		t.DialContext = p.dialContext
+		rt = t
+	} else if !p.AllowPrivateNetworks {
+		return &outboundPolicyTransport{policy: p, err: errors.WithStack(fmt.Errorf("%w: the destination addresses of transport %T can not be checked", ErrOutboundRequestDenied, rt))}
+	}
+
+	return &outboundPolicyTransport{policy: p, next: rt}
+}
+
+func (p *OutboundHTTPPolicy) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   p.timeout(),
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				return errors.WithStack(fmt.Errorf("%w: unable to parse address '%s'", ErrOutboundRequestDenied, ipStr))
+			}
+			return p.ValidateIP(host, ip)
+		},
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+type outboundPolicyTransport struct {
+	policy *OutboundHTTPPolicy
+	next   http.RoundTripper
+
+	// err is returned for every request if the next transport can not enforce the policy.
+	err error
+}
+
+func (t *outboundPolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if err := t.policy.ValidateURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := t.policy.maxResponseBytes()
+	if res.ContentLength > limit {
+		_ = res.Body.Close()
+		return nil, errors.WithStack(fmt.Errorf("%w: %d bytes announced, at most %d bytes allowed", ErrOutboundResponseTooLarge, res.ContentLength, limit))
+	}
+
+	res.Body = &limitedReadCloser{rc: res.Body, remaining: limit}
+	return res, nil
+}
+
+// limitedReadCloser returns ErrOutboundResponseTooLarge instead of silently truncating the body.
+type limitedReadCloser struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errors.WithStack(ErrOutboundResponseTooLarge)
+	}
+
+	// Read one byte more than allowed to detect oversized bodies.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.rc.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), errors.WithStack(ErrOutboundResponseTooLarge)
+	}
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.rc.Close()
+}
+
+// readOutboundResponse reads the body of a response to an outbound request. It returns ErrOutboundResponseTooLarge if
+// the body exceeds the maximum response size of the configured policy, or one MiB if outbound requests are not
+// restricted.
+func readOutboundResponse(ctx context.Context, config interface{}, body io.Reader) ([]byte, error) {
+	limit := int64(defaultOutboundHTTPMaxResponseBytes)
+	if provider, ok := config.(OutboundHTTPPolicyProvider); ok {
+		if policy := provider.GetOutboundHTTPPolicy(ctx); policy != nil {
+			limit = policy.maxResponseBytes()
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) > limit {
+		return nil, errors.WithStack(ErrOutboundResponseTooLarge)
+	}
+	return data, nil
+}
+
+// IsPublicIP returns false if the given address is a loopback, private, link-local, multicast, unspecified
+// or otherwise reserved address.
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+
+	for _, n := range deniedOutboundNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchesHostPattern(patterns []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if strings.EqualFold(s, needle) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(haystack []int, needle int) bool {
+	for _, i := range haystack {
+		if i == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
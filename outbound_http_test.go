@@ -0,0 +1,249 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboundHTTPPolicyValidateURL(t *testing.T) {
+	for k, tc := range []struct {
+		d      string
+		policy OutboundHTTPPolicy
+		url    string
+		err    bool
+	}{
+		{d: "https is allowed by default", url: "https://example.com/jwks.json"},
+		{d: "http is denied by default", url: "http://example.com/jwks.json", err: true},
+		{d: "scheme allow-list", policy: OutboundHTTPPolicy{AllowedSchemes: []string{"http"}}, url: "http://example.com/"},
+		{d: "missing host", url: "https:///foo", err: true},
+		{d: "port allow-list uses the scheme default port", policy: OutboundHTTPPolicy{AllowedPorts: []int{443}}, url: "https://example.com/"},
+		{d: "port allow-list denies other ports", policy: OutboundHTTPPolicy{AllowedPorts: []int{443}}, url: "https://example.com:8443/", err: true},
+		{d: "host allow-list", policy: OutboundHTTPPolicy{AllowedHosts: []string{"example.com"}}, url: "https://EXAMPLE.com/"},
+		{d: "host allow-list denies other hosts", policy: OutboundHTTPPolicy{AllowedHosts: []string{"example.com"}}, url: "https://example.org/", err: true},
+		{d: "host allow-list wildcard", policy: OutboundHTTPPolicy{AllowedHosts: []string{"*.example.com"}}, url: "https://keys.example.com/"},
+		{d: "host allow-list wildcard does not match the apex", policy: OutboundHTTPPolicy{AllowedHosts: []string{"*.example.com"}}, url: "https://example.com/", err: true},
+	} {
+		t.Run(tc.d, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			require.NoError(t, err)
+
+			err = tc.policy.ValidateURL(u)
+			if tc.err {
+				assert.ErrorIs(t, err, ErrOutboundRequestDenied, "%d", k)
+			} else {
+				assert.NoError(t, err, "%d", k)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, expected := range map[string]bool{
+		"8.8.8.8":              true,
+		"2606:4700:4700::1111": true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:10.0.0.1":      false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"224.0.0.1":            false,
+	} {
+		assert.Equal(t, expected, IsPublicIP(net.ParseIP(ip)), "%s", ip)
+	}
+}
+
+func TestOutboundHTTPPolicyWrapClient(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+			return
+		}
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "https://example.com/", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+
+	get := func(t *testing.T, hc *retryablehttp.Client, path string) (string, error) {
+		req, err := retryablehttp.NewRequestWithContext(ctx, "GET", ts.URL+path, nil)
+		require.NoError(t, err)
+		res, err := hc.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	t.Run("case=denies loopback addresses without retrying", func(t *testing.T) {
+		hc := retryablehttp.NewClient()
+		hc.RetryWaitMin = time.Minute
+		p := &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}}
+
+		_, err := get(t, p.WrapClient(hc), "/")
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+	})
+
+	t.Run("case=allows private network hosts", func(t *testing.T) {
+		p := &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}, PrivateNetworkHosts: []string{"127.0.0.1"}}
+
+		body, err := get(t, p.WrapClient(nil), "/")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", body)
+	})
+
+	t.Run("case=denies redirects to disallowed locations", func(t *testing.T) {
+		p := &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}, AllowPrivateNetworks: true}
+
+		_, err := get(t, p.WrapClient(nil), "/redirect")
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+	})
+
+	t.Run("case=limits the response size", func(t *testing.T) {
+		p := &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}, AllowPrivateNetworks: true, MaxResponseBytes: 1024}
+
+		_, err := get(t, p.WrapClient(nil), "/large")
+		require.ErrorIs(t, err, ErrOutboundResponseTooLarge)
+
+		p.MaxResponseBytes = 2048
+		body, err := get(t, p.WrapClient(nil), "/large")
+		require.NoError(t, err)
+		assert.Len(t, body, 2048)
+	})
+
+	t.Run("case=config applies the policy to the HTTP client and JWKS fetcher", func(t *testing.T) {
+		c := &Config{OutboundHTTPPolicy: &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}}}
+
+		_, err := get(t, c.GetHTTPClient(ctx), "/")
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+		assert.Same(t, c.GetHTTPClient(ctx), c.GetHTTPClient(ctx))
+
+		_, err = c.GetJWKSFetcherStrategy(ctx).Resolve(ctx, ts.URL, true)
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+	})
+
+	t.Run("case=config applies a policy by default", func(t *testing.T) {
+		c := new(Config)
+		require.NotNil(t, c.GetOutboundHTTPPolicy(ctx))
+		_, err := get(t, c.GetHTTPClient(ctx), "/")
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+
+		c.DisableOutboundHTTPPolicy = true
+		assert.Nil(t, c.GetOutboundHTTPPolicy(ctx))
+		body, err := get(t, c.GetHTTPClient(ctx), "/")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", body)
+	})
+
+	t.Run("case=refuses transports which can not be checked", func(t *testing.T) {
+		hc := retryablehttp.NewClient()
+		hc.HTTPClient = &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+		p := &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}, PrivateNetworkHosts: []string{"127.0.0.1"}}
+
+		_, err := get(t, p.WrapClient(hc), "/")
+		require.ErrorIs(t, err, ErrOutboundRequestDenied)
+
+		p = &OutboundHTTPPolicy{AllowedSchemes: []string{"http"}, AllowPrivateNetworks: true}
+		body, err := get(t, p.WrapClient(hc), "/")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", body)
+	})
+
+	t.Run("case=replaces custom dialers", func(t *testing.T) {
+		dialed := false
+		transport := &http.Transport{DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = true
+			return nil, errors.New("must not be called")
+		}}
+		p := &OutboundHTTPPolicy{}
+
+		wrapped := p.WrapTransport(transport).(*outboundPolicyTransport).next.(*http.Transport)
+		assert.Nil(t, wrapped.DialTLSContext)
+		assert.NotNil(t, transport.DialTLSContext, "the given transport is not modified")
+		assert.False(t, dialed)
+	})
+
+	t.Run("case=uses the smaller timeout", func(t *testing.T) {
+		p := &OutboundHTTPPolicy{Timeout: 5 * time.Second}
+		for given, expected := range map[time.Duration]time.Duration{0: 5 * time.Second, time.Second: time.Second, time.Minute: 5 * time.Second} {
+			hc := retryablehttp.NewClient()
+			hc.HTTPClient.Timeout = given
+			assert.Equal(t, expected, p.WrapClient(hc).HTTPClient.Timeout, "client timeout %s", given)
+		}
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestReadOutboundResponse(t *testing.T) {
+	ctx := context.Background()
+	large := strings.Repeat("a", defaultOutboundHTTPMaxResponseBytes+1)
+
+	_, err := readOutboundResponse(ctx, &Config{DisableOutboundHTTPPolicy: true}, strings.NewReader(large))
+	assert.ErrorIs(t, err, ErrOutboundResponseTooLarge, "responses are bounded without a policy")
+
+	body, err := readOutboundResponse(ctx, &Config{OutboundHTTPPolicy: &OutboundHTTPPolicy{MaxResponseBytes: int64(len(large))}}, strings.NewReader(large))
+	require.NoError(t, err)
+	assert.Len(t, body, len(large))
+}
+
+func TestConfigGetHTTPClientConcurrent(t *testing.T) {
+	ctx := context.Background()
+	c := &Config{OutboundHTTPPolicy: &OutboundHTTPPolicy{}}
+
+	var wg sync.WaitGroup
+	clients := make([]*retryablehttp.Client, 20)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = c.GetHTTPClient(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, hc := range clients {
+		require.NotNil(t, hc)
+	}
+	assert.Same(t, c.GetHTTPClient(ctx), c.GetHTTPClient(ctx))
+
+	c.OutboundHTTPPolicy = &OutboundHTTPPolicy{}
+	assert.NotSame(t, clients[0], c.GetHTTPClient(ctx), "changing the policy wraps the client again")
+
+	copied := *c
+	assert.Same(t, c.GetHTTPClient(ctx), copied.GetHTTPClient(ctx), "copies of the config share the policy")
+	policy := *c.OutboundHTTPPolicy
+	copied.OutboundHTTPPolicy = &policy
+	assert.NotSame(t, c.GetHTTPClient(ctx), copied.GetHTTPClient(ctx), "copies of the policy do not share the client")
+}
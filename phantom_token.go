@@ -0,0 +1,61 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PhantomTokenMediaType is the media type which resource servers accept at the introspection endpoint to receive a
+// phantom token instead of the JSON introspection response.
+const PhantomTokenMediaType = "application/jwt"
+
+// PhantomTokenIssuer is implemented by token introspection handlers which exchange opaque access tokens for
+// short-lived signed JWTs ("phantom tokens"). Clients only ever see the opaque token, while an API gateway can pass the
+// JWT on to the services behind it.
+//
+// If a resource server sends an introspection request with the header "Accept: application/jwt", the first
+// introspection handler which implements PhantomTokenIssuer is asked for a phantom token of the introspected access
+// token. Handlers return ErrUnknownRequest if they can not issue phantom tokens.
+type PhantomTokenIssuer interface {
+	// IssuePhantomToken returns a signed JWT for the given active access token, which has already been introspected
+	// into the requester.
+	IssuePhantomToken(ctx context.Context, token string, requester AccessRequester) (string, error)
+}
+
+// PhantomTokenResponder is implemented by introspection responses which carry a phantom token.
+type PhantomTokenResponder interface {
+	// GetPhantomToken returns the phantom token, or an empty string if none was requested.
+	GetPhantomToken() string
+}
+
+func acceptsPhantomToken(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == PhantomTokenMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fosite) issuePhantomToken(ctx context.Context, token string, requester AccessRequester) (string, error) {
+	for _, handler := range f.Config.GetTokenIntrospectionHandlers(ctx) {
+		issuer, ok := handler.(PhantomTokenIssuer)
+		if !ok {
+			continue
+		}
+
+		phantomToken, err := issuer.IssuePhantomToken(ctx, token, requester)
+		if errors.Is(err, ErrUnknownRequest) {
+			continue
+		}
+		return phantomToken, err
+	}
+	return "", nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func TestPhantomTokens(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	secret, err := (&BCrypt{Config: &Config{HashCost: 4}}).Hash(ctx, []byte("foobar"))
+	require.NoError(t, err)
+	store.Clients["app"] = &DefaultClient{ID: "app", Secret: secret, GrantTypes: []string{"client_credentials"}, Scopes: []string{"read"}}
+	store.Clients["gateway"] = &DefaultClient{ID: "gateway", Secret: secret}
+
+	key := gen.MustRSAKey()
+	signer := &jwt.DefaultSigner{GetPrivateKey: func(context.Context) (interface{}, error) {
+		return key, nil
+	}}
+	config := &Config{
+		GlobalSecret:         []byte("some-super-cool-secret-that-nobody-knows"),
+		AccessTokenIssuer:    "https://auth.example.com",
+		PhantomTokenLifespan: time.Minute,
+		HashCost:             4,
+	}
+	introspection, revocation := compose.OAuth2PhantomTokenFactories(signer)
+	provider := compose.Compose(config, store, compose.NewOAuth2HMACStrategy(config), compose.OAuth2ClientCredentialsGrantFactory, introspection, revocation)
+
+	newRequest := func(path, clientID string, form url.Values) *http.Request {
+		req := httptest.NewRequest("POST", "https://auth.example.com"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, "foobar")
+		return req
+	}
+
+	ar, err := provider.NewAccessRequest(ctx, newRequest("/token", "app", url.Values{"grant_type": {"client_credentials"}, "scope": {"read"}}), &oauth2.JWTSession{JWTClaims: new(jwt.JWTClaims)})
+	require.NoError(t, err)
+	ar.GrantScope("read")
+	resp, err := provider.NewAccessResponse(ctx, ar)
+	require.NoError(t, err)
+	token := resp.GetAccessToken()
+
+	introspect := func(accept string) *httptest.ResponseRecorder {
+		req := newRequest("/introspect", "gateway", url.Values{"token": {token}})
+		req.Header.Set("Accept", accept)
+		ir, err := provider.NewIntrospectionRequest(ctx, req, new(oauth2.JWTSession))
+		rec := httptest.NewRecorder()
+		if err != nil {
+			provider.WriteIntrospectionError(ctx, rec, err)
+		} else {
+			provider.WriteIntrospectionResponse(ctx, rec, ir)
+		}
+		return rec
+	}
+
+	rec := introspect("application/json;q=0.5, application/jwt")
+	assert.Equal(t, PhantomTokenMediaType, rec.Header().Get("Content-Type"))
+	phantomToken := rec.Body.String()
+	assert.NotContains(t, phantomToken, token)
+
+	decoded, err := signer.Decode(ctx, phantomToken)
+	require.NoError(t, err)
+	assert.Equal(t, "app", decoded.Claims["client_id"])
+	assert.Equal(t, "https://auth.example.com", decoded.Claims["iss"])
+	assert.Equal(t, []interface{}{"read"}, decoded.Claims["scp"])
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), decoded.Claims["exp"], 5)
+
+	assert.Equal(t, phantomToken, introspect(PhantomTokenMediaType).Body.String(), "phantom tokens are cached")
+
+	rec = introspect("application/json")
+	assert.Equal(t, "application/json;charset=UTF-8", rec.Header().Get("Content-Type"))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, true, body["active"])
+
+	require.NoError(t, provider.NewRevocationRequest(ctx, newRequest("/revoke", "app", url.Values{"token": {token}})))
+
+	rec = introspect(PhantomTokenMediaType)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, false, body["active"])
+}
@@ -27,6 +27,7 @@ func (f *Fosite) NewPushedAuthorizeRequest(ctx context.Context, r *http.Request)
 	defer otelx.End(span, &err)
 
 	request := NewAuthorizeRequest()
+	request.RequestedAt = f.Config.GetClock(ctx).Now().UTC()
 	request.Request.Lang = i18n.GetLangFromRequest(f.Config.GetMessageCatalog(ctx), r)
 
 	if r.Method != "POST" {
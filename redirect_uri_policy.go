@@ -0,0 +1,221 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/ory/x/errorsx"
+)
+
+const (
+	// RedirectURIProfileNative selects the NativeAppRedirectURIPolicy.
+	RedirectURIProfileNative = "native"
+
+	// RedirectURIProfileWeb selects the WebRedirectURIPolicy.
+	RedirectURIProfileWeb = "web"
+)
+
+// RedirectURIPolicy decides which redirect URIs a client may use and how a requested redirect URI is compared to
+// the client's registered redirect URIs.
+type RedirectURIPolicy interface {
+	// MatchRedirectURI returns true if the requested redirect URI matches the registered redirect URI.
+	MatchRedirectURI(ctx context.Context, requested, registered string) bool
+
+	// ValidateRedirectURI returns an error if the client must not use the redirect URI.
+	ValidateRedirectURI(ctx context.Context, client Client, redirectURI *url.URL) error
+}
+
+// RedirectURIProfileClient represents a client which selects a redirect URI policy by its profile name, for
+// example RedirectURIProfileNative or RedirectURIProfileWeb.
+type RedirectURIProfileClient interface {
+	// GetRedirectURIProfile returns the name of the redirect URI profile of the client.
+	GetRedirectURIProfile() string
+}
+
+var (
+	_ RedirectURIPolicy = (*DefaultRedirectURIPolicy)(nil)
+	_ RedirectURIPolicy = (*NativeAppRedirectURIPolicy)(nil)
+	_ RedirectURIPolicy = (*WebRedirectURIPolicy)(nil)
+)
+
+// DefaultRedirectURIPolicy compares redirect URIs using simple string comparison, but accepts any port for
+// loopback redirect URIs (see https://tools.ietf.org/html/rfc8252#section-7.3). It does not restrict the kind of
+// redirect URIs a client may use.
+type DefaultRedirectURIPolicy struct{}
+
+func (p *DefaultRedirectURIPolicy) MatchRedirectURI(_ context.Context, requested, registered string) bool {
+	_, ok := isMatchingRedirectURI(requested, []string{registered})
+	return ok
+}
+
+func (p *DefaultRedirectURIPolicy) ValidateRedirectURI(context.Context, Client, *url.URL) error {
+	return nil
+}
+
+// NativeAppRedirectURIPolicy implements the redirect URI options of OAuth 2.0 for Native Apps:
+//
+//   - https://tools.ietf.org/html/rfc8252#section-7.1
+//     Private-use URI schemes must be based on a domain name under the control of the app, expressed in
+//     reverse order, for example "com.example.app:/oauth2redirect".
+//   - https://tools.ietf.org/html/rfc8252#section-7.2
+//     Claimed "https" scheme redirect URIs are allowed.
+//   - https://tools.ietf.org/html/rfc8252#section-7.3
+//     Loopback redirect URIs use the "http" scheme and a loopback IP literal. Any port is accepted.
+//   - https://tools.ietf.org/html/rfc8252#section-8.3
+//     Using "localhost" is NOT RECOMMENDED.
+//   - https://tools.ietf.org/html/rfc8252#section-8.4
+//     Private-use URI schemes can be claimed by any app, which is why they are rejected for confidential clients.
+type NativeAppRedirectURIPolicy struct {
+	// AllowLocalhost allows loopback redirect URIs which use the "localhost" host name instead of an IP literal.
+	AllowLocalhost bool
+
+	// AllowNonReverseDomainSchemes allows private-use URI schemes which are not reverse domain names, for example
+	// "myapp:/callback".
+	AllowNonReverseDomainSchemes bool
+}
+
+func (p *NativeAppRedirectURIPolicy) MatchRedirectURI(_ context.Context, requested, registered string) bool {
+	_, ok := isMatchingRedirectURI(requested, []string{registered})
+	return ok
+}
+
+func (p *NativeAppRedirectURIPolicy) ValidateRedirectURI(_ context.Context, client Client, redirectURI *url.URL) error {
+	switch redirectURI.Scheme {
+	case "https":
+		if redirectURI.Host == "" {
+			return errRedirectURIPolicy(redirectURI, "Claimed https redirect URIs must contain a host.")
+		}
+		return nil
+	case "http":
+		if isLoopbackAddress(redirectURI.Hostname()) || (p.AllowLocalhost && redirectURI.Hostname() == "localhost") {
+			return nil
+		}
+		return errRedirectURIPolicy(redirectURI, "Redirect URIs using the http scheme must use a loopback IP literal.")
+	}
+
+	if !client.IsPublic() {
+		return errRedirectURIPolicy(redirectURI, "Private-use URI schemes are not allowed for confidential clients.")
+	} else if !p.AllowNonReverseDomainSchemes && !isReverseDomainScheme(redirectURI.Scheme) {
+		return errRedirectURIPolicy(redirectURI, "Private-use URI schemes must be a reverse domain name such as 'com.example.app'.")
+	}
+	return nil
+}
+
+// WebRedirectURIPolicy only accepts "https" redirect URIs and compares them using simple string comparison. It is
+// intended for confidential web applications.
+type WebRedirectURIPolicy struct {
+	// AllowLoopback additionally allows "http" redirect URIs which use a loopback IP literal or "localhost", which
+	// is useful during development.
+	AllowLoopback bool
+}
+
+func (p *WebRedirectURIPolicy) MatchRedirectURI(_ context.Context, requested, registered string) bool {
+	return requested == registered
+}
+
+func (p *WebRedirectURIPolicy) ValidateRedirectURI(_ context.Context, _ Client, redirectURI *url.URL) error {
+	switch redirectURI.Scheme {
+	case "https":
+		if redirectURI.Host == "" {
+			return errRedirectURIPolicy(redirectURI, "Redirect URIs must contain a host.")
+		}
+		return nil
+	case "http":
+		if p.AllowLoopback && IsLocalhost(redirectURI) {
+			return nil
+		}
+	}
+	return errRedirectURIPolicy(redirectURI, "Redirect URIs must use the https scheme.")
+}
+
+// DefaultRedirectURIPolicies returns the built-in redirect URI policies by their profile name.
+func DefaultRedirectURIPolicies() map[string]RedirectURIPolicy {
+	return map[string]RedirectURIPolicy{
+		RedirectURIProfileNative: new(NativeAppRedirectURIPolicy),
+		RedirectURIProfileWeb:    new(WebRedirectURIPolicy),
+	}
+}
+
+// MatchRedirectURIWithPolicy is like MatchRedirectURIWithClientRedirectURIs, but compares and validates the redirect
+// URI using the given policy. If policy is nil, DefaultRedirectURIPolicy is used.
+func MatchRedirectURIWithPolicy(ctx context.Context, rawurl string, client Client, policy RedirectURIPolicy) (*url.URL, error) {
+	if policy == nil {
+		policy = new(DefaultRedirectURIPolicy)
+	}
+
+	var redirectTo *url.URL
+	if rawurl == "" && len(client.GetRedirectURIs()) == 1 {
+		if redirectURIFromClient, err := url.Parse(client.GetRedirectURIs()[0]); err == nil && IsValidRedirectURI(redirectURIFromClient) {
+			// If no redirect_uri was given and the client has exactly one valid redirect_uri registered, use that instead
+			redirectTo = redirectURIFromClient
+		}
+	} else if rawurl != "" {
+		for _, registered := range client.GetRedirectURIs() {
+			if !policy.MatchRedirectURI(ctx, rawurl, registered) {
+				continue
+			}
+			// We have to use the requested URL here because otherwise the port might get lost (see isMatchingAsLoopback).
+			if parsed, err := url.Parse(rawurl); err == nil && IsValidRedirectURI(parsed) {
+				redirectTo = parsed
+			}
+			break
+		}
+	}
+
+	if redirectTo == nil {
+		return nil, errorsx.WithStack(ErrInvalidRequest.WithHint("The 'redirect_uri' parameter does not match any of the OAuth 2.0 Client's pre-registered redirect urls."))
+	}
+
+	if err := policy.ValidateRedirectURI(ctx, client, redirectTo); err != nil {
+		return nil, err
+	}
+	return redirectTo, nil
+}
+
+// redirectURIPolicyForClient returns the policy of the client's redirect URI profile from policies, falling back to
+// the built-in policies and then to fallback.
+func redirectURIPolicyForClient(client Client, policies map[string]RedirectURIPolicy, fallback RedirectURIPolicy) RedirectURIPolicy {
+	if pc, ok := client.(RedirectURIProfileClient); ok && pc.GetRedirectURIProfile() != "" {
+		if policy, ok := policies[pc.GetRedirectURIProfile()]; ok {
+			return policy
+		} else if policy, ok := DefaultRedirectURIPolicies()[pc.GetRedirectURIProfile()]; ok {
+			return policy
+		}
+		return &unknownRedirectURIPolicy{profile: pc.GetRedirectURIProfile()}
+	}
+	return fallback
+}
+
+// unknownRedirectURIPolicy rejects all redirect URIs of clients which select an unknown profile.
+type unknownRedirectURIPolicy struct {
+	profile string
+}
+
+func (p *unknownRedirectURIPolicy) MatchRedirectURI(context.Context, string, string) bool {
+	return false
+}
+
+func (p *unknownRedirectURIPolicy) ValidateRedirectURI(context.Context, Client, *url.URL) error {
+	return errorsx.WithStack(ErrInvalidClient.WithHintf("The OAuth 2.0 Client uses the unknown redirect URI profile '%s'.", p.profile))
+}
+
+func isReverseDomainScheme(scheme string) bool {
+	labels := strings.Split(scheme, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func errRedirectURIPolicy(redirectURI *url.URL, reason string) error {
+	return errorsx.WithStack(ErrInvalidRequest.WithHintf("The redirect URI '%s' is not allowed for the OAuth 2.0 Client. %s", redirectURI, reason))
+}
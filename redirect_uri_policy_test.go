@@ -0,0 +1,107 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+)
+
+func TestRedirectURIPolicyValidateRedirectURI(t *testing.T) {
+	ctx := context.Background()
+	public := &fosite.DefaultClient{ID: "foo", Public: true}
+	confidential := &fosite.DefaultClient{ID: "foo"}
+
+	for k, c := range []struct {
+		d      string
+		policy fosite.RedirectURIPolicy
+		client fosite.Client
+		uri    string
+		err    bool
+	}{
+		{d: "native allows loopback IPv4 literals", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "http://127.0.0.1:51004/cb"},
+		{d: "native allows loopback IPv6 literals", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "http://[::1]:51004/cb"},
+		{d: "native denies localhost by default", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "http://localhost:51004/cb", err: true},
+		{d: "native allows localhost if configured", policy: &fosite.NativeAppRedirectURIPolicy{AllowLocalhost: true}, client: public, uri: "http://localhost:51004/cb"},
+		{d: "native denies http for other hosts", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "http://example.com/cb", err: true},
+		{d: "native allows claimed https redirects", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "https://app.example.com/cb"},
+		{d: "native allows reverse domain schemes", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "com.example.app:/oauth2redirect"},
+		{d: "native denies other private-use schemes", policy: new(fosite.NativeAppRedirectURIPolicy), client: public, uri: "myapp:/oauth2redirect", err: true},
+		{d: "native allows other private-use schemes if configured", policy: &fosite.NativeAppRedirectURIPolicy{AllowNonReverseDomainSchemes: true}, client: public, uri: "myapp:/oauth2redirect"},
+		{d: "native denies private-use schemes for confidential clients", policy: new(fosite.NativeAppRedirectURIPolicy), client: confidential, uri: "com.example.app:/oauth2redirect", err: true},
+		{d: "web allows https", policy: new(fosite.WebRedirectURIPolicy), client: confidential, uri: "https://example.com/cb"},
+		{d: "web denies loopback by default", policy: new(fosite.WebRedirectURIPolicy), client: confidential, uri: "http://127.0.0.1/cb", err: true},
+		{d: "web allows loopback if configured", policy: &fosite.WebRedirectURIPolicy{AllowLoopback: true}, client: confidential, uri: "http://localhost/cb"},
+		{d: "web denies private-use schemes", policy: new(fosite.WebRedirectURIPolicy), client: public, uri: "com.example.app:/oauth2redirect", err: true},
+		{d: "default allows anything", policy: new(fosite.DefaultRedirectURIPolicy), client: confidential, uri: "myapp:/oauth2redirect"},
+	} {
+		t.Run(c.d, func(t *testing.T) {
+			u, err := url.Parse(c.uri)
+			require.NoError(t, err)
+
+			err = c.policy.ValidateRedirectURI(ctx, c.client, u)
+			if c.err {
+				assert.ErrorIs(t, err, fosite.ErrInvalidRequest, "%d", k)
+			} else {
+				assert.NoError(t, err, "%d", k)
+			}
+		})
+	}
+}
+
+func TestMatchRedirectURIWithPolicy(t *testing.T) {
+	ctx := context.Background()
+	client := &fosite.DefaultClient{ID: "foo", Public: true, RedirectURIs: []string{"http://127.0.0.1/cb", "https://example.com/cb"}}
+
+	u, err := fosite.MatchRedirectURIWithPolicy(ctx, "http://127.0.0.1:51004/cb", client, new(fosite.NativeAppRedirectURIPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:51004/cb", u.String())
+
+	_, err = fosite.MatchRedirectURIWithPolicy(ctx, "http://127.0.0.1:51004/cb", client, &fosite.WebRedirectURIPolicy{AllowLoopback: true})
+	assert.ErrorIs(t, err, fosite.ErrInvalidRequest)
+
+	u, err = fosite.MatchRedirectURIWithPolicy(ctx, "https://example.com/cb", client, new(fosite.WebRedirectURIPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cb", u.String())
+
+	_, err = fosite.MatchRedirectURIWithPolicy(ctx, "http://127.0.0.1/cb", client, new(fosite.WebRedirectURIPolicy))
+	assert.ErrorIs(t, err, fosite.ErrInvalidRequest)
+}
+
+func TestConfigGetRedirectURIPolicy(t *testing.T) {
+	ctx := context.Background()
+	custom := &fosite.NativeAppRedirectURIPolicy{AllowLocalhost: true}
+	config := &fosite.Config{RedirectURIPolicies: map[string]fosite.RedirectURIPolicy{"custom": custom}}
+
+	newClient := func(profile string) fosite.Client {
+		return &fosite.DefaultRedirectURIProfileClient{
+			DefaultClient:      &fosite.DefaultClient{ID: "foo", Public: true, RedirectURIs: []string{"myapp:/cb"}},
+			RedirectURIProfile: profile,
+		}
+	}
+
+	assert.IsType(t, new(fosite.DefaultRedirectURIPolicy), config.GetRedirectURIPolicy(ctx, &fosite.DefaultClient{}))
+	assert.IsType(t, new(fosite.DefaultRedirectURIPolicy), config.GetRedirectURIPolicy(ctx, newClient("")))
+	assert.IsType(t, new(fosite.NativeAppRedirectURIPolicy), config.GetRedirectURIPolicy(ctx, newClient(fosite.RedirectURIProfileNative)))
+	assert.IsType(t, new(fosite.WebRedirectURIPolicy), config.GetRedirectURIPolicy(ctx, newClient(fosite.RedirectURIProfileWeb)))
+	assert.Same(t, custom, config.GetRedirectURIPolicy(ctx, newClient("custom")))
+
+	unknown := config.GetRedirectURIPolicy(ctx, newClient("unknown"))
+	assert.False(t, unknown.MatchRedirectURI(ctx, "myapp:/cb", "myapp:/cb"))
+	_, err := fosite.MatchRedirectURIWithPolicy(ctx, "myapp:/cb", newClient("unknown"), unknown)
+	assert.ErrorIs(t, err, fosite.ErrInvalidRequest)
+	_, err = fosite.MatchRedirectURIWithPolicy(ctx, "", newClient("unknown"), unknown)
+	assert.ErrorIs(t, err, fosite.ErrInvalidClient)
+
+	_, err = fosite.MatchRedirectURIWithClientRedirectURIs("myapp:/cb", newClient(""))
+	assert.NoError(t, err)
+	_, err = fosite.MatchRedirectURIWithClientRedirectURIs("myapp:/cb", newClient(fosite.RedirectURIProfileNative))
+	assert.ErrorIs(t, err, fosite.ErrInvalidRequest)
+}
@@ -0,0 +1,120 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+
+	"github.com/ory/x/errorsx"
+)
+
+// RevocationFilter selects the grants revoked by Fosite.RevokeTokens. A grant matches if all fields which are set
+// match, so an empty filter matches nothing.
+type RevocationFilter struct {
+	// Subject matches the subject of the grant's session.
+	Subject string
+
+	// ClientID matches the client the grant was issued to.
+	ClientID string
+
+	// SessionID matches the "sid" of the grant's session, see GetSessionID.
+	SessionID string
+
+	// RequestID matches the grant ID, which is the ID of the request that created the grant. It is shared by all
+	// tokens of the grant, including the tokens issued by refreshing it.
+	RequestID string
+}
+
+// IsEmpty returns true if no field of the filter is set.
+func (f RevocationFilter) IsEmpty() bool {
+	return f.Subject == "" && f.ClientID == "" && f.SessionID == "" && f.RequestID == ""
+}
+
+// Matches returns true if the request matches all fields of the filter which are set.
+func (f RevocationFilter) Matches(r Requester) bool {
+	if f.IsEmpty() {
+		return false
+	}
+	if f.RequestID != "" && f.RequestID != r.GetID() {
+		return false
+	}
+	if f.ClientID != "" && (r.GetClient() == nil || f.ClientID != r.GetClient().GetID()) {
+		return false
+	}
+	if f.Subject != "" && (r.GetSession() == nil || f.Subject != r.GetSession().GetSubject()) {
+		return false
+	}
+	if f.SessionID != "" && f.SessionID != GetSessionID(r.GetSession()) {
+		return false
+	}
+	return true
+}
+
+// SessionIDSession is implemented by sessions which know the ID of the end-user's login session they were issued
+// in, commonly found in the "sid" claim.
+type SessionIDSession interface {
+	// GetSessionID returns the login session ID, or an empty string if it is unknown.
+	GetSessionID() string
+}
+
+// GetSessionID returns the login session ID of the session. It uses SessionIDSession if the session implements it and
+// falls back to the "sid" extra claim.
+func GetSessionID(session Session) string {
+	switch s := session.(type) {
+	case SessionIDSession:
+		return s.GetSessionID()
+	case ExtraClaimsSession:
+		sid, _ := s.GetExtraClaims()["sid"].(string)
+		return sid
+	}
+	return ""
+}
+
+// BulkRevocationStorage revokes all grants matching a filter, for example to log an end-user out of all clients or to
+// revoke all tokens of a compromised client.
+type BulkRevocationStorage interface {
+	// RevokeTokens revokes the access tokens, refresh tokens, authorize codes and PKCE sessions of all grants
+	// matching the filter and returns the IDs of the revoked grants.
+	RevokeTokens(ctx context.Context, filter RevocationFilter) (requestIDs []string, err error)
+}
+
+// BulkRevocationHandler is optionally implemented by RevocationHandlers which keep state about the tokens of a grant,
+// for example a cache, which must be cleared when the grant is revoked by Fosite.RevokeTokens.
+type BulkRevocationHandler interface {
+	// RevokeRequests is called with the IDs of the grants revoked by Fosite.RevokeTokens.
+	RevokeRequests(ctx context.Context, requestIDs []string)
+}
+
+// RevokeTokens revokes the access tokens, refresh tokens, authorize codes and PKCE sessions of all grants matching
+// the filter and returns the IDs of the revoked grants. The storage must implement BulkRevocationStorage.
+//
+// The revocation handlers implementing BulkRevocationHandler are notified about the revoked grants, so that, for
+// example, cached phantom tokens are removed.
+//
+// This is an administrative API and does not authenticate the caller. Stateless access tokens, such as JWTs validated
+// by oauth2.StatelessJWTValidator, are not put on the deny-list and remain valid until they expire.
+func (f *Fosite) RevokeTokens(ctx context.Context, filter RevocationFilter) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, errorsx.WithStack(ErrInvalidRequest.WithHint("At least one of subject, client ID, session ID or request ID must be set."))
+	}
+
+	storage, ok := f.Store.(BulkRevocationStorage)
+	if !ok {
+		return nil, errorsx.WithStack(ErrServerError.WithHint("The storage does not support bulk revocation."))
+	}
+
+	requestIDs, err := storage.RevokeTokens(ctx, filter)
+	if err != nil {
+		return nil, errorsx.WithStack(ErrServerError.WithWrap(err).WithDebug(err.Error()))
+	}
+
+	if len(requestIDs) > 0 {
+		for _, handler := range f.Config.GetRevocationHandlers(ctx) {
+			if h, ok := handler.(BulkRevocationHandler); ok {
+				h.RevokeRequests(ctx, requestIDs)
+			}
+		}
+	}
+	return requestIDs, nil
+}
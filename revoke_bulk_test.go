@@ -0,0 +1,110 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func TestRevocationFilter(t *testing.T) {
+	session := &openid.DefaultSession{Subject: "peter", Claims: &jwt.IDTokenClaims{Extra: map[string]interface{}{"sid": "login"}}}
+	r := &Request{ID: "request", Client: &DefaultClient{ID: "client"}, Session: session}
+
+	for _, c := range []struct {
+		filter  RevocationFilter
+		matches bool
+	}{
+		{filter: RevocationFilter{}},
+		{filter: RevocationFilter{Subject: "peter"}, matches: true},
+		{filter: RevocationFilter{Subject: "peter", ClientID: "client"}, matches: true},
+		{filter: RevocationFilter{Subject: "peter", ClientID: "other"}},
+		{filter: RevocationFilter{SessionID: "login"}, matches: true},
+		{filter: RevocationFilter{SessionID: "other"}},
+		{filter: RevocationFilter{RequestID: "request"}, matches: true},
+	} {
+		assert.Equal(t, c.matches, c.filter.Matches(r), "%+v", c.filter)
+	}
+
+	assert.Equal(t, "sid", GetSessionID(&DefaultSession{Extra: map[string]interface{}{"sid": "sid"}}))
+	assert.Empty(t, GetSessionID(&DefaultSession{}))
+}
+
+func TestRevokeTokens(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	cache := oauth2.NewPhantomTokenCache()
+	f := &Fosite{Store: store, Config: &Config{RevocationHandlers: RevocationHandlers{
+		&oauth2.TokenRevocationHandler{TokenRevocationStorage: store, PhantomTokenCache: cache},
+	}}}
+
+	create := func(id, clientID, subject, sid string) {
+		session := &DefaultSession{Subject: subject, Extra: map[string]interface{}{"sid": sid}}
+		r := &Request{ID: id, Client: &DefaultClient{ID: clientID}, Session: session}
+		require.NoError(t, store.CreateAccessTokenSession(ctx, id+"-at", r))
+		require.NoError(t, store.CreateRefreshTokenSession(ctx, id+"-rt", r))
+		require.NoError(t, store.CreateAuthorizeCodeSession(ctx, id+"-ac", r))
+		require.NoError(t, store.CreatePKCERequestSession(ctx, id+"-ac", r))
+	}
+	create("a", "foo", "peter", "login-1")
+	create("b", "bar", "peter", "login-2")
+	create("c", "foo", "alice", "login-3")
+
+	revoked := func(id string) bool {
+		_, err := store.GetAccessTokenSession(ctx, id+"-at", nil)
+		return err != nil
+	}
+
+	now := time.Now()
+	cache.Set("b-at", "b", "phantom-b", now.Add(time.Hour), now)
+	cache.Set("a-at", "a", "phantom-a", now.Add(time.Hour), now)
+
+	_, err := f.RevokeTokens(ctx, RevocationFilter{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	_, err = (&Fosite{Store: struct{ ClientManager }{store}}).RevokeTokens(ctx, RevocationFilter{Subject: "peter"})
+	assert.ErrorIs(t, err, ErrServerError)
+
+	requestIDs, err := f.RevokeTokens(ctx, RevocationFilter{SessionID: "login-2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, requestIDs)
+	assert.True(t, revoked("b"))
+	assert.False(t, revoked("a"))
+
+	_, ok := cache.Get("b-at", now)
+	assert.False(t, ok, "phantom tokens of revoked grants are removed from the cache")
+	_, ok = cache.Get("a-at", now)
+	assert.True(t, ok)
+
+	_, err = store.GetRefreshTokenSession(ctx, "b-rt", nil)
+	assert.ErrorIs(t, err, ErrInactiveToken)
+	_, err = store.GetAuthorizeCodeSession(ctx, "b-ac", nil)
+	assert.ErrorIs(t, err, ErrInvalidatedAuthorizeCode)
+	_, err = store.GetPKCERequestSession(ctx, "b-ac", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	requestIDs, err = f.RevokeTokens(ctx, RevocationFilter{ClientID: "foo", Subject: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, requestIDs)
+	assert.False(t, revoked("a"))
+
+	requestIDs, err = f.RevokeTokens(ctx, RevocationFilter{Subject: "peter"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, requestIDs)
+	assert.True(t, revoked("a"))
+
+	requestIDs, err = f.RevokeTokens(ctx, RevocationFilter{Subject: "peter"})
+	require.NoError(t, err)
+	assert.Empty(t, requestIDs)
+}
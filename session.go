@@ -89,6 +89,32 @@ type ExtraClaimsSession interface {
 	GetExtraClaims() map[string]interface{}
 }
 
+// IsSenderConstrained returns true if the session carries a confirmation ("cnf") claim which binds its tokens to a key
+// held by the client, for example using DPoP or mutual TLS. See https://tools.ietf.org/html/rfc7800#section-3.1
+func IsSenderConstrained(session Session) bool {
+	jwkThumbprint, x509Thumbprint := GetConfirmationThumbprints(session)
+	return jwkThumbprint != "" || x509Thumbprint != ""
+}
+
+// GetConfirmationThumbprints returns the SHA-256 JWK thumbprint ("jkt", see https://tools.ietf.org/html/rfc9449#section-6.1)
+// and the SHA-256 X.509 certificate thumbprint ("x5t#S256", see https://tools.ietf.org/html/rfc8705#section-3.1) of
+// the session's confirmation ("cnf") claim. Both are empty if the session's tokens are bearer tokens.
+func GetConfirmationThumbprints(session Session) (jwkThumbprint, x509Thumbprint string) {
+	s, ok := session.(ExtraClaimsSession)
+	if !ok {
+		return "", ""
+	}
+
+	cnf, ok := s.GetExtraClaims()["cnf"].(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+
+	jwkThumbprint, _ = cnf["jkt"].(string)
+	x509Thumbprint, _ = cnf["x5t#S256"].(string)
+	return jwkThumbprint, x509Thumbprint
+}
+
 // GetExtraClaims implements ExtraClaimsSession for DefaultSession.
 // The returned value can be modified in-place.
 func (s *DefaultSession) GetExtraClaims() map[string]interface{} {
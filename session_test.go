@@ -4,6 +4,7 @@
 package fosite
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,3 +24,21 @@ func TestZeroSession(t *testing.T) {
 	assert.Empty(t, s.Clone())
 	assert.Empty(t, s.GetExpiresAt(AccessToken))
 }
+
+func TestIsSenderConstrained(t *testing.T) {
+	for k, c := range []struct {
+		extra    map[string]interface{}
+		expected bool
+	}{
+		{extra: nil, expected: false},
+		{extra: map[string]interface{}{"cnf": "thumbprint"}, expected: false},
+		{extra: map[string]interface{}{"cnf": map[string]interface{}{}}, expected: false},
+		{extra: map[string]interface{}{"cnf": map[string]interface{}{"jkt": ""}}, expected: false},
+		{extra: map[string]interface{}{"cnf": map[string]interface{}{"jkt": "thumbprint"}}, expected: true},
+		{extra: map[string]interface{}{"cnf": map[string]interface{}{"x5t#S256": "thumbprint"}}, expected: true},
+	} {
+		t.Run(fmt.Sprintf("case=%d", k), func(t *testing.T) {
+			assert.Equal(t, c.expected, IsSenderConstrained(&DefaultSession{Extra: c.extra}))
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+)
+
+// binaryMagic starts every binary encoded request. JSON encoded requests always start with '{'.
+const binaryMagic = 0xfc
+
+func isBinary(data []byte) bool {
+	return len(data) > 0 && data[0] == binaryMagic
+}
+
+type binaryWriter struct {
+	bytes.Buffer
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (w *binaryWriter) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.Write(b)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.WriteString(s)
+}
+
+func (w *binaryWriter) strings(s []string) {
+	w.uvarint(uint64(len(s)))
+	for _, v := range s {
+		w.string(v)
+	}
+}
+
+// time encodes the instant, the location is not preserved.
+func (w *binaryWriter) time(t time.Time) {
+	if t.IsZero() {
+		w.WriteByte(0)
+		return
+	}
+	w.WriteByte(1)
+	w.varint(t.Unix())
+	w.uvarint(uint64(t.Nanosecond()))
+}
+
+type binaryReader struct {
+	*bytes.Reader
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r)
+	r.err = err
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r)
+	r.err = err
+	return v
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	b, err := r.ReadByte()
+	r.err = err
+	return b
+}
+
+func (r *binaryReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r, b)
+	return b
+}
+
+func (r *binaryReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *binaryReader) strings() []string {
+	n := r.uvarint()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+	if n > uint64(r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	s := make([]string, n)
+	for i := range s {
+		s[i] = r.string()
+	}
+	return s
+}
+
+func (r *binaryReader) time() time.Time {
+	if r.byte() == 0 {
+		return time.Time{}
+	}
+	sec := r.varint()
+	nsec := r.uvarint()
+	return time.Unix(sec, int64(nsec)).UTC()
+}
+
+// marshalBinary encodes the record with length-prefixed fields. The session is embedded as JSON because its type is
+// only known to the registry.
+func marshalBinary(rec *record) ([]byte, error) {
+	var w binaryWriter
+	w.WriteByte(binaryMagic)
+	w.uvarint(uint64(rec.Version))
+	w.string(rec.ID)
+	w.time(rec.RequestedAt)
+	w.string(rec.ClientID)
+	w.strings(rec.RequestedScope)
+	w.strings(rec.GrantedScope)
+	w.strings(rec.RequestedAudience)
+	w.strings(rec.GrantedAudience)
+
+	keys := make([]string, 0, len(rec.Form))
+	for k := range rec.Form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.uvarint(uint64(len(keys)))
+	for _, k := range keys {
+		w.string(k)
+		w.strings(rec.Form[k])
+	}
+
+	w.string(rec.Lang)
+	w.string(rec.SessionType)
+	w.uvarint(uint64(rec.SessionVersion))
+	w.bytes(rec.Session)
+
+	if rec.Authorize == nil {
+		w.WriteByte(0)
+		return w.Bytes(), nil
+	}
+	w.WriteByte(1)
+	w.strings(rec.Authorize.ResponseTypes)
+	w.string(rec.Authorize.RedirectURI)
+	w.string(rec.Authorize.State)
+	w.strings(rec.Authorize.HandledResponseTypes)
+	w.string(string(rec.Authorize.ResponseMode))
+	w.string(string(rec.Authorize.DefaultResponseMode))
+	return w.Bytes(), nil
+}
+
+func unmarshalBinary(data []byte, rec *record) error {
+	r := binaryReader{Reader: bytes.NewReader(data[1:])}
+	rec.Version = int(r.uvarint())
+	rec.ID = r.string()
+	rec.RequestedAt = r.time()
+	rec.ClientID = r.string()
+	rec.RequestedScope = r.strings()
+	rec.GrantedScope = r.strings()
+	rec.RequestedAudience = r.strings()
+	rec.GrantedAudience = r.strings()
+
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		if n > uint64(r.Len()) {
+			return errors.WithStack(io.ErrUnexpectedEOF)
+		}
+		rec.Form = make(map[string][]string, n)
+		for i := uint64(0); i < n; i++ {
+			k := r.string()
+			rec.Form[k] = r.strings()
+		}
+	}
+
+	rec.Lang = r.string()
+	rec.SessionType = r.string()
+	rec.SessionVersion = int(r.uvarint())
+	if session := r.bytes(); len(session) > 0 {
+		rec.Session = json.RawMessage(session)
+	}
+
+	if r.byte() == 1 {
+		rec.Authorize = &authorizeRecord{
+			ResponseTypes:        r.strings(),
+			RedirectURI:          r.string(),
+			State:                r.string(),
+			HandledResponseTypes: r.strings(),
+			ResponseMode:         fosite.ResponseModeType(r.string()),
+			DefaultResponseMode:  fosite.ResponseModeType(r.string()),
+		}
+	}
+
+	if r.err != nil {
+		return errors.Wrap(r.err, "unable to decode binary request")
+	}
+	return nil
+}
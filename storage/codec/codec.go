@@ -0,0 +1,302 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package codec serializes fosite.Requester values for storage implementations.
+//
+// Sessions are polymorphic, so the codec keeps a registry of session types. Every registered type has a name, which
+// is stored next to the session, and a schema version, which allows upgrading sessions stored by older releases.
+// Clients are stored by their ID and loaded from a fosite.ClientManager when a request is decoded.
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+)
+
+// Version is the version of the serialization format of requests. Decode reads all versions up to Version.
+const Version = 1
+
+// SessionType describes a session type which can be encoded and decoded.
+type SessionType struct {
+	// Name identifies the type in encoded requests and must never change.
+	Name string
+
+	// Version is the current schema version of the type. Sessions are stored with the version they were encoded
+	// with and are upgraded by Upgrade when they are decoded.
+	Version int
+
+	// New creates an empty session of the type.
+	New func() fosite.Session
+
+	// Upgrade migrates the JSON of a session encoded with an older schema version to the next version. It is called
+	// once per version until the session is current, and is required if Version is greater than 1.
+	Upgrade func(version int, session json.RawMessage) (json.RawMessage, error)
+}
+
+// Codec encodes and decodes requests. It is safe for concurrent use.
+type Codec struct {
+	// Clients loads the clients of decoded requests. If it is nil, the client of a decoded request is a
+	// fosite.DefaultClient which only has its ID set.
+	Clients fosite.ClientManager
+
+	// Binary selects the compact binary encoding for Encode. Decode reads both encodings.
+	Binary bool
+
+	m      sync.RWMutex
+	byName map[string]SessionType
+	byType map[reflect.Type]SessionType
+}
+
+// New returns a codec which knows the session types of fosite and its handlers.
+func New(clients fosite.ClientManager) *Codec {
+	c := &Codec{Clients: clients}
+	c.Register(SessionType{Name: "fosite.DefaultSession", New: func() fosite.Session { return new(fosite.DefaultSession) }})
+	c.Register(SessionType{Name: "openid.DefaultSession", New: func() fosite.Session { return openid.NewDefaultSession() }})
+	c.Register(SessionType{Name: "oauth2.JWTSession", New: func() fosite.Session { return new(oauth2.JWTSession) }})
+	return c
+}
+
+// Register adds a session type to the registry, replacing a type with the same name.
+func (c *Codec) Register(t SessionType) {
+	if t.Version == 0 {
+		t.Version = 1
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.byName == nil {
+		c.byName = make(map[string]SessionType)
+		c.byType = make(map[reflect.Type]SessionType)
+	}
+	c.byName[t.Name] = t
+	c.byType[reflect.TypeOf(t.New())] = t
+}
+
+func (c *Codec) sessionTypeOf(session fosite.Session) (SessionType, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	t, ok := c.byType[reflect.TypeOf(session)]
+	return t, ok
+}
+
+func (c *Codec) sessionTypeByName(name string) (SessionType, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	t, ok := c.byName[name]
+	return t, ok
+}
+
+// record is the encoded form of a request.
+type record struct {
+	Version           int             `json:"v"`
+	ID                string          `json:"id"`
+	RequestedAt       time.Time       `json:"requested_at"`
+	ClientID          string          `json:"client_id"`
+	RequestedScope    []string        `json:"requested_scope,omitempty"`
+	GrantedScope      []string        `json:"granted_scope,omitempty"`
+	RequestedAudience []string        `json:"requested_audience,omitempty"`
+	GrantedAudience   []string        `json:"granted_audience,omitempty"`
+	Form              url.Values      `json:"form,omitempty"`
+	Lang              string          `json:"lang,omitempty"`
+	SessionType       string          `json:"session_type,omitempty"`
+	SessionVersion    int             `json:"session_version,omitempty"`
+	Session           json.RawMessage `json:"session,omitempty"`
+
+	// Authorize is only set for authorize requests, for example pushed authorization requests.
+	Authorize *authorizeRecord `json:"authorize,omitempty"`
+}
+
+type authorizeRecord struct {
+	ResponseTypes        []string                `json:"response_types,omitempty"`
+	RedirectURI          string                  `json:"redirect_uri,omitempty"`
+	State                string                  `json:"state,omitempty"`
+	HandledResponseTypes []string                `json:"handled_response_types,omitempty"`
+	ResponseMode         fosite.ResponseModeType `json:"response_mode,omitempty"`
+	DefaultResponseMode  fosite.ResponseModeType `json:"default_response_mode,omitempty"`
+}
+
+// Encode serializes the request. Sessions of unregistered types are encoded as well, but can only be decoded by
+// passing a session of the same type to Decode.
+func (c *Codec) Encode(r fosite.Requester) ([]byte, error) {
+	rec := record{
+		Version:           Version,
+		ID:                r.GetID(),
+		RequestedAt:       r.GetRequestedAt(),
+		RequestedScope:    r.GetRequestedScopes(),
+		GrantedScope:      r.GetGrantedScopes(),
+		RequestedAudience: r.GetRequestedAudience(),
+		GrantedAudience:   r.GetGrantedAudience(),
+		Form:              r.GetRequestForm(),
+	}
+	if r.GetClient() != nil {
+		rec.ClientID = r.GetClient().GetID()
+	}
+	if g, ok := r.(fosite.G11NContext); ok && g.GetLang() != language.Und {
+		rec.Lang = g.GetLang().String()
+	}
+	if session := r.GetSession(); session != nil {
+		if t, ok := c.sessionTypeOf(session); ok {
+			rec.SessionType, rec.SessionVersion = t.Name, t.Version
+		}
+
+		data, err := json.Marshal(session)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		rec.Session = data
+	}
+
+	if ar, ok := r.(fosite.AuthorizeRequester); ok {
+		rec.Authorize = &authorizeRecord{
+			ResponseTypes:       ar.GetResponseTypes(),
+			State:               ar.GetState(),
+			ResponseMode:        ar.GetResponseMode(),
+			DefaultResponseMode: ar.GetDefaultResponseMode(),
+		}
+		if ar.GetRedirectURI() != nil {
+			rec.Authorize.RedirectURI = ar.GetRedirectURI().String()
+		}
+		if r, ok := ar.(*fosite.AuthorizeRequest); ok {
+			rec.Authorize.HandledResponseTypes = r.HandledResponseTypes
+		}
+	}
+
+	if c.Binary {
+		return marshalBinary(&rec)
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
+
+// Decode restores a request encoded by Encode. The session is decoded into the given session if it is not nil, and
+// into a new session of the stored type otherwise.
+func (c *Codec) Decode(ctx context.Context, data []byte, session fosite.Session) (fosite.Requester, error) {
+	var rec record
+	if isBinary(data) {
+		if err := unmarshalBinary(data, &rec); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if rec.Version < 1 || rec.Version > Version {
+		return nil, errors.Errorf("unsupported request serialization version %d", rec.Version)
+	}
+
+	session, err := c.decodeSession(&rec, session)
+	if err != nil {
+		return nil, err
+	}
+
+	request := fosite.Request{
+		ID:                rec.ID,
+		RequestedAt:       rec.RequestedAt,
+		RequestedScope:    fosite.Arguments(rec.RequestedScope),
+		GrantedScope:      fosite.Arguments(rec.GrantedScope),
+		RequestedAudience: fosite.Arguments(rec.RequestedAudience),
+		GrantedAudience:   fosite.Arguments(rec.GrantedAudience),
+		Form:              rec.Form,
+		Session:           session,
+	}
+	if request.RequestedScope == nil {
+		request.RequestedScope = fosite.Arguments{}
+	}
+	if request.GrantedScope == nil {
+		request.GrantedScope = fosite.Arguments{}
+	}
+	if request.RequestedAudience == nil {
+		request.RequestedAudience = fosite.Arguments{}
+	}
+	if request.GrantedAudience == nil {
+		request.GrantedAudience = fosite.Arguments{}
+	}
+	if request.Form == nil {
+		request.Form = url.Values{}
+	}
+	if rec.Lang != "" {
+		request.Lang, _ = language.Parse(rec.Lang)
+	}
+	if rec.ClientID != "" {
+		if c.Clients == nil {
+			request.Client = &fosite.DefaultClient{ID: rec.ClientID}
+		} else if request.Client, err = c.Clients.GetClient(ctx, rec.ClientID); err != nil {
+			return nil, err
+		}
+	}
+
+	if rec.Authorize == nil {
+		return &request, nil
+	}
+
+	ar := &fosite.AuthorizeRequest{
+		ResponseTypes:        fosite.Arguments(rec.Authorize.ResponseTypes),
+		State:                rec.Authorize.State,
+		HandledResponseTypes: fosite.Arguments(rec.Authorize.HandledResponseTypes),
+		ResponseMode:         rec.Authorize.ResponseMode,
+		DefaultResponseMode:  rec.Authorize.DefaultResponseMode,
+		Request:              request,
+	}
+	if ar.ResponseTypes == nil {
+		ar.ResponseTypes = fosite.Arguments{}
+	}
+	if ar.HandledResponseTypes == nil {
+		ar.HandledResponseTypes = fosite.Arguments{}
+	}
+	if rec.Authorize.RedirectURI != "" {
+		if ar.RedirectURI, err = url.Parse(rec.Authorize.RedirectURI); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return ar, nil
+}
+
+func (c *Codec) decodeSession(rec *record, session fosite.Session) (fosite.Session, error) {
+	t, registered := c.sessionTypeByName(rec.SessionType)
+	if session == nil && len(rec.Session) == 0 && rec.SessionType == "" {
+		// the request was encoded without a session
+		return nil, nil
+	}
+	if session == nil {
+		if !registered {
+			return nil, errors.Errorf("unable to decode session of unregistered type %q", rec.SessionType)
+		}
+		session = t.New()
+	}
+	if len(rec.Session) == 0 {
+		return session, nil
+	}
+
+	data := rec.Session
+	if registered {
+		for version := rec.SessionVersion; version > 0 && version < t.Version; version++ {
+			if t.Upgrade == nil {
+				return nil, errors.Errorf("unable to upgrade session of type %q from version %d", t.Name, version)
+			}
+
+			var err error
+			if data, err = t.Upgrade(version, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return session, nil
+}
@@ -0,0 +1,221 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func newRequest(session fosite.Session) *fosite.Request {
+	r := fosite.NewRequest()
+	r.ID = "request-id"
+	r.RequestedAt = time.Now().UTC().Round(time.Second)
+	r.Client = &fosite.DefaultClient{ID: "client"}
+	r.RequestedScope = fosite.Arguments{"foo", "bar"}
+	r.GrantedScope = fosite.Arguments{"foo"}
+	r.RequestedAudience = fosite.Arguments{"https://api.example.com"}
+	r.GrantedAudience = fosite.Arguments{"https://api.example.com"}
+	r.Form = url.Values{"scope": {"foo bar"}, "redirect_uri": {"https://example.com/callback"}, "secret": {"value"}}
+	r.Lang = language.German
+	r.Session = session
+	return r
+}
+
+func newCodecs() map[string]*Codec {
+	store := storage.NewMemoryStore()
+	store.Clients["client"] = &fosite.DefaultClient{ID: "client", Scopes: []string{"foo", "bar"}}
+
+	binary := New(store)
+	binary.Binary = true
+	return map[string]*Codec{"json": New(store), "binary": binary}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Round(time.Second)
+
+	for name, c := range newCodecs() {
+		for _, session := range []fosite.Session{
+			&fosite.DefaultSession{Subject: "peter", Username: "peter", ExpiresAt: map[fosite.TokenType]time.Time{fosite.AccessToken: now}, Extra: map[string]interface{}{"foo": "bar"}},
+			&openid.DefaultSession{Subject: "peter", Claims: &jwt.IDTokenClaims{Subject: "peter", Nonce: "nonce", AuthTime: now, Extra: map[string]interface{}{"sid": "login"}}, Headers: &jwt.Headers{Extra: map[string]interface{}{"kid": "key"}}},
+			&oauth2.JWTSession{Subject: "peter", JWTClaims: &jwt.JWTClaims{Subject: "peter", Extra: map[string]interface{}{"foo": "bar"}}, JWTHeader: &jwt.Headers{}},
+		} {
+			t.Run(fmt.Sprintf("encoding=%s/session=%T", name, session), func(t *testing.T) {
+				request := newRequest(session)
+				data, err := c.Encode(request)
+				require.NoError(t, err)
+
+				decoded, err := c.Decode(ctx, data, nil)
+				require.NoError(t, err)
+				assert.Equal(t, request.Session, decoded.GetSession(), "the session is decoded into its registered type")
+				assert.Equal(t, []string{"foo", "bar"}, []string(decoded.GetClient().GetScopes()), "the client is loaded from the client manager")
+
+				// Merge and Sanitize must behave as if the request was never encoded.
+				request.Client = decoded.GetClient()
+				assert.Equal(t, request.Sanitize([]string{"redirect_uri"}), decoded.Sanitize([]string{"redirect_uri"}))
+
+				merged, expected := fosite.NewRequest(), fosite.NewRequest()
+				merged.Merge(decoded)
+				expected.Merge(request)
+				assert.Equal(t, expected, merged)
+				assert.Equal(t, language.German, decoded.(*fosite.Request).GetLang())
+			})
+		}
+	}
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	for name, c := range newCodecs() {
+		t.Run("encoding="+name, func(t *testing.T) {
+			ar := fosite.NewAuthorizeRequest()
+			ar.Request = *newRequest(new(fosite.DefaultSession))
+			ar.ResponseTypes = fosite.Arguments{"code", "id_token"}
+			ar.RedirectURI, _ = url.Parse("https://example.com/callback")
+			ar.State = "some-state"
+			ar.ResponseMode = fosite.ResponseModeFragment
+			ar.SetDefaultResponseMode(fosite.ResponseModeFragment)
+			ar.SetResponseTypeHandled("code")
+
+			data, err := c.Encode(ar)
+			require.NoError(t, err)
+			decoded, err := c.Decode(context.Background(), data, nil)
+			require.NoError(t, err)
+
+			ar.Client = decoded.GetClient()
+			assert.Equal(t, ar, decoded)
+		})
+	}
+}
+
+func TestClients(t *testing.T) {
+	data, err := New(nil).Encode(newRequest(new(fosite.DefaultSession)))
+	require.NoError(t, err)
+
+	decoded, err := New(nil).Decode(context.Background(), data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &fosite.DefaultClient{ID: "client"}, decoded.GetClient())
+
+	_, err = New(storage.NewMemoryStore()).Decode(context.Background(), data, nil)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+}
+
+type customSessionV1 struct {
+	fosite.DefaultSession
+	Name string `json:"name"`
+}
+
+type customSessionV2 struct {
+	fosite.DefaultSession
+	DisplayName string `json:"display_name"`
+}
+
+func TestSessionTypes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=unregistered", func(t *testing.T) {
+		c := New(nil)
+		data, err := c.Encode(newRequest(&customSessionV1{Name: "Peter"}))
+		require.NoError(t, err)
+
+		_, err = c.Decode(ctx, data, nil)
+		assert.Error(t, err)
+
+		decoded, err := c.Decode(ctx, data, new(customSessionV1))
+		require.NoError(t, err)
+		assert.Equal(t, "Peter", decoded.GetSession().(*customSessionV1).Name)
+	})
+
+	t.Run("case=upgrade", func(t *testing.T) {
+		old := New(nil)
+		old.Register(SessionType{Name: "custom", New: func() fosite.Session { return new(customSessionV1) }})
+		data, err := old.Encode(newRequest(&customSessionV1{Name: "Peter"}))
+		require.NoError(t, err)
+
+		c := New(nil)
+		c.Register(SessionType{
+			Name:    "custom",
+			Version: 2,
+			New:     func() fosite.Session { return new(customSessionV2) },
+			Upgrade: func(version int, session json.RawMessage) (json.RawMessage, error) {
+				require.Equal(t, 1, version)
+				var fields map[string]interface{}
+				if err := json.Unmarshal(session, &fields); err != nil {
+					return nil, err
+				}
+				fields["display_name"] = fields["name"]
+				return json.Marshal(fields)
+			},
+		})
+
+		decoded, err := c.Decode(ctx, data, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Peter", decoded.GetSession().(*customSessionV2).DisplayName)
+
+		c.Register(SessionType{Name: "custom", Version: 2, New: func() fosite.Session { return new(customSessionV2) }})
+		_, err = c.Decode(ctx, data, nil)
+		assert.Error(t, err, "sessions can not be decoded without an upgrade")
+	})
+}
+
+func TestInvalidData(t *testing.T) {
+	c := New(nil)
+	c.Binary = true
+	data, err := c.Encode(newRequest(new(fosite.DefaultSession)))
+	require.NoError(t, err)
+
+	for i := 1; i < len(data); i++ {
+		_, err := c.Decode(context.Background(), data[:i], nil)
+		assert.Error(t, err, "truncated at %d", i)
+	}
+
+	_, err = c.Decode(context.Background(), []byte(`{"v":2}`), nil)
+	assert.Error(t, err)
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	codecs := newCodecs()
+	request := newRequest(&fosite.DefaultSession{Subject: "peter"})
+
+	jsonData, err := codecs["json"].Encode(request)
+	require.NoError(t, err)
+	binaryData, err := codecs["binary"].Encode(request)
+	require.NoError(t, err)
+	assert.Less(t, len(binaryData), len(jsonData))
+}
+
+func BenchmarkCodec(b *testing.B) {
+	ctx := context.Background()
+	request := newRequest(&openid.DefaultSession{Subject: "peter", Claims: &jwt.IDTokenClaims{Subject: "peter"}, Headers: &jwt.Headers{}})
+
+	for name, c := range newCodecs() {
+		data, err := c.Encode(request)
+		require.NoError(b, err)
+
+		b.Run("encoding="+name+"/op=encode", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = c.Encode(request)
+			}
+		})
+		b.Run("encoding="+name+"/op=decode", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _ = c.Decode(ctx, data, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package encrypted is a storage decorator which encrypts the requests stored by fosite at rest.
+//
+// Access tokens, refresh tokens, authorize codes, OpenID Connect and PKCE requests are serialized with the codec package
+// and sealed with an AEAD before they are passed to the wrapped storage. The wrapped storage only sees the request ID,
+// the client, the request time and the expiry of the tokens; scopes, form values and the session, including ID token
+// and extra claims, are encrypted. The signature of the token is the associated data, so a ciphertext can not be moved
+// to another token.
+//
+// Every ciphertext records the ID of the key it was sealed with. The first key is used for encryption and all keys are
+// used for decryption, which allows rotating keys by prepending a new one. If the wrapped storage is transactional,
+// requests sealed with an old key are re-encrypted with the current key when they are read.
+//
+// As subjects and session IDs are encrypted, the decorator does not implement fosite.BulkRevocationStorage, and the
+// wrapped storage can only revoke grants by client ID or request ID. Its RevokeTokens matches nothing for filters by
+// subject or session ID, because the sessions it sees have neither.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/storage/codec"
+)
+
+// Storage is the set of storage interfaces the decorator encrypts. The methods of fosite.Storage and of the revocation
+// storage are passed through.
+type Storage interface {
+	fosite.Storage
+	oauth2.CoreStorage
+	oauth2.TokenRevocationStorage
+	openid.OpenIDConnectRequestStorage
+	pkce.PKCERequestStorage
+}
+
+var (
+	_ Storage               = (*Store)(nil)
+	_ Storage               = (*TransactionalStore)(nil)
+	_ storage.Transactional = (*TransactionalStore)(nil)
+)
+
+// Key is an encryption key. The ID is stored with every ciphertext and must therefore never be reused for another key.
+type Key struct {
+	ID   string
+	AEAD cipher.AEAD
+}
+
+// NewAESGCMKey returns an AES-GCM key. The secret must be 16, 24 or 32 bytes long.
+func NewAESGCMKey(id string, secret []byte) (Key, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return Key{}, errors.WithStack(err)
+	}
+	return Key{ID: id, AEAD: aead}, nil
+}
+
+// Session replaces the session of the requests passed to the wrapped storage. It holds the encrypted request and the
+// expiry of the tokens, which is not encrypted so the wrapped storage can still expire them.
+type Session struct {
+	KeyID      string                         `json:"kid"`
+	Ciphertext []byte                         `json:"ciphertext"`
+	ExpiresAt  map[fosite.TokenType]time.Time `json:"expires_at,omitempty"`
+}
+
+func (s *Session) SetExpiresAt(key fosite.TokenType, exp time.Time) {
+	if s.ExpiresAt == nil {
+		s.ExpiresAt = make(map[fosite.TokenType]time.Time)
+	}
+	s.ExpiresAt[key] = exp
+}
+
+func (s *Session) GetExpiresAt(key fosite.TokenType) time.Time {
+	return s.ExpiresAt[key]
+}
+
+func (s *Session) GetUsername() string {
+	return ""
+}
+
+func (s *Session) GetSubject() string {
+	return ""
+}
+
+func (s *Session) Clone() fosite.Session {
+	if s == nil {
+		return nil
+	}
+
+	clone := &Session{KeyID: s.KeyID, Ciphertext: append([]byte(nil), s.Ciphertext...)}
+	for k, v := range s.ExpiresAt {
+		clone.SetExpiresAt(k, v)
+	}
+	return clone
+}
+
+// tokenTypes are the token types whose expiry is copied to Session.
+var tokenTypes = []fosite.TokenType{fosite.AccessToken, fosite.RefreshToken, fosite.AuthorizeCode, fosite.IDToken, fosite.PushedAuthorizeRequestContext}
+
+// The kinds of stored requests. They are part of the associated data, so a ciphertext is only valid for the kind of
+// request it was created for.
+const (
+	kindAuthorizeCode = "authorize_code"
+	kindAccessToken   = "access_token"
+	kindRefreshToken  = "refresh_token"
+	kindOpenIDConnect = "oidc"
+	kindPKCE          = "pkce"
+)
+
+// Store encrypts the requests stored in the wrapped storage.
+type Store struct {
+	Storage
+
+	codec   *codec.Codec
+	current Key
+	keys    map[string]Key
+}
+
+// TransactionalStore is the Store returned by New for storage implementing storage.Transactional.
+type TransactionalStore struct {
+	*Store
+	tx storage.Transactional
+}
+
+// New wraps the storage. The first key encrypts, all keys decrypt. If the storage implements storage.Transactional,
+// the returned store is a *TransactionalStore, otherwise it is a *Store.
+func New(s Storage, keys ...Key) (Storage, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one encryption key is required")
+	}
+
+	store := &Store{Storage: s, codec: codec.New(nil), current: keys[0], keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" || key.AEAD == nil {
+			return nil, errors.New("encryption keys must have an ID and an AEAD")
+		}
+		if _, ok := store.keys[key.ID]; ok {
+			return nil, errors.Errorf("encryption key ID %q is used more than once", key.ID)
+		}
+		store.keys[key.ID] = key
+	}
+
+	if tx, ok := s.(storage.Transactional); ok {
+		return &TransactionalStore{Store: store, tx: tx}, nil
+	}
+	return store, nil
+}
+
+func (s *TransactionalStore) BeginTX(ctx context.Context) (context.Context, error) {
+	return s.tx.BeginTX(ctx)
+}
+
+func (s *TransactionalStore) Commit(ctx context.Context) error {
+	return s.tx.Commit(ctx)
+}
+
+func (s *TransactionalStore) Rollback(ctx context.Context) error {
+	return s.tx.Rollback(ctx)
+}
+
+func associatedData(kind, signature string) []byte {
+	return []byte(kind + "\x00" + signature)
+}
+
+// encrypt returns the request which is passed to the wrapped storage.
+func (s *Store) encrypt(kind, signature string, request fosite.Requester) (fosite.Requester, error) {
+	plaintext, err := s.codec.Encode(request)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, s.current.AEAD.NonceSize(), s.current.AEAD.NonceSize()+len(plaintext)+s.current.AEAD.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	session := &Session{
+		KeyID:      s.current.ID,
+		Ciphertext: s.current.AEAD.Seal(nonce, nonce, plaintext, associatedData(kind, signature)),
+	}
+	if original := request.GetSession(); original != nil {
+		for _, tokenType := range tokenTypes {
+			if exp := original.GetExpiresAt(tokenType); !exp.IsZero() {
+				session.SetExpiresAt(tokenType, exp)
+			}
+		}
+	}
+
+	encrypted := fosite.NewRequest()
+	encrypted.ID = request.GetID()
+	encrypted.RequestedAt = request.GetRequestedAt()
+	encrypted.Client = request.GetClient()
+	encrypted.Session = session
+	return encrypted, nil
+}
+
+// decrypt restores the request read from the wrapped storage and reports whether it was encrypted with an old key.
+func (s *Store) decrypt(ctx context.Context, kind, signature string, stored fosite.Requester, session fosite.Session) (fosite.Requester, bool, error) {
+	sealed, ok := stored.GetSession().(*Session)
+	if !ok || sealed == nil {
+		return nil, false, errors.Errorf("the stored request is not encrypted")
+	}
+
+	key, ok := s.keys[sealed.KeyID]
+	if !ok {
+		return nil, false, errors.Errorf("the stored request is encrypted with the unknown key %q", sealed.KeyID)
+	}
+
+	nonceSize := key.AEAD.NonceSize()
+	if len(sealed.Ciphertext) < nonceSize {
+		return nil, false, errors.New("the stored request is malformed")
+	}
+	plaintext, err := key.AEAD.Open(nil, sealed.Ciphertext[:nonceSize], sealed.Ciphertext[nonceSize:], associatedData(kind, signature))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to decrypt the stored request")
+	}
+
+	request, err := s.codec.Decode(ctx, plaintext, session)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// the codec only knows the client ID, use the client loaded by the wrapped storage
+	if client := stored.GetClient(); client != nil {
+		switch r := request.(type) {
+		case *fosite.AuthorizeRequest:
+			r.Client = client
+		case *fosite.Request:
+			r.Client = client
+		}
+	}
+	return request, sealed.KeyID != s.current.ID, nil
+}
+
+func (s *Store) create(kind, signature string, request fosite.Requester, create func(fosite.Requester) error) error {
+	encrypted, err := s.encrypt(kind, signature, request)
+	if err != nil {
+		return err
+	}
+	return create(encrypted)
+}
+
+// get reads and decrypts a request. Requests encrypted with an old key are replaced if replace is not nil and the
+// wrapped storage returned no error, which means inactive tokens are never replaced.
+func (s *Store) get(ctx context.Context, kind, signature string, session fosite.Session, get func(context.Context) (fosite.Requester, error), replace func(context.Context, fosite.Requester) error) (fosite.Requester, error) {
+	stored, err := get(ctx)
+	if stored == nil {
+		return nil, err
+	}
+
+	request, stale, decryptErr := s.decrypt(ctx, kind, signature, stored, session)
+	if decryptErr != nil {
+		return nil, decryptErr
+	}
+	if stale && err == nil && replace != nil {
+		s.reencrypt(ctx, kind, signature, stored.GetSession().(*Session), request, get, replace)
+	}
+	return request, err
+}
+
+// reencrypt replaces the stored request with one encrypted with the current key. Replacing deletes and recreates the
+// request, so it is only done within a transaction which reads the request again and checks that it is still active
+// and sealed with the ciphertext read before. Otherwise a token revoked after the first read would be restored.
+//
+// Requests are not re-encrypted if the wrapped storage is not transactional or a transaction can not be started, for
+// example because the context already carries one. Failures are ignored because the request was read successfully and
+// is re-encrypted on the next read.
+func (s *Store) reencrypt(ctx context.Context, kind, signature string, read *Session, request fosite.Requester, get func(context.Context) (fosite.Requester, error), replace func(context.Context, fosite.Requester) error) {
+	tx, ok := s.Storage.(storage.Transactional)
+	if !ok {
+		return
+	}
+
+	encrypted, err := s.encrypt(kind, signature, request)
+	if err != nil {
+		return
+	}
+
+	txCtx, err := tx.BeginTX(ctx)
+	if err != nil {
+		return
+	}
+	if err := func() error {
+		current, err := get(txCtx)
+		if err != nil {
+			return err
+		}
+		if sealed, ok := current.GetSession().(*Session); !ok || sealed == nil || sealed.KeyID != read.KeyID || !bytes.Equal(sealed.Ciphertext, read.Ciphertext) {
+			return errors.New("the stored request has changed")
+		}
+		return replace(txCtx, encrypted)
+	}(); err != nil {
+		_ = tx.Rollback(txCtx)
+		return
+	}
+	_ = tx.Commit(txCtx)
+}
+
+func (s *Store) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) error {
+	return s.create(kindAuthorizeCode, code, request, func(encrypted fosite.Requester) error {
+		return s.Storage.CreateAuthorizeCodeSession(ctx, code, encrypted)
+	})
+}
+
+// GetAuthorizeCodeSession decrypts the authorize code request. Authorize codes are short-lived and can not be replaced
+// through oauth2.AuthorizeCodeStorage, so they are not re-encrypted.
+func (s *Store) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	return s.get(ctx, kindAuthorizeCode, code, session, func(ctx context.Context) (fosite.Requester, error) {
+		return s.Storage.GetAuthorizeCodeSession(ctx, code, new(Session))
+	}, nil)
+}
+
+func (s *Store) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	return s.create(kindAccessToken, signature, request, func(encrypted fosite.Requester) error {
+		return s.Storage.CreateAccessTokenSession(ctx, signature, encrypted)
+	})
+}
+
+func (s *Store) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.get(ctx, kindAccessToken, signature, session, func(ctx context.Context) (fosite.Requester, error) {
+		return s.Storage.GetAccessTokenSession(ctx, signature, new(Session))
+	}, func(ctx context.Context, encrypted fosite.Requester) error {
+		if err := s.Storage.DeleteAccessTokenSession(ctx, signature); err != nil {
+			return err
+		}
+		return s.Storage.CreateAccessTokenSession(ctx, signature, encrypted)
+	})
+}
+
+func (s *Store) CreateRefreshTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	return s.create(kindRefreshToken, signature, request, func(encrypted fosite.Requester) error {
+		return s.Storage.CreateRefreshTokenSession(ctx, signature, encrypted)
+	})
+}
+
+func (s *Store) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.get(ctx, kindRefreshToken, signature, session, func(ctx context.Context) (fosite.Requester, error) {
+		return s.Storage.GetRefreshTokenSession(ctx, signature, new(Session))
+	}, func(ctx context.Context, encrypted fosite.Requester) error {
+		if err := s.Storage.DeleteRefreshTokenSession(ctx, signature); err != nil {
+			return err
+		}
+		return s.Storage.CreateRefreshTokenSession(ctx, signature, encrypted)
+	})
+}
+
+func (s *Store) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) error {
+	return s.create(kindOpenIDConnect, authorizeCode, requester, func(encrypted fosite.Requester) error {
+		return s.Storage.CreateOpenIDConnectSession(ctx, authorizeCode, encrypted)
+	})
+}
+
+func (s *Store) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (fosite.Requester, error) {
+	var session fosite.Session
+	if requester != nil {
+		session = requester.GetSession()
+	}
+
+	return s.get(ctx, kindOpenIDConnect, authorizeCode, session, func(ctx context.Context) (fosite.Requester, error) {
+		return s.Storage.GetOpenIDConnectSession(ctx, authorizeCode, &fosite.Request{Session: new(Session)})
+	}, func(ctx context.Context, encrypted fosite.Requester) error {
+		if err := s.Storage.DeleteOpenIDConnectSession(ctx, authorizeCode); err != nil {
+			return err
+		}
+		return s.Storage.CreateOpenIDConnectSession(ctx, authorizeCode, encrypted)
+	})
+}
+
+func (s *Store) CreatePKCERequestSession(ctx context.Context, signature string, requester fosite.Requester) error {
+	return s.create(kindPKCE, signature, requester, func(encrypted fosite.Requester) error {
+		return s.Storage.CreatePKCERequestSession(ctx, signature, encrypted)
+	})
+}
+
+func (s *Store) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.get(ctx, kindPKCE, signature, session, func(ctx context.Context) (fosite.Requester, error) {
+		return s.Storage.GetPKCERequestSession(ctx, signature, new(Session))
+	}, func(ctx context.Context, encrypted fosite.Requester) error {
+		if err := s.Storage.DeletePKCERequestSession(ctx, signature); err != nil {
+			return err
+		}
+		return s.Storage.CreatePKCERequestSession(ctx, signature, encrypted)
+	})
+}
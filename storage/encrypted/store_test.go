@@ -0,0 +1,287 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package encrypted
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/storage/sqlstore"
+	"github.com/ory/fosite/storage/storagetest"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func newKey(t *testing.T, id string) Key {
+	secret := make([]byte, 32)
+	copy(secret, id)
+	key, err := NewAESGCMKey(id, secret)
+	require.NoError(t, err)
+	return key
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("storage=memory", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) interface{} {
+			s, err := New(storage.NewMemoryStore(), newKey(t, "key-1"))
+			require.NoError(t, err)
+			return s
+		}, storagetest.Options{
+			CreateClient: func(_ context.Context, s interface{}, client *fosite.DefaultClient) error {
+				s.(*Store).Storage.(*storage.MemoryStore).Clients[client.ID] = client
+				return nil
+			},
+		})
+	})
+
+	t.Run("storage=sql", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) interface{} {
+			db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fosite.db")+"?_pragma=busy_timeout(10000)")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			inner := sqlstore.New(db)
+			require.NoError(t, inner.Migrate(context.Background()))
+			s, err := New(inner, newKey(t, "key-1"))
+			require.NoError(t, err)
+			return s
+		}, storagetest.Options{
+			CreateClient: func(ctx context.Context, s interface{}, client *fosite.DefaultClient) error {
+				return s.(*TransactionalStore).Storage.(*sqlstore.Store).CreateClient(ctx, client)
+			},
+		})
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(storage.NewMemoryStore())
+	assert.Error(t, err)
+
+	_, err = New(storage.NewMemoryStore(), newKey(t, "key-1"), newKey(t, "key-1"))
+	assert.Error(t, err)
+
+	_, err = New(storage.NewMemoryStore(), Key{ID: "key-1"})
+	assert.Error(t, err)
+
+	s, err := New(storage.NewMemoryStore(), newKey(t, "key-1"))
+	require.NoError(t, err)
+	_, ok := s.(storage.Transactional)
+	assert.False(t, ok, "the memory store is not transactional")
+}
+
+func newIDTokenRequest(id string) *fosite.Request {
+	r := storagetest.NewRequest(id)
+	r.Form.Set("login_hint", "peter@example.com")
+	r.Session = &openid.DefaultSession{
+		Claims:  &jwt.IDTokenClaims{Subject: "peter", Extra: map[string]interface{}{"email": "peter@example.com"}},
+		Headers: &jwt.Headers{},
+		Subject: "peter",
+	}
+	return r
+}
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background()
+	inner := storage.NewMemoryStore()
+	inner.Clients[storagetest.ClientID] = &fosite.DefaultClient{ID: storagetest.ClientID}
+	s, err := New(inner, newKey(t, "key-1"))
+	require.NoError(t, err)
+
+	request := newIDTokenRequest("request")
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access", request))
+	require.NoError(t, s.CreateOpenIDConnectSession(ctx, "code", request))
+
+	t.Run("case=the wrapped storage does not see the request", func(t *testing.T) {
+		for _, stored := range []fosite.Requester{inner.AccessTokens["access"], inner.IDSessions["code"]} {
+			sealed, ok := stored.GetSession().(*Session)
+			require.True(t, ok)
+			assert.Equal(t, "key-1", sealed.KeyID)
+			assert.NotContains(t, string(sealed.Ciphertext), "peter@example.com")
+			assert.Empty(t, stored.GetRequestForm())
+			assert.Empty(t, stored.GetGrantedScopes())
+			assert.Equal(t, "request", stored.GetID())
+			assert.Equal(t, storagetest.ClientID, stored.GetClient().GetID())
+			assert.Equal(t, request.GetSession().GetExpiresAt(fosite.AccessToken), sealed.GetExpiresAt(fosite.AccessToken))
+		}
+	})
+
+	t.Run("case=the request is decrypted", func(t *testing.T) {
+		got, err := s.GetOpenIDConnectSession(ctx, "code", &fosite.Request{Session: openid.NewDefaultSession()})
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, request, got)
+		assert.Equal(t, "peter@example.com", got.GetSession().(*openid.DefaultSession).Claims.Extra["email"])
+		assert.Equal(t, "peter@example.com", got.GetRequestForm().Get("login_hint"))
+	})
+
+	t.Run("case=ciphertexts are bound to the signature", func(t *testing.T) {
+		inner.AccessTokens["moved"] = inner.AccessTokens["access"]
+		_, err := s.GetAccessTokenSession(ctx, "moved", openid.NewDefaultSession())
+		assert.Error(t, err)
+	})
+
+	t.Run("case=ciphertexts are bound to the kind of request", func(t *testing.T) {
+		inner.AccessTokens["code"] = inner.IDSessions["code"]
+		_, err := s.GetAccessTokenSession(ctx, "code", openid.NewDefaultSession())
+		assert.Error(t, err)
+	})
+
+	t.Run("case=tampered ciphertexts are rejected", func(t *testing.T) {
+		sealed := inner.AccessTokens["access"].GetSession().Clone().(*Session)
+		sealed.Ciphertext[len(sealed.Ciphertext)-1] ^= 1
+		tampered := fosite.NewRequest()
+		tampered.Session = sealed
+		inner.AccessTokens["tampered"] = tampered
+
+		_, err := s.GetAccessTokenSession(ctx, "tampered", openid.NewDefaultSession())
+		assert.Error(t, err)
+	})
+
+	t.Run("case=unencrypted requests are rejected", func(t *testing.T) {
+		require.NoError(t, inner.CreateAccessTokenSession(ctx, "plain", storagetest.NewRequest("plain")))
+		_, err := s.GetAccessTokenSession(ctx, "plain", new(fosite.DefaultSession))
+		assert.Error(t, err)
+	})
+}
+
+func newSQLStore(t *testing.T) *sqlstore.Store {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fosite.db")+"?_pragma=busy_timeout(10000)")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := sqlstore.New(db)
+	require.NoError(t, s.Migrate(context.Background()))
+	require.NoError(t, s.CreateClient(context.Background(), &fosite.DefaultClient{ID: storagetest.ClientID}))
+	return s
+}
+
+// revokingStore calls afterGet once after the next read of a token, before the token is re-encrypted.
+type revokingStore struct {
+	*sqlstore.Store
+	afterGet func()
+}
+
+func (s *revokingStore) done() {
+	if f := s.afterGet; f != nil {
+		s.afterGet = nil
+		f()
+	}
+}
+
+func (s *revokingStore) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	defer s.done()
+	return s.Store.GetAccessTokenSession(ctx, signature, session)
+}
+
+func (s *revokingStore) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	defer s.done()
+	return s.Store.GetRefreshTokenSession(ctx, signature, session)
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	inner := &revokingStore{Store: newSQLStore(t)}
+
+	old, err := New(inner, newKey(t, "key-1"))
+	require.NoError(t, err)
+	request := storagetest.NewRequest("request")
+	require.NoError(t, old.CreateAccessTokenSession(ctx, "access", request))
+	require.NoError(t, old.CreateRefreshTokenSession(ctx, "refresh", request))
+	require.NoError(t, old.CreateRefreshTokenSession(ctx, "revoked", storagetest.NewRequest("revoked-request")))
+	require.NoError(t, old.RevokeRefreshToken(ctx, "revoked-request"))
+	require.NoError(t, old.CreateAuthorizeCodeSession(ctx, "code", request))
+
+	keyID := func(stored fosite.Requester, _ error) string {
+		require.NotNil(t, stored)
+		return stored.GetSession().(*Session).KeyID
+	}
+
+	t.Run("case=old keys can not be used without the key", func(t *testing.T) {
+		s, err := New(inner, newKey(t, "key-2"))
+		require.NoError(t, err)
+		_, err = s.GetAccessTokenSession(ctx, "access", new(fosite.DefaultSession))
+		assert.Error(t, err)
+	})
+
+	rotated, err := New(inner, newKey(t, "key-2"), newKey(t, "key-1"))
+	require.NoError(t, err)
+
+	t.Run("case=new requests are encrypted with the current key", func(t *testing.T) {
+		require.NoError(t, rotated.CreateAccessTokenSession(ctx, "new", storagetest.NewRequest("new-request")))
+		assert.Equal(t, "key-2", keyID(inner.GetAccessTokenSession(ctx, "new", new(Session))))
+	})
+
+	t.Run("case=requests are re-encrypted when they are read", func(t *testing.T) {
+		got, err := rotated.GetAccessTokenSession(ctx, "access", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, request, got)
+		assert.Equal(t, "key-2", keyID(inner.GetAccessTokenSession(ctx, "access", new(Session))))
+
+		got, err = rotated.GetRefreshTokenSession(ctx, "refresh", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, request, got)
+		assert.Equal(t, "key-2", keyID(inner.GetRefreshTokenSession(ctx, "refresh", new(Session))))
+
+		// the re-encrypted requests can be read with the current key only
+		s, err := New(inner, newKey(t, "key-2"))
+		require.NoError(t, err)
+		_, err = s.GetAccessTokenSession(ctx, "access", new(fosite.DefaultSession))
+		assert.NoError(t, err)
+	})
+
+	t.Run("case=inactive tokens are not re-encrypted", func(t *testing.T) {
+		got, err := rotated.GetRefreshTokenSession(ctx, "revoked", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+		require.NotNil(t, got)
+		assert.Equal(t, "revoked-request", got.GetID())
+		assert.Equal(t, "key-1", keyID(inner.GetRefreshTokenSession(ctx, "revoked", new(Session))))
+	})
+
+	t.Run("case=authorize codes are not re-encrypted", func(t *testing.T) {
+		_, err := rotated.GetAuthorizeCodeSession(ctx, "code", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		assert.Equal(t, "key-1", keyID(inner.GetAuthorizeCodeSession(ctx, "code", new(Session))))
+	})
+
+	t.Run("case=tokens revoked before they are re-encrypted stay revoked", func(t *testing.T) {
+		revoked := storagetest.NewRequest("concurrently-revoked-request")
+		require.NoError(t, old.CreateAccessTokenSession(ctx, "concurrently-revoked-access", revoked))
+		require.NoError(t, old.CreateRefreshTokenSession(ctx, "concurrently-revoked-refresh", revoked))
+
+		inner.afterGet = func() { require.NoError(t, inner.RevokeAccessToken(ctx, "concurrently-revoked-request")) }
+		_, err := rotated.GetAccessTokenSession(ctx, "concurrently-revoked-access", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		_, err = inner.GetAccessTokenSession(ctx, "concurrently-revoked-access", new(Session))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+		inner.afterGet = func() { require.NoError(t, inner.RevokeRefreshToken(ctx, "concurrently-revoked-request")) }
+		_, err = rotated.GetRefreshTokenSession(ctx, "concurrently-revoked-refresh", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		_, err = inner.GetRefreshTokenSession(ctx, "concurrently-revoked-refresh", new(Session))
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+		assert.Equal(t, "key-1", keyID(inner.GetRefreshTokenSession(ctx, "concurrently-revoked-refresh", new(Session))))
+	})
+
+	t.Run("case=requests in non-transactional storage are not re-encrypted", func(t *testing.T) {
+		inner := storage.NewMemoryStore()
+		inner.Clients[storagetest.ClientID] = &fosite.DefaultClient{ID: storagetest.ClientID}
+		old, err := New(inner, newKey(t, "key-1"))
+		require.NoError(t, err)
+		require.NoError(t, old.CreateAccessTokenSession(ctx, "access", request))
+
+		rotated, err := New(inner, newKey(t, "key-2"), newKey(t, "key-1"))
+		require.NoError(t, err)
+		got, err := rotated.GetAccessTokenSession(ctx, "access", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, request, got)
+		assert.Equal(t, "key-1", keyID(inner.AccessTokens["access"], nil))
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned by KV.Get if the key does not exist or has expired.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KV is a key-value store whose keys can expire. Implementations must be safe for concurrent use.
+type KV interface {
+	// Get returns the value of the key, or ErrKeyNotFound if the key does not exist or has expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value. The key expires after the TTL, or never if the TTL is zero.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the key. Deleting a key which does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// CompareAndSwap atomically replaces the value of the key with new if its value is old, and reports whether it
+	// did. If old is nil, the key must not exist. The key expires after the TTL, or never if the TTL is zero.
+	CompareAndSwap(ctx context.Context, key string, old, new []byte, ttl time.Duration) (bool, error)
+}
+
+// maxCASAttempts limits the retries of read-modify-write cycles which lose the race against concurrent writers.
+const maxCASAttempts = 100
+
+var errTooManyAttempts = errors.New("unable to update the key because of concurrent writes")
+
+// Update applies a read-modify-write cycle to the key using CompareAndSwap, retrying if the key was modified
+// concurrently. The update function receives nil if the key does not exist and returns the new value and its TTL.
+// If it returns a nil value, the key is left unchanged.
+func Update(ctx context.Context, kv KV, key string, update func(current []byte) ([]byte, time.Duration, error)) error {
+	for i := 0; i < maxCASAttempts; i++ {
+		current, err := kv.Get(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			current = nil
+		} else if err != nil {
+			return err
+		}
+
+		value, ttl, err := update(current)
+		if err != nil || value == nil {
+			return err
+		}
+
+		if swapped, err := kv.CompareAndSwap(ctx, key, current, value, ttl); err != nil {
+			return err
+		} else if swapped {
+			return nil
+		}
+	}
+	return pkgerrors.WithStack(errTooManyAttempts)
+}
+
+// indexRecord is the value of a secondary index key.
+type indexRecord struct {
+	Values []string `json:"values"`
+	// ExpiresAt is the latest expiry of the indexed keys, or zero if one of them never expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+func decodeIndex(data []byte) (indexRecord, error) {
+	var index indexRecord
+	if data == nil {
+		return index, nil
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, pkgerrors.WithStack(err)
+	}
+	return index, nil
+}
+
+// AddToIndex adds the value to the secondary index stored under the key. Indexes hold a set of values, for example the
+// signatures of the tokens issued for a request ID. The index expires with the last of its values, whose expiry is
+// given by expiresAt; a zero expiresAt means the value never expires.
+func AddToIndex(ctx context.Context, kv KV, key, value string, expiresAt time.Time, now time.Time) error {
+	return Update(ctx, kv, key, func(current []byte) ([]byte, time.Duration, error) {
+		index, err := decodeIndex(current)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch {
+		case current == nil:
+			index.ExpiresAt = expiresAt
+		case expiresAt.IsZero():
+			index.ExpiresAt = time.Time{}
+		case !index.ExpiresAt.IsZero() && expiresAt.After(index.ExpiresAt):
+			index.ExpiresAt = expiresAt
+		}
+
+		i := sort.SearchStrings(index.Values, value)
+		if i == len(index.Values) || index.Values[i] != value {
+			index.Values = append(index.Values, "")
+			copy(index.Values[i+1:], index.Values[i:])
+			index.Values[i] = value
+		}
+
+		data, err := json.Marshal(index)
+		if err != nil {
+			return nil, 0, pkgerrors.WithStack(err)
+		}
+		return data, ttlUntil(index.ExpiresAt, now), nil
+	})
+}
+
+// RemoveFromIndex removes the value from the secondary index stored under the key. Empty indexes expire immediately.
+func RemoveFromIndex(ctx context.Context, kv KV, key, value string, now time.Time) error {
+	for i := 0; i < maxCASAttempts; i++ {
+		current, err := kv.Get(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		index, err := decodeIndex(current)
+		if err != nil {
+			return err
+		}
+		j := sort.SearchStrings(index.Values, value)
+		if j == len(index.Values) || index.Values[j] != value {
+			return nil
+		}
+		index.Values = append(index.Values[:j], index.Values[j+1:]...)
+
+		if len(index.Values) == 0 {
+			// deleting the key could remove a value added concurrently, so the empty index expires instead
+			index.ExpiresAt = now
+		}
+
+		data, err := json.Marshal(index)
+		if err != nil {
+			return pkgerrors.WithStack(err)
+		}
+		if swapped, err := kv.CompareAndSwap(ctx, key, current, data, ttlUntil(index.ExpiresAt, now)); err != nil {
+			return err
+		} else if swapped {
+			return nil
+		}
+	}
+	return pkgerrors.WithStack(errTooManyAttempts)
+}
+
+// IndexValues returns the values of the secondary index stored under the key, or none if the index does not exist.
+func IndexValues(ctx context.Context, kv KV, key string) ([]string, error) {
+	data, err := kv.Get(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	index, err := decodeIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	return index.Values, nil
+}
+
+// ttlUntil returns the TTL of a key expiring at the given time, zero if it never expires. Keys which have expired
+// already get the shortest TTL.
+func ttlUntil(expiresAt, now time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return 0
+	}
+	if ttl := expiresAt.Sub(now); ttl > time.Millisecond {
+		return ttl
+	}
+	return time.Millisecond
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ory/fosite"
+)
+
+var _ KV = (*MemoryKV)(nil)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryKV is an in-memory KV. Expired keys are removed when they are accessed and by Sweep.
+type MemoryKV struct {
+	// Clock is used to expire keys. Defaults to fosite.DefaultClock.
+	Clock fosite.Clock
+
+	m       sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{entries: make(map[string]memoryEntry)}
+}
+
+func (kv *MemoryKV) now() time.Time {
+	if kv.Clock == nil {
+		return fosite.DefaultClock.Now()
+	}
+	return kv.Clock.Now()
+}
+
+// get returns the entry of the key, removing it if it has expired. The mutex must be locked.
+func (kv *MemoryKV) get(key string) (memoryEntry, bool) {
+	e, ok := kv.entries[key]
+	if !ok {
+		return e, false
+	}
+	if !e.expiresAt.IsZero() && !e.expiresAt.After(kv.now()) {
+		delete(kv.entries, key)
+		return e, false
+	}
+	return e, true
+}
+
+// set stores the value. The mutex must be locked.
+func (kv *MemoryKV) set(key string, value []byte, ttl time.Duration) {
+	if kv.entries == nil {
+		kv.entries = make(map[string]memoryEntry)
+	}
+
+	e := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expiresAt = kv.now().Add(ttl)
+	}
+	kv.entries[key] = e
+}
+
+func (kv *MemoryKV) Get(_ context.Context, key string) ([]byte, error) {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	e, ok := kv.get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), e.value...), nil
+}
+
+func (kv *MemoryKV) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	kv.set(key, value, ttl)
+	return nil
+}
+
+func (kv *MemoryKV) Delete(_ context.Context, key string) error {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	delete(kv.entries, key)
+	return nil
+}
+
+func (kv *MemoryKV) CompareAndSwap(_ context.Context, key string, old, new []byte, ttl time.Duration) (bool, error) {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	e, ok := kv.get(key)
+	if old == nil && ok || old != nil && (!ok || !bytes.Equal(e.value, old)) {
+		return false, nil
+	}
+	kv.set(key, new, ttl)
+	return true, nil
+}
+
+// Sweep removes all expired keys and returns their number.
+func (kv *MemoryKV) Sweep() int {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	var n int
+	for key := range kv.entries {
+		if _, ok := kv.get(key); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of stored keys, including expired keys which have not been removed yet.
+func (kv *MemoryKV) Len() int {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+	return len(kv.entries)
+}
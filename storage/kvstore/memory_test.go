@@ -0,0 +1,191 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package kvstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+)
+
+// newTestKV returns a MemoryKV whose clock is advanced by the returned function.
+func newTestKV() (*MemoryKV, func(time.Duration)) {
+	now := time.Now()
+	kv := NewMemoryKV()
+	kv.Clock = fosite.ClockFunc(func() time.Time { return now })
+	return kv, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryKV(t *testing.T) {
+	ctx := context.Background()
+	kv, advance := newTestKV()
+
+	_, err := kv.Get(ctx, "foo")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, kv.Set(ctx, "foo", []byte("bar"), 0))
+	value, err := kv.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), value)
+
+	value[0] = 'x'
+	value, err = kv.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bar"), value, "stored values must not be modified through returned values")
+
+	require.NoError(t, kv.Delete(ctx, "foo"))
+	require.NoError(t, kv.Delete(ctx, "foo"))
+	_, err = kv.Get(ctx, "foo")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	t.Run("case=ttl", func(t *testing.T) {
+		require.NoError(t, kv.Set(ctx, "ttl", []byte("bar"), time.Minute))
+		require.NoError(t, kv.Set(ctx, "forever", []byte("bar"), 0))
+
+		advance(30 * time.Second)
+		_, err := kv.Get(ctx, "ttl")
+		require.NoError(t, err)
+
+		advance(30 * time.Second)
+		_, err = kv.Get(ctx, "ttl")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		_, err = kv.Get(ctx, "forever")
+		assert.NoError(t, err)
+	})
+
+	t.Run("case=compare and swap", func(t *testing.T) {
+		swapped, err := kv.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		assert.False(t, swapped, "the key does not exist")
+
+		swapped, err = kv.CompareAndSwap(ctx, "cas", nil, []byte("old"), time.Minute)
+		require.NoError(t, err)
+		assert.True(t, swapped)
+
+		swapped, err = kv.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.NoError(t, err)
+		assert.False(t, swapped, "the key exists")
+
+		swapped, err = kv.CompareAndSwap(ctx, "cas", []byte("other"), []byte("new"), 0)
+		require.NoError(t, err)
+		assert.False(t, swapped)
+
+		swapped, err = kv.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), time.Minute)
+		require.NoError(t, err)
+		assert.True(t, swapped)
+
+		advance(time.Minute)
+		swapped, err = kv.CompareAndSwap(ctx, "cas", nil, []byte("again"), 0)
+		require.NoError(t, err)
+		assert.True(t, swapped, "expired keys do not exist")
+	})
+
+	t.Run("case=sweep", func(t *testing.T) {
+		kv, advance := newTestKV()
+		require.NoError(t, kv.Set(ctx, "a", []byte("a"), time.Minute))
+		require.NoError(t, kv.Set(ctx, "b", []byte("b"), time.Hour))
+		require.NoError(t, kv.Set(ctx, "c", []byte("c"), 0))
+
+		assert.Equal(t, 0, kv.Sweep())
+		advance(time.Minute)
+		assert.Equal(t, 3, kv.Len())
+		assert.Equal(t, 1, kv.Sweep())
+		assert.Equal(t, 2, kv.Len())
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+
+	increment := func(current []byte) ([]byte, time.Duration, error) {
+		return append(current, 'x'), 0, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, Update(ctx, kv, "counter", increment))
+		}()
+	}
+	wg.Wait()
+
+	value, err := kv.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Len(t, value, 20, "no update may be lost")
+
+	require.NoError(t, Update(ctx, kv, "counter", func([]byte) ([]byte, time.Duration, error) { return nil, 0, nil }))
+	value, err = kv.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Len(t, value, 20, "returning nil leaves the key unchanged")
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	kv, advance := newTestKV()
+	now := kv.Clock.Now()
+
+	values, err := IndexValues(ctx, kv, "index")
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	require.NoError(t, AddToIndex(ctx, kv, "index", "b", now.Add(time.Minute), now))
+	require.NoError(t, AddToIndex(ctx, kv, "index", "a", now.Add(time.Hour), now))
+	require.NoError(t, AddToIndex(ctx, kv, "index", "b", now.Add(time.Minute), now))
+	values, err = IndexValues(ctx, kv, "index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, values)
+
+	require.NoError(t, RemoveFromIndex(ctx, kv, "index", "b", now))
+	require.NoError(t, RemoveFromIndex(ctx, kv, "index", "unknown", now))
+	require.NoError(t, RemoveFromIndex(ctx, kv, "unknown", "a", now))
+	values, err = IndexValues(ctx, kv, "index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, values)
+
+	t.Run("case=expiry", func(t *testing.T) {
+		advance(time.Minute)
+		values, err := IndexValues(ctx, kv, "index")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, values, "the index expires with the last of its values")
+
+		advance(time.Hour)
+		values, err = IndexValues(ctx, kv, "index")
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("case=never expires", func(t *testing.T) {
+		now := kv.Clock.Now()
+		require.NoError(t, AddToIndex(ctx, kv, "forever", "a", now.Add(time.Minute), now))
+		require.NoError(t, AddToIndex(ctx, kv, "forever", "b", time.Time{}, now))
+		require.NoError(t, AddToIndex(ctx, kv, "forever", "c", now.Add(time.Minute), now))
+
+		advance(24 * time.Hour)
+		values, err := IndexValues(ctx, kv, "forever")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, values)
+	})
+
+	t.Run("case=empty", func(t *testing.T) {
+		now := kv.Clock.Now()
+		require.NoError(t, AddToIndex(ctx, kv, "empty", "a", time.Time{}, now))
+		require.NoError(t, RemoveFromIndex(ctx, kv, "empty", "a", now))
+		values, err := IndexValues(ctx, kv, "empty")
+		require.NoError(t, err)
+		assert.Empty(t, values)
+
+		advance(time.Millisecond)
+		_, err = kv.Get(ctx, "empty")
+		assert.ErrorIs(t, err, ErrKeyNotFound, "empty indexes expire")
+	})
+}
@@ -0,0 +1,528 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package kvstore implements fosite's storage interfaces on top of a key-value store whose keys can expire, such as
+// Redis, memcached or etcd.
+//
+// Stored requests expire with their tokens, so the KV removes them without a janitor. Operations which have to be
+// atomic, for example invalidating authorize codes or recording JTIs, use CompareAndSwap. Transactions are not
+// supported.
+package kvstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/x/errorsx"
+	pkgerrors "github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/handler/rfc7523"
+	"github.com/ory/fosite/storage/codec"
+)
+
+var (
+	_ fosite.Storage                     = (*Store)(nil)
+	_ fosite.PARStorage                  = (*Store)(nil)
+	_ oauth2.CoreStorage                 = (*Store)(nil)
+	_ oauth2.TokenRevocationStorage      = (*Store)(nil)
+	_ oauth2.JWTRevocationStorage        = (*Store)(nil)
+	_ openid.OpenIDConnectRequestStorage = (*Store)(nil)
+	_ pkce.PKCERequestStorage            = (*Store)(nil)
+	_ rfc7523.RFC7523KeyStorage          = (*Store)(nil)
+)
+
+// DefaultPrefix is the prefix of all keys written by a Store created by New.
+const DefaultPrefix = "fosite:"
+
+const (
+	kindClient              = "client"
+	kindAuthorizeCode       = "authorize_code"
+	kindAccessToken         = "access_token"
+	kindRefreshToken        = "refresh_token"
+	kindOpenIDConnect       = "oidc"
+	kindPKCE                = "pkce"
+	kindPAR                 = "par"
+	kindJTI                 = "jti"
+	kindRevokedJWT          = "revoked_jwt"
+	kindIssuerKey           = "issuer_key"
+	kindIssuerKeys          = "issuer_keys"
+	kindAccessTokenRequest  = "access_token_request"
+	kindRefreshTokenRequest = "refresh_token_request"
+)
+
+// Store implements fosite's storage interfaces on top of a KV.
+type Store struct {
+	KV KV
+
+	// Codec serializes the stored requests. New creates a codec which loads clients from the store.
+	Codec *codec.Codec
+
+	// Prefix is prepended to all keys, which allows several stores to share a KV.
+	Prefix string
+
+	// NewSession creates the session requests are decoded into if the caller does not provide one, for example in
+	// GetPARSession. If it is nil, the session type registered with the Codec is used.
+	NewSession func() fosite.Session
+
+	// Clock is used to compute the TTLs of stored keys. Defaults to fosite.DefaultClock.
+	Clock fosite.Clock
+}
+
+// New returns a store using the KV.
+func New(kv KV) *Store {
+	s := &Store{KV: kv, Prefix: DefaultPrefix}
+	s.Codec = codec.New(s)
+	return s
+}
+
+// record is the value of the keys storing requests.
+type record struct {
+	// Active is false once an authorize code has been invalidated or a refresh token has been revoked.
+	Active    bool      `json:"active"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	RequestID string    `json:"request_id"`
+	Request   []byte    `json:"request"`
+}
+
+// issuerKey is the value of the keys storing the public keys of JWT authorization grant issuers.
+type issuerKey struct {
+	Key    *jose.JSONWebKey `json:"key"`
+	Scopes []string         `json:"scopes"`
+}
+
+func (s *Store) now() time.Time {
+	if s.Clock == nil {
+		return fosite.DefaultClock.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Store) newSession() fosite.Session {
+	if s.NewSession == nil {
+		return nil
+	}
+	return s.NewSession()
+}
+
+// key joins the kind and the escaped parts to a key.
+func (s *Store) key(kind string, parts ...string) string {
+	var b strings.Builder
+	b.WriteString(s.Prefix)
+	b.WriteString(kind)
+	for _, part := range parts {
+		b.WriteByte(':')
+		b.WriteString(url.QueryEscape(part))
+	}
+	return b.String()
+}
+
+// handleError maps ErrKeyNotFound to fosite.ErrNotFound.
+func handleError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrKeyNotFound):
+		return errorsx.WithStack(fosite.ErrNotFound)
+	}
+	return pkgerrors.WithStack(err)
+}
+
+func (s *Store) get(ctx context.Context, key string, v interface{}) error {
+	data, err := s.KV.Get(ctx, key)
+	if err != nil {
+		return handleError(err)
+	}
+	return pkgerrors.WithStack(json.Unmarshal(data, v))
+}
+
+func expiresAt(request fosite.Requester, tokenType fosite.TokenType) time.Time {
+	if request.GetSession() == nil {
+		return time.Time{}
+	}
+	return request.GetSession().GetExpiresAt(tokenType)
+}
+
+// createRequest stores the request under the key until its session expires for the token type.
+func (s *Store) createRequest(ctx context.Context, key string, request fosite.Requester, tokenType fosite.TokenType) (time.Time, error) {
+	data, err := s.Codec.Encode(request)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	rec := record{Active: true, ExpiresAt: expiresAt(request, tokenType), RequestID: request.GetID(), Request: data}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return time.Time{}, pkgerrors.WithStack(err)
+	}
+	return rec.ExpiresAt, handleError(s.KV.Set(ctx, key, value, ttlUntil(rec.ExpiresAt, s.now())))
+}
+
+func (s *Store) getRecord(ctx context.Context, key string) (record, error) {
+	var rec record
+	err := s.get(ctx, key, &rec)
+	return rec, err
+}
+
+// getRequest returns the request stored under the key and whether it is active. Expired requests are not found,
+// even if the KV has not evicted them yet.
+func (s *Store) getRequest(ctx context.Context, key string, session fosite.Session) (fosite.Requester, bool, error) {
+	rec, err := s.getRecord(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if !rec.ExpiresAt.IsZero() && rec.ExpiresAt.Before(s.now()) {
+		return nil, false, errorsx.WithStack(fosite.ErrNotFound)
+	}
+
+	request, err := s.Codec.Decode(ctx, rec.Request, session)
+	if err != nil {
+		return nil, false, err
+	}
+	return request, rec.Active, nil
+}
+
+// deleteRequest deletes the request stored under the key and removes it from the request ID index.
+func (s *Store) deleteRequest(ctx context.Context, key, indexKind string) error {
+	rec, err := s.getRecord(ctx, key)
+	if errors.Is(err, fosite.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.KV.Delete(ctx, key); err != nil {
+		return handleError(err)
+	}
+	return handleError(RemoveFromIndex(ctx, s.KV, s.key(indexKind, rec.RequestID), key, s.now()))
+}
+
+// deactivate marks the request stored under the key as inactive. It returns fosite.ErrNotFound if the key does not
+// exist.
+func (s *Store) deactivate(ctx context.Context, key string) error {
+	return handleError(Update(ctx, s.KV, key, func(current []byte) ([]byte, time.Duration, error) {
+		if current == nil {
+			return nil, 0, ErrKeyNotFound
+		}
+
+		var rec record
+		if err := json.Unmarshal(current, &rec); err != nil {
+			return nil, 0, err
+		}
+		rec.Active = false
+
+		value, err := json.Marshal(rec)
+		return value, ttlUntil(rec.ExpiresAt, s.now()), err
+	}))
+}
+
+// CreateClient stores the client. Clients are stored as JSON, so only fosite.DefaultClient is supported.
+func (s *Store) CreateClient(ctx context.Context, client *fosite.DefaultClient) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return pkgerrors.WithStack(err)
+	}
+	return handleError(s.KV.Set(ctx, s.key(kindClient, client.GetID()), data, 0))
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	var client fosite.DefaultClient
+	if err := s.get(ctx, s.key(kindClient, id), &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (s *Store) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	_, err := s.KV.Get(ctx, s.key(kindJTI, jti))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil
+	} else if err != nil {
+		return handleError(err)
+	}
+	return errorsx.WithStack(fosite.ErrJTIKnown)
+}
+
+// SetClientAssertionJWT marks the JTI as known until it expires. JTIs which have expired already are not stored.
+func (s *Store) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
+	now := s.now()
+	if !exp.After(now) {
+		return nil
+	}
+
+	value, err := exp.MarshalText()
+	if err != nil {
+		return pkgerrors.WithStack(err)
+	}
+	swapped, err := s.KV.CompareAndSwap(ctx, s.key(kindJTI, jti), nil, value, ttlUntil(exp, now))
+	if err != nil {
+		return handleError(err)
+	} else if !swapped {
+		return errorsx.WithStack(fosite.ErrJTIKnown)
+	}
+	return nil
+}
+
+// RevokeJWT adds the jti to the deny-list until the token expires at exp.
+func (s *Store) RevokeJWT(ctx context.Context, jti string, exp time.Time) error {
+	now := s.now()
+	if !exp.After(now) {
+		// expired tokens are rejected anyway
+		return nil
+	}
+
+	value, err := exp.MarshalText()
+	if err != nil {
+		return pkgerrors.WithStack(err)
+	}
+	return handleError(s.KV.Set(ctx, s.key(kindRevokedJWT, jti), value, ttlUntil(exp, now)))
+}
+
+func (s *Store) IsJWTRevoked(ctx context.Context, jti string) (bool, error) {
+	_, err := s.KV.Get(ctx, s.key(kindRevokedJWT, jti))
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, handleError(err)
+	}
+	return true, nil
+}
+
+func (s *Store) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) error {
+	_, err := s.createRequest(ctx, s.key(kindAuthorizeCode, code), request, fosite.AuthorizeCode)
+	return err
+}
+
+func (s *Store) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	request, active, err := s.getRequest(ctx, s.key(kindAuthorizeCode, code), session)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return request, errorsx.WithStack(fosite.ErrInvalidatedAuthorizeCode)
+	}
+	return request, nil
+}
+
+func (s *Store) InvalidateAuthorizeCodeSession(ctx context.Context, code string) error {
+	return s.deactivate(ctx, s.key(kindAuthorizeCode, code))
+}
+
+func (s *Store) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	key := s.key(kindAccessToken, signature)
+	exp, err := s.createRequest(ctx, key, request, fosite.AccessToken)
+	if err != nil {
+		return err
+	}
+	return handleError(AddToIndex(ctx, s.KV, s.key(kindAccessTokenRequest, request.GetID()), key, exp, s.now()))
+}
+
+func (s *Store) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	request, _, err := s.getRequest(ctx, s.key(kindAccessToken, signature), session)
+	return request, err
+}
+
+func (s *Store) DeleteAccessTokenSession(ctx context.Context, signature string) error {
+	return s.deleteRequest(ctx, s.key(kindAccessToken, signature), kindAccessTokenRequest)
+}
+
+func (s *Store) CreateRefreshTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	key := s.key(kindRefreshToken, signature)
+	exp, err := s.createRequest(ctx, key, request, fosite.RefreshToken)
+	if err != nil {
+		return err
+	}
+	return handleError(AddToIndex(ctx, s.KV, s.key(kindRefreshTokenRequest, request.GetID()), key, exp, s.now()))
+}
+
+func (s *Store) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	request, active, err := s.getRequest(ctx, s.key(kindRefreshToken, signature), session)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return request, errorsx.WithStack(fosite.ErrInactiveToken)
+	}
+	return request, nil
+}
+
+func (s *Store) DeleteRefreshTokenSession(ctx context.Context, signature string) error {
+	return s.deleteRequest(ctx, s.key(kindRefreshToken, signature), kindRefreshTokenRequest)
+}
+
+// RevokeRefreshToken marks all refresh tokens of the request as inactive.
+func (s *Store) RevokeRefreshToken(ctx context.Context, requestID string) error {
+	keys, err := IndexValues(ctx, s.KV, s.key(kindRefreshTokenRequest, requestID))
+	if err != nil {
+		return handleError(err)
+	}
+
+	for _, key := range keys {
+		if err := s.deactivate(ctx, key); err != nil && !errors.Is(err, fosite.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
+	// grace periods are not supported
+	return s.RevokeRefreshToken(ctx, requestID)
+}
+
+// RevokeAccessToken deletes all access tokens of the request.
+func (s *Store) RevokeAccessToken(ctx context.Context, requestID string) error {
+	index := s.key(kindAccessTokenRequest, requestID)
+	keys, err := IndexValues(ctx, s.KV, index)
+	if err != nil {
+		return handleError(err)
+	}
+
+	for _, key := range keys {
+		if err := s.KV.Delete(ctx, key); err != nil {
+			return handleError(err)
+		}
+		if err := RemoveFromIndex(ctx, s.KV, index, key, s.now()); err != nil {
+			return handleError(err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) error {
+	_, err := s.createRequest(ctx, s.key(kindOpenIDConnect, authorizeCode), requester, fosite.AuthorizeCode)
+	return err
+}
+
+func (s *Store) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (fosite.Requester, error) {
+	var session fosite.Session
+	if requester != nil {
+		session = requester.GetSession()
+	}
+	request, _, err := s.getRequest(ctx, s.key(kindOpenIDConnect, authorizeCode), session)
+	return request, err
+}
+
+func (s *Store) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) error {
+	return handleError(s.KV.Delete(ctx, s.key(kindOpenIDConnect, authorizeCode)))
+}
+
+func (s *Store) CreatePKCERequestSession(ctx context.Context, signature string, requester fosite.Requester) error {
+	_, err := s.createRequest(ctx, s.key(kindPKCE, signature), requester, fosite.AuthorizeCode)
+	return err
+}
+
+func (s *Store) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	request, _, err := s.getRequest(ctx, s.key(kindPKCE, signature), session)
+	return request, err
+}
+
+func (s *Store) DeletePKCERequestSession(ctx context.Context, signature string) error {
+	return handleError(s.KV.Delete(ctx, s.key(kindPKCE, signature)))
+}
+
+// CreatePARSession stores the pushed authorization request context until it expires.
+func (s *Store) CreatePARSession(ctx context.Context, requestURI string, request fosite.AuthorizeRequester) error {
+	_, err := s.createRequest(ctx, s.key(kindPAR, requestURI), request, fosite.PushedAuthorizeRequestContext)
+	return err
+}
+
+// GetPARSession gets the push authorization request context. The session is created by NewSession, or is of the
+// type the request was stored with.
+func (s *Store) GetPARSession(ctx context.Context, requestURI string) (fosite.AuthorizeRequester, error) {
+	request, _, err := s.getRequest(ctx, s.key(kindPAR, requestURI), s.newSession())
+	if err != nil {
+		return nil, err
+	}
+
+	ar, ok := request.(fosite.AuthorizeRequester)
+	if !ok {
+		return nil, pkgerrors.Errorf("pushed authorization request %s is not an authorize request", requestURI)
+	}
+	return ar, nil
+}
+
+// DeletePARSession deletes the context.
+func (s *Store) DeletePARSession(ctx context.Context, requestURI string) error {
+	return handleError(s.KV.Delete(ctx, s.key(kindPAR, requestURI)))
+}
+
+// SetPublicKey stores the public key used to verify JWT authorization grants of the issuer and subject, and the
+// scopes the grants may request.
+func (s *Store) SetPublicKey(ctx context.Context, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+	data, err := json.Marshal(issuerKey{Key: key, Scopes: scopes})
+	if err != nil {
+		return pkgerrors.WithStack(err)
+	}
+
+	if err := s.KV.Set(ctx, s.key(kindIssuerKey, issuer, subject, key.KeyID), data, 0); err != nil {
+		return handleError(err)
+	}
+	return handleError(AddToIndex(ctx, s.KV, s.key(kindIssuerKeys, issuer, subject), key.KeyID, time.Time{}, s.now()))
+}
+
+func (s *Store) getIssuerKey(ctx context.Context, issuer, subject, keyID string) (issuerKey, error) {
+	var key issuerKey
+	err := s.get(ctx, s.key(kindIssuerKey, issuer, subject, keyID), &key)
+	return key, err
+}
+
+func (s *Store) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	key, err := s.getIssuerKey(ctx, issuer, subject, keyId)
+	if err != nil {
+		return nil, err
+	}
+	return key.Key, nil
+}
+
+func (s *Store) GetPublicKeys(ctx context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	keyIDs, err := IndexValues(ctx, s.KV, s.key(kindIssuerKeys, issuer, subject))
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	var keys []jose.JSONWebKey
+	for _, keyID := range keyIDs {
+		key, err := s.getIssuerKey(ctx, issuer, subject, keyID)
+		if errors.Is(err, fosite.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key.Key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errorsx.WithStack(fosite.ErrNotFound)
+	}
+	return &jose.JSONWebKeySet{Keys: keys}, nil
+}
+
+func (s *Store) GetPublicKeyScopes(ctx context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	key, err := s.getIssuerKey(ctx, issuer, subject, keyId)
+	if err != nil {
+		return nil, err
+	}
+	return key.Scopes, nil
+}
+
+func (s *Store) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	if err := s.ClientAssertionJWTValid(ctx, jti); errors.Is(err, fosite.ErrJTIKnown) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *Store) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	return s.SetClientAssertionJWT(ctx, jti, exp)
+}
@@ -0,0 +1,114 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package kvstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) interface{} {
+		return New(NewMemoryKV())
+	}, storagetest.Options{
+		CreateClient: func(ctx context.Context, s interface{}, client *fosite.DefaultClient) error {
+			return s.(*Store).CreateClient(ctx, client)
+		},
+		SetPublicKey: func(ctx context.Context, s interface{}, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+			return s.(*Store).SetPublicKey(ctx, issuer, subject, key, scopes)
+		},
+	})
+}
+
+func newTestStore(t *testing.T) (*Store, *MemoryKV, func(time.Duration)) {
+	kv, advance := newTestKV()
+	s := New(kv)
+	s.Clock = kv.Clock
+	require.NoError(t, s.CreateClient(context.Background(), &fosite.DefaultClient{ID: storagetest.ClientID}))
+	return s, kv, advance
+}
+
+func TestStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	s, kv, advance := newTestStore(t)
+	now := s.Clock.Now()
+
+	request := storagetest.NewRequest("request-1")
+	request.Session.SetExpiresAt(fosite.AccessToken, now.Add(time.Minute))
+	request.Session.SetExpiresAt(fosite.RefreshToken, now.Add(time.Hour))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access", request))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "refresh", request))
+	require.NoError(t, s.SetClientAssertionJWT(ctx, "jti", now.Add(time.Minute)))
+
+	advance(time.Minute)
+	_, err := s.GetAccessTokenSession(ctx, "access", request.Session)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = s.GetRefreshTokenSession(ctx, "refresh", request.Session)
+	assert.NoError(t, err)
+	assert.NoError(t, s.ClientAssertionJWTValid(ctx, "jti"))
+
+	advance(time.Hour)
+	_, err = s.GetRefreshTokenSession(ctx, "refresh", request.Session)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	kv.Sweep()
+	assert.Equal(t, 1, kv.Len(), "only the client is left")
+}
+
+func TestStore_Revocation(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestStore(t)
+
+	first, second := storagetest.NewRequest("request-1"), storagetest.NewRequest("request-2")
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-1", first))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-2", first))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access-3", second))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "refresh-1", first))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "refresh-2", first))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "refresh-3", second))
+
+	require.NoError(t, s.DeleteAccessTokenSession(ctx, "access-2"))
+	values, err := IndexValues(ctx, s.KV, s.key(kindAccessTokenRequest, "request-1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{s.key(kindAccessToken, "access-1")}, values)
+
+	require.NoError(t, s.RevokeAccessToken(ctx, "request-1"))
+	require.NoError(t, s.RevokeRefreshToken(ctx, "request-1"))
+
+	_, err = s.GetAccessTokenSession(ctx, "access-1", first.Session)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = s.GetAccessTokenSession(ctx, "access-3", second.Session)
+	assert.NoError(t, err)
+
+	for _, signature := range []string{"refresh-1", "refresh-2"} {
+		got, err := s.GetRefreshTokenSession(ctx, signature, first.Session)
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+		require.NotNil(t, got)
+		assert.Equal(t, "request-1", got.GetID())
+	}
+	_, err = s.GetRefreshTokenSession(ctx, "refresh-3", second.Session)
+	assert.NoError(t, err)
+}
+
+func TestStore_Keys(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemoryKV()
+
+	a, b := New(kv), New(kv)
+	b.Prefix = "other:"
+	require.NoError(t, a.CreateClient(ctx, &fosite.DefaultClient{ID: "client"}))
+	_, err := b.GetClient(ctx, "client")
+	assert.ErrorIs(t, err, fosite.ErrNotFound, "stores with different prefixes do not share keys")
+
+	assert.Equal(t, "fosite:issuer_key:a%3Ab:c:d", a.key(kindIssuerKey, "a:b", "c", "d"))
+	assert.NotEqual(t, a.key(kindIssuerKey, "a:b", "c", "d"), a.key(kindIssuerKey, "a", "b:c", "d"))
+}
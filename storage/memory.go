@@ -44,12 +44,23 @@ type MemoryStore struct {
 	PKCES           map[string]fosite.Requester
 	Users           map[string]MemoryUserRelation
 	BlacklistedJTIs map[string]time.Time
+	// In-memory deny-list of revoked JWT access token ids and their expiry
+	RevokedJWTs map[string]time.Time
 	// In-memory request ID to token signatures
-	AccessTokenRequestIDs  map[string]string
-	RefreshTokenRequestIDs map[string]string
+	AccessTokenRequestIDs   map[string]string
+	RefreshTokenRequestIDs  map[string]string
+	AuthorizeCodeRequestIDs map[string]string
+	PKCERequestIDs          map[string]string
+	// In-memory requests by ID and request IDs by subject, client ID and session ID, used by RevokeTokens
+	Requests              map[string]fosite.Requester
+	RequestIDsBySubject   map[string]map[string]struct{}
+	RequestIDsByClientID  map[string]map[string]struct{}
+	RequestIDsBySessionID map[string]map[string]struct{}
 	// Public keys to check signature in auth grant jwt assertion.
 	IssuerPublicKeys map[string]IssuerPublicKeys
 	PARSessions      map[string]fosite.AuthorizeRequester
+	// Clock is used to determine whether stored entries have expired. Defaults to fosite.DefaultClock.
+	Clock fosite.Clock
 
 	clientsMutex                sync.RWMutex
 	authorizeCodesMutex         sync.RWMutex
@@ -59,29 +70,59 @@ type MemoryStore struct {
 	pkcesMutex                  sync.RWMutex
 	usersMutex                  sync.RWMutex
 	blacklistedJTIsMutex        sync.RWMutex
+	revokedJWTsMutex            sync.RWMutex
 	accessTokenRequestIDsMutex  sync.RWMutex
 	refreshTokenRequestIDsMutex sync.RWMutex
+	requestIndexMutex           sync.RWMutex
 	issuerPublicKeysMutex       sync.RWMutex
 	parSessionsMutex            sync.RWMutex
 }
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		Clients:                make(map[string]fosite.Client),
-		AuthorizeCodes:         make(map[string]StoreAuthorizeCode),
-		IDSessions:             make(map[string]fosite.Requester),
-		AccessTokens:           make(map[string]fosite.Requester),
-		RefreshTokens:          make(map[string]StoreRefreshToken),
-		PKCES:                  make(map[string]fosite.Requester),
-		Users:                  make(map[string]MemoryUserRelation),
-		AccessTokenRequestIDs:  make(map[string]string),
-		RefreshTokenRequestIDs: make(map[string]string),
-		BlacklistedJTIs:        make(map[string]time.Time),
-		IssuerPublicKeys:       make(map[string]IssuerPublicKeys),
-		PARSessions:            make(map[string]fosite.AuthorizeRequester),
+		Clients:                 make(map[string]fosite.Client),
+		AuthorizeCodes:          make(map[string]StoreAuthorizeCode),
+		IDSessions:              make(map[string]fosite.Requester),
+		AccessTokens:            make(map[string]fosite.Requester),
+		RefreshTokens:           make(map[string]StoreRefreshToken),
+		PKCES:                   make(map[string]fosite.Requester),
+		Users:                   make(map[string]MemoryUserRelation),
+		AccessTokenRequestIDs:   make(map[string]string),
+		RefreshTokenRequestIDs:  make(map[string]string),
+		AuthorizeCodeRequestIDs: make(map[string]string),
+		PKCERequestIDs:          make(map[string]string),
+		Requests:                make(map[string]fosite.Requester),
+		RequestIDsBySubject:     make(map[string]map[string]struct{}),
+		RequestIDsByClientID:    make(map[string]map[string]struct{}),
+		RequestIDsBySessionID:   make(map[string]map[string]struct{}),
+		BlacklistedJTIs:         make(map[string]time.Time),
+		RevokedJWTs:             make(map[string]time.Time),
+		IssuerPublicKeys:        make(map[string]IssuerPublicKeys),
+		PARSessions:             make(map[string]fosite.AuthorizeRequester),
 	}
 }
 
+func (s *MemoryStore) now() time.Time {
+	if s.Clock == nil {
+		return fosite.DefaultClock.Now()
+	}
+	return s.Clock.Now()
+}
+
+// expired reports whether the token of the given type, which was stored with the request, has expired. Tokens
+// without an expiry never expire.
+func (s *MemoryStore) expired(req fosite.Requester, tokenType fosite.TokenType) bool {
+	return isExpired(req, tokenType, s.now())
+}
+
+func isExpired(req fosite.Requester, tokenType fosite.TokenType, now time.Time) bool {
+	if req == nil || req.GetSession() == nil {
+		return false
+	}
+	exp := req.GetSession().GetExpiresAt(tokenType)
+	return !exp.IsZero() && exp.Before(now)
+}
+
 type StoreAuthorizeCode struct {
 	active bool
 	fosite.Requester
@@ -135,14 +176,22 @@ func NewExampleStore() *MemoryStore {
 				Password: "secret",
 			},
 		},
-		AuthorizeCodes:         map[string]StoreAuthorizeCode{},
-		AccessTokens:           map[string]fosite.Requester{},
-		RefreshTokens:          map[string]StoreRefreshToken{},
-		PKCES:                  map[string]fosite.Requester{},
-		AccessTokenRequestIDs:  map[string]string{},
-		RefreshTokenRequestIDs: map[string]string{},
-		IssuerPublicKeys:       map[string]IssuerPublicKeys{},
-		PARSessions:            map[string]fosite.AuthorizeRequester{},
+		AuthorizeCodes:          map[string]StoreAuthorizeCode{},
+		AccessTokens:            map[string]fosite.Requester{},
+		RefreshTokens:           map[string]StoreRefreshToken{},
+		PKCES:                   map[string]fosite.Requester{},
+		AccessTokenRequestIDs:   map[string]string{},
+		RefreshTokenRequestIDs:  map[string]string{},
+		AuthorizeCodeRequestIDs: map[string]string{},
+		PKCERequestIDs:          map[string]string{},
+		Requests:                map[string]fosite.Requester{},
+		RequestIDsBySubject:     map[string]map[string]struct{}{},
+		RequestIDsByClientID:    map[string]map[string]struct{}{},
+		RequestIDsBySessionID:   map[string]map[string]struct{}{},
+		BlacklistedJTIs:         map[string]time.Time{},
+		RevokedJWTs:             map[string]time.Time{},
+		IssuerPublicKeys:        map[string]IssuerPublicKeys{},
+		PARSessions:             map[string]fosite.AuthorizeRequester{},
 	}
 }
 
@@ -159,7 +208,7 @@ func (s *MemoryStore) GetOpenIDConnectSession(_ context.Context, authorizeCode s
 	defer s.idSessionsMutex.RUnlock()
 
 	cl, ok := s.IDSessions[authorizeCode]
-	if !ok {
+	if !ok || s.expired(cl, fosite.AuthorizeCode) {
 		return nil, fosite.ErrNotFound
 	}
 	return cl, nil
@@ -173,7 +222,11 @@ func (s *MemoryStore) DeleteOpenIDConnectSession(_ context.Context, authorizeCod
 	return nil
 }
 
-func (s *MemoryStore) GetClient(_ context.Context, id string) (fosite.Client, error) {
+func (s *MemoryStore) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	if cl, ok := s.snapshotClient(ctx, id); ok {
+		return cl, nil
+	}
+
 	s.clientsMutex.RLock()
 	defer s.clientsMutex.RUnlock()
 
@@ -199,7 +252,7 @@ func (s *MemoryStore) ClientAssertionJWTValid(_ context.Context, jti string) err
 	s.blacklistedJTIsMutex.RLock()
 	defer s.blacklistedJTIsMutex.RUnlock()
 
-	if exp, exists := s.BlacklistedJTIs[jti]; exists && exp.After(time.Now()) {
+	if exp, exists := s.BlacklistedJTIs[jti]; exists && exp.After(s.now()) {
 		return fosite.ErrJTIKnown
 	}
 
@@ -211,8 +264,9 @@ func (s *MemoryStore) SetClientAssertionJWT(_ context.Context, jti string, exp t
 	defer s.blacklistedJTIsMutex.Unlock()
 
 	// delete expired jtis
+	now := s.now()
 	for j, e := range s.BlacklistedJTIs {
-		if e.Before(time.Now()) {
+		if e.Before(now) {
 			delete(s.BlacklistedJTIs, j)
 		}
 	}
@@ -225,11 +279,50 @@ func (s *MemoryStore) SetClientAssertionJWT(_ context.Context, jti string, exp t
 	return nil
 }
 
+func (s *MemoryStore) RevokeJWT(_ context.Context, jti string, exp time.Time) error {
+	s.revokedJWTsMutex.Lock()
+	defer s.revokedJWTsMutex.Unlock()
+
+	// delete expired jtis, they are rejected based on their expiry anyway
+	now := s.now()
+	for j, e := range s.RevokedJWTs {
+		if e.Before(now) {
+			delete(s.RevokedJWTs, j)
+		}
+	}
+
+	s.RevokedJWTs[jti] = exp
+	return nil
+}
+
+func (s *MemoryStore) IsJWTRevoked(_ context.Context, jti string) (bool, error) {
+	s.revokedJWTsMutex.RLock()
+	defer s.revokedJWTsMutex.RUnlock()
+
+	exp, exists := s.RevokedJWTs[jti]
+	return exists && exp.After(s.now()), nil
+}
+
+func (s *MemoryStore) ListRevokedJWTs(_ context.Context) ([]string, error) {
+	s.revokedJWTsMutex.RLock()
+	defer s.revokedJWTsMutex.RUnlock()
+
+	now := s.now()
+	jtis := make([]string, 0, len(s.RevokedJWTs))
+	for j, e := range s.RevokedJWTs {
+		if e.After(now) {
+			jtis = append(jtis, j)
+		}
+	}
+	return jtis, nil
+}
+
 func (s *MemoryStore) CreateAuthorizeCodeSession(_ context.Context, code string, req fosite.Requester) error {
 	s.authorizeCodesMutex.Lock()
 	defer s.authorizeCodesMutex.Unlock()
 
 	s.AuthorizeCodes[code] = StoreAuthorizeCode{active: true, Requester: req}
+	s.indexRequest(req, func() { s.AuthorizeCodeRequestIDs[req.GetID()] = code })
 	return nil
 }
 
@@ -238,7 +331,7 @@ func (s *MemoryStore) GetAuthorizeCodeSession(_ context.Context, code string, _
 	defer s.authorizeCodesMutex.RUnlock()
 
 	rel, ok := s.AuthorizeCodes[code]
-	if !ok {
+	if !ok || s.expired(rel.Requester, fosite.AuthorizeCode) {
 		return nil, fosite.ErrNotFound
 	}
 	if !rel.active {
@@ -266,6 +359,7 @@ func (s *MemoryStore) CreatePKCERequestSession(_ context.Context, code string, r
 	defer s.pkcesMutex.Unlock()
 
 	s.PKCES[code] = req
+	s.indexRequest(req, func() { s.PKCERequestIDs[req.GetID()] = code })
 	return nil
 }
 
@@ -274,7 +368,7 @@ func (s *MemoryStore) GetPKCERequestSession(_ context.Context, code string, _ fo
 	defer s.pkcesMutex.RUnlock()
 
 	rel, ok := s.PKCES[code]
-	if !ok {
+	if !ok || s.expired(rel, fosite.AuthorizeCode) {
 		return nil, fosite.ErrNotFound
 	}
 	return rel, nil
@@ -298,6 +392,7 @@ func (s *MemoryStore) CreateAccessTokenSession(_ context.Context, signature stri
 
 	s.AccessTokens[signature] = req
 	s.AccessTokenRequestIDs[req.GetID()] = signature
+	s.indexRequest(req, nil)
 	return nil
 }
 
@@ -306,7 +401,7 @@ func (s *MemoryStore) GetAccessTokenSession(_ context.Context, signature string,
 	defer s.accessTokensMutex.RUnlock()
 
 	rel, ok := s.AccessTokens[signature]
-	if !ok {
+	if !ok || s.expired(rel, fosite.AccessToken) {
 		return nil, fosite.ErrNotFound
 	}
 	return rel, nil
@@ -330,6 +425,7 @@ func (s *MemoryStore) CreateRefreshTokenSession(_ context.Context, signature str
 
 	s.RefreshTokens[signature] = StoreRefreshToken{active: true, Requester: req}
 	s.RefreshTokenRequestIDs[req.GetID()] = signature
+	s.indexRequest(req, nil)
 	return nil
 }
 
@@ -338,7 +434,7 @@ func (s *MemoryStore) GetRefreshTokenSession(_ context.Context, signature string
 	defer s.refreshTokensMutex.RUnlock()
 
 	rel, ok := s.RefreshTokens[signature]
-	if !ok {
+	if !ok || s.expired(rel.Requester, fosite.RefreshToken) {
 		return nil, fosite.ErrNotFound
 	}
 	if !rel.active {
@@ -401,6 +497,114 @@ func (s *MemoryStore) RevokeAccessToken(ctx context.Context, requestID string) e
 	return nil
 }
 
+// indexRequest adds the request to the indexes used by RevokeTokens. The update function is called while the indexes
+// are locked.
+func (s *MemoryStore) indexRequest(req fosite.Requester, update func()) {
+	s.requestIndexMutex.Lock()
+	defer s.requestIndexMutex.Unlock()
+
+	if s.Requests == nil {
+		s.AuthorizeCodeRequestIDs = make(map[string]string)
+		s.PKCERequestIDs = make(map[string]string)
+		s.Requests = make(map[string]fosite.Requester)
+		s.RequestIDsBySubject = make(map[string]map[string]struct{})
+		s.RequestIDsByClientID = make(map[string]map[string]struct{})
+		s.RequestIDsBySessionID = make(map[string]map[string]struct{})
+	}
+	if update != nil {
+		update()
+	}
+
+	id := req.GetID()
+	s.Requests[id] = req
+	if req.GetSession() != nil {
+		addRequestID(s.RequestIDsBySubject, req.GetSession().GetSubject(), id)
+		addRequestID(s.RequestIDsBySessionID, fosite.GetSessionID(req.GetSession()), id)
+	}
+	if req.GetClient() != nil {
+		addRequestID(s.RequestIDsByClientID, req.GetClient().GetID(), id)
+	}
+}
+
+func addRequestID(index map[string]map[string]struct{}, key, id string) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = make(map[string]struct{})
+	}
+	index[key][id] = struct{}{}
+}
+
+func removeRequestID(index map[string]map[string]struct{}, key, id string) {
+	delete(index[key], id)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// RevokeTokens revokes the access tokens, refresh tokens, authorize codes and PKCE sessions of all requests matching
+// the filter and removes them from the indexes.
+func (s *MemoryStore) RevokeTokens(ctx context.Context, filter fosite.RevocationFilter) ([]string, error) {
+	s.requestIndexMutex.Lock()
+	var candidates map[string]struct{}
+	switch {
+	case filter.RequestID != "":
+		candidates = map[string]struct{}{filter.RequestID: {}}
+	case filter.SessionID != "":
+		candidates = s.RequestIDsBySessionID[filter.SessionID]
+	case filter.Subject != "":
+		candidates = s.RequestIDsBySubject[filter.Subject]
+	default:
+		candidates = s.RequestIDsByClientID[filter.ClientID]
+	}
+
+	var requestIDs []string
+	codes := map[string]string{}
+	pkces := map[string]string{}
+	for id := range candidates {
+		req, ok := s.Requests[id]
+		if !ok || !filter.Matches(req) {
+			continue
+		}
+
+		requestIDs = append(requestIDs, id)
+		codes[id] = s.AuthorizeCodeRequestIDs[id]
+		pkces[id] = s.PKCERequestIDs[id]
+		delete(s.Requests, id)
+		delete(s.AuthorizeCodeRequestIDs, id)
+		delete(s.PKCERequestIDs, id)
+		if req.GetSession() != nil {
+			removeRequestID(s.RequestIDsBySubject, req.GetSession().GetSubject(), id)
+			removeRequestID(s.RequestIDsBySessionID, fosite.GetSessionID(req.GetSession()), id)
+		}
+		if req.GetClient() != nil {
+			removeRequestID(s.RequestIDsByClientID, req.GetClient().GetID(), id)
+		}
+	}
+	s.requestIndexMutex.Unlock()
+
+	for _, id := range requestIDs {
+		if err := s.RevokeAccessToken(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.RevokeRefreshToken(ctx, id); err != nil {
+			return nil, err
+		}
+		if code := codes[id]; code != "" {
+			if err := s.InvalidateAuthorizeCodeSession(ctx, code); err != nil && !errors.Is(err, fosite.ErrNotFound) {
+				return nil, err
+			}
+		}
+		if code := pkces[id]; code != "" {
+			if err := s.DeletePKCERequestSession(ctx, code); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return requestIDs, nil
+}
+
 func (s *MemoryStore) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
 	s.issuerPublicKeysMutex.RLock()
 	defer s.issuerPublicKeysMutex.RUnlock()
@@ -481,7 +685,7 @@ func (s *MemoryStore) GetPARSession(ctx context.Context, requestURI string) (fos
 	defer s.parSessionsMutex.RUnlock()
 
 	r, ok := s.PARSessions[requestURI]
-	if !ok {
+	if !ok || s.expired(r, fosite.PushedAuthorizeRequestContext) {
 		return nil, fosite.ErrNotFound
 	}
 
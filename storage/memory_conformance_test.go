@@ -0,0 +1,60 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/storage/storagetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) interface{} { return storage.NewMemoryStore() }, storagetest.Options{
+		CreateClient: func(_ context.Context, s interface{}, client *fosite.DefaultClient) error {
+			s.(*storage.MemoryStore).Clients[client.ID] = client
+			return nil
+		},
+		SetPublicKey: func(_ context.Context, s interface{}, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+			s.(*storage.MemoryStore).IssuerPublicKeys[issuer] = storage.IssuerPublicKeys{
+				Issuer: issuer,
+				KeysBySub: map[string]storage.SubjectPublicKeys{
+					subject: {Subject: subject, Keys: map[string]storage.PublicKeyScopes{key.KeyID: {Key: key, Scopes: scopes}}},
+				},
+			}
+			return nil
+		},
+	})
+}
+
+func TestMultiTenantMemoryStoreConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) interface{} { return storage.NewMultiTenantMemoryStore() }, storagetest.Options{
+		CreateClient: func(ctx context.Context, s interface{}, client *fosite.DefaultClient) error {
+			s.(*storage.MultiTenantMemoryStore).Tenant(fosite.TenantFromContext(ctx)).Clients[client.ID] = client
+			return nil
+		},
+	})
+}
+
+func TestShardedMemoryStoreConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) interface{} { return storage.NewShardedMemoryStore(0) }, storagetest.Options{
+		CreateClient: func(_ context.Context, s interface{}, client *fosite.DefaultClient) error {
+			s.(*storage.ShardedMemoryStore).Clients[client.ID] = client
+			return nil
+		},
+		SetPublicKey: func(_ context.Context, s interface{}, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+			s.(*storage.ShardedMemoryStore).IssuerPublicKeys[issuer] = storage.IssuerPublicKeys{
+				Issuer: issuer,
+				KeysBySub: map[string]storage.SubjectPublicKeys{
+					subject: {Subject: subject, Keys: map[string]storage.PublicKeyScopes{key.KeyID: {Key: key, Scopes: scopes}}},
+				},
+			}
+			return nil
+		},
+	})
+}
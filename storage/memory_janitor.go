@@ -0,0 +1,337 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ory/fosite"
+)
+
+// PurgeStats counts the entries removed by a purge.
+type PurgeStats struct {
+	AuthorizeCodes  int
+	IDSessions      int
+	AccessTokens    int
+	RefreshTokens   int
+	PKCES           int
+	PARSessions     int
+	BlacklistedJTIs int
+	RevokedJWTs     int
+	// RequestIDs counts the request ID index entries removed because the tokens they refer to no longer exist.
+	RequestIDs int
+}
+
+// Total returns the number of removed entries.
+func (p PurgeStats) Total() int {
+	return p.AuthorizeCodes + p.IDSessions + p.AccessTokens + p.RefreshTokens + p.PKCES + p.PARSessions +
+		p.BlacklistedJTIs + p.RevokedJWTs + p.RequestIDs
+}
+
+func (p *PurgeStats) add(o PurgeStats) {
+	p.AuthorizeCodes += o.AuthorizeCodes
+	p.IDSessions += o.IDSessions
+	p.AccessTokens += o.AccessTokens
+	p.RefreshTokens += o.RefreshTokens
+	p.PKCES += o.PKCES
+	p.PARSessions += o.PARSessions
+	p.BlacklistedJTIs += o.BlacklistedJTIs
+	p.RevokedJWTs += o.RevokedJWTs
+	p.RequestIDs += o.RequestIDs
+}
+
+// Purger removes expired entries. It is implemented by MemoryStore and MultiTenantMemoryStore.
+type Purger interface {
+	PurgeExpired() PurgeStats
+}
+
+var (
+	_ Purger = (*MemoryStore)(nil)
+	_ Purger = (*MultiTenantMemoryStore)(nil)
+)
+
+// PurgeExpired removes expired authorize codes, tokens, PKCE, OpenID Connect and PAR sessions and JTIs, and the
+// request ID index entries of tokens which no longer exist. Expired entries are never returned by the store, so
+// purging only frees memory.
+func (s *MemoryStore) PurgeExpired() PurgeStats {
+	var stats PurgeStats
+	now := s.now()
+
+	s.authorizeCodesMutex.Lock()
+	for code, rel := range s.AuthorizeCodes {
+		if s.expired(rel.Requester, fosite.AuthorizeCode) {
+			delete(s.AuthorizeCodes, code)
+			stats.AuthorizeCodes++
+		}
+	}
+	s.authorizeCodesMutex.Unlock()
+
+	s.idSessionsMutex.Lock()
+	for code, req := range s.IDSessions {
+		if s.expired(req, fosite.AuthorizeCode) {
+			delete(s.IDSessions, code)
+			stats.IDSessions++
+		}
+	}
+	s.idSessionsMutex.Unlock()
+
+	s.accessTokenRequestIDsMutex.Lock()
+	s.accessTokensMutex.Lock()
+	for signature, req := range s.AccessTokens {
+		if s.expired(req, fosite.AccessToken) {
+			delete(s.AccessTokens, signature)
+			stats.AccessTokens++
+		}
+	}
+	for id, signature := range s.AccessTokenRequestIDs {
+		if _, ok := s.AccessTokens[signature]; !ok {
+			delete(s.AccessTokenRequestIDs, id)
+			stats.RequestIDs++
+		}
+	}
+	s.accessTokensMutex.Unlock()
+	s.accessTokenRequestIDsMutex.Unlock()
+
+	s.refreshTokenRequestIDsMutex.Lock()
+	s.refreshTokensMutex.Lock()
+	for signature, rel := range s.RefreshTokens {
+		if s.expired(rel.Requester, fosite.RefreshToken) {
+			delete(s.RefreshTokens, signature)
+			stats.RefreshTokens++
+		}
+	}
+	for id, signature := range s.RefreshTokenRequestIDs {
+		if _, ok := s.RefreshTokens[signature]; !ok {
+			delete(s.RefreshTokenRequestIDs, id)
+			stats.RequestIDs++
+		}
+	}
+	s.refreshTokensMutex.Unlock()
+	s.refreshTokenRequestIDsMutex.Unlock()
+
+	s.pkcesMutex.Lock()
+	for code, req := range s.PKCES {
+		if s.expired(req, fosite.AuthorizeCode) {
+			delete(s.PKCES, code)
+			stats.PKCES++
+		}
+	}
+	s.pkcesMutex.Unlock()
+
+	s.parSessionsMutex.Lock()
+	for uri, req := range s.PARSessions {
+		if s.expired(req, fosite.PushedAuthorizeRequestContext) {
+			delete(s.PARSessions, uri)
+			stats.PARSessions++
+		}
+	}
+	s.parSessionsMutex.Unlock()
+
+	s.blacklistedJTIsMutex.Lock()
+	for jti, exp := range s.BlacklistedJTIs {
+		if exp.Before(now) {
+			delete(s.BlacklistedJTIs, jti)
+			stats.BlacklistedJTIs++
+		}
+	}
+	s.blacklistedJTIsMutex.Unlock()
+
+	s.revokedJWTsMutex.Lock()
+	for jti, exp := range s.RevokedJWTs {
+		if exp.Before(now) {
+			delete(s.RevokedJWTs, jti)
+			stats.RevokedJWTs++
+		}
+	}
+	s.revokedJWTsMutex.Unlock()
+
+	stats.RequestIDs += s.purgeRequestIndex()
+	return stats
+}
+
+// purgeRequestIndex removes the requests which no token refers to anymore from the indexes used by RevokeTokens. The
+// mutexes are locked in the order used by the Create methods.
+func (s *MemoryStore) purgeRequestIndex() int {
+	s.accessTokenRequestIDsMutex.RLock()
+	defer s.accessTokenRequestIDsMutex.RUnlock()
+	s.refreshTokenRequestIDsMutex.RLock()
+	defer s.refreshTokenRequestIDsMutex.RUnlock()
+	s.authorizeCodesMutex.RLock()
+	defer s.authorizeCodesMutex.RUnlock()
+	s.pkcesMutex.RLock()
+	defer s.pkcesMutex.RUnlock()
+	s.requestIndexMutex.Lock()
+	defer s.requestIndexMutex.Unlock()
+
+	var purged int
+	for id, code := range s.AuthorizeCodeRequestIDs {
+		if _, ok := s.AuthorizeCodes[code]; !ok {
+			delete(s.AuthorizeCodeRequestIDs, id)
+			purged++
+		}
+	}
+	for id, code := range s.PKCERequestIDs {
+		if _, ok := s.PKCES[code]; !ok {
+			delete(s.PKCERequestIDs, id)
+			purged++
+		}
+	}
+
+	for id, req := range s.Requests {
+		_, access := s.AccessTokenRequestIDs[id]
+		_, refresh := s.RefreshTokenRequestIDs[id]
+		_, code := s.AuthorizeCodeRequestIDs[id]
+		_, pkce := s.PKCERequestIDs[id]
+		if access || refresh || code || pkce {
+			continue
+		}
+
+		delete(s.Requests, id)
+		if req.GetSession() != nil {
+			removeRequestID(s.RequestIDsBySubject, req.GetSession().GetSubject(), id)
+			removeRequestID(s.RequestIDsBySessionID, fosite.GetSessionID(req.GetSession()), id)
+		}
+		if req.GetClient() != nil {
+			removeRequestID(s.RequestIDsByClientID, req.GetClient().GetID(), id)
+		}
+		purged++
+	}
+	return purged
+}
+
+// PurgeExpired purges the stores of all tenants.
+func (s *MultiTenantMemoryStore) PurgeExpired() PurgeStats {
+	s.m.RLock()
+	tenants := make([]*MemoryStore, 0, len(s.tenants))
+	for _, store := range s.tenants {
+		tenants = append(tenants, store)
+	}
+	s.m.RUnlock()
+
+	var stats PurgeStats
+	for _, store := range tenants {
+		stats.add(store.PurgeExpired())
+	}
+	return stats
+}
+
+// JanitorMetrics describes the purges run by a Janitor.
+type JanitorMetrics struct {
+	// Runs is the number of purges.
+	Runs int
+	// Purged sums the entries removed by all purges.
+	Purged PurgeStats
+	// Last holds the entries removed by the latest purge.
+	Last PurgeStats
+	// LastRun is the time the latest purge finished.
+	LastRun time.Time
+}
+
+// Janitor periodically purges expired entries from a store, so long-running servers using a MemoryStore do not grow
+// without bound.
+type Janitor struct {
+	// Interval is the time between two purges. Defaults to one minute.
+	Interval time.Duration
+
+	// OnPurge is called with the result of every purge, for example to export metrics.
+	OnPurge func(PurgeStats)
+
+	// Clock is used for the time of the latest purge in the metrics. Defaults to the Clock of the purged MemoryStore,
+	// or to fosite.DefaultClock.
+	Clock fosite.Clock
+
+	store Purger
+
+	m       sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	metrics JanitorMetrics
+}
+
+func NewJanitor(store Purger, interval time.Duration) *Janitor {
+	return &Janitor{store: store, Interval: interval}
+}
+
+// Start starts purging in the background. It does nothing if the janitor is running already.
+func (j *Janitor) Start() {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	if j.stop != nil {
+		return
+	}
+
+	interval := j.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	go j.run(interval, j.stop, j.done)
+}
+
+func (j *Janitor) run(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			j.Purge()
+		}
+	}
+}
+
+// Stop stops purging and waits for a running purge to finish. The janitor can be started again.
+func (j *Janitor) Stop() {
+	j.m.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.m.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Purge purges the store immediately and records the result in the metrics.
+func (j *Janitor) Purge() PurgeStats {
+	stats := j.store.PurgeExpired()
+
+	j.m.Lock()
+	j.metrics.Runs++
+	j.metrics.Purged.add(stats)
+	j.metrics.Last = stats
+	j.metrics.LastRun = j.now()
+	j.m.Unlock()
+
+	if j.OnPurge != nil {
+		j.OnPurge(stats)
+	}
+	return stats
+}
+
+func (j *Janitor) now() time.Time {
+	if j.Clock != nil {
+		return j.Clock.Now()
+	}
+	if s, ok := j.store.(*MemoryStore); ok {
+		return s.now()
+	}
+	return fosite.DefaultClock.Now()
+}
+
+// Metrics returns the metrics of all purges so far.
+func (j *Janitor) Metrics() JanitorMetrics {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.metrics
+}
@@ -0,0 +1,619 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/ory/fosite"
+)
+
+var (
+	_ fosite.ClientManager         = (*ShardedMemoryStore)(nil)
+	_ fosite.PARStorage            = (*ShardedMemoryStore)(nil)
+	_ fosite.BulkRevocationStorage = (*ShardedMemoryStore)(nil)
+	_ Purger                       = (*ShardedMemoryStore)(nil)
+)
+
+// DefaultShardCount is the number of shards used by NewShardedMemoryStore if no count is given.
+const DefaultShardCount = 64
+
+// memoryShard holds the entries whose keys hash to the shard. Request ID index entries are stored in the shard of the
+// request ID, which usually differs from the shard of the token signature.
+type memoryShard struct {
+	sync.RWMutex
+	authorizeCodes         map[string]StoreAuthorizeCode
+	idSessions             map[string]fosite.Requester
+	accessTokens           map[string]fosite.Requester
+	refreshTokens          map[string]StoreRefreshToken
+	pkces                  map[string]fosite.Requester
+	parSessions            map[string]fosite.AuthorizeRequester
+	blacklistedJTIs        map[string]time.Time
+	revokedJWTs            map[string]time.Time
+	accessTokenRequestIDs  map[string]string
+	refreshTokenRequestIDs map[string]string
+}
+
+func newMemoryShard() *memoryShard {
+	return &memoryShard{
+		authorizeCodes:         make(map[string]StoreAuthorizeCode),
+		idSessions:             make(map[string]fosite.Requester),
+		accessTokens:           make(map[string]fosite.Requester),
+		refreshTokens:          make(map[string]StoreRefreshToken),
+		pkces:                  make(map[string]fosite.Requester),
+		parSessions:            make(map[string]fosite.AuthorizeRequester),
+		blacklistedJTIs:        make(map[string]time.Time),
+		revokedJWTs:            make(map[string]time.Time),
+		accessTokenRequestIDs:  make(map[string]string),
+		refreshTokenRequestIDs: make(map[string]string),
+	}
+}
+
+// ShardedMemoryStore is an in-memory store for load tests. Unlike MemoryStore, which guards every map with a single
+// mutex, it partitions tokens, sessions and JTIs by the hash of their key into shards with a mutex of their own, so
+// concurrent requests rarely contend. At most one shard is locked at a time.
+//
+// Clients, users and issuer public keys are read-mostly and must be added before the store is used.
+type ShardedMemoryStore struct {
+	Clients          map[string]fosite.Client
+	Users            map[string]MemoryUserRelation
+	IssuerPublicKeys map[string]IssuerPublicKeys
+	// Clock is used to determine whether stored entries have expired. Defaults to fosite.DefaultClock.
+	Clock fosite.Clock
+
+	shards []*memoryShard
+}
+
+// NewShardedMemoryStore returns a store with the given number of shards, or DefaultShardCount shards if it is not
+// positive.
+func NewShardedMemoryStore(shards int) *ShardedMemoryStore {
+	if shards <= 0 {
+		shards = DefaultShardCount
+	}
+
+	s := &ShardedMemoryStore{
+		Clients:          make(map[string]fosite.Client),
+		Users:            make(map[string]MemoryUserRelation),
+		IssuerPublicKeys: make(map[string]IssuerPublicKeys),
+		shards:           make([]*memoryShard, shards),
+	}
+	for i := range s.shards {
+		s.shards[i] = newMemoryShard()
+	}
+	return s
+}
+
+func (s *ShardedMemoryStore) now() time.Time {
+	if s.Clock == nil {
+		return fosite.DefaultClock.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *ShardedMemoryStore) expired(req fosite.Requester, tokenType fosite.TokenType) bool {
+	return isExpired(req, tokenType, s.now())
+}
+
+// shard returns the shard of the key using the FNV-1a hash.
+func (s *ShardedMemoryStore) shard(key string) *memoryShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *ShardedMemoryStore) GetClient(_ context.Context, id string) (fosite.Client, error) {
+	cl, ok := s.Clients[id]
+	if !ok {
+		return nil, fosite.ErrNotFound
+	}
+	return cl, nil
+}
+
+func (s *ShardedMemoryStore) Authenticate(_ context.Context, name string, secret string) error {
+	rel, ok := s.Users[name]
+	if !ok {
+		return fosite.ErrNotFound
+	}
+	if rel.Password != secret {
+		return fosite.ErrNotFound.WithDebug("Invalid credentials")
+	}
+	return nil
+}
+
+func (s *ShardedMemoryStore) ClientAssertionJWTValid(_ context.Context, jti string) error {
+	sh := s.shard(jti)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	if exp, exists := sh.blacklistedJTIs[jti]; exists && exp.After(s.now()) {
+		return fosite.ErrJTIKnown
+	}
+	return nil
+}
+
+func (s *ShardedMemoryStore) SetClientAssertionJWT(_ context.Context, jti string, exp time.Time) error {
+	sh := s.shard(jti)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if e, exists := sh.blacklistedJTIs[jti]; exists && e.After(s.now()) {
+		return fosite.ErrJTIKnown
+	}
+	sh.blacklistedJTIs[jti] = exp
+	return nil
+}
+
+func (s *ShardedMemoryStore) RevokeJWT(_ context.Context, jti string, exp time.Time) error {
+	sh := s.shard(jti)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.revokedJWTs[jti] = exp
+	return nil
+}
+
+func (s *ShardedMemoryStore) IsJWTRevoked(_ context.Context, jti string) (bool, error) {
+	sh := s.shard(jti)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	exp, exists := sh.revokedJWTs[jti]
+	return exists && exp.After(s.now()), nil
+}
+
+func (s *ShardedMemoryStore) CreateAuthorizeCodeSession(_ context.Context, code string, req fosite.Requester) error {
+	sh := s.shard(code)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.authorizeCodes[code] = StoreAuthorizeCode{active: true, Requester: req}
+	return nil
+}
+
+func (s *ShardedMemoryStore) GetAuthorizeCodeSession(_ context.Context, code string, _ fosite.Session) (fosite.Requester, error) {
+	sh := s.shard(code)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	rel, ok := sh.authorizeCodes[code]
+	if !ok || s.expired(rel.Requester, fosite.AuthorizeCode) {
+		return nil, fosite.ErrNotFound
+	}
+	if !rel.active {
+		return rel, fosite.ErrInvalidatedAuthorizeCode
+	}
+	return rel.Requester, nil
+}
+
+func (s *ShardedMemoryStore) InvalidateAuthorizeCodeSession(_ context.Context, code string) error {
+	sh := s.shard(code)
+	sh.Lock()
+	defer sh.Unlock()
+
+	rel, ok := sh.authorizeCodes[code]
+	if !ok {
+		return fosite.ErrNotFound
+	}
+	rel.active = false
+	sh.authorizeCodes[code] = rel
+	return nil
+}
+
+func (s *ShardedMemoryStore) CreateOpenIDConnectSession(_ context.Context, authorizeCode string, requester fosite.Requester) error {
+	sh := s.shard(authorizeCode)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.idSessions[authorizeCode] = requester
+	return nil
+}
+
+func (s *ShardedMemoryStore) GetOpenIDConnectSession(_ context.Context, authorizeCode string, _ fosite.Requester) (fosite.Requester, error) {
+	sh := s.shard(authorizeCode)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	cl, ok := sh.idSessions[authorizeCode]
+	if !ok || s.expired(cl, fosite.AuthorizeCode) {
+		return nil, fosite.ErrNotFound
+	}
+	return cl, nil
+}
+
+func (s *ShardedMemoryStore) DeleteOpenIDConnectSession(_ context.Context, authorizeCode string) error {
+	sh := s.shard(authorizeCode)
+	sh.Lock()
+	defer sh.Unlock()
+
+	delete(sh.idSessions, authorizeCode)
+	return nil
+}
+
+func (s *ShardedMemoryStore) CreatePKCERequestSession(_ context.Context, code string, req fosite.Requester) error {
+	sh := s.shard(code)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.pkces[code] = req
+	return nil
+}
+
+func (s *ShardedMemoryStore) GetPKCERequestSession(_ context.Context, code string, _ fosite.Session) (fosite.Requester, error) {
+	sh := s.shard(code)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	rel, ok := sh.pkces[code]
+	if !ok || s.expired(rel, fosite.AuthorizeCode) {
+		return nil, fosite.ErrNotFound
+	}
+	return rel, nil
+}
+
+func (s *ShardedMemoryStore) DeletePKCERequestSession(_ context.Context, code string) error {
+	sh := s.shard(code)
+	sh.Lock()
+	defer sh.Unlock()
+
+	delete(sh.pkces, code)
+	return nil
+}
+
+func (s *ShardedMemoryStore) CreateAccessTokenSession(_ context.Context, signature string, req fosite.Requester) error {
+	sh := s.shard(signature)
+	sh.Lock()
+	sh.accessTokens[signature] = req
+	sh.Unlock()
+
+	ix := s.shard(req.GetID())
+	ix.Lock()
+	ix.accessTokenRequestIDs[req.GetID()] = signature
+	ix.Unlock()
+	return nil
+}
+
+func (s *ShardedMemoryStore) GetAccessTokenSession(_ context.Context, signature string, _ fosite.Session) (fosite.Requester, error) {
+	sh := s.shard(signature)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	rel, ok := sh.accessTokens[signature]
+	if !ok || s.expired(rel, fosite.AccessToken) {
+		return nil, fosite.ErrNotFound
+	}
+	return rel, nil
+}
+
+func (s *ShardedMemoryStore) DeleteAccessTokenSession(_ context.Context, signature string) error {
+	sh := s.shard(signature)
+	sh.Lock()
+	defer sh.Unlock()
+
+	delete(sh.accessTokens, signature)
+	return nil
+}
+
+func (s *ShardedMemoryStore) CreateRefreshTokenSession(_ context.Context, signature string, req fosite.Requester) error {
+	sh := s.shard(signature)
+	sh.Lock()
+	sh.refreshTokens[signature] = StoreRefreshToken{active: true, Requester: req}
+	sh.Unlock()
+
+	ix := s.shard(req.GetID())
+	ix.Lock()
+	ix.refreshTokenRequestIDs[req.GetID()] = signature
+	ix.Unlock()
+	return nil
+}
+
+func (s *ShardedMemoryStore) GetRefreshTokenSession(_ context.Context, signature string, _ fosite.Session) (fosite.Requester, error) {
+	sh := s.shard(signature)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	rel, ok := sh.refreshTokens[signature]
+	if !ok || s.expired(rel.Requester, fosite.RefreshToken) {
+		return nil, fosite.ErrNotFound
+	}
+	if !rel.active {
+		return rel, fosite.ErrInactiveToken
+	}
+	return rel, nil
+}
+
+func (s *ShardedMemoryStore) DeleteRefreshTokenSession(_ context.Context, signature string) error {
+	sh := s.shard(signature)
+	sh.Lock()
+	defer sh.Unlock()
+
+	delete(sh.refreshTokens, signature)
+	return nil
+}
+
+// requestSignature looks up the signature of the request's access or refresh token in the request ID index.
+func (s *ShardedMemoryStore) requestSignature(requestID string, refresh bool) (string, bool) {
+	ix := s.shard(requestID)
+	ix.RLock()
+	defer ix.RUnlock()
+
+	if refresh {
+		signature, ok := ix.refreshTokenRequestIDs[requestID]
+		return signature, ok
+	}
+	signature, ok := ix.accessTokenRequestIDs[requestID]
+	return signature, ok
+}
+
+func (s *ShardedMemoryStore) RevokeRefreshToken(_ context.Context, requestID string) error {
+	signature, ok := s.requestSignature(requestID, true)
+	if !ok {
+		return nil
+	}
+
+	sh := s.shard(signature)
+	sh.Lock()
+	defer sh.Unlock()
+
+	rel, ok := sh.refreshTokens[signature]
+	if !ok {
+		return fosite.ErrNotFound
+	}
+	rel.active = false
+	sh.refreshTokens[signature] = rel
+	return nil
+}
+
+func (s *ShardedMemoryStore) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, _ string) error {
+	// no configuration option is available; grace period is not available with memory store
+	return s.RevokeRefreshToken(ctx, requestID)
+}
+
+func (s *ShardedMemoryStore) RevokeAccessToken(ctx context.Context, requestID string) error {
+	if signature, ok := s.requestSignature(requestID, false); ok {
+		return s.DeleteAccessTokenSession(ctx, signature)
+	}
+	return nil
+}
+
+// RevokeTokens revokes the access tokens, refresh tokens, authorize codes and PKCE sessions of all requests matching
+// the filter. The store keeps no indexes for the filter, so all shards are scanned.
+func (s *ShardedMemoryStore) RevokeTokens(_ context.Context, filter fosite.RevocationFilter) ([]string, error) {
+	revoked := map[string]struct{}{}
+	for _, sh := range s.shards {
+		sh.Lock()
+		for signature, req := range sh.accessTokens {
+			if filter.Matches(req) {
+				delete(sh.accessTokens, signature)
+				revoked[req.GetID()] = struct{}{}
+			}
+		}
+		for signature, rel := range sh.refreshTokens {
+			if rel.active && filter.Matches(rel.Requester) {
+				rel.active = false
+				sh.refreshTokens[signature] = rel
+				revoked[rel.GetID()] = struct{}{}
+			}
+		}
+		for code, rel := range sh.authorizeCodes {
+			if rel.active && filter.Matches(rel.Requester) {
+				rel.active = false
+				sh.authorizeCodes[code] = rel
+				revoked[rel.GetID()] = struct{}{}
+			}
+		}
+		for code, req := range sh.pkces {
+			if filter.Matches(req) {
+				delete(sh.pkces, code)
+				revoked[req.GetID()] = struct{}{}
+			}
+		}
+		sh.Unlock()
+	}
+
+	requestIDs := make([]string, 0, len(revoked))
+	for id := range revoked {
+		requestIDs = append(requestIDs, id)
+	}
+	return requestIDs, nil
+}
+
+func (s *ShardedMemoryStore) GetPublicKey(_ context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	if issuerKeys, ok := s.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if keyScopes, ok := subKeys.Keys[keyId]; ok {
+				return keyScopes.Key, nil
+			}
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+func (s *ShardedMemoryStore) GetPublicKeys(_ context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	if issuerKeys, ok := s.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if len(subKeys.Keys) == 0 {
+				return nil, fosite.ErrNotFound
+			}
+
+			keys := make([]jose.JSONWebKey, 0, len(subKeys.Keys))
+			for _, keyScopes := range subKeys.Keys {
+				keys = append(keys, *keyScopes.Key)
+			}
+
+			return &jose.JSONWebKeySet{Keys: keys}, nil
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+func (s *ShardedMemoryStore) GetPublicKeyScopes(_ context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	if issuerKeys, ok := s.IssuerPublicKeys[issuer]; ok {
+		if subKeys, ok := issuerKeys.KeysBySub[subject]; ok {
+			if keyScopes, ok := subKeys.Keys[keyId]; ok {
+				return keyScopes.Scopes, nil
+			}
+		}
+	}
+
+	return nil, fosite.ErrNotFound
+}
+
+func (s *ShardedMemoryStore) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	if err := s.ClientAssertionJWTValid(ctx, jti); err != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *ShardedMemoryStore) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	return s.SetClientAssertionJWT(ctx, jti, exp)
+}
+
+// CreatePARSession stores the pushed authorization request context. The requestURI is used to derive the key.
+func (s *ShardedMemoryStore) CreatePARSession(_ context.Context, requestURI string, request fosite.AuthorizeRequester) error {
+	sh := s.shard(requestURI)
+	sh.Lock()
+	defer sh.Unlock()
+
+	sh.parSessions[requestURI] = request
+	return nil
+}
+
+// GetPARSession gets the push authorization request context.
+func (s *ShardedMemoryStore) GetPARSession(_ context.Context, requestURI string) (fosite.AuthorizeRequester, error) {
+	sh := s.shard(requestURI)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	r, ok := sh.parSessions[requestURI]
+	if !ok || s.expired(r, fosite.PushedAuthorizeRequestContext) {
+		return nil, fosite.ErrNotFound
+	}
+	return r, nil
+}
+
+// DeletePARSession deletes the context.
+func (s *ShardedMemoryStore) DeletePARSession(_ context.Context, requestURI string) error {
+	sh := s.shard(requestURI)
+	sh.Lock()
+	defer sh.Unlock()
+
+	delete(sh.parSessions, requestURI)
+	return nil
+}
+
+// PurgeExpired removes expired entries shard by shard, and then the request ID index entries of tokens which no longer
+// exist.
+func (s *ShardedMemoryStore) PurgeExpired() PurgeStats {
+	var stats PurgeStats
+	now := s.now()
+
+	for _, sh := range s.shards {
+		sh.Lock()
+		for code, rel := range sh.authorizeCodes {
+			if isExpired(rel.Requester, fosite.AuthorizeCode, now) {
+				delete(sh.authorizeCodes, code)
+				stats.AuthorizeCodes++
+			}
+		}
+		for code, req := range sh.idSessions {
+			if isExpired(req, fosite.AuthorizeCode, now) {
+				delete(sh.idSessions, code)
+				stats.IDSessions++
+			}
+		}
+		for signature, req := range sh.accessTokens {
+			if isExpired(req, fosite.AccessToken, now) {
+				delete(sh.accessTokens, signature)
+				stats.AccessTokens++
+			}
+		}
+		for signature, rel := range sh.refreshTokens {
+			if isExpired(rel.Requester, fosite.RefreshToken, now) {
+				delete(sh.refreshTokens, signature)
+				stats.RefreshTokens++
+			}
+		}
+		for code, req := range sh.pkces {
+			if isExpired(req, fosite.AuthorizeCode, now) {
+				delete(sh.pkces, code)
+				stats.PKCES++
+			}
+		}
+		for uri, req := range sh.parSessions {
+			if isExpired(req, fosite.PushedAuthorizeRequestContext, now) {
+				delete(sh.parSessions, uri)
+				stats.PARSessions++
+			}
+		}
+		for jti, exp := range sh.blacklistedJTIs {
+			if exp.Before(now) {
+				delete(sh.blacklistedJTIs, jti)
+				stats.BlacklistedJTIs++
+			}
+		}
+		for jti, exp := range sh.revokedJWTs {
+			if exp.Before(now) {
+				delete(sh.revokedJWTs, jti)
+				stats.RevokedJWTs++
+			}
+		}
+		sh.Unlock()
+	}
+
+	for _, ix := range s.shards {
+		stats.RequestIDs += s.purgeRequestIDs(ix, false) + s.purgeRequestIDs(ix, true)
+	}
+	return stats
+}
+
+// purgeRequestIDs removes the access or refresh token request ID index entries of the shard whose tokens no longer
+// exist. The index is copied first, so only one shard is locked at a time.
+func (s *ShardedMemoryStore) purgeRequestIDs(ix *memoryShard, refresh bool) int {
+	ix.RLock()
+	index := ix.accessTokenRequestIDs
+	if refresh {
+		index = ix.refreshTokenRequestIDs
+	}
+	signatures := make(map[string]string, len(index))
+	for id, signature := range index {
+		signatures[id] = signature
+	}
+	ix.RUnlock()
+
+	var orphans []string
+	for id, signature := range signatures {
+		sh := s.shard(signature)
+		sh.RLock()
+		_, ok := sh.accessTokens[signature]
+		if refresh {
+			_, ok = sh.refreshTokens[signature]
+		}
+		sh.RUnlock()
+		if !ok {
+			orphans = append(orphans, id)
+		}
+	}
+
+	ix.Lock()
+	defer ix.Unlock()
+	var purged int
+	for _, id := range orphans {
+		// the request may have been issued a new token in the meantime
+		if index[id] == signatures[id] {
+			delete(index, id)
+			purged++
+		}
+	}
+	return purged
+}
@@ -0,0 +1,192 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/handler/rfc7523"
+	"github.com/ory/fosite/storage"
+)
+
+var (
+	_ oauth2.CoreStorage                                  = (*storage.ShardedMemoryStore)(nil)
+	_ oauth2.TokenRevocationStorage                       = (*storage.ShardedMemoryStore)(nil)
+	_ oauth2.ResourceOwnerPasswordCredentialsGrantStorage = (*storage.ShardedMemoryStore)(nil)
+	_ oauth2.JWTRevocationStorage                         = (*storage.ShardedMemoryStore)(nil)
+	_ openid.OpenIDConnectRequestStorage                  = (*storage.ShardedMemoryStore)(nil)
+	_ pkce.PKCERequestStorage                             = (*storage.ShardedMemoryStore)(nil)
+	_ rfc7523.RFC7523KeyStorage                           = (*storage.ShardedMemoryStore)(nil)
+)
+
+func newShardedRequest(id, subject string, exp time.Time) *fosite.Request {
+	session := &fosite.DefaultSession{Subject: subject}
+	session.SetExpiresAt(fosite.AccessToken, exp)
+	session.SetExpiresAt(fosite.RefreshToken, exp)
+	session.SetExpiresAt(fosite.AuthorizeCode, exp)
+	return &fosite.Request{ID: id, Client: &fosite.DefaultClient{ID: "client"}, Session: session}
+}
+
+func TestShardedMemoryStore_RevokeTokens(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewShardedMemoryStore(4)
+	exp := time.Now().Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		subject := "peter"
+		if i%2 == 1 {
+			subject = "alice"
+		}
+		id := fmt.Sprintf("request-%d", i)
+		req := newShardedRequest(id, subject, exp)
+		_ = s.CreateAccessTokenSession(ctx, "access-"+id, req)
+		_ = s.CreateRefreshTokenSession(ctx, "refresh-"+id, req)
+		_ = s.CreateAuthorizeCodeSession(ctx, "code-"+id, req)
+		_ = s.CreatePKCERequestSession(ctx, "code-"+id, req)
+	}
+
+	ids, err := s.RevokeTokens(ctx, fosite.RevocationFilter{Subject: "peter"})
+	if err != nil {
+		t.Fatalf("RevokeTokens() error = %v", err)
+	}
+	sort.Strings(ids)
+	if fmt.Sprint(ids) != "[request-0 request-2 request-4 request-6 request-8]" {
+		t.Errorf("RevokeTokens() = %v, want the requests of peter", ids)
+	}
+
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("request-%d", i)
+		_, accessErr := s.GetAccessTokenSession(ctx, "access-"+id, nil)
+		_, refreshErr := s.GetRefreshTokenSession(ctx, "refresh-"+id, nil)
+		_, codeErr := s.GetAuthorizeCodeSession(ctx, "code-"+id, nil)
+		_, pkceErr := s.GetPKCERequestSession(ctx, "code-"+id, nil)
+		if i%2 == 1 {
+			if accessErr != nil || refreshErr != nil || codeErr != nil || pkceErr != nil {
+				t.Errorf("%s: tokens of alice were revoked: %v, %v, %v, %v", id, accessErr, refreshErr, codeErr, pkceErr)
+			}
+			continue
+		}
+		if !errors.Is(accessErr, fosite.ErrNotFound) || !errors.Is(refreshErr, fosite.ErrInactiveToken) ||
+			!errors.Is(codeErr, fosite.ErrInvalidatedAuthorizeCode) || !errors.Is(pkceErr, fosite.ErrNotFound) {
+			t.Errorf("%s: tokens of peter were not revoked: %v, %v, %v, %v", id, accessErr, refreshErr, codeErr, pkceErr)
+		}
+	}
+}
+
+func TestShardedMemoryStore_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := storage.NewShardedMemoryStore(4)
+	s.Clock = fosite.FixedClock(now)
+
+	for i, exp := range []time.Time{now.Add(-time.Minute), now.Add(time.Minute)} {
+		id := fmt.Sprintf("request-%d", i)
+		req := newShardedRequest(id, "peter", exp)
+		_ = s.CreateAccessTokenSession(ctx, "access-"+id, req)
+		_ = s.CreateRefreshTokenSession(ctx, "refresh-"+id, req)
+		_ = s.CreateAuthorizeCodeSession(ctx, "code-"+id, req)
+		_ = s.SetClientAssertionJWT(ctx, "jti-"+id, exp)
+	}
+
+	want := storage.PurgeStats{AccessTokens: 1, RefreshTokens: 1, AuthorizeCodes: 1, BlacklistedJTIs: 1, RequestIDs: 2}
+	if stats := s.PurgeExpired(); stats != want {
+		t.Errorf("PurgeExpired() = %+v, want %+v", stats, want)
+	}
+	if stats := s.PurgeExpired(); stats.Total() != 0 {
+		t.Errorf("PurgeExpired() = %+v, want nothing to purge", stats)
+	}
+	if _, err := s.GetAccessTokenSession(ctx, "access-request-1", nil); err != nil {
+		t.Errorf("GetAccessTokenSession() error = %v for a valid token", err)
+	}
+	if err := s.RevokeAccessToken(ctx, "request-1"); err != nil {
+		t.Fatalf("RevokeAccessToken() error = %v", err)
+	}
+	if _, err := s.GetAccessTokenSession(ctx, "access-request-1", nil); !errors.Is(err, fosite.ErrNotFound) {
+		t.Errorf("GetAccessTokenSession() error = %v after revocation, wantErr %v", err, fosite.ErrNotFound)
+	}
+}
+
+type benchmarkStore interface {
+	oauth2.AccessTokenStorage
+	oauth2.RefreshTokenStorage
+}
+
+func benchmarkStores() map[string]func() benchmarkStore {
+	return map[string]func() benchmarkStore{
+		"store=MemoryStore":        func() benchmarkStore { return storage.NewMemoryStore() },
+		"store=ShardedMemoryStore": func() benchmarkStore { return storage.NewShardedMemoryStore(0) },
+	}
+}
+
+// BenchmarkParallelIssuance stores an access and a refresh token per operation, like the token endpoint.
+func BenchmarkParallelIssuance(b *testing.B) {
+	for name, newStore := range benchmarkStores() {
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			s := newStore()
+			exp := time.Now().Add(time.Hour)
+			var n int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := fmt.Sprintf("request-%d", atomic.AddInt64(&n, 1))
+					req := newShardedRequest(id, "peter", exp)
+					if err := s.CreateAccessTokenSession(ctx, "access-"+id, req); err != nil {
+						b.Fatal(err)
+					}
+					if err := s.CreateRefreshTokenSession(ctx, "refresh-"+id, req); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkParallelIntrospection reads access tokens while one in ten operations issues a new token.
+func BenchmarkParallelIntrospection(b *testing.B) {
+	const tokens = 10000
+
+	for name, newStore := range benchmarkStores() {
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			s := newStore()
+			exp := time.Now().Add(time.Hour)
+			for i := 0; i < tokens; i++ {
+				id := fmt.Sprintf("request-%d", i)
+				_ = s.CreateAccessTokenSession(ctx, "access-"+id, newShardedRequest(id, "peter", exp))
+			}
+			var n int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddInt64(&n, 1)
+					if i%10 == 0 {
+						id := fmt.Sprintf("new-request-%d", i)
+						if err := s.CreateAccessTokenSession(ctx, "access-"+id, newShardedRequest(id, "peter", exp)); err != nil {
+							b.Fatal(err)
+						}
+						continue
+					}
+					if _, err := s.GetAccessTokenSession(ctx, fmt.Sprintf("access-request-%d", i%tokens), nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,549 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+)
+
+// RequestCodec serializes the requests of a snapshot. It is implemented by *codec.Codec from the storage/codec
+// package, which should be created with the store as its fosite.ClientManager, so that restored requests refer to
+// the restored clients.
+type RequestCodec interface {
+	Encode(r fosite.Requester) ([]byte, error)
+	Decode(ctx context.Context, data []byte, session fosite.Session) (fosite.Requester, error)
+}
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion = 1
+
+// snapshotClientTypes are the client types a snapshot can hold, by the name stored in the snapshot.
+var snapshotClientTypes = map[string]func() fosite.Client{
+	"fosite.DefaultClient":                         func() fosite.Client { return new(fosite.DefaultClient) },
+	"fosite.DefaultOpenIDConnectClient":            func() fosite.Client { return new(fosite.DefaultOpenIDConnectClient) },
+	"fosite.DefaultClientWithCustomTokenLifespans": func() fosite.Client { return new(fosite.DefaultClientWithCustomTokenLifespans) },
+	"fosite.DefaultResponseModeClient":             func() fosite.Client { return new(fosite.DefaultResponseModeClient) },
+	"fosite.DefaultRedirectURIProfileClient":       func() fosite.Client { return new(fosite.DefaultRedirectURIProfileClient) },
+}
+
+type memorySnapshot struct {
+	Version                 int                           `json:"version"`
+	Clients                 map[string]snapshotClient     `json:"clients"`
+	Users                   map[string]MemoryUserRelation `json:"users"`
+	IssuerPublicKeys        map[string]IssuerPublicKeys   `json:"issuer_public_keys"`
+	AuthorizeCodes          map[string]snapshotRequest    `json:"authorize_codes"`
+	IDSessions              map[string][]byte             `json:"id_sessions"`
+	AccessTokens            map[string][]byte             `json:"access_tokens"`
+	RefreshTokens           map[string]snapshotRequest    `json:"refresh_tokens"`
+	PKCES                   map[string][]byte             `json:"pkces"`
+	PARSessions             map[string][]byte             `json:"par_sessions"`
+	BlacklistedJTIs         map[string]time.Time          `json:"blacklisted_jtis"`
+	RevokedJWTs             map[string]time.Time          `json:"revoked_jwts"`
+	AccessTokenRequestIDs   map[string]string             `json:"access_token_request_ids"`
+	RefreshTokenRequestIDs  map[string]string             `json:"refresh_token_request_ids"`
+	AuthorizeCodeRequestIDs map[string]string             `json:"authorize_code_request_ids"`
+	PKCERequestIDs          map[string]string             `json:"pkce_request_ids"`
+}
+
+type snapshotClient struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// snapshotRequest is a request of an authorize code or refresh token, which can be inactive.
+type snapshotRequest struct {
+	Active  bool   `json:"active"`
+	Request []byte `json:"request"`
+}
+
+// Save writes a snapshot of all clients, users, issuer public keys, tokens, sessions and JTIs to the writer. Every map
+// is copied while it is locked, so the store can be used while it is saved. Only the client types of fosite can be
+// saved.
+func (s *MemoryStore) Save(w io.Writer, codec RequestCodec) error {
+	snapshot := memorySnapshot{Version: snapshotVersion}
+
+	var err error
+	s.clientsMutex.RLock()
+	snapshot.Clients, err = encodeSnapshotClients(s.Clients)
+	s.clientsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.usersMutex.RLock()
+	snapshot.Users = copyUsers(s.Users)
+	s.usersMutex.RUnlock()
+
+	s.issuerPublicKeysMutex.RLock()
+	snapshot.IssuerPublicKeys = copyIssuerPublicKeys(s.IssuerPublicKeys)
+	s.issuerPublicKeysMutex.RUnlock()
+
+	s.authorizeCodesMutex.RLock()
+	snapshot.AuthorizeCodes = make(map[string]snapshotRequest, len(s.AuthorizeCodes))
+	for code, rel := range s.AuthorizeCodes {
+		if snapshot.AuthorizeCodes[code], err = encodeSnapshotRequest(codec, rel.active, rel.Requester); err != nil {
+			break
+		}
+	}
+	s.authorizeCodesMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.idSessionsMutex.RLock()
+	snapshot.IDSessions, err = encodeSnapshotRequests(codec, s.IDSessions)
+	s.idSessionsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.accessTokenRequestIDsMutex.RLock()
+	s.accessTokensMutex.RLock()
+	snapshot.AccessTokens, err = encodeSnapshotRequests(codec, s.AccessTokens)
+	snapshot.AccessTokenRequestIDs = copyStrings(s.AccessTokenRequestIDs)
+	s.accessTokensMutex.RUnlock()
+	s.accessTokenRequestIDsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.refreshTokenRequestIDsMutex.RLock()
+	s.refreshTokensMutex.RLock()
+	snapshot.RefreshTokens = make(map[string]snapshotRequest, len(s.RefreshTokens))
+	for signature, rel := range s.RefreshTokens {
+		if snapshot.RefreshTokens[signature], err = encodeSnapshotRequest(codec, rel.active, rel.Requester); err != nil {
+			break
+		}
+	}
+	snapshot.RefreshTokenRequestIDs = copyStrings(s.RefreshTokenRequestIDs)
+	s.refreshTokensMutex.RUnlock()
+	s.refreshTokenRequestIDsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.pkcesMutex.RLock()
+	snapshot.PKCES, err = encodeSnapshotRequests(codec, s.PKCES)
+	s.pkcesMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.parSessionsMutex.RLock()
+	snapshot.PARSessions = make(map[string][]byte, len(s.PARSessions))
+	for uri, req := range s.PARSessions {
+		if snapshot.PARSessions[uri], err = codec.Encode(req); err != nil {
+			break
+		}
+	}
+	s.parSessionsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.blacklistedJTIsMutex.RLock()
+	snapshot.BlacklistedJTIs = copyTimes(s.BlacklistedJTIs)
+	s.blacklistedJTIsMutex.RUnlock()
+
+	s.revokedJWTsMutex.RLock()
+	snapshot.RevokedJWTs = copyTimes(s.RevokedJWTs)
+	s.revokedJWTsMutex.RUnlock()
+
+	s.requestIndexMutex.RLock()
+	snapshot.AuthorizeCodeRequestIDs = copyStrings(s.AuthorizeCodeRequestIDs)
+	snapshot.PKCERequestIDs = copyStrings(s.PKCERequestIDs)
+	s.requestIndexMutex.RUnlock()
+
+	return errors.WithStack(json.NewEncoder(w).Encode(snapshot))
+}
+
+// snapshotClientsKey is the context key of the clients Load decodes, see snapshotClient.
+type snapshotClientsKey struct{}
+
+// snapshotClients are the clients of a snapshot which is being loaded into the store.
+type snapshotClients struct {
+	store   *MemoryStore
+	clients map[string]fosite.Client
+}
+
+// snapshotClient returns the client of the snapshot being loaded into the store, if GetClient is called by a codec
+// decoding the requests of the snapshot.
+func (s *MemoryStore) snapshotClient(ctx context.Context, id string) (fosite.Client, bool) {
+	loading, ok := ctx.Value(snapshotClientsKey{}).(*snapshotClients)
+	if !ok || loading.store != s {
+		return nil, false
+	}
+	cl, ok := loading.clients[id]
+	return cl, ok
+}
+
+// Load replaces the contents of the store with a snapshot written by Save. The whole snapshot is decoded before the
+// store is changed, so the store is left unchanged if loading fails. While the requests are decoded, a codec using the
+// store as its fosite.ClientManager finds the clients of the snapshot.
+func (s *MemoryStore) Load(ctx context.Context, r io.Reader, codec RequestCodec) error {
+	var snapshot memorySnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return errors.WithStack(err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return errors.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	loaded := NewMemoryStore()
+	var err error
+	if loaded.Clients, err = decodeSnapshotClients(snapshot.Clients); err != nil {
+		return err
+	}
+	loaded.Users = copyUsers(snapshot.Users)
+	loaded.IssuerPublicKeys = copyIssuerPublicKeys(snapshot.IssuerPublicKeys)
+
+	ctx = context.WithValue(ctx, snapshotClientsKey{}, &snapshotClients{store: s, clients: loaded.Clients})
+	for code, rel := range snapshot.AuthorizeCodes {
+		req, err := codec.Decode(ctx, rel.Request, nil)
+		if err != nil {
+			return err
+		}
+		loaded.AuthorizeCodes[code] = StoreAuthorizeCode{active: rel.Active, Requester: req}
+	}
+	if loaded.IDSessions, err = decodeSnapshotRequests(ctx, codec, snapshot.IDSessions); err != nil {
+		return err
+	}
+	if loaded.AccessTokens, err = decodeSnapshotRequests(ctx, codec, snapshot.AccessTokens); err != nil {
+		return err
+	}
+	for signature, rel := range snapshot.RefreshTokens {
+		req, err := codec.Decode(ctx, rel.Request, nil)
+		if err != nil {
+			return err
+		}
+		loaded.RefreshTokens[signature] = StoreRefreshToken{active: rel.Active, Requester: req}
+	}
+	if loaded.PKCES, err = decodeSnapshotRequests(ctx, codec, snapshot.PKCES); err != nil {
+		return err
+	}
+	for uri, data := range snapshot.PARSessions {
+		req, err := codec.Decode(ctx, data, nil)
+		if err != nil {
+			return err
+		}
+		ar, ok := req.(fosite.AuthorizeRequester)
+		if !ok {
+			return errors.Errorf("the pushed authorization request %q is not an authorize request", uri)
+		}
+		loaded.PARSessions[uri] = ar
+	}
+	loaded.BlacklistedJTIs = copyTimes(snapshot.BlacklistedJTIs)
+	loaded.RevokedJWTs = copyTimes(snapshot.RevokedJWTs)
+	loaded.AccessTokenRequestIDs = copyStrings(snapshot.AccessTokenRequestIDs)
+	loaded.RefreshTokenRequestIDs = copyStrings(snapshot.RefreshTokenRequestIDs)
+
+	// rebuild the indexes used by RevokeTokens
+	for code, rel := range loaded.AuthorizeCodes {
+		if snapshot.AuthorizeCodeRequestIDs[rel.GetID()] == code {
+			loaded.indexRequest(rel.Requester, func() { loaded.AuthorizeCodeRequestIDs[rel.GetID()] = code })
+		}
+	}
+	for code, req := range loaded.PKCES {
+		if snapshot.PKCERequestIDs[req.GetID()] == code {
+			loaded.indexRequest(req, func() { loaded.PKCERequestIDs[req.GetID()] = code })
+		}
+	}
+	for _, req := range loaded.AccessTokens {
+		loaded.indexRequest(req, nil)
+	}
+	for _, rel := range loaded.RefreshTokens {
+		loaded.indexRequest(rel.Requester, nil)
+	}
+
+	s.clientsMutex.Lock()
+	s.Clients = loaded.Clients
+	s.clientsMutex.Unlock()
+
+	s.usersMutex.Lock()
+	s.Users = loaded.Users
+	s.usersMutex.Unlock()
+
+	s.issuerPublicKeysMutex.Lock()
+	s.IssuerPublicKeys = loaded.IssuerPublicKeys
+	s.issuerPublicKeysMutex.Unlock()
+
+	s.authorizeCodesMutex.Lock()
+	s.AuthorizeCodes = loaded.AuthorizeCodes
+	s.authorizeCodesMutex.Unlock()
+
+	s.idSessionsMutex.Lock()
+	s.IDSessions = loaded.IDSessions
+	s.idSessionsMutex.Unlock()
+
+	s.accessTokenRequestIDsMutex.Lock()
+	s.accessTokensMutex.Lock()
+	s.AccessTokens = loaded.AccessTokens
+	s.AccessTokenRequestIDs = loaded.AccessTokenRequestIDs
+	s.accessTokensMutex.Unlock()
+	s.accessTokenRequestIDsMutex.Unlock()
+
+	s.refreshTokenRequestIDsMutex.Lock()
+	s.refreshTokensMutex.Lock()
+	s.RefreshTokens = loaded.RefreshTokens
+	s.RefreshTokenRequestIDs = loaded.RefreshTokenRequestIDs
+	s.refreshTokensMutex.Unlock()
+	s.refreshTokenRequestIDsMutex.Unlock()
+
+	s.pkcesMutex.Lock()
+	s.PKCES = loaded.PKCES
+	s.pkcesMutex.Unlock()
+
+	s.parSessionsMutex.Lock()
+	s.PARSessions = loaded.PARSessions
+	s.parSessionsMutex.Unlock()
+
+	s.blacklistedJTIsMutex.Lock()
+	s.BlacklistedJTIs = loaded.BlacklistedJTIs
+	s.blacklistedJTIsMutex.Unlock()
+
+	s.revokedJWTsMutex.Lock()
+	s.RevokedJWTs = loaded.RevokedJWTs
+	s.revokedJWTsMutex.Unlock()
+
+	s.requestIndexMutex.Lock()
+	s.AuthorizeCodeRequestIDs = loaded.AuthorizeCodeRequestIDs
+	s.PKCERequestIDs = loaded.PKCERequestIDs
+	s.Requests = loaded.Requests
+	s.RequestIDsBySubject = loaded.RequestIDsBySubject
+	s.RequestIDsByClientID = loaded.RequestIDsByClientID
+	s.RequestIDsBySessionID = loaded.RequestIDsBySessionID
+	s.requestIndexMutex.Unlock()
+	return nil
+}
+
+// SaveFile saves a snapshot to the file. The snapshot is written to a temporary file in the same directory, which
+// replaces the file once it has been synced to disk, so a crash never leaves a partially written snapshot behind.
+func (s *MemoryStore) SaveFile(path string, codec RequestCodec) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := s.Save(f, codec); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(f.Name(), path))
+}
+
+// LoadFile loads a snapshot saved by SaveFile. A missing file is not an error, the store is left unchanged.
+func (s *MemoryStore) LoadFile(ctx context.Context, path string, codec RequestCodec) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	return s.Load(ctx, f, codec)
+}
+
+// Autosaver periodically saves snapshots of a MemoryStore to a file.
+type Autosaver struct {
+	// Interval is the time between two snapshots. Defaults to one minute.
+	Interval time.Duration
+
+	// OnError is called if a snapshot can not be saved. Errors are ignored if it is nil.
+	OnError func(error)
+
+	store *MemoryStore
+	path  string
+	codec RequestCodec
+
+	m    sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewAutosaver(store *MemoryStore, path string, codec RequestCodec, interval time.Duration) *Autosaver {
+	return &Autosaver{store: store, path: path, codec: codec, Interval: interval}
+}
+
+// Start starts saving snapshots in the background. It does nothing if the autosaver is running already.
+func (a *Autosaver) Start() {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.stop != nil {
+		return
+	}
+
+	interval := a.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.run(interval, a.stop, a.done)
+}
+
+func (a *Autosaver) run(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.save()
+		}
+	}
+}
+
+func (a *Autosaver) save() {
+	if err := a.store.SaveFile(a.path, a.codec); err != nil && a.OnError != nil {
+		a.OnError(err)
+	}
+}
+
+// Stop stops saving in the background and saves a final snapshot, so no changes are lost on shutdown. It does nothing
+// if the autosaver is not running.
+func (a *Autosaver) Stop() {
+	a.m.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.m.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	a.save()
+}
+
+func encodeSnapshotClients(clients map[string]fosite.Client) (map[string]snapshotClient, error) {
+	encoded := make(map[string]snapshotClient, len(clients))
+	for id, client := range clients {
+		var name string
+		for n, newClient := range snapshotClientTypes {
+			if reflect.TypeOf(newClient()) == reflect.TypeOf(client) {
+				name = n
+				break
+			}
+		}
+		if name == "" {
+			return nil, errors.Errorf("unable to save client %q of unsupported type %T", id, client)
+		}
+
+		data, err := json.Marshal(client)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		encoded[id] = snapshotClient{Type: name, Data: data}
+	}
+	return encoded, nil
+}
+
+func decodeSnapshotClients(encoded map[string]snapshotClient) (map[string]fosite.Client, error) {
+	clients := make(map[string]fosite.Client, len(encoded))
+	for id, c := range encoded {
+		newClient, ok := snapshotClientTypes[c.Type]
+		if !ok {
+			return nil, errors.Errorf("unable to load client %q of unsupported type %q", id, c.Type)
+		}
+
+		client := newClient()
+		if err := json.Unmarshal(c.Data, client); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		clients[id] = client
+	}
+	return clients, nil
+}
+
+func encodeSnapshotRequest(codec RequestCodec, active bool, req fosite.Requester) (snapshotRequest, error) {
+	data, err := codec.Encode(req)
+	if err != nil {
+		return snapshotRequest{}, err
+	}
+	return snapshotRequest{Active: active, Request: data}, nil
+}
+
+func encodeSnapshotRequests(codec RequestCodec, requests map[string]fosite.Requester) (map[string][]byte, error) {
+	encoded := make(map[string][]byte, len(requests))
+	for key, req := range requests {
+		data, err := codec.Encode(req)
+		if err != nil {
+			return nil, err
+		}
+		encoded[key] = data
+	}
+	return encoded, nil
+}
+
+func decodeSnapshotRequests(ctx context.Context, codec RequestCodec, encoded map[string][]byte) (map[string]fosite.Requester, error) {
+	requests := make(map[string]fosite.Requester, len(encoded))
+	for key, data := range encoded {
+		req, err := codec.Decode(ctx, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		requests[key] = req
+	}
+	return requests, nil
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyTimes(m map[string]time.Time) map[string]time.Time {
+	c := make(map[string]time.Time, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyUsers(m map[string]MemoryUserRelation) map[string]MemoryUserRelation {
+	c := make(map[string]MemoryUserRelation, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyIssuerPublicKeys(m map[string]IssuerPublicKeys) map[string]IssuerPublicKeys {
+	c := make(map[string]IssuerPublicKeys, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
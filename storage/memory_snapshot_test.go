@@ -0,0 +1,229 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/storage/codec"
+	"github.com/ory/fosite/storage/storagetest"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func newSnapshotRequest(id, clientID string) *fosite.AuthorizeRequest {
+	ar := fosite.NewAuthorizeRequest()
+	ar.ID = id
+	ar.RequestedAt = time.Now().UTC().Truncate(time.Second)
+	ar.Client = &fosite.DefaultClient{ID: clientID}
+	ar.RequestedScope = fosite.Arguments{"openid", "offline"}
+	ar.GrantedScope = fosite.Arguments{"openid"}
+	ar.Form = url.Values{"foo": {"bar"}}
+	ar.ResponseTypes = fosite.Arguments{"code"}
+	ar.RedirectURI, _ = url.Parse("http://localhost:3846/callback")
+	ar.State = "some-state"
+	ar.Session = &openid.DefaultSession{
+		Claims:    &jwt.IDTokenClaims{Subject: "peter", Extra: map[string]interface{}{"sid": "session"}},
+		Headers:   &jwt.Headers{},
+		Subject:   "peter",
+		ExpiresAt: map[fosite.TokenType]time.Time{fosite.AccessToken: ar.RequestedAt.Add(time.Hour)},
+	}
+	return ar
+}
+
+func TestMemoryStore_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey := &jose.JSONWebKey{Key: &key.PublicKey, KeyID: "key", Algorithm: "RS256", Use: "sig"}
+
+	s := storage.NewExampleStore()
+	s.IssuerPublicKeys["issuer"] = storage.IssuerPublicKeys{
+		Issuer: "issuer",
+		KeysBySub: map[string]storage.SubjectPublicKeys{
+			"peter": {Subject: "peter", Keys: map[string]storage.PublicKeyScopes{"key": {Key: publicKey, Scopes: []string{"openid"}}}},
+		},
+	}
+
+	req := newSnapshotRequest("request", "my-client")
+	require.NoError(t, s.CreateAuthorizeCodeSession(ctx, "code", req))
+	require.NoError(t, s.CreateOpenIDConnectSession(ctx, "code", req))
+	require.NoError(t, s.CreatePKCERequestSession(ctx, "code", req))
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access", req))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "refresh", req))
+	require.NoError(t, s.CreatePARSession(ctx, "urn:par", newSnapshotRequest("par-request", "my-client")))
+	require.NoError(t, s.InvalidateAuthorizeCodeSession(ctx, "code"))
+	require.NoError(t, s.CreateRefreshTokenSession(ctx, "revoked", newSnapshotRequest("revoked-request", "my-client")))
+	require.NoError(t, s.RevokeRefreshToken(ctx, "revoked-request"))
+	require.NoError(t, s.SetClientAssertionJWT(ctx, "jti", time.Now().Add(time.Hour)))
+	require.NoError(t, s.RevokeJWT(ctx, "revoked-jti", time.Now().Add(time.Hour)))
+
+	require.NoError(t, s.SaveFile(path, codec.New(s)))
+
+	loaded := storage.NewMemoryStore()
+	require.NoError(t, loaded.LoadFile(ctx, path, codec.New(loaded)))
+
+	t.Run("case=clients and users", func(t *testing.T) {
+		for id, expected := range s.Clients {
+			actual, err := loaded.GetClient(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		}
+		assert.NoError(t, loaded.Authenticate(ctx, "peter", "secret"))
+
+		actual, err := loaded.GetPublicKey(ctx, "issuer", "peter", "key")
+		require.NoError(t, err)
+		assert.Equal(t, "key", actual.KeyID)
+		scopes, err := loaded.GetPublicKeyScopes(ctx, "issuer", "peter", "key")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"openid"}, scopes)
+	})
+
+	t.Run("case=requests", func(t *testing.T) {
+		actual, err := loaded.GetAccessTokenSession(ctx, "access", nil)
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, req, actual)
+		assert.Equal(t, s.Clients["my-client"], actual.GetClient(), "requests must refer to the restored clients")
+
+		actual, err = loaded.GetRefreshTokenSession(ctx, "refresh", nil)
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, req, actual)
+
+		actual, err = loaded.GetOpenIDConnectSession(ctx, "code", nil)
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, req, actual)
+
+		actual, err = loaded.GetPKCERequestSession(ctx, "code", nil)
+		require.NoError(t, err)
+		storagetest.AssertRequestEqual(t, req, actual)
+
+		ar, err := loaded.GetPARSession(ctx, "urn:par")
+		require.NoError(t, err)
+		assert.Equal(t, "par-request", ar.GetID())
+		assert.Equal(t, "some-state", ar.GetState())
+	})
+
+	t.Run("case=inactive tokens stay inactive", func(t *testing.T) {
+		_, err := loaded.GetAuthorizeCodeSession(ctx, "code", nil)
+		assert.ErrorIs(t, err, fosite.ErrInvalidatedAuthorizeCode)
+		_, err = loaded.GetRefreshTokenSession(ctx, "revoked", nil)
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+	})
+
+	t.Run("case=jtis", func(t *testing.T) {
+		assert.ErrorIs(t, loaded.ClientAssertionJWTValid(ctx, "jti"), fosite.ErrJTIKnown)
+		revoked, err := loaded.IsJWTRevoked(ctx, "revoked-jti")
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("case=the revocation indexes are restored", func(t *testing.T) {
+		ids, err := loaded.RevokeTokens(ctx, fosite.RevocationFilter{SessionID: "session"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"request", "revoked-request"}, ids)
+		_, err = loaded.GetAccessTokenSession(ctx, "access", nil)
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+		_, err = loaded.GetPKCERequestSession(ctx, "code", nil)
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=no temporary files are left behind", func(t *testing.T) {
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "store.json", entries[0].Name())
+	})
+}
+
+func TestMemoryStore_SnapshotErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("case=missing files are ignored", func(t *testing.T) {
+		s := storage.NewExampleStore()
+		require.NoError(t, s.LoadFile(ctx, filepath.Join(t.TempDir(), "missing.json"), codec.New(s)))
+		assert.NotEmpty(t, s.Clients)
+	})
+
+	t.Run("case=unsupported client types are rejected", func(t *testing.T) {
+		type customClient struct{ *fosite.DefaultClient }
+		s := storage.NewMemoryStore()
+		s.Clients["custom"] = &customClient{DefaultClient: &fosite.DefaultClient{ID: "custom"}}
+		path := filepath.Join(t.TempDir(), "store.json")
+
+		assert.Error(t, s.SaveFile(path, codec.New(s)))
+		_, err := os.Stat(path)
+		assert.True(t, errors.Is(err, os.ErrNotExist), "failed snapshots must not be written")
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("case=failed loads leave the store unchanged", func(t *testing.T) {
+		src := storage.NewMemoryStore()
+		require.NoError(t, src.CreateAccessTokenSession(ctx, "access", newSnapshotRequest("request", "unknown-client")))
+		var snapshot bytes.Buffer
+		require.NoError(t, src.Save(&snapshot, codec.New(src)))
+
+		s := storage.NewExampleStore()
+		require.NoError(t, s.CreateAccessTokenSession(ctx, "existing", newSnapshotRequest("existing-request", "my-client")))
+		clients := len(s.Clients)
+
+		assert.ErrorIs(t, s.Load(ctx, &snapshot, codec.New(s)), fosite.ErrNotFound, "the client of the request is not in the snapshot")
+		assert.Len(t, s.Clients, clients)
+		assert.NoError(t, s.Authenticate(ctx, "peter", "secret"))
+		_, err := s.GetAccessTokenSession(ctx, "existing", nil)
+		assert.NoError(t, err)
+		_, err = s.GetAccessTokenSession(ctx, "access", nil)
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=unsupported versions are rejected", func(t *testing.T) {
+		s := storage.NewMemoryStore()
+		assert.Error(t, s.Load(ctx, bytes.NewBufferString(`{"version":2}`), codec.New(s)))
+	})
+}
+
+func TestAutosaver(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+	s := storage.NewExampleStore()
+
+	a := storage.NewAutosaver(s, path, codec.New(s), time.Millisecond)
+	a.OnError = func(err error) { t.Errorf("autosave error = %v", err) }
+	a.Start()
+	a.Start()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("the autosaver did not save a snapshot")
+		}
+	}
+
+	require.NoError(t, s.CreateAccessTokenSession(ctx, "access", newSnapshotRequest("request", "my-client")))
+	a.Stop()
+	a.Stop()
+
+	loaded := storage.NewMemoryStore()
+	require.NoError(t, loaded.LoadFile(ctx, path, codec.New(loaded)))
+	_, err := loaded.GetAccessTokenSession(ctx, "access", nil)
+	assert.NoError(t, err, "stopping the autosaver must save a final snapshot")
+}
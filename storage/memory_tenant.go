@@ -0,0 +1,349 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/ory/x/errorsx"
+
+	"github.com/ory/fosite"
+)
+
+// MultiTenantMemoryStore partitions a MemoryStore by the tenant stored in the request context, see
+// fosite.WithTenant. Clients, tokens and all other data of one tenant are invisible to all other tenants. Contexts
+// without a tenant use a partition of their own.
+//
+// Partitions are only created by Tenant, so requests can not grow the store by naming arbitrary tenants. All
+// methods return fosite.ErrNotFound for tenants which were not registered using Tenant.
+type MultiTenantMemoryStore struct {
+	// NewTenantStore creates the store of a tenant when it is first accessed. Defaults to NewMemoryStore.
+	NewTenantStore func(tenant string) *MemoryStore
+
+	m       sync.RWMutex
+	tenants map[string]*MemoryStore
+}
+
+func NewMultiTenantMemoryStore() *MultiTenantMemoryStore {
+	return &MultiTenantMemoryStore{}
+}
+
+// Tenant returns the store of the tenant, creating it if it does not exist yet. Use it to register the tenant's
+// clients and to compose the tenant's handlers.
+func (s *MultiTenantMemoryStore) Tenant(tenant string) *MemoryStore {
+	s.m.RLock()
+	store, ok := s.tenants[tenant]
+	s.m.RUnlock()
+	if ok {
+		return store
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if store, ok := s.tenants[tenant]; ok {
+		return store
+	}
+
+	if s.NewTenantStore != nil {
+		store = s.NewTenantStore(tenant)
+	} else {
+		store = NewMemoryStore()
+	}
+	if s.tenants == nil {
+		s.tenants = make(map[string]*MemoryStore)
+	}
+	s.tenants[tenant] = store
+	return store
+}
+
+// store returns the store of the context's tenant, or an error if the tenant is not registered.
+func (s *MultiTenantMemoryStore) store(ctx context.Context) (*MemoryStore, error) {
+	tenant := fosite.TenantFromContext(ctx)
+	if tenant == "" {
+		return s.Tenant(tenant), nil
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if store, ok := s.tenants[tenant]; ok {
+		return store, nil
+	}
+	return nil, errorsx.WithStack(fosite.ErrNotFound.WithHintf("The tenant '%s' is not registered.", tenant))
+}
+
+func (s *MultiTenantMemoryStore) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreateOpenIDConnectSession(ctx, authorizeCode, requester)
+}
+
+func (s *MultiTenantMemoryStore) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (fosite.Requester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetOpenIDConnectSession(ctx, authorizeCode, requester)
+}
+
+func (s *MultiTenantMemoryStore) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeleteOpenIDConnectSession(ctx, authorizeCode)
+}
+
+func (s *MultiTenantMemoryStore) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetClient(ctx, id)
+}
+
+func (s *MultiTenantMemoryStore) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.ClientAssertionJWTValid(ctx, jti)
+}
+
+func (s *MultiTenantMemoryStore) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.SetClientAssertionJWT(ctx, jti, exp)
+}
+
+func (s *MultiTenantMemoryStore) RevokeJWT(ctx context.Context, jti string, exp time.Time) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.RevokeJWT(ctx, jti, exp)
+}
+
+func (s *MultiTenantMemoryStore) IsJWTRevoked(ctx context.Context, jti string) (bool, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return false, err
+	}
+	return store.IsJWTRevoked(ctx, jti)
+}
+
+func (s *MultiTenantMemoryStore) ListRevokedJWTs(ctx context.Context) ([]string, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListRevokedJWTs(ctx)
+}
+
+func (s *MultiTenantMemoryStore) CreateAuthorizeCodeSession(ctx context.Context, code string, req fosite.Requester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreateAuthorizeCodeSession(ctx, code, req)
+}
+
+func (s *MultiTenantMemoryStore) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetAuthorizeCodeSession(ctx, code, session)
+}
+
+func (s *MultiTenantMemoryStore) InvalidateAuthorizeCodeSession(ctx context.Context, code string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.InvalidateAuthorizeCodeSession(ctx, code)
+}
+
+func (s *MultiTenantMemoryStore) CreatePKCERequestSession(ctx context.Context, code string, req fosite.Requester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreatePKCERequestSession(ctx, code, req)
+}
+
+func (s *MultiTenantMemoryStore) GetPKCERequestSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetPKCERequestSession(ctx, code, session)
+}
+
+func (s *MultiTenantMemoryStore) DeletePKCERequestSession(ctx context.Context, code string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeletePKCERequestSession(ctx, code)
+}
+
+func (s *MultiTenantMemoryStore) CreateAccessTokenSession(ctx context.Context, signature string, req fosite.Requester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreateAccessTokenSession(ctx, signature, req)
+}
+
+func (s *MultiTenantMemoryStore) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetAccessTokenSession(ctx, signature, session)
+}
+
+func (s *MultiTenantMemoryStore) DeleteAccessTokenSession(ctx context.Context, signature string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeleteAccessTokenSession(ctx, signature)
+}
+
+func (s *MultiTenantMemoryStore) CreateRefreshTokenSession(ctx context.Context, signature string, req fosite.Requester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreateRefreshTokenSession(ctx, signature, req)
+}
+
+func (s *MultiTenantMemoryStore) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetRefreshTokenSession(ctx, signature, session)
+}
+
+func (s *MultiTenantMemoryStore) DeleteRefreshTokenSession(ctx context.Context, signature string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeleteRefreshTokenSession(ctx, signature)
+}
+
+func (s *MultiTenantMemoryStore) Authenticate(ctx context.Context, name string, secret string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Authenticate(ctx, name, secret)
+}
+
+func (s *MultiTenantMemoryStore) RevokeRefreshToken(ctx context.Context, requestID string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.RevokeRefreshToken(ctx, requestID)
+}
+
+func (s *MultiTenantMemoryStore) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.RevokeRefreshTokenMaybeGracePeriod(ctx, requestID, signature)
+}
+
+func (s *MultiTenantMemoryStore) RevokeAccessToken(ctx context.Context, requestID string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.RevokeAccessToken(ctx, requestID)
+}
+
+func (s *MultiTenantMemoryStore) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetPublicKey(ctx, issuer, subject, keyId)
+}
+
+func (s *MultiTenantMemoryStore) GetPublicKeys(ctx context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetPublicKeys(ctx, issuer, subject)
+}
+
+func (s *MultiTenantMemoryStore) GetPublicKeyScopes(ctx context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetPublicKeyScopes(ctx, issuer, subject, keyId)
+}
+
+func (s *MultiTenantMemoryStore) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return false, err
+	}
+	return store.IsJWTUsed(ctx, jti)
+}
+
+func (s *MultiTenantMemoryStore) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.MarkJWTUsedForTime(ctx, jti, exp)
+}
+
+func (s *MultiTenantMemoryStore) CreatePARSession(ctx context.Context, requestURI string, request fosite.AuthorizeRequester) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.CreatePARSession(ctx, requestURI, request)
+}
+
+func (s *MultiTenantMemoryStore) GetPARSession(ctx context.Context, requestURI string) (fosite.AuthorizeRequester, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetPARSession(ctx, requestURI)
+}
+
+func (s *MultiTenantMemoryStore) DeletePARSession(ctx context.Context, requestURI string) error {
+	store, err := s.store(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeletePARSession(ctx, requestURI)
+}
+
+func (s *MultiTenantMemoryStore) RevokeTokens(ctx context.Context, filter fosite.RevocationFilter) ([]string, error) {
+	store, err := s.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.RevokeTokens(ctx, filter)
+}
@@ -0,0 +1,58 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+)
+
+func TestMultiTenantMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	fooCtx, barCtx := fosite.WithTenant(ctx, "foo"), fosite.WithTenant(ctx, "bar")
+
+	store := NewMultiTenantMemoryStore()
+	store.Tenant("foo").Clients["client"] = &fosite.DefaultClient{ID: "client"}
+
+	_, err := store.GetClient(fooCtx, "client")
+	require.NoError(t, err)
+	_, err = store.GetClient(barCtx, "client")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = store.GetClient(ctx, "client")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	store.Tenant("bar")
+	require.NoError(t, store.CreateAccessTokenSession(barCtx, "signature", fosite.NewAccessRequest(new(fosite.DefaultSession))))
+	_, err = store.GetAccessTokenSession(barCtx, "signature", nil)
+	require.NoError(t, err)
+	_, err = store.GetAccessTokenSession(fooCtx, "signature", nil)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	assert.Same(t, store.Tenant("foo"), store.Tenant("foo"))
+}
+
+func TestMultiTenantMemoryStoreUnknownTenants(t *testing.T) {
+	ctx := fosite.WithTenant(context.Background(), "unknown")
+	store := NewMultiTenantMemoryStore()
+
+	_, err := store.GetClient(ctx, "client")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = store.GetAccessTokenSession(ctx, "signature", nil)
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	err = store.CreateAccessTokenSession(ctx, "signature", fosite.NewAccessRequest(new(fosite.DefaultSession)))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = store.IsJWTRevoked(ctx, "jti")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	assert.Empty(t, store.tenants, "unknown tenants do not create partitions")
+
+	_, err = store.GetClient(context.Background(), "client")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	assert.Len(t, store.tenants, 1, "contexts without a tenant use a partition of their own")
+}
@@ -6,16 +6,15 @@ package storage
 import (
 	"context"
 	"errors"
-	"sync"
 	"testing"
+	"time"
 
 	"github.com/ory/fosite"
 )
 
 func TestMemoryStore_Authenticate(t *testing.T) {
 	type fields struct {
-		Users      map[string]MemoryUserRelation
-		usersMutex sync.RWMutex
+		Users map[string]MemoryUserRelation
 	}
 	type args struct {
 		in0    context.Context
@@ -49,8 +48,7 @@ func TestMemoryStore_Authenticate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &MemoryStore{
-				Users:      tt.fields.Users,
-				usersMutex: tt.fields.usersMutex,
+				Users: tt.fields.Users,
 			}
 			if err := s.Authenticate(tt.args.in0, tt.args.name, tt.args.secret); err == nil || !errors.Is(err, tt.wantErr) {
 				t.Errorf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
@@ -58,3 +56,283 @@ func TestMemoryStore_Authenticate(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryStore_ClientAssertionJWTWithClock(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.Clock = fosite.FixedClock(now)
+
+	ctx := context.Background()
+	if err := s.SetClientAssertionJWT(ctx, "jti", now.Add(time.Minute)); err != nil {
+		t.Fatalf("SetClientAssertionJWT() error = %v", err)
+	}
+	if err := s.ClientAssertionJWTValid(ctx, "jti"); !errors.Is(err, fosite.ErrJTIKnown) {
+		t.Errorf("ClientAssertionJWTValid() error = %v, wantErr %v", err, fosite.ErrJTIKnown)
+	}
+
+	s.Clock = fosite.FixedClock(now.Add(2 * time.Minute))
+	if err := s.ClientAssertionJWTValid(ctx, "jti"); err != nil {
+		t.Errorf("ClientAssertionJWTValid() error = %v, wantErr nil", err)
+	}
+}
+
+func TestMemoryStore_RevokeJWT(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.Clock = fosite.FixedClock(now)
+
+	ctx := context.Background()
+	if err := s.RevokeJWT(ctx, "jti", now.Add(time.Minute)); err != nil {
+		t.Fatalf("RevokeJWT() error = %v", err)
+	}
+	if revoked, err := s.IsJWTRevoked(ctx, "jti"); err != nil || !revoked {
+		t.Errorf("IsJWTRevoked() = %v, %v, want true, nil", revoked, err)
+	}
+	if revoked, err := s.IsJWTRevoked(ctx, "other"); err != nil || revoked {
+		t.Errorf("IsJWTRevoked() = %v, %v, want false, nil", revoked, err)
+	}
+	if jtis, err := s.ListRevokedJWTs(ctx); err != nil || len(jtis) != 1 || jtis[0] != "jti" {
+		t.Errorf("ListRevokedJWTs() = %v, %v, want [jti], nil", jtis, err)
+	}
+
+	s.Clock = fosite.FixedClock(now.Add(2 * time.Minute))
+	if revoked, err := s.IsJWTRevoked(ctx, "jti"); err != nil || revoked {
+		t.Errorf("IsJWTRevoked() = %v, %v, want false, nil after expiry", revoked, err)
+	}
+	if err := s.RevokeJWT(ctx, "new", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJWT() error = %v", err)
+	}
+	if len(s.RevokedJWTs) != 1 {
+		t.Errorf("RevokedJWTs = %v, want expired entries to be evicted", s.RevokedJWTs)
+	}
+}
+
+func TestMemoryStore_RevokeTokens(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	for _, id := range []string{"a", "b"} {
+		r := &fosite.Request{ID: id, Client: &fosite.DefaultClient{ID: "client"}, Session: &fosite.DefaultSession{Subject: "peter"}}
+		if err := s.CreateAccessTokenSession(ctx, id, r); err != nil {
+			t.Fatalf("CreateAccessTokenSession() error = %v", err)
+		}
+	}
+
+	requestIDs, err := s.RevokeTokens(ctx, fosite.RevocationFilter{ClientID: "client"})
+	if err != nil || len(requestIDs) != 2 {
+		t.Fatalf("RevokeTokens() = %v, %v, want 2 request IDs", requestIDs, err)
+	}
+	if len(s.AccessTokens) != 0 {
+		t.Errorf("AccessTokens = %v, want all tokens to be revoked", s.AccessTokens)
+	}
+	if len(s.Requests) != 0 || len(s.RequestIDsByClientID) != 0 || len(s.RequestIDsBySubject) != 0 {
+		t.Errorf("revoked requests are still indexed")
+	}
+}
+
+func newExpiringRequest(id string, tokenType fosite.TokenType, exp time.Time) *fosite.AuthorizeRequest {
+	session := &fosite.DefaultSession{Subject: "peter"}
+	session.SetExpiresAt(tokenType, exp)
+	return &fosite.AuthorizeRequest{Request: fosite.Request{ID: id, Client: &fosite.DefaultClient{ID: "client"}, Session: session}}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore()
+	s.Clock = fosite.FixedClock(now)
+
+	exp := now.Add(time.Minute)
+	_ = s.CreateAuthorizeCodeSession(ctx, "code", newExpiringRequest("code", fosite.AuthorizeCode, exp))
+	_ = s.CreateOpenIDConnectSession(ctx, "code", newExpiringRequest("code", fosite.AuthorizeCode, exp))
+	_ = s.CreatePKCERequestSession(ctx, "code", newExpiringRequest("code", fosite.AuthorizeCode, exp))
+	_ = s.CreateAccessTokenSession(ctx, "access", newExpiringRequest("access", fosite.AccessToken, exp))
+	_ = s.CreateRefreshTokenSession(ctx, "refresh", newExpiringRequest("refresh", fosite.RefreshToken, exp))
+	_ = s.CreatePARSession(ctx, "par", newExpiringRequest("par", fosite.PushedAuthorizeRequestContext, exp))
+	_ = s.CreateAccessTokenSession(ctx, "forever", &fosite.Request{ID: "forever", Session: &fosite.DefaultSession{}})
+
+	get := map[string]func() error{
+		"GetAuthorizeCodeSession": func() error {
+			_, err := s.GetAuthorizeCodeSession(ctx, "code", nil)
+			return err
+		},
+		"GetOpenIDConnectSession": func() error {
+			_, err := s.GetOpenIDConnectSession(ctx, "code", nil)
+			return err
+		},
+		"GetPKCERequestSession": func() error {
+			_, err := s.GetPKCERequestSession(ctx, "code", nil)
+			return err
+		},
+		"GetAccessTokenSession": func() error {
+			_, err := s.GetAccessTokenSession(ctx, "access", nil)
+			return err
+		},
+		"GetRefreshTokenSession": func() error {
+			_, err := s.GetRefreshTokenSession(ctx, "refresh", nil)
+			return err
+		},
+		"GetPARSession": func() error {
+			_, err := s.GetPARSession(ctx, "par")
+			return err
+		},
+	}
+
+	for name, get := range get {
+		if err := get(); err != nil {
+			t.Errorf("%s() error = %v before expiry", name, err)
+		}
+	}
+
+	s.Clock = fosite.FixedClock(exp.Add(time.Second))
+	for name, get := range get {
+		if err := get(); !errors.Is(err, fosite.ErrNotFound) {
+			t.Errorf("%s() error = %v after expiry, wantErr %v", name, err, fosite.ErrNotFound)
+		}
+	}
+	if _, err := s.GetAccessTokenSession(ctx, "forever", nil); err != nil {
+		t.Errorf("GetAccessTokenSession() error = %v for a token without expiry", err)
+	}
+}
+
+func TestMemoryStore_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore()
+	s.Clock = fosite.FixedClock(now)
+
+	for _, exp := range []time.Time{now.Add(-time.Minute), now.Add(time.Minute)} {
+		id := exp.Format(time.RFC3339Nano)
+		_ = s.CreateAuthorizeCodeSession(ctx, id, newExpiringRequest("code-"+id, fosite.AuthorizeCode, exp))
+		_ = s.CreateOpenIDConnectSession(ctx, id, newExpiringRequest("code-"+id, fosite.AuthorizeCode, exp))
+		_ = s.CreatePKCERequestSession(ctx, id, newExpiringRequest("code-"+id, fosite.AuthorizeCode, exp))
+		_ = s.CreateAccessTokenSession(ctx, id, newExpiringRequest("access-"+id, fosite.AccessToken, exp))
+		_ = s.CreateRefreshTokenSession(ctx, id, newExpiringRequest("refresh-"+id, fosite.RefreshToken, exp))
+		_ = s.CreatePARSession(ctx, id, newExpiringRequest("par-"+id, fosite.PushedAuthorizeRequestContext, exp))
+		s.BlacklistedJTIs[id] = exp
+		s.RevokedJWTs[id] = exp
+	}
+
+	// the index entries of deleted tokens are orphaned
+	_ = s.CreateAccessTokenSession(ctx, "deleted", newExpiringRequest("deleted", fosite.AccessToken, now.Add(time.Hour)))
+	_ = s.DeleteAccessTokenSession(ctx, "deleted")
+
+	stats := s.PurgeExpired()
+	want := PurgeStats{
+		AuthorizeCodes:  1,
+		IDSessions:      1,
+		AccessTokens:    1,
+		RefreshTokens:   1,
+		PKCES:           1,
+		PARSessions:     1,
+		BlacklistedJTIs: 1,
+		RevokedJWTs:     1,
+		// the access token, refresh token, authorize code and PKCE request IDs of the expired and deleted tokens,
+		// and the expired access token, refresh token and code requests and the deleted request
+		RequestIDs: 2 + 1 + 1 + 1 + 3 + 1,
+	}
+	if stats != want {
+		t.Errorf("PurgeExpired() = %+v, want %+v", stats, want)
+	}
+
+	for name, n := range map[string]int{
+		"AuthorizeCodes":          len(s.AuthorizeCodes),
+		"IDSessions":              len(s.IDSessions),
+		"AccessTokens":            len(s.AccessTokens),
+		"RefreshTokens":           len(s.RefreshTokens),
+		"PKCES":                   len(s.PKCES),
+		"PARSessions":             len(s.PARSessions),
+		"BlacklistedJTIs":         len(s.BlacklistedJTIs),
+		"RevokedJWTs":             len(s.RevokedJWTs),
+		"AccessTokenRequestIDs":   len(s.AccessTokenRequestIDs),
+		"RefreshTokenRequestIDs":  len(s.RefreshTokenRequestIDs),
+		"AuthorizeCodeRequestIDs": len(s.AuthorizeCodeRequestIDs),
+		"PKCERequestIDs":          len(s.PKCERequestIDs),
+	} {
+		if n != 1 {
+			t.Errorf("len(%s) = %d after purge, want 1", name, n)
+		}
+	}
+	if len(s.Requests) != 3 {
+		t.Errorf("len(Requests) = %d after purge, want 3", len(s.Requests))
+	}
+	if ids := s.RequestIDsBySubject["peter"]; len(ids) != 3 {
+		t.Errorf("RequestIDsBySubject = %v after purge, want 3 request IDs", ids)
+	}
+
+	if stats := s.PurgeExpired(); stats.Total() != 0 {
+		t.Errorf("PurgeExpired() = %+v, want nothing to purge", stats)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	ctx := context.Background()
+	s := NewMultiTenantMemoryStore()
+	for _, tenant := range []string{"a", "b"} {
+		s.Tenant(tenant)
+		ctx := fosite.WithTenant(ctx, tenant)
+		_ = s.CreateAccessTokenSession(ctx, "expired", newExpiringRequest("expired", fosite.AccessToken, time.Now().Add(-time.Minute)))
+		_ = s.CreateAccessTokenSession(ctx, "valid", newExpiringRequest("valid", fosite.AccessToken, time.Now().Add(time.Hour)))
+	}
+
+	purged := make(chan PurgeStats, 1)
+	j := NewJanitor(s, time.Millisecond)
+	j.OnPurge = func(stats PurgeStats) {
+		select {
+		case purged <- stats:
+		default:
+		}
+	}
+	j.Start()
+	j.Start()
+
+	select {
+	case stats := <-purged:
+		if stats.AccessTokens != 2 {
+			t.Errorf("OnPurge() AccessTokens = %d, want 2", stats.AccessTokens)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the janitor did not purge")
+	}
+	j.Stop()
+	j.Stop()
+
+	metrics := j.Metrics()
+	if metrics.Runs < 1 || metrics.Purged.AccessTokens != 2 || metrics.LastRun.IsZero() {
+		t.Errorf("Metrics() = %+v, want the expired access tokens of both tenants to be purged", metrics)
+	}
+	for _, tenant := range []string{"a", "b"} {
+		if _, err := s.GetAccessTokenSession(fosite.WithTenant(ctx, tenant), "valid", nil); err != nil {
+			t.Errorf("GetAccessTokenSession() error = %v for a valid token of tenant %s", err, tenant)
+		}
+	}
+
+	// the janitor can be restarted
+	runs := metrics.Runs
+	j.Start()
+	defer j.Stop()
+	for deadline := time.Now().Add(10 * time.Second); j.Metrics().Runs == runs; {
+		if time.Now().After(deadline) {
+			t.Fatal("the restarted janitor did not purge")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJanitorClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.Clock = fosite.ClockFunc(func() time.Time { return now })
+
+	j := NewJanitor(s, time.Minute)
+	j.Purge()
+	if lastRun := j.Metrics().LastRun; !lastRun.Equal(now) {
+		t.Errorf("Metrics().LastRun = %v, want the time of the store clock %v", lastRun, now)
+	}
+
+	later := now.Add(time.Hour)
+	j.Clock = fosite.ClockFunc(func() time.Time { return later })
+	j.Purge()
+	if lastRun := j.Metrics().LastRun; !lastRun.Equal(later) {
+		t.Errorf("Metrics().LastRun = %v, want the time of the janitor clock %v", lastRun, later)
+	}
+}
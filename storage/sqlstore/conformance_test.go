@@ -0,0 +1,37 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) interface{} {
+		// Writers wait for each other instead of failing immediately.
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fosite.db")+"?_pragma=busy_timeout(10000)")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		s := New(db)
+		require.NoError(t, s.Migrate(context.Background()))
+		return s
+	}, storagetest.Options{
+		CreateClient: func(ctx context.Context, s interface{}, client *fosite.DefaultClient) error {
+			return s.(*Store).CreateClient(ctx, client)
+		},
+		SetPublicKey: func(ctx context.Context, s interface{}, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+			return s.(*Store).SetPublicKey(ctx, issuer, subject, key, scopes)
+		},
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlstore
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migration is a schema change. Migrations are applied in the order of their version, which is the numeric prefix of
+// their file name, for example 0001 for 0001_initial.sql.
+type migration struct {
+	version    int
+	statements []string
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := make([]migration, 0, len(files))
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(path.Base(file), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, errors.Errorf("migration %s does not start with a version number", file)
+		}
+
+		content, err := migrations.ReadFile(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var statements []string
+		for _, statement := range strings.Split(string(content), ";") {
+			if statement = strings.TrimSpace(statement); statement != "" {
+				statements = append(statements, statement)
+			}
+		}
+		result = append(result, migration{version: version, statements: statements})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	return result, nil
+}
+
+// Migrate creates or upgrades the schema. Every migration runs in a transaction of its own and is recorded in the
+// fosite_migrations table, so Migrate can be called on every start.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS fosite_migrations (version INTEGER NOT NULL PRIMARY KEY)`); err != nil {
+		return errors.WithStack(err)
+	}
+
+	all, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the version of the latest applied migration, or 0 if no migration was applied.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	if err := s.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM fosite_migrations`).Scan(&version); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to apply migration %04d", m.version))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO fosite_migrations (version) VALUES (?)`, m.version); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
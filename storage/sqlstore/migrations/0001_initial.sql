@@ -0,0 +1,58 @@
+CREATE TABLE fosite_clients (
+	id   VARCHAR(255) NOT NULL PRIMARY KEY,
+	data TEXT         NOT NULL
+);
+
+CREATE TABLE fosite_authorize_codes (
+	signature  VARCHAR(255) NOT NULL PRIMARY KEY,
+	request_id VARCHAR(255) NOT NULL,
+	active     BOOLEAN      NOT NULL,
+	data       TEXT         NOT NULL
+);
+CREATE INDEX fosite_authorize_codes_request_id_idx ON fosite_authorize_codes (request_id);
+
+CREATE TABLE fosite_access_tokens (
+	signature  VARCHAR(255) NOT NULL PRIMARY KEY,
+	request_id VARCHAR(255) NOT NULL,
+	data       TEXT         NOT NULL
+);
+CREATE INDEX fosite_access_tokens_request_id_idx ON fosite_access_tokens (request_id);
+
+CREATE TABLE fosite_refresh_tokens (
+	signature  VARCHAR(255) NOT NULL PRIMARY KEY,
+	request_id VARCHAR(255) NOT NULL,
+	active     BOOLEAN      NOT NULL,
+	data       TEXT         NOT NULL
+);
+CREATE INDEX fosite_refresh_tokens_request_id_idx ON fosite_refresh_tokens (request_id);
+
+CREATE TABLE fosite_oidc_sessions (
+	signature  VARCHAR(255) NOT NULL PRIMARY KEY,
+	request_id VARCHAR(255) NOT NULL,
+	data       TEXT         NOT NULL
+);
+
+CREATE TABLE fosite_pkce_sessions (
+	signature  VARCHAR(255) NOT NULL PRIMARY KEY,
+	request_id VARCHAR(255) NOT NULL,
+	data       TEXT         NOT NULL
+);
+
+CREATE TABLE fosite_par_sessions (
+	request_uri VARCHAR(255) NOT NULL PRIMARY KEY,
+	data        TEXT         NOT NULL
+);
+
+CREATE TABLE fosite_jtis (
+	jti        VARCHAR(255) NOT NULL PRIMARY KEY,
+	expires_at BIGINT       NOT NULL
+);
+
+CREATE TABLE fosite_issuer_public_keys (
+	issuer  VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	key_id  VARCHAR(255) NOT NULL,
+	data    TEXT         NOT NULL,
+	scopes  TEXT         NOT NULL,
+	PRIMARY KEY (issuer, subject, key_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE fosite_clients ADD COLUMN kind VARCHAR(32) NOT NULL DEFAULT '';
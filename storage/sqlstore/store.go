@@ -0,0 +1,521 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sqlstore is a reference implementation of fosite's storage interfaces on top of database/sql.
+//
+// The schema is created and upgraded by Migrate. The migrations are written for SQLite and use `?` placeholders;
+// other databases need adapted migrations and a driver which accepts `?` placeholders.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ory/x/errorsx"
+	"github.com/pkg/errors"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/handler/rfc7523"
+	"github.com/ory/fosite/storage"
+	"github.com/ory/fosite/storage/codec"
+)
+
+var (
+	_ fosite.Storage                     = (*Store)(nil)
+	_ fosite.PARStorage                  = (*Store)(nil)
+	_ oauth2.CoreStorage                 = (*Store)(nil)
+	_ oauth2.TokenRevocationStorage      = (*Store)(nil)
+	_ openid.OpenIDConnectRequestStorage = (*Store)(nil)
+	_ pkce.PKCERequestStorage            = (*Store)(nil)
+	_ rfc7523.RFC7523KeyStorage          = (*Store)(nil)
+	_ storage.Transactional              = (*Store)(nil)
+)
+
+// Store implements fosite's storage interfaces on top of a SQL database. Call Migrate before using it.
+type Store struct {
+	DB *sql.DB
+
+	// Codec serializes the stored requests. New creates a codec which loads clients from the store.
+	Codec *codec.Codec
+
+	// NewSession creates the session requests are decoded into if the caller does not provide one, for example in
+	// GetPARSession. If it is nil, the session type registered with the Codec is used.
+	NewSession func() fosite.Session
+
+	// Clock is used to determine whether stored sessions and JTIs have expired. Defaults to fosite.DefaultClock.
+	Clock fosite.Clock
+}
+
+// New returns a store using the database. Call Migrate before using it.
+func New(db *sql.DB) *Store {
+	s := &Store{DB: db}
+	s.Codec = codec.New(s)
+	return s
+}
+
+func (s *Store) now() time.Time {
+	if s.Clock == nil {
+		return fosite.DefaultClock.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Store) newSession() fosite.Session {
+	if s.NewSession == nil {
+		return nil
+	}
+	return s.NewSession()
+}
+
+func (s *Store) encodeRequest(request fosite.Requester) (string, error) {
+	data, err := s.Codec.Encode(request)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeRequest decodes the stored request. It returns fosite.ErrNotFound if the session has expired for the token
+// type.
+func (s *Store) decodeRequest(ctx context.Context, data string, session fosite.Session, tokenType fosite.TokenType) (fosite.Requester, error) {
+	request, err := s.Codec.Decode(ctx, []byte(data), session)
+	if err != nil {
+		return nil, err
+	}
+	if request.GetSession() != nil {
+		if exp := request.GetSession().GetExpiresAt(tokenType); !exp.IsZero() && exp.Before(s.now()) {
+			return nil, errorsx.WithStack(fosite.ErrNotFound)
+		}
+	}
+	return request, nil
+}
+
+type txKey struct{}
+
+// executor is implemented by *sql.DB and *sql.Tx.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// db returns the transaction stored in the context by BeginTX, or the database.
+func (s *Store) db(ctx context.Context) executor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.DB
+}
+
+// BeginTX starts a transaction and returns a context which makes all store operations use it until Commit or Rollback
+// is called with the context. Nested transactions are not supported.
+func (s *Store) BeginTX(ctx context.Context) (context.Context, error) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return ctx, errors.New("a transaction is already in progress")
+	}
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return ctx, handleError(err)
+	}
+	return context.WithValue(ctx, txKey{}, tx), nil
+}
+
+// Commit commits the transaction started by BeginTX.
+func (s *Store) Commit(ctx context.Context) error {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	if !ok {
+		return errors.New("no transaction in progress")
+	}
+	return handleError(tx.Commit())
+}
+
+// Rollback aborts the transaction started by BeginTX.
+func (s *Store) Rollback(ctx context.Context) error {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	if !ok {
+		return errors.New("no transaction in progress")
+	}
+	return handleError(tx.Rollback())
+}
+
+// handleError maps driver errors to fosite errors. Errors caused by concurrent access, such as serialization failures
+// or locked databases, become fosite.ErrSerializationFailure.
+func handleError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return errorsx.WithStack(fosite.ErrNotFound)
+	case isSerializationFailure(err):
+		return errors.WithStack(fmt.Errorf("%w: %s", fosite.ErrSerializationFailure, err))
+	}
+	return errors.WithStack(err)
+}
+
+func isSerializationFailure(err error) bool {
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		// serialization_failure and deadlock_detected
+		return sqlState.SQLState() == "40001" || sqlState.SQLState() == "40P01"
+	}
+
+	var code interface{ Code() int }
+	if errors.As(err, &code) {
+		// SQLITE_BUSY and SQLITE_LOCKED, including their extended codes
+		return code.Code()&0xff == 5 || code.Code()&0xff == 6
+	}
+
+	return strings.Contains(err.Error(), "database is locked")
+}
+
+// clientKindOpenIDConnect marks clients stored as fosite.DefaultOpenIDConnectClient.
+const clientKindOpenIDConnect = "openid"
+
+// CreateClient stores the client. Clients are stored as JSON, use CreateOpenIDConnectClient to store clients with
+// OpenID Connect metadata.
+func (s *Store) CreateClient(ctx context.Context, client *fosite.DefaultClient) error {
+	return s.createClient(ctx, client.GetID(), "", client)
+}
+
+// CreateOpenIDConnectClient stores the client. GetClient returns it as a fosite.DefaultOpenIDConnectClient.
+func (s *Store) CreateOpenIDConnectClient(ctx context.Context, client *fosite.DefaultOpenIDConnectClient) error {
+	return s.createClient(ctx, client.GetID(), clientKindOpenIDConnect, client)
+}
+
+func (s *Store) createClient(ctx context.Context, id, kind string, client fosite.Client) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_clients (id, kind, data) VALUES (?, ?, ?)`, id, kind, string(data))
+	return handleError(err)
+}
+
+func (s *Store) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	var kind, data string
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT kind, data FROM fosite_clients WHERE id = ?`, id).Scan(&kind, &data); err != nil {
+		return nil, handleError(err)
+	}
+
+	var client fosite.Client = new(fosite.DefaultClient)
+	if kind == clientKindOpenIDConnect {
+		client = &fosite.DefaultOpenIDConnectClient{DefaultClient: new(fosite.DefaultClient)}
+	}
+	if err := json.Unmarshal([]byte(data), client); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return client, nil
+}
+
+func (s *Store) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	var exp int64
+	err := s.db(ctx).QueryRowContext(ctx, `SELECT expires_at FROM fosite_jtis WHERE jti = ?`, jti).Scan(&exp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return handleError(err)
+	}
+
+	if time.Unix(exp, 0).After(s.now()) {
+		return errorsx.WithStack(fosite.ErrJTIKnown)
+	}
+	return nil
+}
+
+func (s *Store) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
+	// delete expired jtis
+	if _, err := s.db(ctx).ExecContext(ctx, `DELETE FROM fosite_jtis WHERE expires_at < ?`, s.now().Unix()); err != nil {
+		return handleError(err)
+	}
+
+	if _, err := s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_jtis (jti, expires_at) VALUES (?, ?)`, jti, exp.Unix()); err != nil {
+		if err := s.ClientAssertionJWTValid(ctx, jti); err != nil {
+			return err
+		}
+		return handleError(err)
+	}
+	return nil
+}
+
+// createSession stores the request in one of the session tables, which all have the same layout.
+func (s *Store) createSession(ctx context.Context, table, signature string, request fosite.Requester) error {
+	data, err := s.encodeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO `+table+` (signature, request_id, data) VALUES (?, ?, ?)`, signature, request.GetID(), data)
+	return handleError(err)
+}
+
+func (s *Store) getSession(ctx context.Context, table, signature string, session fosite.Session, tokenType fosite.TokenType) (fosite.Requester, error) {
+	var data string
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT data FROM `+table+` WHERE signature = ?`, signature).Scan(&data); err != nil {
+		return nil, handleError(err)
+	}
+	return s.decodeRequest(ctx, data, session, tokenType)
+}
+
+func (s *Store) deleteSession(ctx context.Context, table, signature string) error {
+	_, err := s.db(ctx).ExecContext(ctx, `DELETE FROM `+table+` WHERE signature = ?`, signature)
+	return handleError(err)
+}
+
+func (s *Store) CreateAuthorizeCodeSession(ctx context.Context, code string, request fosite.Requester) error {
+	data, err := s.encodeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_authorize_codes (signature, request_id, active, data) VALUES (?, ?, ?, ?)`, code, request.GetID(), true, data)
+	return handleError(err)
+}
+
+func (s *Store) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	var data string
+	var active bool
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT data, active FROM fosite_authorize_codes WHERE signature = ?`, code).Scan(&data, &active); err != nil {
+		return nil, handleError(err)
+	}
+
+	request, err := s.decodeRequest(ctx, data, session, fosite.AuthorizeCode)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return request, errorsx.WithStack(fosite.ErrInvalidatedAuthorizeCode)
+	}
+	return request, nil
+}
+
+func (s *Store) InvalidateAuthorizeCodeSession(ctx context.Context, code string) error {
+	result, err := s.db(ctx).ExecContext(ctx, `UPDATE fosite_authorize_codes SET active = ? WHERE signature = ?`, false, code)
+	if err != nil {
+		return handleError(err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return errorsx.WithStack(fosite.ErrNotFound)
+	}
+	return nil
+}
+
+func (s *Store) CreateAccessTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	return s.createSession(ctx, "fosite_access_tokens", signature, request)
+}
+
+func (s *Store) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.getSession(ctx, "fosite_access_tokens", signature, session, fosite.AccessToken)
+}
+
+func (s *Store) DeleteAccessTokenSession(ctx context.Context, signature string) error {
+	return s.deleteSession(ctx, "fosite_access_tokens", signature)
+}
+
+func (s *Store) CreateRefreshTokenSession(ctx context.Context, signature string, request fosite.Requester) error {
+	data, err := s.encodeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_refresh_tokens (signature, request_id, active, data) VALUES (?, ?, ?, ?)`, signature, request.GetID(), true, data)
+	return handleError(err)
+}
+
+func (s *Store) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	var data string
+	var active bool
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT data, active FROM fosite_refresh_tokens WHERE signature = ?`, signature).Scan(&data, &active); err != nil {
+		return nil, handleError(err)
+	}
+
+	request, err := s.decodeRequest(ctx, data, session, fosite.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return request, errorsx.WithStack(fosite.ErrInactiveToken)
+	}
+	return request, nil
+}
+
+func (s *Store) DeleteRefreshTokenSession(ctx context.Context, signature string) error {
+	return s.deleteSession(ctx, "fosite_refresh_tokens", signature)
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, requestID string) error {
+	_, err := s.db(ctx).ExecContext(ctx, `UPDATE fosite_refresh_tokens SET active = ? WHERE request_id = ?`, false, requestID)
+	return handleError(err)
+}
+
+func (s *Store) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
+	// grace periods are not supported
+	return s.RevokeRefreshToken(ctx, requestID)
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, requestID string) error {
+	_, err := s.db(ctx).ExecContext(ctx, `DELETE FROM fosite_access_tokens WHERE request_id = ?`, requestID)
+	return handleError(err)
+}
+
+func (s *Store) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) error {
+	return s.createSession(ctx, "fosite_oidc_sessions", authorizeCode, requester)
+}
+
+func (s *Store) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (fosite.Requester, error) {
+	var session fosite.Session
+	if requester != nil {
+		session = requester.GetSession()
+	}
+	return s.getSession(ctx, "fosite_oidc_sessions", authorizeCode, session, fosite.AuthorizeCode)
+}
+
+func (s *Store) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) error {
+	return s.deleteSession(ctx, "fosite_oidc_sessions", authorizeCode)
+}
+
+func (s *Store) CreatePKCERequestSession(ctx context.Context, signature string, requester fosite.Requester) error {
+	return s.createSession(ctx, "fosite_pkce_sessions", signature, requester)
+}
+
+func (s *Store) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	return s.getSession(ctx, "fosite_pkce_sessions", signature, session, fosite.AuthorizeCode)
+}
+
+func (s *Store) DeletePKCERequestSession(ctx context.Context, signature string) error {
+	return s.deleteSession(ctx, "fosite_pkce_sessions", signature)
+}
+
+// CreatePARSession stores the pushed authorization request context. The requestURI is used to derive the key.
+func (s *Store) CreatePARSession(ctx context.Context, requestURI string, request fosite.AuthorizeRequester) error {
+	data, err := s.encodeRequest(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_par_sessions (request_uri, data) VALUES (?, ?)`, requestURI, data)
+	return handleError(err)
+}
+
+// GetPARSession gets the push authorization request context. The session is created by NewSession, or is of the
+// type the request was stored with.
+func (s *Store) GetPARSession(ctx context.Context, requestURI string) (fosite.AuthorizeRequester, error) {
+	var data string
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT data FROM fosite_par_sessions WHERE request_uri = ?`, requestURI).Scan(&data); err != nil {
+		return nil, handleError(err)
+	}
+
+	request, err := s.decodeRequest(ctx, data, s.newSession(), fosite.PushedAuthorizeRequestContext)
+	if err != nil {
+		return nil, err
+	}
+
+	ar, ok := request.(fosite.AuthorizeRequester)
+	if !ok {
+		return nil, errors.Errorf("pushed authorization request %s is not an authorize request", requestURI)
+	}
+	return ar, nil
+}
+
+// DeletePARSession deletes the context.
+func (s *Store) DeletePARSession(ctx context.Context, requestURI string) error {
+	_, err := s.db(ctx).ExecContext(ctx, `DELETE FROM fosite_par_sessions WHERE request_uri = ?`, requestURI)
+	return handleError(err)
+}
+
+// SetPublicKey stores the public key used to verify JWT authorization grants of the issuer and subject, and the
+// scopes the grants may request.
+func (s *Store) SetPublicKey(ctx context.Context, issuer, subject string, key *jose.JSONWebKey, scopes []string) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	encodedScopes, err := json.Marshal(scopes)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := s.db(ctx).ExecContext(ctx, `DELETE FROM fosite_issuer_public_keys WHERE issuer = ? AND subject = ? AND key_id = ?`, issuer, subject, key.KeyID); err != nil {
+		return handleError(err)
+	}
+	_, err = s.db(ctx).ExecContext(ctx, `INSERT INTO fosite_issuer_public_keys (issuer, subject, key_id, data, scopes) VALUES (?, ?, ?, ?, ?)`, issuer, subject, key.KeyID, string(data), string(encodedScopes))
+	return handleError(err)
+}
+
+func (s *Store) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	var data string
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT data FROM fosite_issuer_public_keys WHERE issuer = ? AND subject = ? AND key_id = ?`, issuer, subject, keyId).Scan(&data); err != nil {
+		return nil, handleError(err)
+	}
+
+	var key jose.JSONWebKey
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &key, nil
+}
+
+func (s *Store) GetPublicKeys(ctx context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	rows, err := s.db(ctx).QueryContext(ctx, `SELECT data FROM fosite_issuer_public_keys WHERE issuer = ? AND subject = ?`, issuer, subject)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	defer rows.Close()
+
+	var keys []jose.JSONWebKey
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, handleError(err)
+		}
+
+		var key jose.JSONWebKey
+		if err := json.Unmarshal([]byte(data), &key); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, handleError(err)
+	}
+
+	if len(keys) == 0 {
+		return nil, errorsx.WithStack(fosite.ErrNotFound)
+	}
+	return &jose.JSONWebKeySet{Keys: keys}, nil
+}
+
+func (s *Store) GetPublicKeyScopes(ctx context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	var data string
+	if err := s.db(ctx).QueryRowContext(ctx, `SELECT scopes FROM fosite_issuer_public_keys WHERE issuer = ? AND subject = ? AND key_id = ?`, issuer, subject, keyId).Scan(&data); err != nil {
+		return nil, handleError(err)
+	}
+
+	var scopes []string
+	if err := json.Unmarshal([]byte(data), &scopes); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return scopes, nil
+}
+
+func (s *Store) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	if err := s.ClientAssertionJWTValid(ctx, jti); errors.Is(err, fosite.ErrJTIKnown) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func (s *Store) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	return s.SetClientAssertionJWT(ctx, jti, exp)
+}
@@ -0,0 +1,308 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/token/jwt"
+)
+
+func newTestStore(t *testing.T) *Store {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "fosite.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := New(db)
+	require.NoError(t, s.Migrate(context.Background()))
+	require.NoError(t, s.CreateClient(context.Background(), &fosite.DefaultClient{ID: "client", Secret: []byte("secret"), Scopes: []string{"foo"}}))
+	return s
+}
+
+func newTestRequest(id string) *fosite.Request {
+	r := fosite.NewRequest()
+	r.ID = id
+	r.RequestedAt = time.Now().UTC().Round(time.Second)
+	r.Client = &fosite.DefaultClient{ID: "client"}
+	r.RequestedScope = fosite.Arguments{"foo", "bar"}
+	r.GrantedScope = fosite.Arguments{"foo"}
+	r.Form = url.Values{"foo": {"bar"}}
+	r.Session = &fosite.DefaultSession{Subject: "peter", Extra: map[string]interface{}{"foo": "bar"}}
+	return r
+}
+
+func TestMigrate(t *testing.T) {
+	s := newTestStore(t)
+	require.NoError(t, s.Migrate(context.Background()), "migrations are only applied once")
+
+	version, err := s.SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	t.Run("case=client", func(t *testing.T) {
+		client, err := s.GetClient(ctx, "client")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("secret"), client.GetHashedSecret())
+
+		_, err = s.GetClient(ctx, "unknown")
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=openid connect client", func(t *testing.T) {
+		require.NoError(t, s.CreateOpenIDConnectClient(ctx, &fosite.DefaultOpenIDConnectClient{
+			DefaultClient:           &fosite.DefaultClient{ID: "oidc-client", Secret: []byte("secret")},
+			TokenEndpointAuthMethod: "private_key_jwt",
+			JSONWebKeysURI:          "https://example.com/jwks.json",
+		}))
+
+		client, err := s.GetClient(ctx, "oidc-client")
+		require.NoError(t, err)
+		oidc, ok := client.(*fosite.DefaultOpenIDConnectClient)
+		require.True(t, ok, "%T", client)
+		assert.Equal(t, []byte("secret"), oidc.GetHashedSecret())
+		assert.Equal(t, "private_key_jwt", oidc.GetTokenEndpointAuthMethod())
+		assert.Equal(t, "https://example.com/jwks.json", oidc.GetJSONWebKeysURI())
+
+		assert.Error(t, s.CreateOpenIDConnectClient(ctx, &fosite.DefaultOpenIDConnectClient{DefaultClient: &fosite.DefaultClient{ID: "oidc-client"}}))
+	})
+
+	t.Run("case=authorize code", func(t *testing.T) {
+		request := newTestRequest("code-request")
+		require.NoError(t, s.CreateAuthorizeCodeSession(ctx, "code", request))
+
+		got, err := s.GetAuthorizeCodeSession(ctx, "code", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		assert.Equal(t, request.GetID(), got.GetID())
+		assert.Equal(t, request.RequestedAt, got.GetRequestedAt())
+		assert.Equal(t, request.GrantedScope, got.GetGrantedScopes())
+		assert.Equal(t, request.Form, got.GetRequestForm())
+		assert.Equal(t, "peter", got.GetSession().GetSubject())
+		assert.Equal(t, "client", got.GetClient().GetID())
+
+		require.NoError(t, s.InvalidateAuthorizeCodeSession(ctx, "code"))
+		got, err = s.GetAuthorizeCodeSession(ctx, "code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInvalidatedAuthorizeCode)
+		require.NotNil(t, got)
+		assert.Equal(t, request.GetID(), got.GetID())
+
+		assert.ErrorIs(t, s.InvalidateAuthorizeCodeSession(ctx, "unknown"), fosite.ErrNotFound)
+	})
+
+	t.Run("case=access and refresh tokens", func(t *testing.T) {
+		request := newTestRequest("token-request")
+		require.NoError(t, s.CreateAccessTokenSession(ctx, "at", request))
+		require.NoError(t, s.CreateRefreshTokenSession(ctx, "rt", request))
+
+		_, err := s.GetAccessTokenSession(ctx, "at", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		_, err = s.GetRefreshTokenSession(ctx, "rt", new(fosite.DefaultSession))
+		require.NoError(t, err)
+
+		require.NoError(t, s.RevokeAccessToken(ctx, "token-request"))
+		require.NoError(t, s.RevokeRefreshToken(ctx, "token-request"))
+
+		_, err = s.GetAccessTokenSession(ctx, "at", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+		got, err := s.GetRefreshTokenSession(ctx, "rt", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+		require.NotNil(t, got)
+		assert.Equal(t, "token-request", got.GetID())
+
+		require.NoError(t, s.DeleteRefreshTokenSession(ctx, "rt"))
+		_, err = s.GetRefreshTokenSession(ctx, "rt", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=openid connect session", func(t *testing.T) {
+		request := newTestRequest("oidc-request")
+		request.Session = &openid.DefaultSession{
+			Subject: "peter",
+			Claims:  &jwt.IDTokenClaims{Subject: "peter", Nonce: "nonce", Extra: map[string]interface{}{"sid": "login"}},
+			Headers: &jwt.Headers{},
+		}
+		require.NoError(t, s.CreateOpenIDConnectSession(ctx, "code", request))
+
+		got, err := s.GetOpenIDConnectSession(ctx, "code", &fosite.Request{Session: openid.NewDefaultSession()})
+		require.NoError(t, err)
+		session := got.GetSession().(*openid.DefaultSession)
+		assert.Equal(t, "nonce", session.Claims.Nonce)
+		assert.Equal(t, "login", session.GetSessionID())
+
+		require.NoError(t, s.DeleteOpenIDConnectSession(ctx, "code"))
+		_, err = s.GetOpenIDConnectSession(ctx, "code", &fosite.Request{Session: openid.NewDefaultSession()})
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=pkce", func(t *testing.T) {
+		require.NoError(t, s.CreatePKCERequestSession(ctx, "pkce", newTestRequest("pkce-request")))
+		got, err := s.GetPKCERequestSession(ctx, "pkce", new(fosite.DefaultSession))
+		require.NoError(t, err)
+		assert.Equal(t, "pkce-request", got.GetID())
+
+		require.NoError(t, s.DeletePKCERequestSession(ctx, "pkce"))
+		_, err = s.GetPKCERequestSession(ctx, "pkce", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=pushed authorization request", func(t *testing.T) {
+		ar := fosite.NewAuthorizeRequest()
+		ar.Request = *newTestRequest("par-request")
+		ar.Session = nil
+		ar.ResponseTypes = fosite.Arguments{"code"}
+		ar.RedirectURI, _ = url.Parse("https://example.com/callback")
+		ar.State = "some-state"
+		require.NoError(t, s.CreatePARSession(ctx, "urn:par", ar))
+
+		got, err := s.GetPARSession(ctx, "urn:par")
+		require.NoError(t, err)
+		assert.Equal(t, "par-request", got.GetID())
+		assert.Equal(t, fosite.Arguments{"code"}, got.GetResponseTypes())
+		assert.Equal(t, "https://example.com/callback", got.GetRedirectURI().String())
+		assert.Equal(t, "some-state", got.GetState())
+		assert.Equal(t, fosite.ResponseModeDefault, got.GetResponseMode())
+
+		require.NoError(t, s.DeletePARSession(ctx, "urn:par"))
+		_, err = s.GetPARSession(ctx, "urn:par")
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=client assertion jti", func(t *testing.T) {
+		now := time.Now()
+		s.Clock = fosite.FixedClock(now)
+		defer func() { s.Clock = nil }()
+
+		require.NoError(t, s.ClientAssertionJWTValid(ctx, "jti"))
+		require.NoError(t, s.SetClientAssertionJWT(ctx, "jti", now.Add(time.Minute)))
+		assert.ErrorIs(t, s.ClientAssertionJWTValid(ctx, "jti"), fosite.ErrJTIKnown)
+		assert.ErrorIs(t, s.SetClientAssertionJWT(ctx, "jti", now.Add(time.Minute)), fosite.ErrJTIKnown)
+
+		used, err := s.IsJWTUsed(ctx, "jti")
+		require.NoError(t, err)
+		assert.True(t, used)
+
+		s.Clock = fosite.FixedClock(now.Add(2 * time.Minute))
+		require.NoError(t, s.ClientAssertionJWTValid(ctx, "jti"))
+		require.NoError(t, s.MarkJWTUsedForTime(ctx, "jti", now.Add(time.Hour)), "expired jtis are replaced")
+	})
+
+	t.Run("case=issuer public keys", func(t *testing.T) {
+		key := &jose.JSONWebKey{Key: &gen.MustRSAKey().PublicKey, KeyID: "kid", Algorithm: "RS256", Use: "sig"}
+		require.NoError(t, s.SetPublicKey(ctx, "issuer", "subject", key, []string{"foo"}))
+
+		got, err := s.GetPublicKey(ctx, "issuer", "subject", "kid")
+		require.NoError(t, err)
+		assert.Equal(t, "kid", got.KeyID)
+
+		keys, err := s.GetPublicKeys(ctx, "issuer", "subject")
+		require.NoError(t, err)
+		assert.Len(t, keys.Keys, 1)
+
+		scopes, err := s.GetPublicKeyScopes(ctx, "issuer", "subject", "kid")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, scopes)
+
+		_, err = s.GetPublicKeys(ctx, "issuer", "unknown")
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	t.Run("case=rollback", func(t *testing.T) {
+		txCtx, err := s.BeginTX(ctx)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateAccessTokenSession(txCtx, "rolled-back", newTestRequest("request")))
+
+		_, err = s.GetAccessTokenSession(txCtx, "rolled-back", new(fosite.DefaultSession))
+		require.NoError(t, err, "the transaction sees its own writes")
+
+		_, err = s.BeginTX(txCtx)
+		assert.Error(t, err, "nested transactions are not supported")
+
+		require.NoError(t, s.Rollback(txCtx))
+		_, err = s.GetAccessTokenSession(ctx, "rolled-back", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=commit", func(t *testing.T) {
+		txCtx, err := s.BeginTX(ctx)
+		require.NoError(t, err)
+		require.NoError(t, s.CreateAccessTokenSession(txCtx, "committed", newTestRequest("request")))
+		require.NoError(t, s.Commit(txCtx))
+
+		_, err = s.GetAccessTokenSession(ctx, "committed", new(fosite.DefaultSession))
+		require.NoError(t, err)
+	})
+
+	t.Run("case=concurrent writes fail with a serialization failure", func(t *testing.T) {
+		first, err := s.BeginTX(ctx)
+		require.NoError(t, err)
+		defer func() { _ = s.Rollback(first) }()
+		require.NoError(t, s.RevokeRefreshToken(first, "request"))
+
+		second, err := s.BeginTX(ctx)
+		require.NoError(t, err)
+		defer func() { _ = s.Rollback(second) }()
+		assert.ErrorIs(t, s.RevokeRefreshToken(second, "request"), fosite.ErrSerializationFailure)
+	})
+}
+
+func TestComposedProvider(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	config := &fosite.Config{GlobalSecret: []byte("some-super-cool-secret-that-nobody-knows"), AccessTokenLifespan: time.Hour, HashCost: 4}
+	secret, err := (&fosite.BCrypt{Config: config}).Hash(ctx, []byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, s.CreateClient(ctx, &fosite.DefaultClient{ID: "composed", Secret: secret, GrantTypes: []string{"client_credentials"}, Scopes: []string{"foo"}}))
+	provider := compose.Compose(
+		config,
+		s,
+		compose.NewOAuth2HMACStrategy(config),
+		compose.OAuth2AuthorizeExplicitFactory,
+		compose.OAuth2ClientCredentialsGrantFactory,
+		compose.OAuth2RefreshTokenGrantFactory,
+		compose.OAuth2TokenIntrospectionFactory,
+		compose.OAuth2TokenRevocationFactory,
+		compose.OAuth2PKCEFactory,
+		compose.PushedAuthorizeHandlerFactory,
+	)
+
+	req := httptest.NewRequest("POST", "/oauth2/token", strings.NewReader(url.Values{"grant_type": {"client_credentials"}, "scope": {"foo"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("composed", "foobar")
+
+	ar, err := provider.NewAccessRequest(ctx, req, new(fosite.DefaultSession))
+	require.NoError(t, err)
+	resp, err := provider.NewAccessResponse(ctx, ar)
+	require.NoError(t, err)
+
+	_, introspected, err := provider.IntrospectToken(ctx, resp.GetAccessToken(), fosite.AccessToken, new(fosite.DefaultSession))
+	require.NoError(t, err)
+	assert.Equal(t, "composed", introspected.GetClient().GetID())
+	assert.Equal(t, fosite.Arguments{"foo"}, introspected.GetRequestedScopes())
+}
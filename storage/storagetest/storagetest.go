@@ -0,0 +1,631 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package storagetest is a conformance test suite for implementations of fosite's storage interfaces. Run it from the
+// tests of a storage implementation to verify that it behaves like storage.MemoryStore:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) interface{} { return NewStore() }, storagetest.Options{
+//			CreateClient: func(ctx context.Context, s interface{}, c *fosite.DefaultClient) error {
+//				return s.(*Store).CreateClient(ctx, c)
+//			},
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/handler/rfc7523"
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/storage"
+)
+
+// ClientID is the ID of the client which Run creates with Options.CreateClient before running the tests.
+const ClientID = "storagetest-client"
+
+// Options configures how Run seeds the data which can not be written through fosite's storage interfaces.
+type Options struct {
+	// CreateClient stores a client. It is required if the store implements fosite.ClientManager.
+	CreateClient func(ctx context.Context, store interface{}, client *fosite.DefaultClient) error
+
+	// SetPublicKey stores the public key of a JWT authorization grant issuer. The rfc7523.RFC7523KeyStorage tests are
+	// skipped if it is nil.
+	SetPublicKey func(ctx context.Context, store interface{}, issuer, subject string, key *jose.JSONWebKey, scopes []string) error
+
+	// Concurrency is the number of goroutines used by the concurrent access tests. Defaults to 20.
+	Concurrency int
+}
+
+// Run runs the tests of all storage interfaces the stores created by newStore implement. Every test gets a store of
+// its own.
+func Run(t *testing.T, newStore func(t *testing.T) interface{}, opts Options) {
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 20
+	}
+
+	store := func(t *testing.T) interface{} {
+		s := newStore(t)
+		if _, ok := s.(fosite.ClientManager); ok {
+			require.NotNil(t, opts.CreateClient, "Options.CreateClient is required for stores implementing fosite.ClientManager")
+			require.NoError(t, opts.CreateClient(context.Background(), s, &fosite.DefaultClient{
+				ID:     ClientID,
+				Secret: []byte("some-secret"),
+				Scopes: []string{"foo", "bar"},
+			}))
+		}
+		return s
+	}
+
+	run := func(name string, test func(t *testing.T, s interface{}, opts Options)) {
+		t.Run(name, func(t *testing.T) {
+			test(t, store(t), opts)
+		})
+	}
+	run("interface=ClientManager", testClientManager)
+	run("interface=AuthorizeCodeStorage", testAuthorizeCodeStorage)
+	run("interface=AccessTokenStorage", testAccessTokenStorage)
+	run("interface=RefreshTokenStorage", testRefreshTokenStorage)
+	run("interface=TokenRevocationStorage", testTokenRevocationStorage)
+	run("interface=JWTRevocationStorage", testJWTRevocationStorage)
+	run("interface=BulkRevocationStorage", testBulkRevocationStorage)
+	run("interface=OpenIDConnectRequestStorage", testOpenIDConnectRequestStorage)
+	run("interface=PKCERequestStorage", testPKCERequestStorage)
+	run("interface=PARStorage", testPARStorage)
+	run("interface=RFC7523KeyStorage", testRFC7523KeyStorage)
+	run("interface=Transactional", testTransactional)
+	run("case=concurrent access", testConcurrentAccess)
+}
+
+// NewRequest returns a request issued to ClientID with a fosite.DefaultSession.
+func NewRequest(id string) *fosite.Request {
+	r := fosite.NewRequest()
+	r.ID = id
+	r.RequestedAt = time.Now().UTC().Truncate(time.Second)
+	r.Client = &fosite.DefaultClient{ID: ClientID}
+	r.RequestedScope = fosite.Arguments{"foo", "bar"}
+	r.GrantedScope = fosite.Arguments{"foo"}
+	r.RequestedAudience = fosite.Arguments{"https://api.example.com"}
+	r.GrantedAudience = fosite.Arguments{"https://api.example.com"}
+	r.Form = url.Values{"foo": {"bar"}}
+	r.Session = &fosite.DefaultSession{
+		Subject:   "peter",
+		Username:  "peter",
+		ExpiresAt: map[fosite.TokenType]time.Time{fosite.AccessToken: r.RequestedAt.Add(time.Hour)},
+		Extra:     map[string]interface{}{"foo": "bar"},
+	}
+	return r
+}
+
+// NewExpiredRequest returns a request like NewRequest whose token of the given type expired a minute ago.
+func NewExpiredRequest(id string, tokenType fosite.TokenType) *fosite.Request {
+	r := NewRequest(id)
+	r.Session.SetExpiresAt(tokenType, time.Now().UTC().Add(-time.Minute))
+	return r
+}
+
+// AssertRequestEqual asserts that a stored request was restored completely.
+func AssertRequestEqual(t *testing.T, expected, actual fosite.Requester) {
+	t.Helper()
+
+	require.NotNil(t, actual)
+	assert.Equal(t, expected.GetID(), actual.GetID())
+	assert.True(t, expected.GetRequestedAt().Equal(actual.GetRequestedAt()), "requested at %s, got %s", expected.GetRequestedAt(), actual.GetRequestedAt())
+	require.NotNil(t, actual.GetClient())
+	assert.Equal(t, expected.GetClient().GetID(), actual.GetClient().GetID())
+	assert.Equal(t, expected.GetRequestedScopes(), actual.GetRequestedScopes())
+	assert.Equal(t, expected.GetGrantedScopes(), actual.GetGrantedScopes())
+	assert.Equal(t, expected.GetRequestedAudience(), actual.GetRequestedAudience())
+	assert.Equal(t, expected.GetGrantedAudience(), actual.GetGrantedAudience())
+	assert.Equal(t, expected.GetRequestForm(), actual.GetRequestForm())
+	require.NotNil(t, actual.GetSession())
+	assert.Equal(t, expected.GetSession().GetSubject(), actual.GetSession().GetSubject())
+	assert.Equal(t, expected.GetSession().GetUsername(), actual.GetSession().GetUsername())
+	assert.True(t, expected.GetSession().GetExpiresAt(fosite.AccessToken).Equal(actual.GetSession().GetExpiresAt(fosite.AccessToken)))
+}
+
+func testClientManager(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(fosite.ClientManager)
+	if !ok {
+		t.Skip("store does not implement fosite.ClientManager")
+	}
+	ctx := context.Background()
+
+	t.Run("case=get client", func(t *testing.T) {
+		client, err := store.GetClient(ctx, ClientID)
+		require.NoError(t, err)
+		assert.Equal(t, ClientID, client.GetID())
+		assert.Equal(t, []byte("some-secret"), client.GetHashedSecret())
+		assert.Equal(t, fosite.Arguments{"foo", "bar"}, client.GetScopes())
+
+		_, err = store.GetClient(ctx, "unknown")
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+
+	t.Run("case=client assertion jti", func(t *testing.T) {
+		require.NoError(t, store.ClientAssertionJWTValid(ctx, "jti"))
+		require.NoError(t, store.SetClientAssertionJWT(ctx, "jti", time.Now().Add(time.Hour)))
+		assert.ErrorIs(t, store.ClientAssertionJWTValid(ctx, "jti"), fosite.ErrJTIKnown)
+		assert.ErrorIs(t, store.SetClientAssertionJWT(ctx, "jti", time.Now().Add(time.Hour)), fosite.ErrJTIKnown)
+	})
+
+	t.Run("case=expired client assertion jti", func(t *testing.T) {
+		require.NoError(t, store.SetClientAssertionJWT(ctx, "expired-jti", time.Now().Add(-time.Minute)))
+		assert.NoError(t, store.ClientAssertionJWTValid(ctx, "expired-jti"))
+		assert.NoError(t, store.SetClientAssertionJWT(ctx, "expired-jti", time.Now().Add(time.Hour)), "expired jtis may be reused")
+		assert.ErrorIs(t, store.ClientAssertionJWTValid(ctx, "expired-jti"), fosite.ErrJTIKnown)
+	})
+}
+
+func testAuthorizeCodeStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(oauth2.AuthorizeCodeStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.AuthorizeCodeStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetAuthorizeCodeSession(ctx, "unknown", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	assert.ErrorIs(t, store.InvalidateAuthorizeCodeSession(ctx, "unknown"), fosite.ErrNotFound)
+
+	request := NewRequest("authorize-code-request")
+	require.NoError(t, store.CreateAuthorizeCodeSession(ctx, "code", request))
+
+	got, err := store.GetAuthorizeCodeSession(ctx, "code", new(fosite.DefaultSession))
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+
+	require.NoError(t, store.InvalidateAuthorizeCodeSession(ctx, "code"))
+	got, err = store.GetAuthorizeCodeSession(ctx, "code", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrInvalidatedAuthorizeCode)
+	require.NotNil(t, got, "the request must be returned with ErrInvalidatedAuthorizeCode")
+	assert.Equal(t, request.GetID(), got.GetID())
+
+	t.Run("case=expired", func(t *testing.T) {
+		require.NoError(t, store.CreateAuthorizeCodeSession(ctx, "expired-code", NewExpiredRequest("expired-authorize-code-request", fosite.AuthorizeCode)))
+		_, err := store.GetAuthorizeCodeSession(ctx, "expired-code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testAccessTokenStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(oauth2.AccessTokenStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.AccessTokenStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetAccessTokenSession(ctx, "unknown", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	request := NewRequest("access-token-request")
+	require.NoError(t, store.CreateAccessTokenSession(ctx, "access-token", request))
+
+	got, err := store.GetAccessTokenSession(ctx, "access-token", new(fosite.DefaultSession))
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+
+	require.NoError(t, store.DeleteAccessTokenSession(ctx, "access-token"))
+	_, err = store.GetAccessTokenSession(ctx, "access-token", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=expired", func(t *testing.T) {
+		require.NoError(t, store.CreateAccessTokenSession(ctx, "expired-access-token", NewExpiredRequest("expired-access-token-request", fosite.AccessToken)))
+		_, err := store.GetAccessTokenSession(ctx, "expired-access-token", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testRefreshTokenStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(oauth2.RefreshTokenStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.RefreshTokenStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetRefreshTokenSession(ctx, "unknown", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	request := NewRequest("refresh-token-request")
+	require.NoError(t, store.CreateRefreshTokenSession(ctx, "refresh-token", request))
+
+	got, err := store.GetRefreshTokenSession(ctx, "refresh-token", new(fosite.DefaultSession))
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+
+	require.NoError(t, store.DeleteRefreshTokenSession(ctx, "refresh-token"))
+	_, err = store.GetRefreshTokenSession(ctx, "refresh-token", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=expired", func(t *testing.T) {
+		require.NoError(t, store.CreateRefreshTokenSession(ctx, "expired-refresh-token", NewExpiredRequest("expired-refresh-token-request", fosite.RefreshToken)))
+		_, err := store.GetRefreshTokenSession(ctx, "expired-refresh-token", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testTokenRevocationStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(oauth2.TokenRevocationStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.TokenRevocationStorage")
+	}
+	ctx := context.Background()
+
+	revoked, other := NewRequest("revoked-request"), NewRequest("other-request")
+	for _, r := range []*fosite.Request{revoked, other} {
+		require.NoError(t, store.CreateAccessTokenSession(ctx, r.ID+"-access-token", r))
+		require.NoError(t, store.CreateRefreshTokenSession(ctx, r.ID+"-refresh-token", r))
+	}
+
+	require.NoError(t, store.RevokeAccessToken(ctx, "revoked-request"))
+	require.NoError(t, store.RevokeRefreshToken(ctx, "revoked-request"))
+	require.NoError(t, store.RevokeAccessToken(ctx, "unknown-request"), "revoking an unknown request is not an error")
+	require.NoError(t, store.RevokeRefreshToken(ctx, "unknown-request"), "revoking an unknown request is not an error")
+
+	_, err := store.GetAccessTokenSession(ctx, "revoked-request-access-token", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	got, err := store.GetRefreshTokenSession(ctx, "revoked-request-refresh-token", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+	require.NotNil(t, got, "the request must be returned with ErrInactiveToken")
+	assert.Equal(t, "revoked-request", got.GetID())
+
+	_, err = store.GetAccessTokenSession(ctx, "other-request-access-token", new(fosite.DefaultSession))
+	assert.NoError(t, err, "tokens of other requests must not be revoked")
+	_, err = store.GetRefreshTokenSession(ctx, "other-request-refresh-token", new(fosite.DefaultSession))
+	assert.NoError(t, err, "tokens of other requests must not be revoked")
+
+	t.Run("case=grace period", func(t *testing.T) {
+		require.NoError(t, store.RevokeRefreshTokenMaybeGracePeriod(ctx, "other-request", "other-request-refresh-token"))
+		_, err := store.GetAccessTokenSession(ctx, "other-request-access-token", new(fosite.DefaultSession))
+		assert.NoError(t, err, "revoking the refresh token does not revoke the access token")
+	})
+}
+
+func testJWTRevocationStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(oauth2.JWTRevocationStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.JWTRevocationStorage")
+	}
+	ctx := context.Background()
+
+	revoked, err := store.IsJWTRevoked(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, store.RevokeJWT(ctx, "revoked-jti", time.Now().Add(time.Hour)))
+	revoked, err = store.IsJWTRevoked(ctx, "revoked-jti")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	require.NoError(t, store.RevokeJWT(ctx, "expired-jti", time.Now().Add(-time.Minute)))
+	revoked, err = store.IsJWTRevoked(ctx, "expired-jti")
+	require.NoError(t, err)
+	assert.False(t, revoked, "expired tokens are rejected based on their expiry and need not be remembered")
+
+	t.Run("case=list", func(t *testing.T) {
+		lister, ok := s.(oauth2.RevokedJWTLister)
+		if !ok {
+			t.Skip("store does not implement oauth2.RevokedJWTLister")
+		}
+
+		jtis, err := lister.ListRevokedJWTs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"revoked-jti"}, jtis)
+	})
+}
+
+func testBulkRevocationStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(fosite.BulkRevocationStorage)
+	if !ok {
+		t.Skip("store does not implement fosite.BulkRevocationStorage")
+	}
+	ctx := context.Background()
+
+	revoked, other := NewRequest("bulk-revoked-request"), NewRequest("bulk-other-request")
+	other.Session.(*fosite.DefaultSession).Subject = "alice"
+	for _, r := range []*fosite.Request{revoked, other} {
+		if store, ok := s.(oauth2.AuthorizeCodeStorage); ok {
+			require.NoError(t, store.CreateAuthorizeCodeSession(ctx, r.ID+"-code", r))
+		}
+		if store, ok := s.(pkce.PKCERequestStorage); ok {
+			require.NoError(t, store.CreatePKCERequestSession(ctx, r.ID+"-code", r))
+		}
+		if store, ok := s.(oauth2.AccessTokenStorage); ok {
+			require.NoError(t, store.CreateAccessTokenSession(ctx, r.ID+"-access-token", r))
+		}
+		if store, ok := s.(oauth2.RefreshTokenStorage); ok {
+			require.NoError(t, store.CreateRefreshTokenSession(ctx, r.ID+"-refresh-token", r))
+		}
+	}
+
+	requestIDs, err := store.RevokeTokens(ctx, fosite.RevocationFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, requestIDs, "an empty filter matches nothing")
+
+	requestIDs, err = store.RevokeTokens(ctx, fosite.RevocationFilter{Subject: "peter", ClientID: ClientID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bulk-revoked-request"}, requestIDs)
+
+	if store, ok := s.(oauth2.AuthorizeCodeStorage); ok {
+		_, err := store.GetAuthorizeCodeSession(ctx, "bulk-revoked-request-code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInvalidatedAuthorizeCode)
+		_, err = store.GetAuthorizeCodeSession(ctx, "bulk-other-request-code", new(fosite.DefaultSession))
+		assert.NoError(t, err)
+	}
+	if store, ok := s.(pkce.PKCERequestStorage); ok {
+		_, err := store.GetPKCERequestSession(ctx, "bulk-revoked-request-code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+		_, err = store.GetPKCERequestSession(ctx, "bulk-other-request-code", new(fosite.DefaultSession))
+		assert.NoError(t, err)
+	}
+	if store, ok := s.(oauth2.AccessTokenStorage); ok {
+		_, err := store.GetAccessTokenSession(ctx, "bulk-revoked-request-access-token", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+		_, err = store.GetAccessTokenSession(ctx, "bulk-other-request-access-token", new(fosite.DefaultSession))
+		assert.NoError(t, err)
+	}
+	if store, ok := s.(oauth2.RefreshTokenStorage); ok {
+		_, err := store.GetRefreshTokenSession(ctx, "bulk-revoked-request-refresh-token", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInactiveToken)
+		_, err = store.GetRefreshTokenSession(ctx, "bulk-other-request-refresh-token", new(fosite.DefaultSession))
+		assert.NoError(t, err)
+	}
+
+	requestIDs, err = store.RevokeTokens(ctx, fosite.RevocationFilter{RequestID: "bulk-revoked-request"})
+	require.NoError(t, err)
+	assert.Empty(t, requestIDs, "revoked grants are not revoked again")
+}
+
+func testOpenIDConnectRequestStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(openid.OpenIDConnectRequestStorage)
+	if !ok {
+		t.Skip("store does not implement openid.OpenIDConnectRequestStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetOpenIDConnectSession(ctx, "unknown", &fosite.Request{Session: new(fosite.DefaultSession)})
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	request := NewRequest("openid-connect-request")
+	require.NoError(t, store.CreateOpenIDConnectSession(ctx, "code", request))
+
+	got, err := store.GetOpenIDConnectSession(ctx, "code", &fosite.Request{Session: new(fosite.DefaultSession)})
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+
+	require.NoError(t, store.DeleteOpenIDConnectSession(ctx, "code"))
+	_, err = store.GetOpenIDConnectSession(ctx, "code", &fosite.Request{Session: new(fosite.DefaultSession)})
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=expired", func(t *testing.T) {
+		require.NoError(t, store.CreateOpenIDConnectSession(ctx, "expired-code", NewExpiredRequest("expired-openid-connect-request", fosite.AuthorizeCode)))
+		_, err := store.GetOpenIDConnectSession(ctx, "expired-code", &fosite.Request{Session: new(fosite.DefaultSession)})
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testPKCERequestStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(pkce.PKCERequestStorage)
+	if !ok {
+		t.Skip("store does not implement pkce.PKCERequestStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetPKCERequestSession(ctx, "unknown", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	request := NewRequest("pkce-request")
+	request.Form.Set("code_challenge", "challenge")
+	request.Form.Set("code_challenge_method", "S256")
+	require.NoError(t, store.CreatePKCERequestSession(ctx, "code", request))
+
+	got, err := store.GetPKCERequestSession(ctx, "code", new(fosite.DefaultSession))
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+
+	require.NoError(t, store.DeletePKCERequestSession(ctx, "code"))
+	_, err = store.GetPKCERequestSession(ctx, "code", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=expired", func(t *testing.T) {
+		require.NoError(t, store.CreatePKCERequestSession(ctx, "expired-code", NewExpiredRequest("expired-pkce-request", fosite.AuthorizeCode)))
+		_, err := store.GetPKCERequestSession(ctx, "expired-code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testPARStorage(t *testing.T, s interface{}, _ Options) {
+	store, ok := s.(fosite.PARStorage)
+	if !ok {
+		t.Skip("store does not implement fosite.PARStorage")
+	}
+	ctx := context.Background()
+
+	_, err := store.GetPARSession(ctx, "urn:ietf:params:oauth:request_uri:unknown")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	request := fosite.NewAuthorizeRequest()
+	request.Request = *NewRequest("par-request")
+	request.ResponseTypes = fosite.Arguments{"code"}
+	request.RedirectURI, _ = url.Parse("https://client.example.com/callback")
+	request.State = "some-state"
+	request.ResponseMode = fosite.ResponseModeQuery
+	require.NoError(t, store.CreatePARSession(ctx, "urn:ietf:params:oauth:request_uri:par", request))
+
+	got, err := store.GetPARSession(ctx, "urn:ietf:params:oauth:request_uri:par")
+	require.NoError(t, err)
+	AssertRequestEqual(t, request, got)
+	assert.Equal(t, request.ResponseTypes, got.GetResponseTypes())
+	assert.Equal(t, request.RedirectURI.String(), got.GetRedirectURI().String())
+	assert.Equal(t, request.State, got.GetState())
+	assert.Equal(t, request.ResponseMode, got.GetResponseMode())
+
+	require.NoError(t, store.DeletePARSession(ctx, "urn:ietf:params:oauth:request_uri:par"))
+	_, err = store.GetPARSession(ctx, "urn:ietf:params:oauth:request_uri:par")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=expired", func(t *testing.T) {
+		expired := fosite.NewAuthorizeRequest()
+		expired.Request = *NewExpiredRequest("expired-par-request", fosite.PushedAuthorizeRequestContext)
+		require.NoError(t, store.CreatePARSession(ctx, "urn:ietf:params:oauth:request_uri:expired", expired))
+		_, err := store.GetPARSession(ctx, "urn:ietf:params:oauth:request_uri:expired")
+		assert.ErrorIs(t, err, fosite.ErrNotFound)
+	})
+}
+
+func testRFC7523KeyStorage(t *testing.T, s interface{}, opts Options) {
+	store, ok := s.(rfc7523.RFC7523KeyStorage)
+	if !ok {
+		t.Skip("store does not implement rfc7523.RFC7523KeyStorage")
+	}
+	if opts.SetPublicKey == nil {
+		t.Skip("Options.SetPublicKey is not set")
+	}
+	ctx := context.Background()
+
+	key := &jose.JSONWebKey{Key: &gen.MustRSAKey().PublicKey, KeyID: "key-id", Algorithm: "RS256", Use: "sig"}
+	require.NoError(t, opts.SetPublicKey(ctx, s, "https://issuer.example.com", "subject", key, []string{"foo"}))
+
+	got, err := store.GetPublicKey(ctx, "https://issuer.example.com", "subject", "key-id")
+	require.NoError(t, err)
+	assert.Equal(t, "key-id", got.KeyID)
+	assert.True(t, got.Valid())
+
+	keys, err := store.GetPublicKeys(ctx, "https://issuer.example.com", "subject")
+	require.NoError(t, err)
+	require.Len(t, keys.Keys, 1)
+	assert.Equal(t, "key-id", keys.Keys[0].KeyID)
+
+	scopes, err := store.GetPublicKeyScopes(ctx, "https://issuer.example.com", "subject", "key-id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, scopes)
+
+	_, err = store.GetPublicKey(ctx, "https://issuer.example.com", "subject", "unknown")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = store.GetPublicKeys(ctx, "https://issuer.example.com", "unknown")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+	_, err = store.GetPublicKeyScopes(ctx, "https://unknown.example.com", "subject", "key-id")
+	assert.ErrorIs(t, err, fosite.ErrNotFound)
+
+	t.Run("case=jwt replay", func(t *testing.T) {
+		used, err := store.IsJWTUsed(ctx, "grant-jti")
+		require.NoError(t, err)
+		assert.False(t, used)
+
+		require.NoError(t, store.MarkJWTUsedForTime(ctx, "grant-jti", time.Now().Add(time.Hour)))
+		used, err = store.IsJWTUsed(ctx, "grant-jti")
+		require.NoError(t, err)
+		assert.True(t, used)
+	})
+}
+
+func testTransactional(t *testing.T, s interface{}, _ Options) {
+	tx, ok := s.(storage.Transactional)
+	if !ok {
+		t.Skip("store does not implement storage.Transactional")
+	}
+	store, ok := s.(oauth2.AccessTokenStorage)
+	if !ok {
+		t.Skip("store does not implement oauth2.AccessTokenStorage")
+	}
+	ctx := context.Background()
+
+	txCtx, err := tx.BeginTX(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(txCtx, "rolled-back", NewRequest("rolled-back-request")))
+	require.NoError(t, tx.Rollback(txCtx))
+	_, err = store.GetAccessTokenSession(ctx, "rolled-back", new(fosite.DefaultSession))
+	assert.ErrorIs(t, err, fosite.ErrNotFound, "rolled back writes must be discarded")
+
+	txCtx, err = tx.BeginTX(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAccessTokenSession(txCtx, "committed", NewRequest("committed-request")))
+	require.NoError(t, tx.Commit(txCtx))
+	_, err = store.GetAccessTokenSession(ctx, "committed", new(fosite.DefaultSession))
+	assert.NoError(t, err, "committed writes must be visible")
+}
+
+func testConcurrentAccess(t *testing.T, s interface{}, opts Options) {
+	ctx := context.Background()
+
+	t.Run("case=parallel issuance and introspection", func(t *testing.T) {
+		store, ok := s.(oauth2.CoreStorage)
+		if !ok {
+			t.Skip("store does not implement oauth2.CoreStorage")
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, opts.Concurrency)
+		for i := 0; i < opts.Concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				request := NewRequest(fmt.Sprintf("concurrent-request-%d", i))
+				signature := fmt.Sprintf("concurrent-access-token-%d", i)
+				if err := store.CreateAccessTokenSession(ctx, signature, request); err != nil {
+					errs <- err
+					return
+				}
+				got, err := store.GetAccessTokenSession(ctx, signature, new(fosite.DefaultSession))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got.GetID() != request.GetID() {
+					errs <- fmt.Errorf("expected request %s but got %s", request.GetID(), got.GetID())
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("case=parallel authorize code invalidation", func(t *testing.T) {
+		store, ok := s.(oauth2.AuthorizeCodeStorage)
+		if !ok {
+			t.Skip("store does not implement oauth2.AuthorizeCodeStorage")
+		}
+		require.NoError(t, store.CreateAuthorizeCodeSession(ctx, "concurrent-code", NewRequest("concurrent-code-request")))
+
+		var wg sync.WaitGroup
+		var failed int32
+		for i := 0; i < opts.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := store.InvalidateAuthorizeCodeSession(ctx, "concurrent-code"); err != nil && !isRetryable(err) {
+					atomic.AddInt32(&failed, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Zero(t, failed)
+
+		_, err := store.GetAuthorizeCodeSession(ctx, "concurrent-code", new(fosite.DefaultSession))
+		assert.ErrorIs(t, err, fosite.ErrInvalidatedAuthorizeCode)
+	})
+}
+
+// isRetryable returns true for errors which transactional stores may return under concurrent access.
+func isRetryable(err error) bool {
+	return errors.Is(err, fosite.ErrSerializationFailure)
+}
@@ -0,0 +1,171 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/ory/x/errorsx"
+)
+
+const (
+	// SubjectTypePublic provides the same subject identifier to all clients.
+	SubjectTypePublic = "public"
+
+	// SubjectTypePairwise provides a different subject identifier to each sector, which prevents clients
+	// of different sectors from correlating the activities of an end-user.
+	SubjectTypePairwise = "pairwise"
+)
+
+// SubjectIdentifierStrategy derives the subject identifier which is presented to a client, for example in
+// the "sub" claim of ID Tokens, JWT access tokens and introspection responses.
+type SubjectIdentifierStrategy interface {
+	// SubjectIdentifier returns the subject identifier of the local subject for the given client.
+	SubjectIdentifier(ctx context.Context, client Client, subject string) (string, error)
+}
+
+var _ SubjectIdentifierStrategy = (*PairwiseSubjectIdentifierStrategy)(nil)
+
+// PairwiseSubjectIdentifierStrategy implements OpenID Connect Core 1.0 Section 8. Clients which have no subject
+// type or the "public" subject type receive the local subject. Clients with the "pairwise" subject type receive
+// an HMAC-SHA256 over their sector identifier and the local subject, keyed with the configured salt.
+//
+// The sector identifier is the host of the client's sector_identifier_uri or, if none is registered, the host
+// of its redirect URIs. Use ValidateSectorIdentifier when registering clients to ensure that the
+// sector_identifier_uri document lists all redirect URIs of the client.
+type PairwiseSubjectIdentifierStrategy struct {
+	Config interface {
+		PairwiseSubjectSaltProvider
+		HTTPClientProvider
+	}
+}
+
+// SubjectIdentifier returns the subject identifier of the local subject for the given client.
+func (s *PairwiseSubjectIdentifierStrategy) SubjectIdentifier(ctx context.Context, client Client, subject string) (string, error) {
+	subjectTypeClient, ok := client.(SubjectTypeClient)
+	if !ok || subject == "" {
+		return subject, nil
+	}
+
+	switch subjectTypeClient.GetSubjectType() {
+	case "", SubjectTypePublic:
+		return subject, nil
+	case SubjectTypePairwise:
+	default:
+		return "", errorsx.WithStack(ErrInvalidClient.WithHintf("The OAuth 2.0 Client uses the unsupported subject type '%s'.", subjectTypeClient.GetSubjectType()))
+	}
+
+	salt := s.Config.GetPairwiseSubjectSalt(ctx)
+	if len(salt) == 0 {
+		return "", errorsx.WithStack(ErrServerError.WithHint("The authorization server is not configured to issue pairwise subject identifiers.").WithDebug("No pairwise subject salt is configured."))
+	}
+
+	sector, err := SectorIdentifier(client)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	_, _ = mac.Write([]byte(sector))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ValidateSectorIdentifier fetches the sector_identifier_uri document of the client, if one is registered, and
+// ensures that it is a JSON array which contains every redirect URI of the client.
+func (s *PairwiseSubjectIdentifierStrategy) ValidateSectorIdentifier(ctx context.Context, client Client) error {
+	var location string
+	if subjectTypeClient, ok := client.(SubjectTypeClient); ok {
+		location = subjectTypeClient.GetSectorIdentifierURI()
+	}
+	if location == "" {
+		_, err := SectorIdentifier(client)
+		return err
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("Unable to parse the 'sector_identifier_uri' of the OAuth 2.0 Client.").WithWrap(err).WithDebug(err.Error()))
+	} else if u.Scheme != "https" || u.Host == "" {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("The 'sector_identifier_uri' of the OAuth 2.0 Client must be an absolute URL using the https scheme."))
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("Unable to fetch the 'sector_identifier_uri' of the OAuth 2.0 Client.").WithWrap(err).WithDebug(err.Error()))
+	}
+
+	res, err := s.Config.GetHTTPClient(ctx).Do(req)
+	if err != nil {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("Unable to fetch the 'sector_identifier_uri' of the OAuth 2.0 Client.").WithWrap(err).WithDebug(err.Error()))
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errorsx.WithStack(ErrInvalidClient.WithHintf("Unable to fetch the 'sector_identifier_uri' of the OAuth 2.0 Client because status code '%d' was received.", res.StatusCode))
+	}
+
+	body, err := readOutboundResponse(ctx, s.Config, res.Body)
+	if err != nil {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("Unable to fetch the 'sector_identifier_uri' of the OAuth 2.0 Client.").WithWrap(err).WithDebug(err.Error()))
+	}
+
+	var redirectURIs []string
+	if err := json.Unmarshal(body, &redirectURIs); err != nil {
+		return errorsx.WithStack(ErrInvalidClient.WithHint("The 'sector_identifier_uri' document of the OAuth 2.0 Client must be a JSON array of redirect URIs.").WithWrap(err).WithDebug(err.Error()))
+	}
+
+	for _, redirectURI := range client.GetRedirectURIs() {
+		if !StringInSlice(redirectURI, redirectURIs) {
+			return errorsx.WithStack(ErrInvalidClient.WithHintf("The 'sector_identifier_uri' document of the OAuth 2.0 Client does not contain the redirect URI '%s'.", redirectURI))
+		}
+	}
+
+	return nil
+}
+
+// SectorIdentifier returns the host of the client's sector_identifier_uri or, if none is registered, the host
+// which all of the client's redirect URIs share.
+func SectorIdentifier(client Client) (string, error) {
+	if subjectTypeClient, ok := client.(SubjectTypeClient); ok && subjectTypeClient.GetSectorIdentifierURI() != "" {
+		location := subjectTypeClient.GetSectorIdentifierURI()
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", errorsx.WithStack(ErrInvalidClient.WithHint("Unable to parse the 'sector_identifier_uri' of the OAuth 2.0 Client.").WithWrap(err).WithDebug(err.Error()))
+		} else if u.Hostname() == "" {
+			return "", errorsx.WithStack(ErrInvalidClient.WithHint("The 'sector_identifier_uri' of the OAuth 2.0 Client must be an absolute URL."))
+		}
+		return strings.ToLower(u.Hostname()), nil
+	}
+
+	var sector string
+	for _, redirectURI := range client.GetRedirectURIs() {
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			return "", errorsx.WithStack(ErrInvalidClient.WithHintf("Unable to parse the redirect URI '%s' of the OAuth 2.0 Client.", redirectURI).WithWrap(err).WithDebug(err.Error()))
+		}
+
+		host := strings.ToLower(u.Hostname())
+		if sector == "" {
+			sector = host
+		} else if sector != host {
+			return "", errorsx.WithStack(ErrInvalidClient.WithHint("The OAuth 2.0 Client must register a 'sector_identifier_uri' because its redirect URIs use more than one host."))
+		}
+	}
+
+	if sector == "" {
+		return "", errorsx.WithStack(ErrInvalidClient.WithHint("Unable to determine the sector identifier of the OAuth 2.0 Client because it has neither a 'sector_identifier_uri' nor redirect URIs."))
+	}
+
+	return sector, nil
+}
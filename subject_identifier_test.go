@@ -0,0 +1,153 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type subjectTypeClient struct {
+	*DefaultClient
+	subjectType string
+}
+
+func (c *subjectTypeClient) GetSubjectType() string         { return c.subjectType }
+func (c *subjectTypeClient) GetSectorIdentifierURI() string { return "" }
+
+func TestPairwiseSubjectIdentifierStrategy(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{PairwiseSubjectSalt: []byte("some-salt")}
+	s := config.GetSubjectIdentifierStrategy(ctx)
+
+	newClient := func(subjectType, sectorIdentifierURI string, redirectURIs ...string) Client {
+		return &DefaultOpenIDConnectClient{
+			DefaultClient:       &DefaultClient{ID: "foo", RedirectURIs: redirectURIs},
+			SubjectType:         subjectType,
+			SectorIdentifierURI: sectorIdentifierURI,
+		}
+	}
+
+	t.Run("case=public subjects are not modified", func(t *testing.T) {
+		for _, c := range []Client{
+			&DefaultClient{ID: "foo"},
+			newClient("", "", "https://a.example.com/cb"),
+			newClient(SubjectTypePublic, "", "https://a.example.com/cb"),
+		} {
+			sub, err := s.SubjectIdentifier(ctx, c, "peter")
+			require.NoError(t, err)
+			assert.Equal(t, "peter", sub)
+		}
+	})
+
+	t.Run("case=pairwise subjects are derived per sector", func(t *testing.T) {
+		a1, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://a.example.com/cb", "https://a.example.com/other"), "peter")
+		require.NoError(t, err)
+		a2, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://A.example.com:8443/cb"), "peter")
+		require.NoError(t, err)
+		b, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://b.example.com/cb"), "peter")
+		require.NoError(t, err)
+		sector, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "https://a.example.com/sector.json", "https://b.example.com/cb", "https://c.example.com/cb"), "peter")
+		require.NoError(t, err)
+		other, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://a.example.com/cb"), "alice")
+		require.NoError(t, err)
+
+		assert.NotEqual(t, "peter", a1)
+		assert.Equal(t, a1, a2)
+		assert.Equal(t, a1, sector)
+		assert.NotEqual(t, a1, b)
+		assert.NotEqual(t, a1, other)
+	})
+
+	t.Run("case=clients which are not OpenID Connect clients select the subject type", func(t *testing.T) {
+		expected, err := s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://a.example.com/cb"), "peter")
+		require.NoError(t, err)
+
+		c := &subjectTypeClient{DefaultClient: &DefaultClient{ID: "foo", RedirectURIs: []string{"https://a.example.com/cb"}}, subjectType: SubjectTypePairwise}
+		_, ok := Client(c).(OpenIDConnectClient)
+		require.False(t, ok)
+
+		actual, err := s.SubjectIdentifier(ctx, c, "peter")
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("case=pairwise subjects depend on the salt", func(t *testing.T) {
+		c := newClient(SubjectTypePairwise, "", "https://a.example.com/cb")
+		expected, err := s.SubjectIdentifier(ctx, c, "peter")
+		require.NoError(t, err)
+
+		actual, err := (&PairwiseSubjectIdentifierStrategy{Config: &Config{PairwiseSubjectSalt: []byte("other-salt")}}).SubjectIdentifier(ctx, c, "peter")
+		require.NoError(t, err)
+		assert.NotEqual(t, expected, actual)
+	})
+
+	t.Run("case=errors", func(t *testing.T) {
+		_, err := (&PairwiseSubjectIdentifierStrategy{Config: new(Config)}).SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://a.example.com/cb"), "peter")
+		assert.ErrorIs(t, err, ErrServerError)
+
+		_, err = s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, "", "https://a.example.com/cb", "https://b.example.com/cb"), "peter")
+		assert.ErrorIs(t, err, ErrInvalidClient)
+
+		_, err = s.SubjectIdentifier(ctx, newClient(SubjectTypePairwise, ""), "peter")
+		assert.ErrorIs(t, err, ErrInvalidClient)
+
+		_, err = s.SubjectIdentifier(ctx, newClient("unknown", "", "https://a.example.com/cb"), "peter")
+		assert.ErrorIs(t, err, ErrInvalidClient)
+	})
+}
+
+func TestPairwiseSubjectIdentifierStrategyValidateSectorIdentifier(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sector.json":
+			require.NoError(t, json.NewEncoder(w).Encode([]string{"https://a.example.com/cb", "https://b.example.com/cb"}))
+		case "/invalid.json":
+			_, _ = w.Write([]byte(`{"redirect_uris":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	hc := retryablehttp.NewClient()
+	hc.RetryMax = 0
+	hc.HTTPClient = ts.Client()
+	s := &PairwiseSubjectIdentifierStrategy{Config: &Config{HTTPClient: hc, DisableOutboundHTTPPolicy: true}}
+
+	for _, tc := range []struct {
+		d                   string
+		sectorIdentifierURI string
+		redirectURIs        []string
+		err                 bool
+	}{
+		{d: "all redirect URIs are listed", sectorIdentifierURI: ts.URL + "/sector.json", redirectURIs: []string{"https://a.example.com/cb", "https://b.example.com/cb"}},
+		{d: "a redirect URI is missing", sectorIdentifierURI: ts.URL + "/sector.json", redirectURIs: []string{"https://a.example.com/cb", "https://c.example.com/cb"}, err: true},
+		{d: "the document is not an array", sectorIdentifierURI: ts.URL + "/invalid.json", redirectURIs: []string{"https://a.example.com/cb"}, err: true},
+		{d: "the document does not exist", sectorIdentifierURI: ts.URL + "/not-found.json", redirectURIs: []string{"https://a.example.com/cb"}, err: true},
+		{d: "the location must use https", sectorIdentifierURI: "http://a.example.com/sector.json", redirectURIs: []string{"https://a.example.com/cb"}, err: true},
+		{d: "no document and a single host", redirectURIs: []string{"https://a.example.com/cb", "https://a.example.com/other"}},
+		{d: "no document and several hosts", redirectURIs: []string{"https://a.example.com/cb", "https://b.example.com/cb"}, err: true},
+	} {
+		t.Run("case="+tc.d, func(t *testing.T) {
+			err := s.ValidateSectorIdentifier(ctx, &DefaultOpenIDConnectClient{
+				DefaultClient:       &DefaultClient{ID: "foo", RedirectURIs: tc.redirectURIs},
+				SectorIdentifierURI: tc.sectorIdentifierURI,
+			})
+			if tc.err {
+				assert.ErrorIs(t, err, ErrInvalidClient)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
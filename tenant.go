@@ -0,0 +1,81 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ory/x/errorsx"
+)
+
+// TenantContextKey is the context key of the tenant ID, see WithTenant.
+const TenantContextKey = ContextKey("tenant")
+
+// WithTenant returns a copy of ctx which carries the given tenant ID. Tenant-aware components such as
+// MultiTenantConfig resolve their state from it.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, TenantContextKey, tenant)
+}
+
+// TenantFromContext returns the tenant ID stored in ctx, or an empty string if there is none.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(TenantContextKey).(string)
+	return tenant
+}
+
+// TenantResolver determines the tenant an HTTP request is addressed to.
+type TenantResolver interface {
+	// ResolveTenant returns the tenant ID of the request, or an error wrapping ErrNotFound if the request is not
+	// addressed to a known tenant.
+	ResolveTenant(r *http.Request) (string, error)
+}
+
+// TenantResolverFunc is a function which implements TenantResolver.
+type TenantResolverFunc func(r *http.Request) (string, error)
+
+func (f TenantResolverFunc) ResolveTenant(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// HostTenantResolver resolves tenants by the host the request is addressed to. It maps host names, without port, to
+// tenant IDs.
+type HostTenantResolver map[string]string
+
+func (m HostTenantResolver) ResolveTenant(r *http.Request) (string, error) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	tenant, ok := m[strings.ToLower(host)]
+	if !ok {
+		return "", errorsx.WithStack(ErrNotFound.WithHintf("No tenant is registered for host '%s'.", host))
+	}
+	return tenant, nil
+}
+
+// PathPrefixTenantResolver resolves tenants by the prefix of the request path. It maps path prefixes, such as
+// "/tenants/foo", to tenant IDs. If several prefixes match, the longest one wins. Prefixes only match complete path
+// segments, "/tenants/foo" therefore matches "/tenants/foo/oauth2/auth" but not "/tenants/foobar/oauth2/auth".
+type PathPrefixTenantResolver map[string]string
+
+func (m PathPrefixTenantResolver) ResolveTenant(r *http.Request) (string, error) {
+	var tenant, longest string
+	for prefix, t := range m {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			continue
+		} else if len(prefix) >= len(longest) {
+			tenant, longest = t, prefix
+		}
+	}
+
+	if tenant == "" {
+		return "", errorsx.WithStack(ErrNotFound.WithHintf("No tenant is registered for path '%s'.", r.URL.Path))
+	}
+	return tenant, nil
+}
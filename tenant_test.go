@@ -0,0 +1,238 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package fosite_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/ory/fosite"
+	"github.com/ory/fosite/compose"
+	"github.com/ory/fosite/internal/gen"
+	"github.com/ory/fosite/storage"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	hosts := HostTenantResolver{"foo.example.com": "foo", "bar.example.com": "bar"}
+	paths := PathPrefixTenantResolver{"/tenants/foo": "foo", "/tenants/foo/bar/": "bar"}
+
+	for _, c := range []struct {
+		resolver TenantResolver
+		url      string
+		expected string
+	}{
+		{resolver: hosts, url: "https://foo.example.com/oauth2/auth", expected: "foo"},
+		{resolver: hosts, url: "https://BAR.example.com:8443/oauth2/auth", expected: "bar"},
+		{resolver: hosts, url: "https://baz.example.com/oauth2/auth"},
+		{resolver: paths, url: "https://example.com/tenants/foo/oauth2/auth", expected: "foo"},
+		{resolver: paths, url: "https://example.com/tenants/foo", expected: "foo"},
+		{resolver: paths, url: "https://example.com/tenants/foo/bar/oauth2/auth", expected: "bar"},
+		{resolver: paths, url: "https://example.com/tenants/foobar/oauth2/auth"},
+		{resolver: paths, url: "https://example.com/oauth2/auth"},
+	} {
+		t.Run("url="+c.url, func(t *testing.T) {
+			tenant, err := c.resolver.ResolveTenant(httptest.NewRequest("GET", c.url, nil))
+			if c.expected == "" {
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, tenant)
+		})
+	}
+}
+
+func TestMultiTenantConfig(t *testing.T) {
+	ctx := context.Background()
+	loads := map[string]int{}
+	config := NewMultiTenantConfig(func(_ context.Context, tenant string) (*Config, error) {
+		if tenant == "unknown" {
+			return nil, errors.WithStack(ErrNotFound)
+		}
+		loads[tenant]++
+		return &Config{IDTokenIssuer: "https://" + tenant + ".example.com", AccessTokenLifespan: time.Duration(loads[tenant]) * time.Minute}, nil
+	})
+	config.Default.IDTokenIssuer = "https://example.com"
+
+	fooCtx, err := config.ContextWithTenant(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", TenantFromContext(fooCtx))
+	assert.Equal(t, "https://foo.example.com", config.GetIDTokenIssuer(fooCtx))
+	assert.Equal(t, "https://bar.example.com", config.GetIDTokenIssuer(WithTenant(ctx, "bar")))
+	assert.Equal(t, "https://example.com", config.GetIDTokenIssuer(ctx))
+
+	_, err = config.ContextWithTenant(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	t.Run("case=unknown tenants do not use the default configuration", func(t *testing.T) {
+		config.Default.GlobalSecret = []byte("some-super-cool-secret-that-nobody-knows")
+		unknownCtx := WithTenant(ctx, "unknown")
+
+		assert.Empty(t, config.GetIDTokenIssuer(unknownCtx))
+		_, err := config.GetGlobalSecret(unknownCtx)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = config.GetRotatedGlobalSecrets(unknownCtx)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = config.GetHMACKeys(unknownCtx)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		secret, err := config.GetGlobalSecret(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, config.Default.GlobalSecret, secret)
+	})
+
+	t.Run("case=caches tenant configurations", func(t *testing.T) {
+		assert.Equal(t, time.Minute, config.GetAccessTokenLifespan(WithTenant(ctx, "foo")))
+		assert.Equal(t, 1, loads["foo"])
+
+		config.Invalidate("foo")
+		assert.Equal(t, 2*time.Minute, config.GetAccessTokenLifespan(WithTenant(ctx, "foo")))
+		assert.Equal(t, 2, loads["foo"])
+	})
+
+	t.Run("case=expires cached tenant configurations", func(t *testing.T) {
+		now := time.Now()
+		config.Default.Clock = FixedClock(now)
+		config.CacheLifespan = time.Hour
+		config.Invalidate("foo")
+		config.GetAccessTokenLifespan(WithTenant(ctx, "foo"))
+
+		config.Default.Clock = FixedClock(now.Add(time.Minute))
+		assert.Equal(t, 3*time.Minute, config.GetAccessTokenLifespan(WithTenant(ctx, "foo")))
+
+		config.Default.Clock = FixedClock(now.Add(2 * time.Hour))
+		assert.Equal(t, 4*time.Minute, config.GetAccessTokenLifespan(WithTenant(ctx, "foo")))
+	})
+}
+
+func TestMultiTenantConfigConcurrentLoads(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	config := NewMultiTenantConfig(func(_ context.Context, tenant string) (*Config, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &Config{IDTokenIssuer: "https://" + tenant + ".example.com"}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := config.TenantConfig(context.Background(), "foo")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://foo.example.com", c.IDTokenIssuer)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&loads), "concurrent requests share one load")
+}
+
+func TestMultiTenantProvider(t *testing.T) {
+	store := storage.NewMultiTenantMemoryStore()
+	secret, err := (&BCrypt{Config: &Config{HashCost: 4}}).Hash(context.Background(), []byte("foobar"))
+	require.NoError(t, err)
+	for _, tenant := range []string{"foo", "bar"} {
+		store.Tenant(tenant).Clients[tenant+"-client"] = &DefaultClient{
+			ID:         tenant + "-client",
+			Secret:     secret,
+			GrantTypes: []string{"client_credentials"},
+		}
+	}
+
+	config := NewMultiTenantConfig(func(_ context.Context, tenant string) (*Config, error) {
+		config := &Config{
+			IDTokenIssuer:       "https://" + tenant + ".example.com",
+			GlobalSecret:        []byte("some-super-cool-secret-of-" + tenant + "-that-nobody-knows"),
+			AccessTokenLifespan: time.Hour,
+			HashCost:            4,
+		}
+		compose.ComposeAllEnabled(config, store.Tenant(tenant), gen.MustRSAKey())
+		return config, nil
+	})
+	provider := NewOAuth2Provider(store, config)
+	resolver := HostTenantResolver{"foo.example.com": "foo", "bar.example.com": "bar"}
+
+	issue := func(host, clientID string) (string, error) {
+		req := httptest.NewRequest("POST", "https://"+host+"/oauth2/token", strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, "foobar")
+
+		ctx, err := config.ContextFromRequest(req, resolver)
+		require.NoError(t, err)
+
+		ar, err := provider.NewAccessRequest(ctx, req, new(DefaultSession))
+		if err != nil {
+			return "", err
+		}
+		resp, err := provider.NewAccessResponse(ctx, ar)
+		if err != nil {
+			return "", err
+		}
+		return resp.GetAccessToken(), nil
+	}
+
+	token, err := issue("foo.example.com", "foo-client")
+	require.NoError(t, err)
+
+	_, err = issue("bar.example.com", "foo-client")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, _, err = provider.IntrospectToken(WithTenant(context.Background(), "foo"), token, AccessToken, new(DefaultSession))
+	assert.NoError(t, err)
+	_, _, err = provider.IntrospectToken(WithTenant(context.Background(), "bar"), token, AccessToken, new(DefaultSession))
+	assert.Error(t, err)
+
+	_, err = issue("bar.example.com", "bar-client")
+	require.NoError(t, err)
+}
+
+func TestMultiTenantProviderUnknownTenant(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMultiTenantMemoryStore()
+	secret, err := (&BCrypt{Config: &Config{HashCost: 4}}).Hash(ctx, []byte("foobar"))
+	require.NoError(t, err)
+	store.Tenant("").Clients["default-client"] = &DefaultClient{
+		ID:         "default-client",
+		Secret:     secret,
+		GrantTypes: []string{"client_credentials"},
+	}
+
+	config := NewMultiTenantConfig(func(_ context.Context, tenant string) (*Config, error) {
+		return nil, errors.WithStack(ErrNotFound)
+	})
+	config.Default = &Config{
+		GlobalSecret:        []byte("some-super-cool-secret-of-the-default-tenant"),
+		AccessTokenLifespan: time.Hour,
+		HashCost:            4,
+	}
+	compose.ComposeAllEnabled(config.Default, store.Tenant(""), gen.MustRSAKey())
+	provider := NewOAuth2Provider(store, config)
+
+	req := httptest.NewRequest("POST", "https://example.com/oauth2/token", strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("default-client", "foobar")
+	ar, err := provider.NewAccessRequest(ctx, req, new(DefaultSession))
+	require.NoError(t, err)
+	resp, err := provider.NewAccessResponse(ctx, ar)
+	require.NoError(t, err)
+
+	_, _, err = provider.IntrospectToken(ctx, resp.GetAccessToken(), AccessToken, new(DefaultSession))
+	require.NoError(t, err)
+	_, _, err = provider.IntrospectToken(WithTenant(ctx, "unknown"), resp.GetAccessToken(), AccessToken, new(DefaultSession))
+	assert.Error(t, err, "an unknown tenant must not validate tokens of the default configuration")
+}
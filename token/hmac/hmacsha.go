@@ -3,6 +3,10 @@
 
 // Package hmac is the default implementation for generating and validating challenges. It uses SHA-512/256 to
 // generate and validate challenges.
+//
+// Tokens have the format "<key>.<signature>" and are validated against the global secret and every rotated global
+// secret. If HMAC keys are configured, tokens have the format "v1.<key id>.<key>.<signature>" instead, and are
+// validated using only the secret with the embedded key identifier.
 
 package hmac
 
@@ -13,7 +17,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/ory/x/errorsx"
 
@@ -22,6 +26,9 @@ import (
 	"github.com/ory/fosite"
 )
 
+// HMACStrategyConfigurator is the configuration of the HMACStrategy. If it implements fosite.HMACKeysProvider,
+// the HMAC keys are used to generate key-identified tokens, and if it implements fosite.ClockProvider, the clock
+// selects the active key.
 type HMACStrategyConfigurator interface {
 	fosite.TokenEntropyProvider
 	fosite.GlobalSecretProvider
@@ -29,9 +36,8 @@ type HMACStrategyConfigurator interface {
 	fosite.HMACHashingProvider
 }
 
-// HMACStrategy is responsible for generating and validating challenges.
+// HMACStrategy is responsible for generating and validating challenges. It is safe for concurrent use.
 type HMACStrategy struct {
-	sync.Mutex
 	Config HMACStrategyConfigurator
 }
 
@@ -41,6 +47,9 @@ const (
 
 	// the secrets (client and global) should each have at least 16 characters making it harder to guess them
 	minimumSecretLength = 32
+
+	// keyIdentifiedVersion is the first segment of key-identified tokens.
+	keyIdentifiedVersion = "v1"
 )
 
 var b64 = base64.URLEncoding.WithPadding(base64.NoPadding)
@@ -48,8 +57,13 @@ var b64 = base64.URLEncoding.WithPadding(base64.NoPadding)
 // Generate generates a token and a matching signature or returns an error.
 // This method implements rfc6819 Section 5.1.4.2.2: Use High Entropy for Secrets.
 func (c *HMACStrategy) Generate(ctx context.Context) (string, string, error) {
-	c.Lock()
-	defer c.Unlock()
+	keys, err := c.hmacKeys(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if len(keys) > 0 {
+		return c.generateKeyIdentified(ctx, keys)
+	}
 
 	secrets, err := c.Config.GetGlobalSecret(ctx)
 	if err != nil {
@@ -63,6 +77,35 @@ func (c *HMACStrategy) Generate(ctx context.Context) (string, string, error) {
 	var signingKey [32]byte
 	copy(signingKey[:], secrets)
 
+	tokenKey, err := c.randomTokenKey(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	signature := c.generateHMAC(ctx, tokenKey, signingKey[:])
+
+	encodedSignature := b64.EncodeToString(signature)
+	encodedToken := fmt.Sprintf("%s.%s", b64.EncodeToString(tokenKey), encodedSignature)
+	return encodedToken, encodedSignature, nil
+}
+
+func (c *HMACStrategy) generateKeyIdentified(ctx context.Context, keys []fosite.HMACKey) (string, string, error) {
+	key, err := signingKey(keys, c.now(ctx))
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenKey, err := c.randomTokenKey(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	encodedToken := keyIdentifiedVersion + "." + key.ID + "." + b64.EncodeToString(tokenKey)
+	encodedSignature := b64.EncodeToString(c.generateHMAC(ctx, []byte(encodedToken), key.Secret))
+	return encodedToken + "." + encodedSignature, encodedSignature, nil
+}
+
+func (c *HMACStrategy) randomTokenKey(ctx context.Context) ([]byte, error) {
 	entropy := c.Config.GetTokenEntropy(ctx)
 	if entropy < minimumEntropy {
 		entropy = minimumEntropy
@@ -77,18 +120,17 @@ func (c *HMACStrategy) Generate(ctx context.Context) (string, string, error) {
 	// by the authorization server.
 	tokenKey, err := RandomBytes(entropy)
 	if err != nil {
-		return "", "", errorsx.WithStack(err)
+		return nil, errorsx.WithStack(err)
 	}
-
-	signature := c.generateHMAC(ctx, tokenKey, &signingKey)
-
-	encodedSignature := b64.EncodeToString(signature)
-	encodedToken := fmt.Sprintf("%s.%s", b64.EncodeToString(tokenKey), encodedSignature)
-	return encodedToken, encodedSignature, nil
+	return tokenKey, nil
 }
 
 // Validate validates a token and returns its signature or an error if the token is not valid.
 func (c *HMACStrategy) Validate(ctx context.Context, token string) (err error) {
+	if strings.HasPrefix(token, keyIdentifiedVersion+".") {
+		return c.validateKeyIdentified(ctx, token)
+	}
+
 	var keys [][]byte
 
 	secrets, err := c.Config.GetGlobalSecret(ctx)
@@ -151,7 +193,7 @@ func (c *HMACStrategy) validate(ctx context.Context, secret []byte, token string
 		return errorsx.WithStack(err)
 	}
 
-	expectedMAC := c.generateHMAC(ctx, decodedTokenKey, &signingKey)
+	expectedMAC := c.generateHMAC(ctx, decodedTokenKey, signingKey[:])
 	if !hmac.Equal(expectedMAC, decodedTokenSignature) {
 		// Hash is invalid
 		return errorsx.WithStack(fosite.ErrTokenSignatureMismatch)
@@ -160,22 +202,100 @@ func (c *HMACStrategy) validate(ctx context.Context, secret []byte, token string
 	return nil
 }
 
+func (c *HMACStrategy) validateKeyIdentified(ctx context.Context, token string) error {
+	split := strings.Split(token, ".")
+	if len(split) != 4 || split[1] == "" || split[2] == "" || split[3] == "" {
+		return errorsx.WithStack(fosite.ErrInvalidTokenFormat)
+	}
+
+	decodedTokenSignature, err := b64.DecodeString(split[3])
+	if err != nil {
+		return errorsx.WithStack(err)
+	}
+
+	keys, err := c.hmacKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := verificationKey(keys, split[1], c.now(ctx))
+	if key == nil {
+		return errorsx.WithStack(fosite.ErrTokenSignatureMismatch)
+	}
+	if len(key.Secret) < minimumSecretLength {
+		return errors.Errorf("secret %q for signing HMAC-SHA512/256 is expected to be 32 byte long, got %d byte", key.ID, len(key.Secret))
+	}
+
+	expectedMAC := c.generateHMAC(ctx, []byte(token[:len(token)-len(split[3])-1]), key.Secret)
+	if !hmac.Equal(expectedMAC, decodedTokenSignature) {
+		return errorsx.WithStack(fosite.ErrTokenSignatureMismatch)
+	}
+
+	return nil
+}
+
+// signingKey returns the key which was activated last among the keys which may currently sign tokens.
+func signingKey(keys []fosite.HMACKey, now time.Time) (*fosite.HMACKey, error) {
+	var active *fosite.HMACKey
+	for i := range keys {
+		if keys[i].CanSign(now) && (active == nil || keys[i].NotBefore.After(active.NotBefore)) {
+			active = &keys[i]
+		}
+	}
+
+	if active == nil {
+		return nil, errors.New("none of the keys for signing HMAC-SHA512/256 is active")
+	}
+	if !isValidKeyID(active.ID) {
+		return nil, errors.Errorf("key id %q for signing HMAC-SHA512/256 must be a non-empty string of URL-safe base64 characters", active.ID)
+	}
+	if len(active.Secret) < minimumSecretLength {
+		return nil, errors.Errorf("secret %q for signing HMAC-SHA512/256 is expected to be 32 byte long, got %d byte", active.ID, len(active.Secret))
+	}
+	return active, nil
+}
+
+// verificationKey returns the key with the given id if it may currently validate tokens.
+func verificationKey(keys []fosite.HMACKey, id string, now time.Time) *fosite.HMACKey {
+	for i := range keys {
+		if keys[i].ID == id && keys[i].CanVerify(now) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func isValidKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *HMACStrategy) Signature(token string) string {
 	split := strings.Split(token, ".")
 
-	if len(split) != 2 {
-		return ""
+	switch {
+	case len(split) == 2:
+		return split[1]
+	case len(split) == 4 && split[0] == keyIdentifiedVersion:
+		return split[3]
 	}
 
-	return split[1]
+	return ""
 }
 
-func (c *HMACStrategy) generateHMAC(ctx context.Context, data []byte, key *[32]byte) []byte {
+func (c *HMACStrategy) generateHMAC(ctx context.Context, data []byte, key []byte) []byte {
 	hasher := c.Config.GetHMACHasher(ctx)
 	if hasher == nil {
 		hasher = sha512.New512_256
 	}
-	h := hmac.New(hasher, key[:])
+	h := hmac.New(hasher, key)
 	// sha512.digest.Write() always returns nil for err, the panic should never happen
 	_, err := h.Write(data)
 	if err != nil {
@@ -183,3 +303,21 @@ func (c *HMACStrategy) generateHMAC(ctx context.Context, data []byte, key *[32]b
 	}
 	return h.Sum(nil)
 }
+
+// hmacKeys returns the configured HMAC keys, or none if the configuration does not implement
+// fosite.HMACKeysProvider.
+func (c *HMACStrategy) hmacKeys(ctx context.Context) ([]fosite.HMACKey, error) {
+	if p, ok := c.Config.(fosite.HMACKeysProvider); ok {
+		return p.GetHMACKeys(ctx)
+	}
+	return nil, nil
+}
+
+// now returns the time of the configured clock, or of fosite.DefaultClock if the configuration does not implement
+// fosite.ClockProvider.
+func (c *HMACStrategy) now(ctx context.Context) time.Time {
+	if p, ok := c.Config.(fosite.ClockProvider); ok {
+		return p.GetClock(ctx).Now()
+	}
+	return fosite.DefaultClock.Now()
+}
@@ -6,7 +6,10 @@ package hmac
 import (
 	"context"
 	"crypto/sha512"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ory/fosite"
 
@@ -133,3 +136,152 @@ func TestCustomHMAC(t *testing.T) {
 	require.NoError(t, sha512.Validate(context.Background(), token512))
 	require.EqualError(t, def.Validate(context.Background(), token512), fosite.ErrTokenSignatureMismatch.Error())
 }
+
+func TestKeyIdentified(t *testing.T) {
+	ctx := context.Background()
+	config := &fosite.Config{
+		GlobalSecret: []byte("1234567890123456789012345678901234567890"),
+		HMACKeys: []fosite.HMACKey{
+			{ID: "a", Secret: []byte("aaaaaaaa90123456789012345678901234567890")},
+		},
+	}
+	cg := HMACStrategy{Config: config}
+
+	legacy, _, err := (&HMACStrategy{Config: &fosite.Config{GlobalSecret: config.GlobalSecret}}).Generate(ctx)
+	require.NoError(t, err)
+
+	token, signature, err := cg.Generate(ctx)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v1.a."), token)
+	assert.Len(t, strings.Split(token, "."), 4)
+	assert.Equal(t, signature, cg.Signature(token))
+
+	require.NoError(t, cg.Validate(ctx, token))
+	require.NoError(t, cg.Validate(ctx, legacy), "tokens generated with the global secret remain valid")
+
+	t.Run("case=rejects tokens with a different key id", func(t *testing.T) {
+		config.HMACKeys = append(config.HMACKeys, fosite.HMACKey{ID: "b", Secret: config.HMACKeys[0].Secret})
+		defer func() { config.HMACKeys = config.HMACKeys[:1] }()
+
+		assert.ErrorIs(t, cg.Validate(ctx, strings.Replace(token, "v1.a.", "v1.b.", 1)), fosite.ErrTokenSignatureMismatch)
+		assert.ErrorIs(t, cg.Validate(ctx, strings.Replace(token, "v1.a.", "v1.c.", 1)), fosite.ErrTokenSignatureMismatch)
+	})
+
+	t.Run("case=rejects malformed tokens", func(t *testing.T) {
+		for _, c := range []string{"v1.", "v1.a", "v1.a.b", "v1..b.c", "v1.a.b.", "v1.a.b.c.d"} {
+			assert.Error(t, cg.Validate(ctx, c), c)
+		}
+	})
+
+	t.Run("case=rejects invalid keys", func(t *testing.T) {
+		for _, keys := range [][]fosite.HMACKey{
+			{{ID: "a", Secret: []byte("short")}},
+			{{ID: "a.b", Secret: config.HMACKeys[0].Secret}},
+			{{ID: "", Secret: config.HMACKeys[0].Secret}},
+			{{ID: "a", Secret: config.HMACKeys[0].Secret, NotAfter: time.Now().Add(-time.Minute)}},
+		} {
+			_, _, err := (&HMACStrategy{Config: &fosite.Config{HMACKeys: keys}}).Generate(ctx)
+			assert.Error(t, err, "%+v", keys)
+		}
+	})
+}
+
+func TestKeyIdentifiedRollover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := &fosite.Config{
+		Clock: fosite.FixedClock(now),
+		HMACKeys: []fosite.HMACKey{
+			{ID: "2023", Secret: []byte("aaaaaaaa90123456789012345678901234567890"), NotAfter: now.Add(2 * time.Hour)},
+			{ID: "2024", Secret: []byte("bbbbbbbb90123456789012345678901234567890"), NotBefore: now.Add(time.Hour)},
+		},
+	}
+	cg := HMACStrategy{Config: config}
+
+	previous, _, err := cg.Generate(ctx)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(previous, "v1.2023."), previous)
+
+	config.Clock = fosite.FixedClock(now.Add(time.Hour))
+	next, _, err := cg.Generate(ctx)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(next, "v1.2024."), next)
+	require.NoError(t, cg.Validate(ctx, previous), "the previous key overlaps with the next key")
+
+	config.Clock = fosite.FixedClock(now.Add(2 * time.Hour))
+	assert.ErrorIs(t, cg.Validate(ctx, previous), fosite.ErrTokenSignatureMismatch)
+	require.NoError(t, cg.Validate(ctx, next))
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	for name, config := range map[string]*fosite.Config{
+		"format=legacy": {GlobalSecret: []byte("1234567890123456789012345678901234567890")},
+		"format=v1": {HMACKeys: []fosite.HMACKey{
+			{ID: "a", Secret: []byte("1234567890123456789012345678901234567890")},
+		}},
+	} {
+		cg := &HMACStrategy{Config: config}
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, _, err := cg.Generate(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	ctx := context.Background()
+	secret := func(i int) []byte {
+		return []byte(fmt.Sprintf("%08d90123456789012345678901234567890", i))
+	}
+
+	for _, rotated := range []int{1, 10, 100} {
+		legacy := &fosite.Config{GlobalSecret: secret(0)}
+		keyed := &fosite.Config{HMACKeys: []fosite.HMACKey{{ID: "0", Secret: secret(0)}}}
+		for i := 1; i <= rotated; i++ {
+			legacy.RotatedGlobalSecrets = append(legacy.RotatedGlobalSecrets, secret(i))
+			keyed.HMACKeys = append(keyed.HMACKeys, fosite.HMACKey{ID: fmt.Sprint(i), Secret: secret(i)})
+		}
+
+		for name, config := range map[string]*fosite.Config{"format=legacy": legacy, "format=v1": keyed} {
+			// Validate a token generated with the oldest secret, which is the worst case for the legacy format.
+			oldest := &fosite.Config{GlobalSecret: secret(rotated), HMACKeys: []fosite.HMACKey{{ID: fmt.Sprint(rotated), Secret: secret(rotated)}}}
+			if name == "format=legacy" {
+				oldest.HMACKeys = nil
+			}
+			token, _, err := (&HMACStrategy{Config: oldest}).Generate(ctx)
+			require.NoError(b, err)
+
+			cg := &HMACStrategy{Config: config}
+			b.Run(fmt.Sprintf("%s/rotated=%d", name, rotated), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if err := cg.Validate(ctx, token); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// minimalConfig only implements the providers HMACStrategyConfigurator requires.
+type minimalConfig struct {
+	HMACStrategyConfigurator
+}
+
+func TestMinimalConfigurator(t *testing.T) {
+	ctx := context.Background()
+	cg := HMACStrategy{Config: minimalConfig{&fosite.Config{GlobalSecret: []byte("1234567890123456789012345678901234567890")}}}
+
+	token, signature, err := cg.Generate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(token, ".")+1)
+	assert.Equal(t, signature, cg.Signature(token))
+	require.NoError(t, cg.Validate(ctx, token))
+}
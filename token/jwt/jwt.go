@@ -37,6 +37,17 @@ type GetPrivateKeyFunc func(ctx context.Context) (interface{}, error)
 // DefaultSigner is responsible for generating and validating JWT challenges
 type DefaultSigner struct {
 	GetPrivateKey GetPrivateKeyFunc
+
+	// GetParserOptions optionally returns the options used by Validate and Decode, for example to validate
+	// time based claims with a different clock.
+	GetParserOptions func(ctx context.Context) []ParserOption
+}
+
+func (j *DefaultSigner) parserOptions(ctx context.Context) []ParserOption {
+	if j.GetParserOptions == nil {
+		return nil
+	}
+	return j.GetParserOptions(ctx)
 }
 
 // Generate generates a new authorize code or returns an error. set secret
@@ -92,11 +103,11 @@ func (j *DefaultSigner) Validate(ctx context.Context, token string) (string, err
 
 	switch t := key.(type) {
 	case *rsa.PrivateKey:
-		return validateToken(token, t.PublicKey)
+		return validateToken(token, t.PublicKey, j.parserOptions(ctx)...)
 	case *ecdsa.PrivateKey:
-		return validateToken(token, t.PublicKey)
+		return validateToken(token, t.PublicKey, j.parserOptions(ctx)...)
 	case jose.OpaqueSigner:
-		return validateToken(token, t.Public().Key)
+		return validateToken(token, t.Public().Key, j.parserOptions(ctx)...)
 	default:
 		return "", errors.New("Unable to validate token. Invalid PrivateKey type")
 	}
@@ -115,11 +126,11 @@ func (j *DefaultSigner) Decode(ctx context.Context, token string) (*Token, error
 
 	switch t := key.(type) {
 	case *rsa.PrivateKey:
-		return decodeToken(token, t.PublicKey)
+		return decodeToken(token, t.PublicKey, j.parserOptions(ctx)...)
 	case *ecdsa.PrivateKey:
-		return decodeToken(token, t.PublicKey)
+		return decodeToken(token, t.PublicKey, j.parserOptions(ctx)...)
 	case jose.OpaqueSigner:
-		return decodeToken(token, t.Public().Key)
+		return decodeToken(token, t.Public().Key, j.parserOptions(ctx)...)
 	default:
 		return nil, errors.New("Unable to decode token. Invalid PrivateKey type")
 	}
@@ -158,13 +169,13 @@ func generateToken(claims MapClaims, header Mapper, signingMethod jose.Signature
 	return
 }
 
-func decodeToken(token string, verificationKey interface{}) (*Token, error) {
+func decodeToken(token string, verificationKey interface{}, opts ...ParserOption) (*Token, error) {
 	keyFunc := func(*Token) (interface{}, error) { return verificationKey, nil }
-	return ParseWithClaims(token, MapClaims{}, keyFunc)
+	return ParseWithClaims(token, MapClaims{}, keyFunc, opts...)
 }
 
-func validateToken(tokenStr string, verificationKey interface{}) (string, error) {
-	_, err := decodeToken(tokenStr, verificationKey)
+func validateToken(tokenStr string, verificationKey interface{}, opts ...ParserOption) (string, error) {
+	_, err := decodeToken(tokenStr, verificationKey, opts...)
 	if err != nil {
 		return "", err
 	}
@@ -108,20 +108,28 @@ func (m MapClaims) toInt64(claim string) (int64, bool) {
 // As well, if any of the above claims are not in the token, it will still
 // be considered a valid claim.
 func (m MapClaims) Valid() error {
+	return m.ValidWithLeeway(TimeFunc(), 0)
+}
+
+// ValidWithLeeway validates the time based claims "exp, iat, nbf" at the given time, tolerating
+// a clock skew of leeway. If any of the above claims are not in the token, it will still be considered
+// a valid claim.
+func (m MapClaims) ValidWithLeeway(at time.Time, leeway time.Duration) error {
 	vErr := new(ValidationError)
-	now := TimeFunc().Unix()
+	now := at.Unix()
+	skew := int64(leeway / time.Second)
 
-	if !m.VerifyExpiresAt(now, false) {
+	if !m.VerifyExpiresAt(now-skew, false) {
 		vErr.Inner = errors.New("Token is expired")
 		vErr.Errors |= ValidationErrorExpired
 	}
 
-	if !m.VerifyIssuedAt(now, false) {
+	if !m.VerifyIssuedAt(now+skew, false) {
 		vErr.Inner = errors.New("Token used before issued")
 		vErr.Errors |= ValidationErrorIssuedAt
 	}
 
-	if !m.VerifyNotBefore(now, false) {
+	if !m.VerifyNotBefore(now+skew, false) {
 		vErr.Inner = errors.New("Token is not valid yet")
 		vErr.Errors |= ValidationErrorNotValidYet
 	}
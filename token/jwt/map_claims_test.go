@@ -3,7 +3,10 @@
 
 package jwt
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 // Test taken from taken from [here](https://raw.githubusercontent.com/form3tech-oss/jwt-go/master/map_claims_test.go).
 func Test_mapClaims_list_aud(t *testing.T) {
@@ -96,3 +99,24 @@ func Test_mapClaims_string_aud_no_claim_not_required(t *testing.T) {
 		t.Fatalf("Failed to verify claims, wanted: %v got %v", want, got)
 	}
 }
+
+func Test_mapClaims_valid_with_leeway(t *testing.T) {
+	now := time.Now()
+	mapClaims := MapClaims{
+		"exp": now.Unix() - 10,
+		"iat": now.Unix() + 10,
+		"nbf": now.Unix() + 10,
+	}
+
+	if err := mapClaims.ValidWithLeeway(now, 0); err == nil {
+		t.Fatalf("Expected claims to be invalid without leeway")
+	}
+
+	if err := mapClaims.ValidWithLeeway(now, 30*time.Second); err != nil {
+		t.Fatalf("Expected claims to be valid with leeway, got %v", err)
+	}
+
+	if err := mapClaims.ValidWithLeeway(now.Add(time.Minute), 30*time.Second); err == nil {
+		t.Fatalf("Expected claims to be expired despite leeway")
+	}
+}
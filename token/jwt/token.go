@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
@@ -154,14 +155,41 @@ func newToken(parsedToken *jwt.JSONWebToken, claims MapClaims) (*Token, error) {
 // Header of the token (such as `kid`) to identify which key to use.
 type Keyfunc func(*Token) (interface{}, error)
 
-func Parse(tokenString string, keyFunc Keyfunc) (*Token, error) {
-	return ParseWithClaims(tokenString, MapClaims{}, keyFunc)
+// ParserOption configures how Parse and ParseWithClaims validate the time based claims of a token.
+type ParserOption func(*parserOptions)
+
+type parserOptions struct {
+	now    func() time.Time
+	leeway time.Duration
+}
+
+// WithTimeFunc sets the function returning the current time. Defaults to TimeFunc.
+func WithTimeFunc(now func() time.Time) ParserOption {
+	return func(o *parserOptions) {
+		o.now = now
+	}
+}
+
+// WithLeeway sets the clock skew which is tolerated when validating the exp, iat and nbf claims.
+func WithLeeway(leeway time.Duration) ParserOption {
+	return func(o *parserOptions) {
+		o.leeway = leeway
+	}
+}
+
+func Parse(tokenString string, keyFunc Keyfunc, opts ...ParserOption) (*Token, error) {
+	return ParseWithClaims(tokenString, MapClaims{}, keyFunc, opts...)
 }
 
 // Parse, validate, and return a token.
 // keyFunc will receive the parsed token and should return the key for validating.
 // If everything is kosher, err will be nil
-func ParseWithClaims(rawToken string, claims MapClaims, keyFunc Keyfunc) (*Token, error) {
+func ParseWithClaims(rawToken string, claims MapClaims, keyFunc Keyfunc, opts ...ParserOption) (*Token, error) {
+	o := &parserOptions{now: TimeFunc}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	// Parse the token.
 	parsedToken, err := jwt.ParseSigned(rawToken)
 	if err != nil {
@@ -220,7 +248,7 @@ func ParseWithClaims(rawToken string, claims MapClaims, keyFunc Keyfunc) (*Token
 	// Validate claims
 	// This validation is performed to be backwards compatible
 	// with jwt-go library behavior
-	if err := claims.Valid(); err != nil {
+	if err := claims.ValidWithLeeway(o.now(), o.leeway); err != nil {
 		if e, ok := err.(*ValidationError); !ok {
 			err = &ValidationError{Inner: e, Errors: ValidationErrorClaimsInvalid}
 		}
@@ -448,6 +448,26 @@ func TestParser_Parse(t *testing.T) {
 	}
 }
 
+func TestParserOptions(t *testing.T) {
+	now := time.Now()
+	tokenString := makeSampleToken(MapClaims{"exp": now.Unix() - 30, "nbf": now.Unix() - 120}, jose.RS256, parseRSAPrivateKeyFromPEM(defaultPrivateKeyPEM))
+
+	_, err := Parse(tokenString, defaultKeyFunc)
+	var ve *ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.True(t, ve.Has(ValidationErrorExpired))
+
+	_, err = Parse(tokenString, defaultKeyFunc, WithLeeway(time.Minute))
+	require.NoError(t, err)
+
+	_, err = Parse(tokenString, defaultKeyFunc, WithTimeFunc(func() time.Time { return now.Add(-time.Minute) }))
+	require.NoError(t, err)
+
+	_, err = Parse(tokenString, defaultKeyFunc, WithTimeFunc(func() time.Time { return now.Add(-5 * time.Minute) }))
+	require.ErrorAs(t, err, &ve)
+	assert.True(t, ve.Has(ValidationErrorNotValidYet))
+}
+
 func makeSampleToken(c MapClaims, m jose.SignatureAlgorithm, key interface{}) string {
 	token := NewWithClaims(m, c)
 	s, e := token.SignedString(key)
@@ -0,0 +1,251 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+// Package paseto is able to encrypt and decrypt PASETO v4.local tokens.
+// Follows https://github.com/paseto-standard/paseto-spec/blob/master/docs/01-Protocol-Versions/Version4.md
+
+package paseto
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// LocalHeader is the header of PASETO v4.local tokens.
+	LocalHeader = "v4.local."
+
+	// KeySize is the size of v4.local keys.
+	KeySize = 32
+
+	nonceSize = 32
+	tagSize   = 32
+)
+
+var (
+	// ErrInvalidToken is returned if a token is malformed or fails authentication.
+	ErrInvalidToken = errors.New("paseto: the token is malformed or has been tampered with")
+
+	// ErrUnknownKey is returned if a token was encrypted with a key which is not known.
+	ErrUnknownKey = errors.New("paseto: the token was encrypted with an unknown key")
+
+	b64 = base64.RawURLEncoding
+
+	// randReader is replaced in tests to reproduce the test vectors of the specification.
+	randReader = rand.Reader
+)
+
+// Key is a v4.local key.
+type Key struct {
+	// ID identifies the key in the footer of the tokens it encrypted. If empty, tokens have no footer.
+	ID string
+
+	// Secret is the key material. It must be KeySize bytes long.
+	Secret []byte
+}
+
+// GetKeysFunc returns the keys used to encrypt and decrypt tokens.
+type GetKeysFunc func(ctx context.Context) ([]Key, error)
+
+// LocalEncrypter encrypts and decrypts v4.local tokens. The first key encrypts new tokens, and every key decrypts the
+// tokens it encrypted, which allows rotating keys by prepending new keys and removing old keys once the tokens they
+// encrypted expired.
+type LocalEncrypter struct {
+	GetKeys GetKeysFunc
+}
+
+type footer struct {
+	KeyID string `json:"kid,omitempty"`
+}
+
+// Encrypt encrypts the payload with the first key. The implicit assertion is authenticated, but not part of the token.
+func (e *LocalEncrypter) Encrypt(ctx context.Context, payload, implicit []byte) (string, error) {
+	keys, err := e.GetKeys(ctx)
+	if err != nil {
+		return "", err
+	} else if len(keys) == 0 {
+		return "", errors.New("paseto: no keys for encrypting tokens are configured")
+	}
+
+	var f []byte
+	if keys[0].ID != "" {
+		if f, err = json.Marshal(&footer{KeyID: keys[0].ID}); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	return Encrypt(keys[0].Secret, payload, f, implicit)
+}
+
+// Decrypt decrypts the token with the key identified by its footer.
+func (e *LocalEncrypter) Decrypt(ctx context.Context, token string, implicit []byte) ([]byte, error) {
+	raw, err := Footer(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var f footer
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, errors.WithStack(ErrInvalidToken)
+		}
+	}
+
+	keys, err := e.GetKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.ID == f.KeyID {
+			return Decrypt(key.Secret, token, implicit)
+		}
+	}
+
+	return nil, errors.WithStack(ErrUnknownKey)
+}
+
+// Encrypt encrypts the payload into a v4.local token with the given footer and implicit assertion.
+func Encrypt(key, payload, footer, implicit []byte) (string, error) {
+	if len(key) != KeySize {
+		return "", errors.Errorf("paseto: the key is expected to be %d bytes long, got %d bytes", KeySize, len(key))
+	}
+
+	n := make([]byte, nonceSize)
+	if _, err := io.ReadFull(randReader, n); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	ek, n2, ak := splitKey(key, n)
+	c := make([]byte, len(payload))
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	cipher.XORKeyStream(c, payload)
+
+	t := tag(ak, n, c, footer, implicit)
+
+	body := make([]byte, 0, nonceSize+len(c)+tagSize)
+	body = append(append(append(body, n...), c...), t...)
+
+	token := LocalHeader + b64.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + b64.EncodeToString(footer)
+	}
+	return token, nil
+}
+
+// Decrypt authenticates and decrypts a v4.local token and returns its payload.
+func Decrypt(key []byte, token string, implicit []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("paseto: the key is expected to be %d bytes long, got %d bytes", KeySize, len(key))
+	}
+
+	body, f, err := split(token)
+	if err != nil {
+		return nil, err
+	}
+
+	n, c, t := body[:nonceSize], body[nonceSize:len(body)-tagSize], body[len(body)-tagSize:]
+	ek, n2, ak := splitKey(key, n)
+	if subtle.ConstantTimeCompare(t, tag(ak, n, c, f, implicit)) != 1 {
+		return nil, errors.WithStack(ErrInvalidToken)
+	}
+
+	payload := make([]byte, len(c))
+	cipher, err := chacha20.NewUnauthenticatedCipher(ek, n2)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cipher.XORKeyStream(payload, c)
+	return payload, nil
+}
+
+// Footer returns the footer of a v4.local token without authenticating it.
+func Footer(token string) ([]byte, error) {
+	_, f, err := split(token)
+	return f, err
+}
+
+// Tag returns the base64url encoded authentication tag of a v4.local token without authenticating it. The tag is
+// unique for every token and can be used to look up tokens.
+func Tag(token string) string {
+	body, _, err := split(token)
+	if err != nil {
+		return ""
+	}
+	return b64.EncodeToString(body[len(body)-tagSize:])
+}
+
+func split(token string) (body, footer []byte, err error) {
+	if !strings.HasPrefix(token, LocalHeader) {
+		return nil, nil, errors.WithStack(ErrInvalidToken)
+	}
+
+	parts := strings.Split(token[len(LocalHeader):], ".")
+	if len(parts) > 2 {
+		return nil, nil, errors.WithStack(ErrInvalidToken)
+	}
+
+	body, err = b64.DecodeString(parts[0])
+	if err != nil || len(body) < nonceSize+tagSize {
+		return nil, nil, errors.WithStack(ErrInvalidToken)
+	}
+
+	if len(parts) == 2 {
+		if footer, err = b64.DecodeString(parts[1]); err != nil || len(footer) == 0 {
+			return nil, nil, errors.WithStack(ErrInvalidToken)
+		}
+	}
+
+	return body, footer, nil
+}
+
+// splitKey derives the encryption key, the XChaCha20 nonce and the authentication key from the key and the nonce.
+func splitKey(key, n []byte) (ek, n2, ak []byte) {
+	tmp := mac(56, key, []byte("paseto-encryption-key"), n)
+	return tmp[:32], tmp[32:], mac(32, key, []byte("paseto-auth-key-for-aead"), n)
+}
+
+func tag(ak, n, c, footer, implicit []byte) []byte {
+	return mac(tagSize, ak, pae([]byte(LocalHeader), n, c, footer, implicit))
+}
+
+func mac(size int, key []byte, data ...[]byte) []byte {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		// The sizes and key lengths used in this package are always valid.
+		panic(err)
+	}
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// pae implements the pre-authentication encoding.
+func pae(pieces ...[]byte) []byte {
+	out := le64(uint64(len(pieces)))
+	for _, p := range pieces {
+		out = append(out, le64(uint64(len(p)))...)
+		out = append(out, p...)
+	}
+	return out
+}
+
+func le64(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n&^(1<<63))
+	return b
+}
@@ -0,0 +1,121 @@
+// Copyright © 2024 Ory Corp
+// SPDX-License-Identifier: Apache-2.0
+
+package paseto
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustKey(t *testing.T) []byte {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncrypt_TestVector(t *testing.T) {
+	// Test vector 4-E-1 of the PASETO specification.
+	key, err := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	require.NoError(t, err)
+	payload := `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`
+	expected := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+
+	randReader = bytes.NewReader(make([]byte, nonceSize))
+	defer func() { randReader = rand.Reader }()
+
+	token, err := Encrypt(key, []byte(payload), nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected, token)
+
+	decrypted, err := Decrypt(key, expected, nil)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(decrypted))
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := mustKey(t)
+	token, err := Encrypt(key, []byte("payload"), []byte(`{"kid":"a"}`), []byte("access_token"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, LocalHeader))
+	assert.NotContains(t, token, "payload")
+
+	footer, err := Footer(token)
+	require.NoError(t, err)
+	assert.Equal(t, `{"kid":"a"}`, string(footer))
+	assert.NotEmpty(t, Tag(token))
+
+	payload, err := Decrypt(key, token, []byte("access_token"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(payload))
+
+	t.Run("case=rejects tampered tokens", func(t *testing.T) {
+		body := strings.Split(token, ".")[2]
+		for _, tampered := range []string{
+			strings.Replace(token, body, body[:10]+string(body[10]^1)+body[11:], 1),
+			strings.Replace(token, ".eyJ", ".eyK", 1),
+			strings.SplitN(token, ".", 4)[0] + "." + strings.SplitN(token, ".", 4)[1] + "." + body,
+			"v4.public." + strings.TrimPrefix(token, LocalHeader),
+			LocalHeader + "AAAA",
+		} {
+			_, err := Decrypt(key, tampered, []byte("access_token"))
+			assert.ErrorIs(t, err, ErrInvalidToken, tampered)
+		}
+	})
+
+	t.Run("case=rejects a different implicit assertion or key", func(t *testing.T) {
+		_, err := Decrypt(key, token, []byte("refresh_token"))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		_, err = Decrypt(mustKey(t), token, []byte("access_token"))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("case=rejects keys of the wrong size", func(t *testing.T) {
+		_, err := Encrypt(key[:16], []byte("payload"), nil, nil)
+		assert.Error(t, err)
+		_, err = Decrypt(key[:16], token, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestLocalEncrypter(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := Key{ID: "a", Secret: mustKey(t)}, Key{ID: "b", Secret: mustKey(t)}
+	keys := []Key{oldKey}
+	e := &LocalEncrypter{GetKeys: func(context.Context) ([]Key, error) {
+		return keys, nil
+	}}
+
+	previous, err := e.Encrypt(ctx, []byte("previous"), nil)
+	require.NoError(t, err)
+
+	keys = []Key{newKey, oldKey}
+	next, err := e.Encrypt(ctx, []byte("next"), nil)
+	require.NoError(t, err)
+	footer, err := Footer(next)
+	require.NoError(t, err)
+	assert.Equal(t, `{"kid":"b"}`, string(footer))
+
+	for token, expected := range map[string]string{previous: "previous", next: "next"} {
+		payload, err := e.Decrypt(ctx, token, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(payload))
+	}
+
+	keys = []Key{newKey}
+	_, err = e.Decrypt(ctx, previous, nil)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	keys = nil
+	_, err = e.Encrypt(ctx, []byte("payload"), nil)
+	assert.Error(t, err)
+}